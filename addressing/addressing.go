@@ -17,3 +17,15 @@ const (
 	AbsoluteX
 	Accumulator
 )
+
+// OperandBytes returns the number of bytes following the opcode for the given mode
+func (m Mode) OperandBytes() int {
+	switch m {
+	case Implied, Accumulator:
+		return 0
+	case Absolute, AbsoluteX, AbsoluteY, Indirect:
+		return 2
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,156 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/addressing"
+	"github.com/slawomirbiernacki/mos6502-emulator/number"
+	"github.com/slawomirbiernacki/mos6502-emulator/opcode"
+)
+
+type key struct {
+	operation opcode.Operation
+	mode      addressing.Mode
+}
+
+var opcodes = map[key]byte{}
+var operations = map[string]opcode.Operation{}
+
+func init() {
+	for b := 0; b < 0x100; b++ {
+		if !opcode.Exists(byte(b)) {
+			continue
+		}
+		spec := opcode.Lookup(byte(b))
+		opcodes[key{spec.Operation, spec.AccessMode}] = byte(b)
+		operations[spec.Operation.String()] = spec.Operation
+	}
+}
+
+// AssembleLine assembles a single instruction placed at the given address, e.g. "LDA ($10),Y".
+// Operands are numbers in the $hex, %binary or decimal notation.
+func AssembleLine(line string, address uint16) ([]byte, error) {
+	mnemonic, operand := splitInstruction(line)
+	return assemble(mnemonic, operand, address, number.Parse, false)
+}
+
+func splitInstruction(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return strings.ToUpper(line[:i]), strings.TrimSpace(line[i+1:])
+	}
+	return strings.ToUpper(line), ""
+}
+
+// assemble encodes one instruction, evaluate resolves the numeric part of the operand.
+// forceAbsolute skips the zero page form, it keeps forward references at the size they got in the first pass.
+func assemble(mnemonic, operand string, address uint16, evaluate func(string) (int, error), forceAbsolute bool) ([]byte, error) {
+	operation, ok := operations[mnemonic]
+	if !ok {
+		return nil, fmt.Errorf("unknown instruction %q", mnemonic)
+	}
+	mode, expression, err := parseOperand(operation, operand)
+	if err != nil {
+		return nil, err
+	}
+	if mode == addressing.Implied || mode == addressing.Accumulator {
+		return []byte{opcodes[key{operation, mode}]}, nil
+	}
+	value, err := evaluate(expression)
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case addressing.Relative:
+		offset := value - int(address) - 2
+		if offset < -128 || offset > 127 {
+			return nil, fmt.Errorf("branch target $%04X out of range", value)
+		}
+		return []byte{opcodes[key{operation, mode}], byte(offset)}, nil
+	case addressing.ZeroPage, addressing.ZeroPageX, addressing.ZeroPageY:
+		// prefer the zero page form when the value fits in a byte and the instruction has one
+		if !hasMode(operation, mode) || forceAbsolute || value < 0 || value > 0xFF {
+			mode = absolute(mode)
+		}
+	}
+	return encode(operation, mode, value)
+}
+
+// parseOperand works out the addressing mode from the operand syntax and returns the expression giving its value.
+// Operands that may be either zero page or absolute are reported as zero page.
+func parseOperand(operation opcode.Operation, operand string) (addressing.Mode, string, error) {
+	upper := strings.ToUpper(strings.ReplaceAll(operand, " ", ""))
+
+	if upper == "" || upper == "A" {
+		for _, mode := range []addressing.Mode{addressing.Implied, addressing.Accumulator} {
+			if hasMode(operation, mode) {
+				return mode, "", nil
+			}
+		}
+		return 0, "", fmt.Errorf("%v requires an operand", operation)
+	}
+
+	switch {
+	case strings.HasPrefix(upper, "#"):
+		return addressing.Immediate, operand[strings.Index(operand, "#")+1:], nil
+	case hasMode(operation, addressing.Relative):
+		return addressing.Relative, operand, nil
+	case strings.HasPrefix(upper, "(") && strings.HasSuffix(upper, ",X)"):
+		return addressing.IndirectX, inner(operand, "(", ","), nil
+	case strings.HasPrefix(upper, "(") && strings.HasSuffix(upper, "),Y"):
+		return addressing.IndirectY, inner(operand, "(", ")"), nil
+	case strings.HasPrefix(upper, "(") && strings.HasSuffix(upper, ")"):
+		return addressing.Indirect, inner(operand, "(", ")"), nil
+	case strings.HasSuffix(upper, ",X"):
+		return addressing.ZeroPageX, operand[:strings.LastIndex(operand, ",")], nil
+	case strings.HasSuffix(upper, ",Y"):
+		return addressing.ZeroPageY, operand[:strings.LastIndex(operand, ",")], nil
+	default:
+		return addressing.ZeroPage, operand, nil
+	}
+}
+
+func hasMode(operation opcode.Operation, mode addressing.Mode) bool {
+	_, ok := opcodes[key{operation, mode}]
+	return ok
+}
+
+func absolute(mode addressing.Mode) addressing.Mode {
+	switch mode {
+	case addressing.ZeroPageX:
+		return addressing.AbsoluteX
+	case addressing.ZeroPageY:
+		return addressing.AbsoluteY
+	default:
+		return addressing.Absolute
+	}
+}
+
+func inner(operand, open, close string) string {
+	start := strings.Index(operand, open) + 1
+	end := strings.LastIndex(operand, close)
+	if end < start {
+		return ""
+	}
+	return operand[start:end]
+}
+
+func encode(operation opcode.Operation, mode addressing.Mode, value int) ([]byte, error) {
+	code, ok := opcodes[key{operation, mode}]
+	if !ok {
+		return nil, fmt.Errorf("%v does not support this addressing mode", operation)
+	}
+	switch mode.OperandBytes() {
+	case 1:
+		if value < -128 || value > 0xFF {
+			return nil, fmt.Errorf("value %d does not fit in a byte", value)
+		}
+		return []byte{code, byte(value)}, nil
+	default:
+		if value < 0 || value > 0xFFFF {
+			return nil, fmt.Errorf("value %d does not fit in a word", value)
+		}
+		return []byte{code, byte(value), byte(value >> 8)}, nil
+	}
+}
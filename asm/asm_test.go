@@ -0,0 +1,93 @@
+package asm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssembleLine(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected []byte
+	}{
+		{"NOP", []byte{0xEA}},
+		{"asl a", []byte{0x0A}},
+		{"LDA #$10", []byte{0xA9, 0x10}},
+		{"LDA $10", []byte{0xA5, 0x10}},
+		{"LDA $1234,X", []byte{0xBD, 0x34, 0x12}},
+		{"LDX $10,Y", []byte{0xB6, 0x10}},
+		{"STA ($20),Y", []byte{0x91, 0x20}},
+		{"LDA ($20,X)", []byte{0xA1, 0x20}},
+		{"JMP ($FFFC)", []byte{0x6C, 0xFC, 0xFF}},
+		{"JMP $10", []byte{0x4C, 0x10, 0x00}},
+		{"BNE $0400", []byte{0xD0, 0xFE}},
+		{"BEQ $0410", []byte{0xF0, 0x0E}},
+	}
+	for _, c := range cases {
+		bytes, err := AssembleLine(c.line, 0x0400)
+		if assert.NoError(t, err, c.line) {
+			assert.Equal(t, c.expected, bytes, c.line)
+		}
+	}
+}
+
+func TestAssembleLine_errors(t *testing.T) {
+	for _, line := range []string{"FOO", "LDA", "STA #$10", "BNE $1000", "LDA #$100"} {
+		_, err := AssembleLine(line, 0x0400)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	source := `
+; prints a message through the output port
+OUT = $D012
+        .org $0400
+start:  LDX #0
+loop    LDA message,X
+        BEQ done
+        STA OUT
+        STA zp
+        INX
+        BNE loop
+done:   JMP done
+message .byte "HI", 'x'+1, 0
+        .word start, >message, *
+zp      = $10
+        .org $FFFC
+        .word start
+`
+	program, err := Assemble(source, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0x0400, program.Symbols["start"])
+	assert.Equal(t, 0x0402, program.Symbols["loop"])
+	assert.Equal(t, 0x0413, program.Symbols["message"])
+	require.Len(t, program.Segments, 2)
+	assert.Equal(t, []byte{
+		0xA2, 0x00, // LDX #0
+		0xBD, 0x13, 0x04, // LDA message,X
+		0xF0, 0x09, // BEQ done
+		0x8D, 0x12, 0xD0, // STA OUT
+		0x8D, 0x10, 0x00, // STA zp, a forward reference keeps the absolute form
+		0xE8,       // INX
+		0xD0, 0xF2, // BNE loop
+		0x4C, 0x10, 0x04, // JMP done
+		'H', 'I', 'y', 0x00,
+		0x00, 0x04, 0x04, 0x00, 0x17, 0x04,
+	}, program.Segments[0].Bytes)
+	assert.Equal(t, Segment{Address: 0xFFFC, Bytes: []byte{0x00, 0x04}}, program.Segments[1])
+
+	start, binary := program.Binary()
+	assert.Equal(t, uint16(0x0400), start)
+	assert.Equal(t, 0xFFFE-0x0400, len(binary))
+}
+
+func TestAssemble_errors(t *testing.T) {
+	for _, source := range []string{"  LDA missing", "a: NOP\na: NOP", "  .foo 1", "  BNE far\n  .org $1000\nfar: NOP", "1bad: NOP"} {
+		_, err := Assemble(source, 0x0400)
+		assert.Error(t, err, source)
+	}
+}
@@ -0,0 +1,99 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/number"
+)
+
+var errUndefined = errors.New("undefined symbol")
+
+// evaluate computes an operand expression: numbers, symbols, character literals ('A') and * for the current
+// address, joined with + and -. A leading < or > takes the low or high byte of the result.
+func evaluate(expression string, symbols map[string]int, pc uint16) (int, error) {
+	expression = strings.TrimSpace(expression)
+	switch {
+	case strings.HasPrefix(expression, "<"):
+		value, err := evaluate(expression[1:], symbols, pc)
+		return value & 0xFF, err
+	case strings.HasPrefix(expression, ">"):
+		value, err := evaluate(expression[1:], symbols, pc)
+		return value >> 8 & 0xFF, err
+	}
+	if expression == "" {
+		return 0, fmt.Errorf("missing value")
+	}
+
+	result := 0
+	sign := 1
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case c == '-':
+			sign = -sign
+			i++
+			continue
+		case c == '+':
+			i++
+			continue
+		}
+		value, length, err := term(expression[i:], symbols, pc)
+		if err != nil {
+			return 0, err
+		}
+		result += sign * value
+		sign = 1
+		i += length
+		for i < len(expression) && (expression[i] == ' ' || expression[i] == '\t') {
+			i++
+		}
+		if i < len(expression) && expression[i] != '+' && expression[i] != '-' {
+			return 0, fmt.Errorf("invalid expression %q", expression)
+		}
+	}
+	return result, nil
+}
+
+// term reads one value from the start of s and returns it with the number of characters consumed
+func term(s string, symbols map[string]int, pc uint16) (int, int, error) {
+	switch {
+	case s[0] == '*':
+		return int(pc), 1, nil
+	case s[0] == '\'' || s[0] == '"':
+		if len(s) < 3 || s[2] != s[0] {
+			return 0, 0, fmt.Errorf("invalid character literal in %q", s)
+		}
+		return int(s[1]), 3, nil
+	}
+	end := 1
+	for end < len(s) && strings.IndexByte(" \t+-", s[end]) < 0 {
+		end++
+	}
+	token := s[:end]
+	if isIdentifier(token) {
+		value, ok := symbols[token]
+		if !ok {
+			return 0, 0, fmt.Errorf("%w %s", errUndefined, token)
+		}
+		return value, end, nil
+	}
+	value, err := number.Parse(token)
+	return value, end, err
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
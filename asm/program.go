@@ -0,0 +1,318 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/addressing"
+)
+
+// Segment is a run of consecutive bytes starting at Address
+type Segment struct {
+	Address uint16
+	Bytes   []byte
+}
+
+// Program is an assembled source
+type Program struct {
+	Segments []Segment
+	Symbols  map[string]int
+}
+
+// Binary returns the program as a single block starting at its lowest address, gaps between segments are zero filled
+func (p *Program) Binary() (uint16, []byte) {
+	if len(p.Segments) == 0 {
+		return 0, nil
+	}
+	start, end := 0x10000, 0
+	for _, s := range p.Segments {
+		if int(s.Address) < start {
+			start = int(s.Address)
+		}
+		if int(s.Address)+len(s.Bytes) > end {
+			end = int(s.Address) + len(s.Bytes)
+		}
+	}
+	binary := make([]byte, end-start)
+	for _, s := range p.Segments {
+		copy(binary[int(s.Address)-start:], s.Bytes)
+	}
+	return uint16(start), binary
+}
+
+type statement struct {
+	line          int
+	label         string
+	directive     string // .org, .byte, .word, = or an instruction mnemonic
+	operand       string
+	address       uint16
+	forceAbsolute bool
+}
+
+// Assemble assembles a whole program, code is placed from origin until the first .org.
+//
+// Every line holds an optional label (either followed by a colon or starting in the first column),
+// then an instruction or a directive, and an optional ; comment. Supported directives are
+// .org (or *=), .byte, .word and NAME = value. Expressions are described at evaluate.
+func Assemble(source string, origin uint16) (*Program, error) {
+	var statements []statement
+	for i, line := range strings.Split(source, "\n") {
+		s, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		s.line = i + 1
+		statements = append(statements, s)
+	}
+
+	symbols := map[string]int{}
+	pc := int(origin)
+	for i := range statements {
+		s := &statements[i]
+		if s.label != "" && s.directive != "=" {
+			if err := define(symbols, s.label, pc); err != nil {
+				return nil, fmt.Errorf("line %d: %v", s.line, err)
+			}
+		}
+		s.address = uint16(pc)
+		var err error
+		switch s.directive {
+		case "=":
+			var value int
+			if value, err = evaluate(s.operand, symbols, s.address); err == nil {
+				err = define(symbols, s.label, value)
+			}
+		case ".org":
+			if pc, err = evaluate(s.operand, symbols, s.address); err == nil && (pc < 0 || pc > 0xFFFF) {
+				err = fmt.Errorf("address %d out of range", pc)
+			}
+		default:
+			var size int
+			size, err = s.size(symbols)
+			pc += size
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", s.line, err)
+		}
+		if pc > 0x10000 {
+			return nil, fmt.Errorf("line %d: program does not fit below $10000", s.line)
+		}
+	}
+
+	program := &Program{Symbols: symbols}
+	for _, s := range statements {
+		bytes, err := s.encode(symbols)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", s.line, err)
+		}
+		program.emit(s.address, bytes)
+	}
+	return program, nil
+}
+
+func (p *Program) emit(address uint16, bytes []byte) {
+	if len(bytes) == 0 {
+		return
+	}
+	if n := len(p.Segments); n > 0 {
+		last := &p.Segments[n-1]
+		if int(last.Address)+len(last.Bytes) == int(address) {
+			last.Bytes = append(last.Bytes, bytes...)
+			return
+		}
+	}
+	p.Segments = append(p.Segments, Segment{Address: address, Bytes: append([]byte(nil), bytes...)})
+}
+
+func define(symbols map[string]int, name string, value int) error {
+	if _, ok := symbols[name]; ok {
+		return fmt.Errorf("%s redefined", name)
+	}
+	symbols[name] = value
+	return nil
+}
+
+func parseLine(line string) (statement, error) {
+	line = strings.TrimRight(stripComment(line), " \t\r")
+	var s statement
+	if strings.TrimSpace(line) == "" {
+		return s, nil
+	}
+
+	if i := strings.Index(line, "="); i > 0 {
+		name := strings.TrimSpace(line[:i])
+		if name == "*" {
+			s.directive, s.operand = ".org", strings.TrimSpace(line[i+1:])
+			return s, nil
+		}
+		if isIdentifier(name) {
+			s.label, s.directive, s.operand = name, "=", strings.TrimSpace(line[i+1:])
+			return s, nil
+		}
+	}
+
+	first, rest := splitInstruction(line)
+	switch {
+	case strings.HasSuffix(first, ":"):
+		s.label = strings.TrimSpace(line)[:len(first)-1]
+		line = rest
+	case line[0] != ' ' && line[0] != '\t' && !strings.HasPrefix(first, ".") && !isMnemonic(first):
+		s.label = strings.TrimSpace(line)[:len(first)]
+		line = rest
+	}
+	if s.label != "" && !isIdentifier(s.label) {
+		return s, fmt.Errorf("invalid label %q", s.label)
+	}
+
+	if strings.TrimSpace(line) == "" {
+		return s, nil
+	}
+	s.directive, s.operand = splitInstruction(line)
+	if strings.HasPrefix(s.directive, ".") {
+		s.directive = strings.ToLower(s.directive)
+		switch s.directive {
+		case ".org", ".byte", ".word":
+		default:
+			return s, fmt.Errorf("unknown directive %s", s.directive)
+		}
+	}
+	return s, nil
+}
+
+func isMnemonic(s string) bool {
+	_, ok := operations[s]
+	return ok
+}
+
+// stripComment removes a ; comment, ignoring semicolons inside quotes
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// size returns the number of bytes the statement occupies.
+// Symbols defined further down are not known yet, operands using them get the absolute form.
+func (s *statement) size(symbols map[string]int) (int, error) {
+	switch s.directive {
+	case "":
+		return 0, nil
+	case ".byte":
+		size := 0
+		for _, item := range splitList(s.operand) {
+			if isString(item) {
+				size += len(item) - 2
+			} else {
+				size++
+			}
+		}
+		return size, nil
+	case ".word":
+		return 2 * len(splitList(s.operand)), nil
+	}
+
+	operation, ok := operations[s.directive]
+	if !ok {
+		return 0, fmt.Errorf("unknown instruction %q", s.directive)
+	}
+	mode, expression, err := parseOperand(operation, s.operand)
+	if err != nil {
+		return 0, err
+	}
+	switch mode {
+	case addressing.ZeroPage, addressing.ZeroPageX, addressing.ZeroPageY:
+		value, err := evaluate(expression, symbols, s.address)
+		if errors.Is(err, errUndefined) {
+			s.forceAbsolute = true
+			return 3, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !hasMode(operation, mode) || value < 0 || value > 0xFF {
+			return 3, nil
+		}
+		return 2, nil
+	default:
+		return 1 + mode.OperandBytes(), nil
+	}
+}
+
+func (s *statement) encode(symbols map[string]int) ([]byte, error) {
+	value := func(expression string) (int, error) {
+		return evaluate(expression, symbols, s.address)
+	}
+	switch s.directive {
+	case "", "=", ".org":
+		return nil, nil
+	case ".byte":
+		var bytes []byte
+		for _, item := range splitList(s.operand) {
+			if isString(item) {
+				bytes = append(bytes, item[1:len(item)-1]...)
+				continue
+			}
+			v, err := value(item)
+			if err != nil {
+				return nil, err
+			}
+			if v < -128 || v > 0xFF {
+				return nil, fmt.Errorf("value %d does not fit in a byte", v)
+			}
+			bytes = append(bytes, byte(v))
+		}
+		return bytes, nil
+	case ".word":
+		var bytes []byte
+		for _, item := range splitList(s.operand) {
+			v, err := value(item)
+			if err != nil {
+				return nil, err
+			}
+			if v < -0x8000 || v > 0xFFFF {
+				return nil, fmt.Errorf("value %d does not fit in a word", v)
+			}
+			bytes = append(bytes, byte(v), byte(v>>8))
+		}
+		return bytes, nil
+	}
+	return assemble(s.directive, s.operand, s.address, value, s.forceAbsolute)
+}
+
+// splitList splits a directive operand on commas outside quotes
+func splitList(operand string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(operand); i++ {
+		switch c := operand[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(operand[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, strings.TrimSpace(operand[start:]))
+}
+
+// isString tells a "text" item of .byte apart from a single character literal
+func isString(item string) bool {
+	return len(item) >= 2 && item[0] == '"' && item[len(item)-1] == '"' && len(item) != 3
+}
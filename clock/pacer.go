@@ -0,0 +1,150 @@
+package clock
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+)
+
+const (
+	DefaultSlice  = 10 * time.Millisecond
+	DefaultMaxLag = 250 * time.Millisecond
+	// cycles between speed measurements in warp mode, when there is no frequency to derive a slice from
+	warpSliceCycles = 10000
+)
+
+// Pacer throttles emulation to a target frequency. Call Pace with the cpu cycle counter after every
+// instruction: cycles are batched into time slices and the pacer sleeps once per slice until real time
+// catches up with emulated time. Sleeps are scheduled against the time the run started rather than the
+// previous slice, so oversleeping in one slice is made up in the following ones.
+type Pacer struct {
+	// Length of a slice, the pacer checks the time once per slice. Set before the first Pace.
+	Slice time.Duration
+	// When the host falls behind by more than MaxLag (suspended process, debugger, slow host) the pacer
+	// stops trying to catch up and continues from the current time. Set before the first Pace.
+	MaxLag time.Duration
+	// OnSpeed, when set, receives the achieved speed in Hz about once a second
+	OnSpeed func(hz float64)
+
+	frequency float64
+	warp      int32
+
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	based      bool
+	baseTime   time.Time
+	baseCycles uint64
+	sliceEnd   uint64
+
+	measureTime   time.Time
+	measureCycles uint64
+	mu            sync.Mutex
+	speed         float64
+}
+
+// NewPacer creates a pacer for the frequency in Hz, 0 runs unthrottled
+func NewPacer(frequency float64) *Pacer {
+	return &Pacer{Slice: DefaultSlice, MaxLag: DefaultMaxLag, frequency: frequency, now: time.Now, sleep: time.Sleep}
+}
+
+// Frequency returns the target frequency in Hz
+func (p *Pacer) Frequency() float64 {
+	return p.frequency
+}
+
+// SetWarp switches unthrottled running on and off, it may be called from any goroutine
+func (p *Pacer) SetWarp(warp bool) {
+	value := int32(0)
+	if warp {
+		value = 1
+	}
+	atomic.StoreInt32(&p.warp, value)
+}
+
+func (p *Pacer) Warp() bool {
+	return atomic.LoadInt32(&p.warp) == 1
+}
+
+// Speed returns the speed in Hz achieved over the last measurement, about a second long.
+// It may be called from any goroutine.
+func (p *Pacer) Speed() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.speed
+}
+
+// Run executes instructions at the pacer's speed until done returns true, it is checked after every instruction
+func (p *Pacer) Run(c *cpu.Cpu, done func() bool) {
+	for {
+		c.ExecuteOpcode()
+		p.Pace(c.Cycles)
+		if done() {
+			return
+		}
+	}
+}
+
+// Pace is called with the cycle counter after every instruction, it sleeps when emulation is ahead of real time
+func (p *Pacer) Pace(cycles uint64) {
+	if p.based && cycles < p.baseCycles {
+		// the counter went back, e.g. a saved state was restored: start over from here
+		p.based = false
+		p.sliceEnd = cycles
+		p.measureTime = time.Time{}
+	}
+	if cycles < p.sliceEnd {
+		return
+	}
+	now := p.now()
+	p.measure(now, cycles)
+
+	throttled := p.frequency > 0 && !p.Warp()
+	if !throttled {
+		// keep the base current, so leaving warp does not try to make up for the time spent in it
+		p.rebase(now, cycles)
+		p.sliceEnd = cycles + warpSliceCycles
+		return
+	}
+	if !p.based {
+		p.rebase(now, cycles)
+	} else {
+		elapsed := float64(cycles-p.baseCycles) / p.frequency
+		due := p.baseTime.Add(time.Duration(elapsed * float64(time.Second)))
+		switch lag := now.Sub(due); {
+		case lag > p.MaxLag:
+			p.rebase(now, cycles)
+		case lag < 0:
+			p.sleep(-lag)
+		}
+	}
+	p.sliceEnd = cycles + uint64(math.Max(1, p.frequency*p.Slice.Seconds()))
+}
+
+func (p *Pacer) rebase(now time.Time, cycles uint64) {
+	p.based = true
+	p.baseTime = now
+	p.baseCycles = cycles
+}
+
+func (p *Pacer) measure(now time.Time, cycles uint64) {
+	if p.measureTime.IsZero() {
+		p.measureTime, p.measureCycles = now, cycles
+		return
+	}
+	elapsed := now.Sub(p.measureTime)
+	if elapsed < time.Second {
+		return
+	}
+	speed := float64(cycles-p.measureCycles) / elapsed.Seconds()
+	p.measureTime, p.measureCycles = now, cycles
+	p.mu.Lock()
+	p.speed = speed
+	p.mu.Unlock()
+	if p.OnSpeed != nil {
+		p.OnSpeed(speed)
+	}
+}
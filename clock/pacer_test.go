@@ -0,0 +1,103 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTime is a host clock where sleeping advances time exactly, plus whatever jitter is added
+type fakeTime struct {
+	now    time.Time
+	slept  time.Duration
+	jitter time.Duration
+}
+
+func newPacer(frequency float64) (*Pacer, *fakeTime) {
+	clock := &fakeTime{now: time.Unix(0, 0)}
+	p := NewPacer(frequency)
+	p.now = func() time.Time { return clock.now }
+	p.sleep = func(d time.Duration) {
+		clock.slept += d
+		clock.now = clock.now.Add(d + clock.jitter)
+	}
+	return p, clock
+}
+
+func TestPacer(t *testing.T) {
+	p, clock := newPacer(1e6)
+	var reported []float64
+	p.OnSpeed = func(hz float64) { reported = append(reported, hz) }
+
+	for cycles := uint64(0); cycles <= 2000000; cycles += 4 {
+		p.Pace(cycles)
+	}
+	assert.InDelta(t, 2*time.Second, clock.now.Sub(time.Unix(0, 0)), float64(p.Slice))
+	assert.InDelta(t, 1e6, p.Speed(), 1e4)
+	assert.Len(t, reported, 1)
+}
+
+func TestPacer_jitter(t *testing.T) {
+	p, clock := newPacer(1e6)
+	clock.jitter = 2 * time.Millisecond // every sleep overshoots
+
+	for cycles := uint64(0); cycles <= 1000000; cycles += 2 {
+		p.Pace(cycles)
+	}
+	assert.InDelta(t, time.Second, clock.now.Sub(time.Unix(0, 0)), float64(3*time.Millisecond),
+		"oversleeping is made up by sleeping less in the following slices")
+}
+
+func TestPacer_lag(t *testing.T) {
+	p, clock := newPacer(1e6)
+	p.Pace(0)
+	clock.now = clock.now.Add(time.Second) // host stalled
+	p.Pace(20000)
+	clock.slept = 0
+	for cycles := uint64(20000); cycles <= 100000; cycles++ {
+		p.Pace(cycles)
+	}
+	assert.InDelta(t, 80*time.Millisecond, clock.slept, float64(p.Slice), "no burst to catch up with the stall")
+}
+
+func TestPacer_rewind(t *testing.T) {
+	p, clock := newPacer(1e6)
+	for cycles := uint64(500000); cycles <= 600000; cycles++ {
+		p.Pace(cycles)
+	}
+	clock.slept = 0
+	for cycles := uint64(0); cycles <= 100000; cycles++ {
+		p.Pace(cycles)
+	}
+	assert.InDelta(t, 100*time.Millisecond, clock.slept, float64(p.Slice), "paced from the restored counter")
+}
+
+func TestPacer_warp(t *testing.T) {
+	p, clock := newPacer(1e6)
+	p.SetWarp(true)
+	for cycles := uint64(0); cycles <= 1000000; cycles++ {
+		p.Pace(cycles)
+	}
+	assert.Zero(t, clock.slept)
+
+	p.SetWarp(false)
+	for cycles := uint64(1000000); cycles <= 1100000; cycles++ {
+		p.Pace(cycles)
+	}
+	assert.InDelta(t, 100*time.Millisecond, clock.slept, float64(p.Slice), "warped cycles are not made up for")
+}
+
+func TestPacer_Run(t *testing.T) {
+	m := &memory.DummyMemoryMapper{}
+	m.Mem[0x0400], m.Mem[0x0401], m.Mem[0x0402] = 0x4C, 0x00, 0x04 // JMP $0400
+	c := cpu.NewCpu(nil, m)
+	c.PC = 0x0400
+
+	p, clock := newPacer(1e6)
+	p.Run(&c, func() bool { return c.Cycles >= 30000 })
+	assert.InDelta(t, 30*time.Millisecond, clock.now.Sub(time.Unix(0, 0)), float64(p.Slice))
+}
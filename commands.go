@@ -0,0 +1,358 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/asm"
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/dap"
+	"github.com/slawomirbiernacki/mos6502-emulator/debugger"
+	"github.com/slawomirbiernacki/mos6502-emulator/disassembler"
+	"github.com/slawomirbiernacki/mos6502-emulator/gdbstub"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/monitor"
+	"github.com/slawomirbiernacki/mos6502-emulator/trace"
+)
+
+const functionalTestSuccess = 0x336D
+
+// suites are the test images run by test when it is not given one
+var suites = []struct {
+	name, image          string
+	load, entry, success uint16
+}{
+	// Klaus Dormann's functional test, built without the decimal mode tests
+	{"functional", "roms/functional_test/6502_functional_test_no_decimal.bin", 0x0000, 0x0400, functionalTestSuccess},
+	// Bruce Clark's decimal mode test, checking ADC and SBC with all operands
+	{"decimal", "roms/decimal_test/6502_decimal_test.bin", 0x0400, 0x0400, 0x0407},
+}
+
+func runCommand(args []string) (int, error) {
+	var board machineFlags
+	var stop stopFlags
+	var record replayFlags
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	board.register(flags)
+	stop.register(flags)
+	record.register(flags)
+	board.replay = &record
+	args, err := parse(flags, args, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	c, err := board.buildRunnable(optional(args))
+	if err != nil {
+		return 0, err
+	}
+	code, err := execute(c, stop, &board)
+	if finishErr := record.finish(); err == nil {
+		err = finishErr
+	}
+	return code, err
+}
+
+func traceCommand(args []string) (int, error) {
+	var board machineFlags
+	var stop stopFlags
+	var record replayFlags
+	flags := flag.NewFlagSet("trace", flag.ContinueOnError)
+	board.register(flags)
+	stop.register(flags)
+	record.register(flags)
+	board.replay = &record
+	nestest := flags.Bool("nestest", false, "use nestest.log compatible trace format")
+	var from, to address
+	flags.Var(&from, "from", "only log instructions at or above this address")
+	flags.Var(&to, "to", "only log instructions at or below this address")
+	args, err := parse(flags, args, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	c, err := board.buildRunnable(optional(args))
+	if err != nil {
+		return 0, err
+	}
+	format := trace.FormatText
+	if *nestest {
+		format = trace.FormatNestest
+	}
+	tracer := trace.New(os.Stdout, format)
+	if from.set {
+		tracer.From = from.value
+	}
+	if to.set {
+		tracer.To = to.value
+	}
+	c.AddTracer(tracer)
+	code, err := execute(c, stop, &board)
+	if err == nil {
+		err = tracer.Err()
+	}
+	if finishErr := record.finish(); err == nil {
+		err = finishErr
+	}
+	return code, err
+}
+
+// testCommand runs until the cpu traps in a jump or branch to itself, which is how test suites report their result
+func testCommand(args []string) (int, error) {
+	var board machineFlags
+	var stop stopFlags
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	board.register(flags)
+	flags.Uint64Var(&stop.cycles, "cycles", 0, "fail after this many cycles, 0 means no limit")
+	flags.Uint64Var(&stop.instructions, "instructions", 0, "fail after this many instructions, 0 means no limit")
+	success := address{value: functionalTestSuccess, set: true}
+	flags.Var(&success, "success", "address of the trap reporting success")
+	suite := flags.String("suite", "all", "built-in test run without an image: functional, decimal or all")
+	args, err := parse(flags, args, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	stop.trap = true
+	image := optional(args)
+	if image != "" || board.config != "" {
+		return runTest(board, stop, image, success.value)
+	}
+	ran := false
+	for _, s := range suites {
+		if *suite != "all" && *suite != s.name {
+			continue
+		}
+		ran = true
+		b := board
+		if !b.load.set {
+			b.load = address{value: s.load, set: true}
+		}
+		if !b.entry.set {
+			b.entry = address{value: s.entry, set: true}
+		}
+		fmt.Fprintf(os.Stderr, "%s test\n", s.name)
+		if code, err := runTest(b, stop, s.image, s.success); err != nil || code != exitOK {
+			return code, err
+		}
+	}
+	if !ran {
+		return 0, usageError(fmt.Sprintf("unknown test suite %q", *suite))
+	}
+	return exitOK, nil
+}
+
+// runTest runs an image until it traps and checks the trap address
+func runTest(board machineFlags, stop stopFlags, image string, success uint16) (int, error) {
+	c, err := board.build(image)
+	if err != nil {
+		return 0, err
+	}
+	code, err := execute(c, stop, &board)
+	if err != nil || code != exitOK {
+		return code, err
+	}
+	if c.PC != success {
+		fmt.Fprintf(os.Stderr, "FAIL: trapped at $%04X\n", c.PC)
+		return exitFailure, nil
+	}
+	fmt.Fprintln(os.Stderr, "PASS")
+	return exitOK, nil
+}
+
+// execute runs the cpu until one of the stop conditions holds or a limit runs out, then reports where it ended
+func execute(c *cpu.Cpu, stop stopFlags, board *machineFlags) (int, error) {
+	pacer, err := stop.pacer(board.clock)
+	if err != nil {
+		return 0, err
+	}
+	var when debugger.Condition
+	if stop.when != "" {
+		if when, err = debugger.ParseCondition(stop.when); err != nil {
+			return 0, usageError(err.Error())
+		}
+	}
+	at := map[uint16]bool{}
+	for _, a := range stop.at {
+		at[a] = true
+	}
+
+	start := c.Cycles
+	var instructions uint64
+	reason := ""
+	for reason == "" {
+		if stop.instructions > 0 && instructions >= stop.instructions {
+			break
+		}
+		if stop.cycles > 0 && c.Cycles-start >= stop.cycles {
+			break
+		}
+		if stop.brk && memory.Peek(c.MemoryMapper(), c.PC) == 0x00 {
+			reason = "BRK"
+			break
+		}
+		pc := c.PC
+		c.ExecuteOpcode()
+		pacer.Pace(c.Cycles)
+		instructions++
+		switch {
+		case stop.trap && c.PC == pc:
+			reason = "trap"
+		case at[c.PC]:
+			reason = "stop address"
+		case when != nil && when(c):
+			reason = "condition " + stop.when
+		case board.calls != nil && board.calls.Err() == io.EOF:
+			reason = "end of input"
+		case board.calls != nil && board.calls.Err() != nil:
+			return 0, board.calls.Err()
+		}
+	}
+
+	if reason == "" {
+		reason = "limit reached"
+	}
+	fmt.Fprintf(os.Stderr, "stopped at $%04X (%s) after %d instructions, %d cycles\n", c.PC, reason, instructions, c.Cycles-start)
+	fmt.Fprintln(os.Stderr, trace.Line(c, trace.FormatText))
+	if reason == "limit reached" {
+		return exitLimit, nil
+	}
+	return exitOK, nil
+}
+
+func disasmCommand(args []string) (int, error) {
+	var board machineFlags
+	flags := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	board.register(flags)
+	var from address
+	flags.Var(&from, "from", "first address to disassemble (default: the entry point)")
+	count := flags.Int("count", 20, "number of instructions")
+	args, err := parse(flags, args, 1, 1)
+	if err != nil {
+		return 0, err
+	}
+	c, err := board.build(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if !from.set {
+		from.value = c.PC
+	}
+	for _, instruction := range disassembler.Range(c.MemoryMapper(), from.value, *count) {
+		fmt.Printf("%04X  %-8s  %s\n", instruction.Address, instruction.HexBytes(), instruction)
+	}
+	return exitOK, nil
+}
+
+func asmCommand(args []string) (int, error) {
+	flags := flag.NewFlagSet("asm", flag.ContinueOnError)
+	var origin address
+	flags.Var(&origin, "origin", "address of the code before the first .org (default $0000)")
+	output := flags.String("o", "", "output file (default: the source name with the format's extension)")
+	format := flags.String("format", "bin", "output format: bin (raw, from the lowest address) or prg (with a load address)")
+	symbols := flags.Bool("symbols", false, "print the symbol table")
+	args, err := parse(flags, args, 1, 1)
+	if err != nil {
+		return 0, err
+	}
+	if *format != "bin" && *format != "prg" {
+		return 0, usageError(fmt.Sprintf("unknown output format %q", *format))
+	}
+	source, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return 0, err
+	}
+	program, err := asm.Assemble(string(source), origin.value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", args[0], err)
+	}
+	start, binary := program.Binary()
+	if *format == "prg" {
+		binary = append([]byte{byte(start), byte(start >> 8)}, binary...)
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + "." + *format
+	}
+	if err := ioutil.WriteFile(*output, binary, 0644); err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d bytes at $%04X\n", *output, len(binary), start)
+	if *symbols {
+		var names []string
+		for name := range program.Symbols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%-16s $%04X\n", name, program.Symbols[name])
+		}
+	}
+	return exitOK, nil
+}
+
+func monitorCommand(args []string) (int, error) {
+	var board machineFlags
+	var record replayFlags
+	flags := flag.NewFlagSet("monitor", flag.ContinueOnError)
+	board.register(flags)
+	record.register(flags)
+	board.replay = &record
+	args, err := parse(flags, args, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	c, err := board.build(optional(args))
+	if err != nil {
+		return 0, err
+	}
+	err = monitor.New(debugger.New(c), os.Stdout).Run(os.Stdin)
+	if finishErr := record.finish(); err == nil {
+		err = finishErr
+	}
+	return exitOK, err
+}
+
+func gdbCommand(args []string) (int, error) {
+	var board machineFlags
+	flags := flag.NewFlagSet("gdb", flag.ContinueOnError)
+	board.register(flags)
+	listen := flags.String("listen", "localhost:6502", "address to listen on")
+	depth := flags.Int("history", 100000, "number of instructions recorded for reverse execution, 0 disables it")
+	args, err := parse(flags, args, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	c, err := board.build(optional(args))
+	if err != nil {
+		return 0, err
+	}
+	d := debugger.New(c)
+	if *depth > 0 {
+		d.EnableHistory(*depth)
+	}
+	fmt.Fprintln(os.Stderr, "waiting for gdb on "+*listen)
+	return exitOK, gdbstub.NewServer(d).ListenAndServe(*listen)
+}
+
+func dapCommand(args []string) (int, error) {
+	var board machineFlags
+	flags := flag.NewFlagSet("dap", flag.ContinueOnError)
+	board.register(flags)
+	listen := flags.String("listen", "", "address to listen on (default: serve a single session on stdio)")
+	args, err := parse(flags, args, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	c, err := board.build(optional(args))
+	if err != nil {
+		return 0, err
+	}
+	server := dap.NewServer(debugger.New(c))
+	if *listen != "" {
+		return exitOK, server.ListenAndServe(*listen)
+	}
+	return exitOK, server.Serve(os.Stdin, os.Stdout)
+}
@@ -58,14 +58,184 @@ type Cpu struct {
 	V byte // Overflow
 	N byte // Negative
 
+	// Cycles executed since the cpu was created
+	Cycles uint64
+
+	// Variant selects the family member emulated, the 6502 unless set
+	Variant Variant
+
 	memoryMapper     memory.MemoryMapper
 	interruptChannel chan InterruptType
+	// interrupts requested with Interrupt or taken off the channel by PendingInterrupts,
+	// they are served before the channel
+	pendingInterrupts []InterruptType
+	irqLine           InterruptLine
+	nmiLine           InterruptLine
+	nmiWasActive      bool
+	tracers           []Tracer
+	memoryListeners   []MemoryListener
+	boundaryListeners []BoundaryListener
+	// base cycles of the instruction being executed, 0 between instructions
+	opcodeCycles int
+	// cycles the cpu is kept off the bus after the instruction being executed
+	stall uint64
+}
+
+// Tracer is notified before every instruction is executed, after any pending interrupt has been taken
+type Tracer interface {
+	Trace(c *Cpu)
+}
+
+// BoundaryListener is notified at every instruction boundary before pending interrupts are served,
+// interrupts requested there with Interrupt are served at this very boundary
+type BoundaryListener interface {
+	Boundary(c *Cpu)
+}
+
+// MemoryListener is notified about every memory access made by executing instructions,
+// writes are reported before they reach the memory. Opcodes and operands read from the instruction
+// stream are fetches, all other reads are data reads.
+type MemoryListener interface {
+	MemoryFetch(address uint16, value byte)
+	MemoryRead(address uint16, value byte)
+	MemoryWrite(address uint16, value byte)
 }
 
 func NewCpu(interruptChannel chan InterruptType, memoryMapper memory.MemoryMapper) Cpu {
 	return Cpu{interruptChannel: interruptChannel, memoryMapper: memoryMapper}
 }
 
+// AddTracer registers a tracer to be notified before every instruction
+func (c *Cpu) AddTracer(tracer Tracer) {
+	c.tracers = append(c.tracers, tracer)
+}
+
+// RemoveTracer unregisters a tracer added with AddTracer
+func (c *Cpu) RemoveTracer(tracer Tracer) {
+	for i, t := range c.tracers {
+		if t == tracer {
+			c.tracers = append(c.tracers[:i], c.tracers[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddBoundaryListener registers a listener to be notified at every instruction boundary
+func (c *Cpu) AddBoundaryListener(listener BoundaryListener) {
+	c.boundaryListeners = append(c.boundaryListeners, listener)
+}
+
+// RemoveBoundaryListener unregisters a listener added with AddBoundaryListener
+func (c *Cpu) RemoveBoundaryListener(listener BoundaryListener) {
+	for i, l := range c.boundaryListeners {
+		if l == listener {
+			c.boundaryListeners = append(c.boundaryListeners[:i], c.boundaryListeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddMemoryListener registers a listener to be notified about memory accesses made by instructions
+func (c *Cpu) AddMemoryListener(listener MemoryListener) {
+	c.memoryListeners = append(c.memoryListeners, listener)
+}
+
+// RemoveMemoryListener unregisters a listener added with AddMemoryListener
+func (c *Cpu) RemoveMemoryListener(listener MemoryListener) {
+	for i, l := range c.memoryListeners {
+		if l == listener {
+			c.memoryListeners = append(c.memoryListeners[:i], c.memoryListeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// MemoryMapper returns the memory the cpu is connected to
+func (c *Cpu) MemoryMapper() memory.MemoryMapper {
+	return c.memoryMapper
+}
+
+// Stall keeps the cpu off the bus for a number of cycles once the instruction being executed completes, the way
+// a device holding RDY low or taking the bus for DMA does. The cycles count in Cycles and in what ExecuteOpcode
+// returns. Stalls requested between instructions delay the next one.
+func (c *Cpu) Stall(cycles uint64) {
+	c.stall += cycles
+}
+
+// PendingStall returns the cycles the cpu is kept off the bus before the next instruction
+func (c *Cpu) PendingStall() uint64 {
+	return c.stall
+}
+
+// SetPendingStall replaces the cycles the cpu is kept off the bus before the next instruction
+func (c *Cpu) SetPendingStall(cycles uint64) {
+	c.stall = cycles
+}
+
+// AccessCycle returns the cycle of the memory access being made by the executing instruction, counting it as
+// the last cycle of the instruction, where stores and most reads happen. Between instructions it is Cycles.
+func (c *Cpu) AccessCycle() uint64 {
+	if c.opcodeCycles == 0 {
+		return c.Cycles
+	}
+	return c.Cycles + uint64(c.opcodeCycles) - 1
+}
+
+// PendingInterrupts returns interrupts requested but not served yet, in the order they will be served.
+// Interrupts waiting on the channel are moved to an internal queue so they can be inspected without being lost.
+func (c *Cpu) PendingInterrupts() []InterruptType {
+	for {
+		select {
+		case interruptType := <-c.interruptChannel:
+			c.pendingInterrupts = append(c.pendingInterrupts, interruptType)
+			continue
+		default:
+		}
+		break
+	}
+	return append([]InterruptType{}, c.pendingInterrupts...)
+}
+
+// Interrupt requests an interrupt, it is served at an instruction boundary after the ones already pending
+func (c *Cpu) Interrupt(interruptType InterruptType) {
+	c.pendingInterrupts = append(c.pendingInterrupts, interruptType)
+}
+
+// SetPendingInterrupts replaces the queue of interrupts to be served before the ones on the channel
+func (c *Cpu) SetPendingInterrupts(interrupts []InterruptType) {
+	c.pendingInterrupts = append([]InterruptType{}, interrupts...)
+}
+
+// Registers is a copy of the cpu registers with flags packed into P
+type Registers struct {
+	A      byte
+	X      byte
+	Y      byte
+	S      byte
+	PC     uint16
+	P      byte
+	Cycles uint64
+}
+
+func (c *Cpu) Registers() Registers {
+	return Registers{A: c.A, X: c.X, Y: c.Y, S: c.S, PC: c.PC, P: c.Status(), Cycles: c.Cycles}
+}
+
+func (c *Cpu) SetRegisters(r Registers) {
+	c.A, c.X, c.Y, c.S, c.PC, c.Cycles = r.A, r.X, r.Y, r.S, r.PC, r.Cycles
+	c.SetStatus(r.P)
+}
+
+// Status returns flags packed into a byte the way PHP would push them, with the B flag clear
+func (c *Cpu) Status() byte {
+	return c.getStatusFlags(0)
+}
+
+// SetStatus unpacks flags from a byte the way PLP would
+func (c *Cpu) SetStatus(value byte) {
+	c.setStatusFlags(value)
+}
+
 // bFlag needs to be 1 or 0
 func (c *Cpu) getStatusFlags(bFlag byte) byte {
 	return (c.N << 7) + (c.V << 6) + 0b00100000 + (bFlag << 4) + (c.D << 3) + (c.I << 2) + (c.Z << 1) + c.C
@@ -150,19 +320,42 @@ func (c *Cpu) Run(cycles int) int {
 }
 
 func (c *Cpu) ExecuteOpcode() int {
-	cycles := 0
-	select {
-	case interruptType := <-c.interruptChannel:
-		cycles += c.interrupt(interruptType) // TODO how do I account for interrupts in cycles, like that?
-	default:
+	for _, l := range c.boundaryListeners {
+		l.Boundary(c)
+	}
+	stalled := int(c.stall)
+	c.Cycles += c.stall
+	c.stall = 0
+
+	interruptCycles := 0
+	if len(c.pendingInterrupts) > 0 {
+		interruptType := c.pendingInterrupts[0]
+		c.pendingInterrupts = c.pendingInterrupts[1:]
+		interruptCycles = c.interrupt(interruptType)
+		c.Cycles += uint64(interruptCycles)
+	} else {
+		select {
+		case interruptType := <-c.interruptChannel:
+			interruptCycles = c.interrupt(interruptType) // TODO how do I account for interrupts in cycles, like that?
+			c.Cycles += uint64(interruptCycles)
+		default:
+		}
+	}
+	if interruptCycles == 0 {
+		interruptCycles = c.lineInterrupt()
+		c.Cycles += uint64(interruptCycles)
 	}
 
-	operation := c.readFromMemory(c.PC)
-	c.PC++
+	for _, t := range c.tracers {
+		t.Trace(c)
+	}
+
+	operation := c.fetch()
 
 	opcodeSpec := opcode.Lookup(operation)
 	memoryAccessMode := opcodeSpec.AccessMode
-	cycles += opcodeSpec.Cycles
+	cycles := opcodeSpec.Cycles
+	c.opcodeCycles = cycles
 	switch opcodeSpec.Operation {
 
 	case opcode.ORA:
@@ -241,20 +434,16 @@ func (c *Cpu) ExecuteOpcode() int {
 		c.bit(val)
 	case opcode.JMP:
 		if memoryAccessMode == addressing.Indirect {
-			lo := c.readFromMemory(c.PC)
-			c.PC++
-			hi := c.readFromMemory(c.PC)
-			c.PC++
+			lo := c.fetch()
+			hi := c.fetch()
 			address := uint16(hi)<<8 | uint16(lo)
 			final_lo := c.readFromMemory(address)
 			final_hi := c.readFromMemory(address + 1)
 			jumpAddress := uint16(final_hi)<<8 | uint16(final_lo)
 			c.PC = jumpAddress
 		} else if memoryAccessMode == addressing.Absolute {
-			lo := c.readFromMemory(c.PC)
-			c.PC++
-			hi := c.readFromMemory(c.PC)
-			c.PC++
+			lo := c.fetch()
+			hi := c.fetch()
 			jumpAddress := uint16(hi)<<8 | uint16(lo)
 			c.PC = jumpAddress
 		}
@@ -282,10 +471,8 @@ func (c *Cpu) ExecuteOpcode() int {
 		c.I = 1
 		c.PC = uint16(c.readFromMemory(0xFFFF))<<8 | uint16(c.readFromMemory(0xFFFE))
 	case opcode.JSR:
-		lo := c.readFromMemory(c.PC)
-		c.PC++
-		hi := c.readFromMemory(c.PC)
-		c.PC++
+		lo := c.fetch()
+		hi := c.fetch()
 		address := uint16(hi)<<8 | uint16(lo)
 
 		t := c.PC - 1
@@ -404,12 +591,15 @@ func (c *Cpu) ExecuteOpcode() int {
 	default:
 		panic(fmt.Sprintf("unknown opcode: %v", operation))
 	}
-	return cycles
+	c.opcodeCycles = 0
+	cycles += int(c.stall)
+	c.Cycles += uint64(cycles)
+	c.stall = 0
+	return stalled + interruptCycles + cycles
 }
 
 func (c *Cpu) takeBranch() int {
-	offset := c.readFromMemory(c.PC)
-	c.PC++
+	offset := c.fetch()
 	relativeAddress, pageCrossed := getRelativeAddress(c.PC, offset)
 	c.PC = relativeAddress
 	return pageCrossed + 1 // +1 for taking the branch
@@ -430,14 +620,31 @@ func getRelativeAddress(address uint16, offset byte) (uint16, int) {
 func (c *Cpu) readNext(accessMode addressing.Mode) (byte, uint16, int) {
 	if accessMode == addressing.Accumulator {
 		return c.A, 0, 0
+	} else if accessMode == addressing.Immediate {
+		address := c.PC
+		return c.fetch(), address, 0
 	} else {
 		address, pageCrossed := c.nextByteToAddress(accessMode)
 		return c.readFromMemory(address), address, pageCrossed
 	}
 }
 
+// fetch reads the byte at PC as part of the instruction and moves PC past it
+func (c *Cpu) fetch() byte {
+	value := c.memoryMapper.Read(c.PC)
+	for _, l := range c.memoryListeners {
+		l.MemoryFetch(c.PC, value)
+	}
+	c.PC++
+	return value
+}
+
 func (c *Cpu) readFromMemory(address uint16) byte {
-	return c.memoryMapper.Read(address)
+	value := c.memoryMapper.Read(address)
+	for _, l := range c.memoryListeners {
+		l.MemoryRead(address, value)
+	}
+	return value
 }
 
 func (c *Cpu) write(address uint16, value byte, accessMode addressing.Mode) {
@@ -449,6 +656,9 @@ func (c *Cpu) write(address uint16, value byte, accessMode addressing.Mode) {
 }
 
 func (c *Cpu) writeToMemory(address uint16, value byte) {
+	for _, l := range c.memoryListeners {
+		l.MemoryWrite(address, value)
+	}
 	c.memoryMapper.Write(address, value)
 }
 
@@ -463,50 +673,39 @@ func (c *Cpu) nextByteToAddress(accessMode addressing.Mode) (uint16, int) {
 		c.PC++
 		return address, 0
 	case addressing.ZeroPage:
-		address := c.readFromMemory(c.PC)
-		c.PC++
+		address := c.fetch()
 		return uint16(address), 0
 	case addressing.ZeroPageX:
-		val := c.readFromMemory(c.PC)
-		c.PC++
+		val := c.fetch()
 		address := (val + c.X) & Mask8Bit
 		return uint16(address), 0
 	case addressing.ZeroPageY:
-		val := c.readFromMemory(c.PC)
-		c.PC++
+		val := c.fetch()
 		address := (val + c.Y) & Mask8Bit
 		return uint16(address), 0
 	case addressing.Absolute:
-		lo := c.readFromMemory(c.PC)
-		c.PC++
-		hi := c.readFromMemory(c.PC)
-		c.PC++
+		lo := c.fetch()
+		hi := c.fetch()
 		return uint16(hi)<<8 | uint16(lo), 0
 	case addressing.AbsoluteX:
-		lo := c.readFromMemory(c.PC)
-		c.PC++
-		hi := c.readFromMemory(c.PC)
-		c.PC++
+		lo := c.fetch()
+		hi := c.fetch()
 		address := uint16(hi)<<8 | uint16(lo)
 		result := address + uint16(c.X)
 		return result, hiByteDiffers(result, address)
 	case addressing.AbsoluteY:
-		lo := c.readFromMemory(c.PC)
-		c.PC++
-		hi := c.readFromMemory(c.PC)
-		c.PC++
+		lo := c.fetch()
+		hi := c.fetch()
 		address := uint16(hi)<<8 | uint16(lo)
 		result := address + uint16(c.Y)
 		return result, hiByteDiffers(result, address)
 	case addressing.IndirectX:
-		loAddr := c.readFromMemory(c.PC)
-		c.PC++
+		loAddr := c.fetch()
 		lo := c.readFromMemory(uint16((loAddr + c.X) & Mask8Bit))
 		hi := uint16(c.readFromMemory(uint16((loAddr+c.X+1)&Mask8Bit))) << 8
 		return hi | uint16(lo), 0
 	case addressing.IndirectY:
-		loAddr := c.readFromMemory(c.PC)
-		c.PC++
+		loAddr := c.fetch()
 		lo := c.readFromMemory(uint16(loAddr))
 		hi := uint16(c.readFromMemory(uint16((loAddr+1)&Mask8Bit))) << 8
 		address := hi | uint16(lo)
@@ -28,3 +28,47 @@ func Test_cpu(t *testing.T) {
 		cpu.ExecuteOpcode()
 	}
 }
+
+func Test_cpuDecimal(t *testing.T) {
+	cpu := NewCpu(nil, &memory.DummyMemoryMapper{})
+	err := cpu.Load("../roms/decimal_test/6502_decimal_test.bin", 0x0400, 0x0400)
+	require.NoError(t, err)
+	for i := 0; i < 20000000 && cpu.PC != 0x0407 && cpu.PC != 0x040A; i++ {
+		cpu.ExecuteOpcode()
+	}
+	assert.Equal(t, uint16(0x0407), cpu.PC, "trapped at SUCCESS")
+}
+
+// stallingMemory holds the cpu off the bus for 10 cycles on writes to $2000 and records when they happen
+type stallingMemory struct {
+	memory.DummyMemoryMapper
+	cpu    *Cpu
+	writes []uint64
+}
+
+func (m *stallingMemory) Write(address uint16, value byte) {
+	if address == 0x2000 {
+		m.writes = append(m.writes, m.cpu.AccessCycle())
+		m.cpu.Stall(10)
+	}
+	m.DummyMemoryMapper.Write(address, value)
+}
+
+func TestCpu_stall(t *testing.T) {
+	m := &stallingMemory{}
+	copy(m.Mem[0x0400:], []byte{0x8D, 0x00, 0x20, 0xEA}) // STA $2000, NOP
+	cpu := NewCpu(nil, m)
+	m.cpu = &cpu
+	cpu.Reset()
+	cpu.PC = 0x0400
+	cpu.Cycles = 100
+
+	assert.Equal(t, 14, cpu.ExecuteOpcode(), "4 cycles of STA and the stall")
+	assert.Equal(t, []uint64{103}, m.writes, "the write is the last cycle of STA")
+	assert.Equal(t, uint64(114), cpu.Cycles)
+	assert.Equal(t, uint64(114), cpu.AccessCycle(), "between instructions")
+
+	cpu.Stall(5)
+	assert.Equal(t, 7, cpu.ExecuteOpcode(), "the NOP after the stall")
+	assert.Equal(t, uint64(121), cpu.Cycles)
+}
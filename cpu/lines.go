@@ -0,0 +1,78 @@
+package cpu
+
+// InterruptLine is an interrupt input shared by any number of devices, wired-OR like on the real bus:
+// it is active while at least one of its pins is held.
+// The IRQ line is level triggered, the cpu takes the interrupt at every instruction boundary while the line
+// is active and interrupts are enabled. The NMI line is edge triggered, an interrupt is taken when it becomes active.
+type InterruptLine struct {
+	held int
+}
+
+// Pin connects one more device to the line
+func (l *InterruptLine) Pin() *InterruptPin {
+	return &InterruptPin{line: l}
+}
+
+// Active tells whether any pin holds the line
+func (l *InterruptLine) Active() bool {
+	return l.held > 0
+}
+
+// InterruptPin is a device's connection to an interrupt line. A nil pin is a device that is not wired to any line.
+type InterruptPin struct {
+	line *InterruptLine
+	held bool
+}
+
+// Set holds or releases the line
+func (p *InterruptPin) Set(active bool) {
+	if p == nil || p.held == active {
+		return
+	}
+	p.held = active
+	if active {
+		p.line.held++
+	} else {
+		p.line.held--
+	}
+}
+
+// Held tells whether this pin holds its line
+func (p *InterruptPin) Held() bool {
+	return p != nil && p.held
+}
+
+// IRQLine returns the level triggered IRQ input
+func (c *Cpu) IRQLine() *InterruptLine {
+	return &c.irqLine
+}
+
+// NMILine returns the edge triggered NMI input
+func (c *Cpu) NMILine() *InterruptLine {
+	return &c.nmiLine
+}
+
+// NMIWasActive returns the level of the NMI line seen at the last instruction boundary,
+// an NMI is taken when the line becomes active after it was not
+func (c *Cpu) NMIWasActive() bool {
+	return c.nmiWasActive
+}
+
+// SetNMIWasActive replaces the level of the NMI line seen at the last instruction boundary
+func (c *Cpu) SetNMIWasActive(active bool) {
+	c.nmiWasActive = active
+}
+
+// lineInterrupt serves the interrupt lines, NMI first
+func (c *Cpu) lineInterrupt() int {
+	nmi := c.nmiLine.Active()
+	edge := nmi && !c.nmiWasActive
+	c.nmiWasActive = nmi
+	if edge {
+		return c.interrupt(InterruptTypeNMI)
+	}
+	if c.irqLine.Active() && c.I == 0 {
+		return c.interrupt(InterruptTypeIRQ)
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCpu_interruptLines(t *testing.T) {
+	m := &memory.DummyMemoryMapper{}
+	for a := 0x0400; a < 0x0600; a++ {
+		m.Mem[a] = 0xEA // NOP
+	}
+	m.Mem[0xFFFE], m.Mem[0xFFFF] = 0x00, 0x05 // IRQ handler at $0500
+	m.Mem[0xFFFA], m.Mem[0xFFFB] = 0x80, 0x05 // NMI handler at $0580
+	cpu := NewCpu(nil, m)
+	cpu.Reset()
+	cpu.PC = 0x0400
+
+	via, acia := cpu.IRQLine().Pin(), cpu.IRQLine().Pin()
+	via.Set(true)
+	acia.Set(true)
+	cpu.ExecuteOpcode()
+	assert.Equal(t, uint16(0x0401), cpu.PC, "interrupts disabled")
+
+	cpu.I = 0
+	via.Set(false)
+	cpu.ExecuteOpcode()
+	assert.Equal(t, uint16(0x0501), cpu.PC, "line still held by the other pin")
+
+	cpu.I = 0
+	cpu.ExecuteOpcode()
+	assert.Equal(t, uint16(0x0501), cpu.PC, "level triggered, taken again while held")
+
+	acia.Set(false)
+	cpu.I = 0
+	cpu.ExecuteOpcode()
+	assert.Equal(t, uint16(0x0502), cpu.PC)
+
+	nmi := cpu.NMILine().Pin()
+	nmi.Set(true)
+	cpu.ExecuteOpcode()
+	assert.Equal(t, uint16(0x0581), cpu.PC)
+	cpu.ExecuteOpcode()
+	assert.Equal(t, uint16(0x0582), cpu.PC, "edge triggered, taken once")
+
+	var unwired *InterruptPin
+	unwired.Set(true)
+	assert.False(t, unwired.Held())
+}
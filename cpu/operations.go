@@ -1,6 +1,10 @@
 package cpu
 
 func (c *Cpu) adc(value byte) {
+	if c.decimal() {
+		c.adcDecimal(value)
+		return
+	}
 	//TODO maybe replace masks with shifts?
 	sum := uint16(value) + uint16(c.A) + uint16(c.C)
 	//if (sum >> 7) != uint16(c.A>>7) {
@@ -10,7 +14,6 @@ func (c *Cpu) adc(value byte) {
 		c.V = 0
 	}
 
-	//TODO BCD
 	if sum > 255 {
 		c.C = 1
 	} else {
@@ -26,6 +29,7 @@ func (c *Cpu) adc(value byte) {
 }
 
 func (c *Cpu) sbc(value byte) {
+	a, borrow := c.A, 1-c.C
 	//TODO maybe replace masks with shifts?
 	sub := 0xFF + uint16(c.A) - uint16(value) + uint16(c.C) // TODO not sure if whole carry should be negated or just last bit, not sure if it should be int16 or uint16
 	if ((uint16(c.A) & 0x80) != (uint16(value) & 0x80)) && ((uint16(c.A) & 0x80) != (uint16(sub) & 0x80)) {
@@ -33,7 +37,6 @@ func (c *Cpu) sbc(value byte) {
 	} else {
 		c.V = 0
 	}
-	//TODO BCD
 	if sub >= 0x100 {
 		c.C = 1
 	} else {
@@ -46,6 +49,55 @@ func (c *Cpu) sbc(value byte) {
 	} else {
 		c.Z = 0
 	}
+	if c.decimal() {
+		c.A = sbcDecimal(a, value, borrow)
+	}
+}
+
+// adcDecimal adds in BCD the way the NMOS 6502 does: Z comes from the binary sum, N and V from the sum
+// before the high digit is adjusted. See http://www.6502.org/tutorials/decimal_mode.html
+func (c *Cpu) adcDecimal(value byte) {
+	a := int(c.A)
+	v := int(value)
+	carry := int(c.C)
+	low := a&0x0F + v&0x0F + carry
+	if low >= 0x0A {
+		low = (low+0x06)&0x0F + 0x10
+	}
+	sum := a&0xF0 + v&0xF0 + low
+	c.N = byte(sum>>7) & 1
+	if (a^sum)&(v^sum)&0x80 != 0 {
+		c.V = 1
+	} else {
+		c.V = 0
+	}
+	if byte(a+v+carry) == 0 {
+		c.Z = 1
+	} else {
+		c.Z = 0
+	}
+	if sum >= 0xA0 {
+		sum += 0x60
+	}
+	if sum >= 0x100 {
+		c.C = 1
+	} else {
+		c.C = 0
+	}
+	c.A = byte(sum)
+}
+
+// sbcDecimal subtracts in BCD the way the NMOS 6502 does, the flags are those of the binary subtraction
+func sbcDecimal(a, value, borrow byte) byte {
+	low := int(a&0x0F) - int(value&0x0F) - int(borrow)
+	if low < 0 {
+		low = (low-0x06)&0x0F - 0x10
+	}
+	result := int(a&0xF0) - int(value&0xF0) + low
+	if result < 0 {
+		result -= 0x60
+	}
+	return byte(result)
 }
 
 func (c *Cpu) and(value byte) {
@@ -22,3 +22,35 @@ func TestCpu_adc1(t *testing.T) {
 	assert.Equal(t, byte(1), cpu.Z)
 	assert.Equal(t, byte(0), cpu.N)
 }
+
+func TestCpu_decimal(t *testing.T) {
+	cpu := NewCpu(nil, &memory.DummyMemoryMapper{})
+	cpu.Reset()
+	cpu.D = 1
+
+	for _, tc := range []struct {
+		a, value, carry byte
+		sum, sumCarry   byte
+		diff, diffCarry byte
+	}{
+		{0x09, 0x01, 0, 0x10, 0, 0x07, 1},
+		{0x58, 0x46, 1, 0x05, 1, 0x12, 1},
+		{0x99, 0x01, 0, 0x00, 1, 0x97, 1},
+		{0x10, 0x20, 1, 0x31, 0, 0x90, 0},
+	} {
+		cpu.A, cpu.C = tc.a, tc.carry
+		cpu.adc(tc.value)
+		assert.Equal(t, []byte{tc.sum, tc.sumCarry}, []byte{cpu.A, cpu.C}, "$%02X + $%02X + %d", tc.a, tc.value, tc.carry)
+		cpu.A, cpu.C = tc.a, tc.carry
+		cpu.sbc(tc.value)
+		assert.Equal(t, []byte{tc.diff, tc.diffCarry}, []byte{cpu.A, cpu.C}, "$%02X - $%02X - %d", tc.a, tc.value, 1-tc.carry)
+	}
+
+	cpu.Variant = Ricoh2A03
+	cpu.A, cpu.C = 0x09, 0
+	cpu.adc(0x01)
+	assert.Equal(t, byte(0x0A), cpu.A, "the 2A03 ignores D")
+	cpu.sbc(0x01)
+	assert.Equal(t, byte(0x08), cpu.A)
+	assert.Equal(t, byte(1), cpu.D)
+}
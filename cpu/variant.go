@@ -0,0 +1,41 @@
+package cpu
+
+import "fmt"
+
+// Variant is the member of the 6502 family a Cpu behaves as
+type Variant int
+
+const (
+	// NMOS6502 is the MOS 6502, ADC and SBC work in BCD while D is set
+	NMOS6502 Variant = iota
+	// Ricoh2A03 is the cpu of the NES, a 6502 with decimal mode disabled: D is set and cleared as usual
+	// but ADC and SBC always work in binary
+	Ricoh2A03
+)
+
+var variantNames = map[Variant]string{
+	NMOS6502:  "6502",
+	Ricoh2A03: "2a03",
+}
+
+func (v Variant) String() string {
+	if name, ok := variantNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("Variant(%d)", int(v))
+}
+
+// ParseVariant returns the variant named 6502 or 2a03
+func ParseVariant(name string) (Variant, error) {
+	for v, n := range variantNames {
+		if n == name {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported cpu variant %q, expected 6502 or 2a03", name)
+}
+
+// decimal tells whether ADC and SBC work in BCD
+func (c *Cpu) decimal() bool {
+	return c.D == 1 && c.Variant != Ricoh2A03
+}
@@ -0,0 +1,569 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/debugger"
+	"github.com/slawomirbiernacki/mos6502-emulator/debuginfo"
+	"github.com/slawomirbiernacki/mos6502-emulator/loader"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/number"
+	"github.com/slawomirbiernacki/mos6502-emulator/opcode"
+)
+
+const (
+	threadID = 1
+
+	// cycles executed between checks for a pause request
+	runSlice = 10000
+	// a source level step gives up after this many cycles, e.g. when stepping over an endless loop
+	stepBudget = 10000000
+
+	registersReference = 1
+	flagsReference     = 2
+	zeroPageReference  = 3
+)
+
+// Server is a Debug Adapter Protocol server, it lets VS Code and other editors debug programs running on the
+// emulator. Source lines are mapped to addresses through ca65/ld65 debug info.
+type Server struct {
+	debugger *debugger.Debugger
+
+	mu      sync.Mutex // guards the debugger and the fields below while the program runs in the background
+	info    *debuginfo.Info
+	infoDir string           // absolute directory of the debug info, source names are relative to it
+	sources map[string][]int // source path -> ids of the breakpoints set for it
+	running bool
+	pause   bool
+	// stop when configuration is done instead of running, set by launch with stopOnEntry and by attach
+	stopOnEntry bool
+
+	writeMu sync.Mutex
+	writer  io.Writer
+	seq     int
+}
+
+func NewServer(d *debugger.Debugger) *Server {
+	return &Server{debugger: d, sources: map[string][]int{}}
+}
+
+// ListenAndServe accepts connections on a TCP address such as "localhost:4711", serving one client at a time
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		err = s.Serve(conn, conn)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Serve handles messages until the client disconnects, reader and writer can be stdin and stdout
+func (s *Server) Serve(reader io.Reader, writer io.Writer) error {
+	s.writer = writer
+	buffered := bufio.NewReader(reader)
+	for {
+		r, err := readMessage(buffered)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if done := s.handle(r); done {
+			return nil
+		}
+	}
+}
+
+func (s *Server) send(message interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	switch m := message.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+	writeMessage(s.writer, message)
+}
+
+func (s *Server) respond(r *request, body interface{}) {
+	s.send(&response{Type: "response", RequestSeq: r.Seq, Success: true, Command: r.Command, Body: body})
+}
+
+func (s *Server) fail(r *request, err error) {
+	s.send(&response{Type: "response", RequestSeq: r.Seq, Success: false, Command: r.Command, Message: err.Error()})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) stopped(reason string) {
+	s.event("stopped", map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true})
+}
+
+// handle processes a single request, returns true when the session is over
+func (s *Server) handle(r *request) bool {
+	var err error
+	switch r.Command {
+	case "initialize":
+		s.respond(r, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsReadMemoryRequest":        true,
+			"supportsWriteMemoryRequest":       true,
+		})
+		s.event("initialized", nil)
+	case "launch":
+		err = s.launch(r)
+	case "attach":
+		err = s.attach(r)
+	case "setBreakpoints":
+		err = s.setBreakpoints(r)
+	case "setExceptionBreakpoints":
+		s.respond(r, map[string]interface{}{"breakpoints": []breakpoint{}})
+	case "configurationDone":
+		s.respond(r, nil)
+		s.mu.Lock()
+		stopOnEntry := s.stopOnEntry
+		s.stopOnEntry = false
+		s.mu.Unlock()
+		if stopOnEntry {
+			s.stopped("entry")
+		} else {
+			s.resume(s.continueSlice)
+		}
+	case "threads":
+		s.respond(r, map[string]interface{}{"threads": []map[string]interface{}{{"id": threadID, "name": "6502"}}})
+	case "stackTrace":
+		s.respond(r, map[string]interface{}{"stackFrames": s.stackTrace()})
+	case "scopes":
+		s.respond(r, map[string]interface{}{"scopes": []scope{
+			{Name: "Registers", VariablesReference: registersReference},
+			{Name: "Flags", VariablesReference: flagsReference},
+			{Name: "Zero page", VariablesReference: zeroPageReference, Expensive: true},
+		}})
+	case "variables":
+		err = s.variables(r)
+	case "readMemory":
+		err = s.readMemory(r)
+	case "writeMemory":
+		err = s.writeMemory(r)
+	case "continue":
+		s.respond(r, map[string]interface{}{"allThreadsContinued": true})
+		s.resume(s.continueSlice)
+	case "next":
+		s.respond(r, nil)
+		s.resume(s.step(func() debugger.Stop { return s.debugger.StepOver(stepBudget) }))
+	case "stepIn":
+		s.respond(r, nil)
+		s.resume(s.step(s.debugger.StepInto))
+	case "stepOut":
+		s.respond(r, nil)
+		s.resume(s.stepOut())
+	case "pause":
+		s.mu.Lock()
+		s.pause = true
+		s.mu.Unlock()
+		s.respond(r, nil)
+	case "disconnect", "terminate":
+		s.mu.Lock()
+		s.pause = true
+		s.mu.Unlock()
+		s.respond(r, nil)
+		return true
+	default:
+		err = fmt.Errorf("unsupported request %q", r.Command)
+	}
+	if err != nil {
+		s.fail(r, err)
+	}
+	return false
+}
+
+func (s *Server) launch(r *request) error {
+	var args launchArguments
+	if err := json.Unmarshal(r.Arguments, &args); err != nil {
+		return err
+	}
+	loadAddress, err := parseAddress(args.LoadAddress, 0)
+	if err != nil {
+		return err
+	}
+	segments, err := loader.Load(args.Program, args.Format, loadAddress)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.debugger.Cpu()
+	loader.Write(c.MemoryMapper(), segments)
+	c.Reset()
+	if len(segments) > 0 && !(loader.Covers(segments, 0xFFFC) && loader.Covers(segments, 0xFFFD)) {
+		c.PC = segments[0].Address
+	}
+	if args.Entry != "" {
+		entry, err := parseAddress(args.Entry, 0)
+		if err != nil {
+			return err
+		}
+		c.PC = entry
+	}
+	if err := s.loadDebugInfo(args.DebugInfo); err != nil {
+		return err
+	}
+	s.stopOnEntry = args.StopOnEntry
+	s.respond(r, nil)
+	return nil
+}
+
+func (s *Server) attach(r *request) error {
+	var args attachArguments
+	if len(r.Arguments) > 0 {
+		if err := json.Unmarshal(r.Arguments, &args); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadDebugInfo(args.DebugInfo); err != nil {
+		return err
+	}
+	s.stopOnEntry = true // attaching stops the program where it is
+	s.respond(r, nil)
+	return nil
+}
+
+func (s *Server) loadDebugInfo(path string) error {
+	if path == "" {
+		return nil
+	}
+	info, err := debuginfo.Load(path)
+	if err != nil {
+		return err
+	}
+	// source file names are relative to the debug info, clients need absolute paths
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	s.info, s.infoDir = info, dir
+	return nil
+}
+
+func (s *Server) setBreakpoints(r *request) error {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(r.Arguments, &args); err != nil {
+		return err
+	}
+	// a bad condition fails the request and leaves the breakpoints of the source as they were
+	conditions := make([]debugger.Condition, len(args.Breakpoints))
+	for i, requested := range args.Breakpoints {
+		if requested.Condition == "" {
+			continue
+		}
+		condition, err := debugger.ParseCondition(requested.Condition)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", requested.Line, err)
+		}
+		conditions[i] = condition
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range s.sources[args.Source.Path] {
+		s.debugger.RemoveBreakpoint(id)
+	}
+	s.sources[args.Source.Path] = nil
+
+	result := make([]breakpoint, 0, len(args.Breakpoints))
+	for i, requested := range args.Breakpoints {
+		var addresses []uint16
+		if s.info != nil {
+			addresses = s.info.AddressesForLine(args.Source.Path, requested.Line)
+		}
+		if len(addresses) == 0 {
+			result = append(result, breakpoint{Verified: false, Line: requested.Line, Message: "no code at this line"})
+			continue
+		}
+		reported := breakpoint{Verified: true, Line: requested.Line}
+		for _, address := range addresses {
+			b := s.debugger.AddBreakpoint(address)
+			b.Expression = requested.Condition
+			b.Condition = conditions[i]
+			s.sources[args.Source.Path] = append(s.sources[args.Source.Path], b.ID)
+			if reported.ID == 0 {
+				reported.ID = b.ID
+			}
+		}
+		result = append(result, reported)
+	}
+	s.respond(r, map[string]interface{}{"breakpoints": result})
+	return nil
+}
+
+// resume runs the program in the background, slice is called under the lock until it reports it is done
+func (s *Server) resume(slice func() (debugger.Stop, bool)) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.pause = false
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			s.mu.Lock()
+			if s.pause {
+				s.running = false
+				s.pause = false
+				s.mu.Unlock()
+				s.stopped("pause")
+				return
+			}
+			stop, done := slice()
+			if done {
+				s.running = false
+				s.mu.Unlock()
+				s.stopped(stopReason(stop))
+				return
+			}
+			s.mu.Unlock()
+		}
+	}()
+}
+
+func (s *Server) continueSlice() (debugger.Stop, bool) {
+	stop := s.debugger.Continue(runSlice)
+	return stop, stop.Reason != debugger.StopCycleLimit
+}
+
+// stepOut runs until the current subroutine returns in slices, so that a pause can stop it
+func (s *Server) stepOut() func() (debugger.Stop, bool) {
+	var stack byte
+	started := false
+	cycles := 0
+	return func() (debugger.Stop, bool) {
+		if !started {
+			started = true
+			stack = s.debugger.Cpu().S
+		}
+		stop := s.debugger.StepOutOf(stack, runSlice)
+		cycles += stop.Cycles
+		return stop, stop.Reason != debugger.StopCycleLimit || cycles > stepBudget
+	}
+}
+
+// step repeats an instruction step until execution reaches the start of a different source line.
+// Without debug info it is a single instruction step.
+func (s *Server) step(instruction func() debugger.Stop) func() (debugger.Stop, bool) {
+	var startLine debuginfo.Line
+	hasLine := false
+	started := false
+	cycles := 0
+	return func() (debugger.Stop, bool) {
+		if !started {
+			started = true
+			if s.info != nil {
+				startLine, hasLine = s.info.LineForAddress(s.debugger.Cpu().PC)
+			}
+		}
+		stop := instruction()
+		cycles += stop.Cycles
+		if s.info == nil || stop.Reason == debugger.StopBreakpoint || stop.Reason == debugger.StopWatchpoint || cycles > stepBudget {
+			return stop, true
+		}
+		line, ok := s.info.LineForAddress(s.debugger.Cpu().PC)
+		if !ok || line.Address != s.debugger.Cpu().PC {
+			return stop, false // inside a line or in code without sources
+		}
+		if hasLine && line.File == startLine.File && line.Line == startLine.Line {
+			return stop, false
+		}
+		return stop, true
+	}
+}
+
+func stopReason(stop debugger.Stop) string {
+	switch stop.Reason {
+	case debugger.StopBreakpoint:
+		return "breakpoint"
+	case debugger.StopWatchpoint:
+		return "data breakpoint"
+	default:
+		return "step"
+	}
+}
+
+// stackTrace reconstructs frames from JSR return addresses found on the stack page
+func (s *Server) stackTrace() []stackFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.debugger.Cpu()
+	mapper := c.MemoryMapper()
+
+	frames := []stackFrame{s.frame(0, c.PC)}
+	for sp := int(c.S) + 1; sp < 0xFF; {
+		lo := memory.Peek(mapper, 0x0100|uint16(sp))
+		hi := memory.Peek(mapper, 0x0100|uint16(sp+1))
+		returnAddress := uint16(hi)<<8 | uint16(lo)
+		call := returnAddress - 2 // JSR pushes the address of its last byte
+		if opcode.Exists(memory.Peek(mapper, call)) && opcode.Lookup(memory.Peek(mapper, call)).Operation == opcode.JSR {
+			frames = append(frames, s.frame(len(frames), call))
+			sp += 2
+		} else {
+			sp++
+		}
+	}
+	return frames
+}
+
+func (s *Server) frame(id int, address uint16) stackFrame {
+	f := stackFrame{ID: id, Name: fmt.Sprintf("$%04X", address), InstructionPointerReference: fmt.Sprintf("0x%04X", address)}
+	if s.info == nil {
+		return f
+	}
+	if symbol, ok := s.info.SymbolForAddress(address); ok {
+		f.Name = symbol.Name
+		if symbol.Address != address {
+			f.Name = fmt.Sprintf("%s+%d", symbol.Name, address-symbol.Address)
+		}
+	}
+	if line, ok := s.info.LineForAddress(address); ok {
+		path := line.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.infoDir, path)
+		}
+		f.Source = &source{Name: filepath.Base(path), Path: path}
+		f.Line = line.Line
+		f.Column = 1
+	}
+	return f
+}
+
+func (s *Server) variables(r *request) error {
+	var args frameArguments
+	if err := json.Unmarshal(r.Arguments, &args); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	c := s.debugger.Cpu()
+	var result []variable
+	switch args.VariablesReference {
+	case registersReference:
+		result = []variable{
+			{Name: "A", Value: fmt.Sprintf("$%02X", c.A)},
+			{Name: "X", Value: fmt.Sprintf("$%02X", c.X)},
+			{Name: "Y", Value: fmt.Sprintf("$%02X", c.Y)},
+			{Name: "S", Value: fmt.Sprintf("$%02X", c.S), MemoryReference: fmt.Sprintf("0x%04X", 0x0100|uint16(c.S))},
+			{Name: "PC", Value: fmt.Sprintf("$%04X", c.PC), MemoryReference: fmt.Sprintf("0x%04X", c.PC)},
+			{Name: "P", Value: fmt.Sprintf("$%02X", c.Status())},
+			{Name: "Cycles", Value: strconv.FormatUint(c.Cycles, 10)},
+		}
+	case flagsReference:
+		for _, flag := range []struct {
+			name  string
+			value byte
+		}{{"N", c.N}, {"V", c.V}, {"D", c.D}, {"I", c.I}, {"Z", c.Z}, {"C", c.C}} {
+			result = append(result, variable{Name: flag.name, Value: strconv.Itoa(int(flag.value))})
+		}
+	case zeroPageReference:
+		for address := 0; address < 0x100; address++ {
+			result = append(result, variable{
+				Name:            fmt.Sprintf("$%02X", address),
+				Value:           fmt.Sprintf("$%02X", memory.Peek(c.MemoryMapper(), uint16(address))),
+				MemoryReference: fmt.Sprintf("0x%04X", address),
+			})
+		}
+	}
+	s.mu.Unlock()
+	s.respond(r, map[string]interface{}{"variables": result})
+	return nil
+}
+
+func (s *Server) readMemory(r *request) error {
+	var args readMemoryArguments
+	if err := json.Unmarshal(r.Arguments, &args); err != nil {
+		return err
+	}
+	base, err := parseAddress(args.MemoryReference, 0)
+	if err != nil {
+		return err
+	}
+	if args.Count < 0 {
+		return fmt.Errorf("invalid count %d", args.Count)
+	}
+	start := int(base) + args.Offset
+	count := args.Count
+	if start < 0 || start > 0xFFFF {
+		s.respond(r, map[string]interface{}{"address": args.MemoryReference, "unreadableBytes": count})
+		return nil
+	}
+	if start+count > 0x10000 {
+		count = 0x10000 - start
+	}
+	s.mu.Lock()
+	data := make([]byte, count)
+	for i := range data {
+		data[i] = memory.Peek(s.debugger.Cpu().MemoryMapper(), uint16(start+i))
+	}
+	s.mu.Unlock()
+	s.respond(r, map[string]interface{}{
+		"address": fmt.Sprintf("0x%04X", start),
+		"data":    base64.StdEncoding.EncodeToString(data),
+	})
+	return nil
+}
+
+func (s *Server) writeMemory(r *request) error {
+	var args writeMemoryArguments
+	if err := json.Unmarshal(r.Arguments, &args); err != nil {
+		return err
+	}
+	base, err := parseAddress(args.MemoryReference, 0)
+	if err != nil {
+		return err
+	}
+	data, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for i, b := range data {
+		s.debugger.Cpu().MemoryMapper().Write(base+uint16(args.Offset+i), b)
+	}
+	s.mu.Unlock()
+	s.respond(r, map[string]interface{}{"bytesWritten": len(data)})
+	return nil
+}
+
+// parseAddress takes plain digits as hex, like memory references
+func parseAddress(s string, defaultValue uint16) (uint16, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	return number.ParseAddressBase(s, 16)
+}
@@ -0,0 +1,161 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/debugger"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	Type       string                 `json:"type"`
+	Command    string                 `json:"command"`
+	Event      string                 `json:"event"`
+	Success    bool                   `json:"success"`
+	RequestSeq int                    `json:"request_seq"`
+	Body       map[string]interface{} `json:"body"`
+}
+
+type client struct {
+	writer io.Writer
+	reader *bufio.Reader
+	seq    int
+}
+
+func (c *client) send(t *testing.T, command string, arguments interface{}) {
+	c.seq++
+	require.NoError(t, writeMessage(c.writer, map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": arguments,
+	}))
+}
+
+// expect reads messages until the response or event with the given name, skipping others
+func (c *client) expect(t *testing.T, name string) message {
+	for {
+		body, err := readBody(c.reader)
+		require.NoError(t, err)
+		var m message
+		require.NoError(t, json.Unmarshal(body, &m))
+		if m.Command == name || m.Event == name {
+			return m
+		}
+	}
+}
+
+// connect serves the debugger over pipes
+func connect(d *debugger.Debugger) *client {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	go NewServer(d).Serve(serverReader, serverWriter)
+	return &client{writer: clientWriter, reader: bufio.NewReader(clientReader)}
+}
+
+func TestServer_session(t *testing.T) {
+	c := cpu.NewCpu(nil, &memory.DummyMemoryMapper{})
+	c.MemoryMapper().Write(0xFFFD, 0x04)
+	dap := connect(debugger.New(&c))
+
+	dap.send(t, "initialize", map[string]interface{}{"adapterID": "mos6502"})
+	assert.True(t, dap.expect(t, "initialize").Success)
+	dap.expect(t, "initialized")
+
+	dap.send(t, "launch", map[string]interface{}{"program": "testdata/hello.bin", "loadAddress": "$FFFA"})
+	assert.False(t, dap.expect(t, "launch").Success, "the image runs past $FFFF")
+	dap.send(t, "launch", map[string]interface{}{"program": "testdata/hello.bin", "loadAddress": "$0400", "debugInfo": "../debuginfo/testdata/hello.dbg"})
+	assert.True(t, dap.expect(t, "launch").Success)
+
+	dap.send(t, "setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": "/src/hello.s"},
+		"breakpoints": []map[string]interface{}{{"line": 8}, {"line": 6}},
+	})
+	breakpoints := dap.expect(t, "setBreakpoints").Body["breakpoints"].([]interface{})
+	assert.Equal(t, true, breakpoints[0].(map[string]interface{})["verified"])
+	assert.Equal(t, false, breakpoints[1].(map[string]interface{})["verified"])
+
+	dap.send(t, "setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": "/src/hello.s"},
+		"breakpoints": []map[string]interface{}{{"line": 3}, {"line": 8, "condition": "A =="}},
+	})
+	assert.False(t, dap.expect(t, "setBreakpoints").Success, "the breakpoint at line 8 is kept")
+
+	dap.send(t, "configurationDone", nil)
+	assert.Equal(t, "breakpoint", dap.expect(t, "stopped").Body["reason"])
+
+	dap.send(t, "stackTrace", map[string]interface{}{"threadId": 1})
+	frames := dap.expect(t, "stackTrace").Body["stackFrames"].([]interface{})
+	require.Len(t, frames, 2)
+	assert.Equal(t, "sub", frames[0].(map[string]interface{})["name"])
+	assert.Equal(t, float64(8), frames[0].(map[string]interface{})["line"])
+	sourceDir, err := filepath.Abs("../debuginfo/testdata")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(sourceDir, "hello.s"), frames[0].(map[string]interface{})["source"].(map[string]interface{})["path"])
+	assert.Equal(t, "start", frames[1].(map[string]interface{})["name"])
+	assert.Equal(t, float64(3), frames[1].(map[string]interface{})["line"])
+
+	dap.send(t, "next", map[string]interface{}{"threadId": 1})
+	dap.expect(t, "stopped")
+	dap.send(t, "variables", map[string]interface{}{"variablesReference": registersReference})
+	variables := dap.expect(t, "variables").Body["variables"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"name": "PC", "value": "$0403", "variablesReference": float64(0), "memoryReference": "0x0403"}, variables[4])
+
+	dap.send(t, "readMemory", map[string]interface{}{"memoryReference": "0x0400", "count": 3})
+	assert.Equal(t, "IAkE", dap.expect(t, "readMemory").Body["data"])
+	dap.send(t, "readMemory", map[string]interface{}{"memoryReference": "0x0400", "count": -1})
+	assert.False(t, dap.expect(t, "readMemory").Success)
+
+	dap.send(t, "disconnect", nil)
+	dap.expect(t, "disconnect")
+}
+
+func TestServer_launchSource(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "loop.asm")
+	require.NoError(t, ioutil.WriteFile(program, []byte(".org $0600\nloop: JMP loop\n"), 0644))
+	c := cpu.NewCpu(nil, &memory.DummyMemoryMapper{})
+	dap := connect(debugger.New(&c))
+
+	dap.send(t, "launch", map[string]interface{}{"program": program, "stopOnEntry": true})
+	assert.True(t, dap.expect(t, "launch").Success)
+	dap.send(t, "configurationDone", nil)
+	dap.expect(t, "stopped")
+	dap.send(t, "readMemory", map[string]interface{}{"memoryReference": "0x0600", "count": 3})
+	assert.Equal(t, "TAAG", dap.expect(t, "readMemory").Body["data"])
+	dap.send(t, "stackTrace", map[string]interface{}{"threadId": 1})
+	frames := dap.expect(t, "stackTrace").Body["stackFrames"].([]interface{})
+	assert.Equal(t, "0x0600", frames[0].(map[string]interface{})["instructionPointerReference"])
+
+	dap.send(t, "disconnect", nil)
+	dap.expect(t, "disconnect")
+}
+
+func TestServer_pauseStepOut(t *testing.T) {
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[0x0400:], []byte{0x20, 0x00, 0x05}) // JSR $0500
+	copy(mem.Mem[0x0500:], []byte{0x4C, 0x00, 0x05}) // JMP $0500
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+	c.PC = 0x0400
+	c.ExecuteOpcode()
+	dap := connect(debugger.New(&c))
+
+	dap.send(t, "attach", nil)
+	dap.expect(t, "attach")
+	dap.send(t, "configurationDone", nil)
+	dap.expect(t, "stopped")
+
+	dap.send(t, "stepOut", map[string]interface{}{"threadId": 1})
+	dap.expect(t, "stepOut")
+	dap.send(t, "pause", map[string]interface{}{"threadId": 1})
+	assert.Equal(t, "pause", dap.expect(t, "stopped").Body["reason"])
+
+	dap.send(t, "disconnect", nil)
+	dap.expect(t, "disconnect")
+}
@@ -0,0 +1,232 @@
+package debugger
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/history"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/opcode"
+)
+
+type StopReason int
+
+const (
+	StopStep         StopReason = iota // a single step finished
+	StopBreakpoint                     // PC hit an enabled breakpoint whose condition held
+	StopTarget                         // step over/out or run until reached its destination
+	StopCycleLimit                     // the cycle budget was used up
+	StopWatchpoint                     // the last instruction accessed watched memory
+	StopHistoryStart                   // running backwards reached the oldest recorded instruction
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopStep:
+		return "step"
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopTarget:
+		return "target reached"
+	case StopCycleLimit:
+		return "cycle limit"
+	case StopWatchpoint:
+		return "watchpoint"
+	case StopHistoryStart:
+		return "start of history"
+	default:
+		return fmt.Sprintf("StopReason(%d)", int(r))
+	}
+}
+
+// Stop describes why the execution has been stopped
+type Stop struct {
+	Reason     StopReason
+	PC         uint16
+	Cycles     int         // cycles executed by the call that stopped
+	Breakpoint *Breakpoint // set when Reason is StopBreakpoint
+	Watch      *WatchHit   // set when Reason is StopWatchpoint
+}
+
+func (s Stop) String() string {
+	if s.Watch != nil {
+		return fmt.Sprintf("%v %d at $%04X ($%04X)", s.Reason, s.Watch.Watchpoint.ID, s.PC, s.Watch.Address)
+	}
+	if s.Breakpoint != nil {
+		return fmt.Sprintf("%v %d at $%04X", s.Reason, s.Breakpoint.ID, s.PC)
+	}
+	return fmt.Sprintf("%v at $%04X", s.Reason, s.PC)
+}
+
+type Breakpoint struct {
+	ID         int
+	Address    uint16
+	Expression string    // source of the condition, empty for unconditional breakpoints
+	Condition  Condition // nil for unconditional breakpoints
+	Enabled    bool
+	Hits       int
+}
+
+// Debugger drives a cpu instruction by instruction and stops it on breakpoints.
+// Every run method takes a cycle budget, 0 or less means run without limit.
+type Debugger struct {
+	cpu         *cpu.Cpu
+	breakpoints map[int]*Breakpoint
+	watchpoints map[int]*Watchpoint
+	watchHit    *WatchHit
+	history     *history.Recorder
+	nextID      int // shared by breakpoints and watchpoints
+}
+
+func New(c *cpu.Cpu) *Debugger {
+	return &Debugger{cpu: c, breakpoints: map[int]*Breakpoint{}, watchpoints: map[int]*Watchpoint{}, nextID: 1}
+}
+
+// Cpu returns the cpu being debugged
+func (d *Debugger) Cpu() *cpu.Cpu {
+	return d.cpu
+}
+
+func (d *Debugger) AddBreakpoint(address uint16) *Breakpoint {
+	breakpoint := &Breakpoint{ID: d.nextID, Address: address, Enabled: true}
+	d.breakpoints[breakpoint.ID] = breakpoint
+	d.nextID++
+	return breakpoint
+}
+
+// AddConditionalBreakpoint adds a breakpoint that only stops when the expression holds, see ParseCondition
+func (d *Debugger) AddConditionalBreakpoint(address uint16, expression string) (*Breakpoint, error) {
+	condition, err := ParseCondition(expression)
+	if err != nil {
+		return nil, err
+	}
+	breakpoint := d.AddBreakpoint(address)
+	breakpoint.Expression = expression
+	breakpoint.Condition = condition
+	return breakpoint, nil
+}
+
+func (d *Debugger) RemoveBreakpoint(id int) bool {
+	_, ok := d.breakpoints[id]
+	delete(d.breakpoints, id)
+	return ok
+}
+
+func (d *Debugger) ClearBreakpoints() {
+	d.breakpoints = map[int]*Breakpoint{}
+}
+
+// Breakpoints returns all breakpoints ordered by ID
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	result := make([]*Breakpoint, 0, len(d.breakpoints))
+	for _, b := range d.breakpoints {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// StepInto executes a single instruction
+func (d *Debugger) StepInto() Stop {
+	d.watchHit = nil
+	cycles := d.cpu.ExecuteOpcode()
+	if d.watchHit != nil {
+		return Stop{Reason: StopWatchpoint, PC: d.cpu.PC, Cycles: cycles, Watch: d.watchHit}
+	}
+	return Stop{Reason: StopStep, PC: d.cpu.PC, Cycles: cycles}
+}
+
+// StepOver executes a single instruction treating a JSR together with the whole subroutine as one step
+func (d *Debugger) StepOver(maxCycles int) Stop {
+	if opcode.Lookup(d.read(d.cpu.PC)).Operation != opcode.JSR {
+		return d.StepInto()
+	}
+	returnAddress := d.cpu.PC + 3
+	stack := d.cpu.S
+	return d.runUntil(maxCycles, func() bool {
+		return d.cpu.PC == returnAddress && d.cpu.S == stack
+	})
+}
+
+// StepOut runs until the current subroutine or interrupt handler returns with RTS or RTI
+func (d *Debugger) StepOut(maxCycles int) Stop {
+	return d.StepOutOf(d.cpu.S, maxCycles)
+}
+
+// StepOutOf runs until an RTS or RTI leaves the stack pointer above stack, a step out can be resumed with
+// the stack pointer it started from after running into the cycle limit
+func (d *Debugger) StepOutOf(stack byte, maxCycles int) Stop {
+	returned := false
+	return d.runUntilAfter(maxCycles, func(operation opcode.Operation) {
+		if (operation == opcode.RTS || operation == opcode.RTI) && d.cpu.S > stack {
+			returned = true
+		}
+	}, func() bool {
+		return returned
+	})
+}
+
+// RunUntil runs until PC reaches the address
+func (d *Debugger) RunUntil(address uint16, maxCycles int) Stop {
+	return d.runUntil(maxCycles, func() bool {
+		return d.cpu.PC == address
+	})
+}
+
+// Continue runs until a breakpoint is hit
+func (d *Debugger) Continue(maxCycles int) Stop {
+	return d.runUntil(maxCycles, func() bool {
+		return false
+	})
+}
+
+func (d *Debugger) runUntil(maxCycles int, done func() bool) Stop {
+	return d.runUntilAfter(maxCycles, func(opcode.Operation) {}, done)
+}
+
+// runUntilAfter always executes at least one instruction so that continuing from a breakpoint moves on.
+// after is called with each executed operation, done and breakpoints are checked before the next one.
+func (d *Debugger) runUntilAfter(maxCycles int, after func(opcode.Operation), done func() bool) Stop {
+	executed := 0
+	for {
+		operation := opcode.Lookup(d.read(d.cpu.PC)).Operation
+		d.watchHit = nil
+		executed += d.cpu.ExecuteOpcode()
+		after(operation)
+
+		if d.watchHit != nil {
+			return Stop{Reason: StopWatchpoint, PC: d.cpu.PC, Cycles: executed, Watch: d.watchHit}
+		}
+		if done() {
+			return Stop{Reason: StopTarget, PC: d.cpu.PC, Cycles: executed}
+		}
+		if breakpoint := d.breakpointHit(); breakpoint != nil {
+			return Stop{Reason: StopBreakpoint, PC: d.cpu.PC, Cycles: executed, Breakpoint: breakpoint}
+		}
+		if maxCycles > 0 && executed >= maxCycles {
+			return Stop{Reason: StopCycleLimit, PC: d.cpu.PC, Cycles: executed}
+		}
+	}
+}
+
+func (d *Debugger) breakpointHit() *Breakpoint {
+	var hit *Breakpoint
+	for _, b := range d.breakpoints {
+		if !b.Enabled || b.Address != d.cpu.PC {
+			continue
+		}
+		if b.Condition != nil && !b.Condition(d.cpu) {
+			continue
+		}
+		b.Hits++
+		if hit == nil || b.ID < hit.ID {
+			hit = b
+		}
+	}
+	return hit
+}
+
+func (d *Debugger) read(address uint16) byte {
+	return memory.Peek(d.cpu.MemoryMapper(), address)
+}
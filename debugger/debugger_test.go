@@ -0,0 +1,119 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 0400 JSR $0410
+// 0403 LDX #$05
+// 0405 JMP $0405
+// 0410 LDA #$42
+// 0412 INX
+// 0413 RTS
+func newDebugger() *Debugger {
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[0x0400:], []byte{0x20, 0x10, 0x04, 0xA2, 0x05, 0x4C, 0x05, 0x04})
+	copy(mem.Mem[0x0410:], []byte{0xA9, 0x42, 0xE8, 0x60})
+	mem.Mem[0xFFFC] = 0x00
+	mem.Mem[0xFFFD] = 0x04
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+	return New(&c)
+}
+
+func TestDebugger_stepOver(t *testing.T) {
+	d := newDebugger()
+
+	stop := d.StepOver(1000)
+
+	assert.Equal(t, StopTarget, stop.Reason)
+	assert.Equal(t, uint16(0x0403), stop.PC)
+	assert.Equal(t, byte(0x42), d.Cpu().A)
+	assert.Equal(t, 6+2+2+6, stop.Cycles)
+}
+
+func TestDebugger_stepOut(t *testing.T) {
+	d := newDebugger()
+	d.StepInto()
+	assert.Equal(t, uint16(0x0410), d.Cpu().PC)
+
+	stop := d.StepOut(1000)
+
+	assert.Equal(t, StopTarget, stop.Reason)
+	assert.Equal(t, uint16(0x0403), stop.PC)
+}
+
+func TestDebugger_breakpoints(t *testing.T) {
+	d := newDebugger()
+	d.AddBreakpoint(0x0412)
+	conditional, err := d.AddConditionalBreakpoint(0x0405, "X == 5 && A == $42")
+	require.NoError(t, err)
+
+	stop := d.Continue(1000)
+	assert.Equal(t, StopBreakpoint, stop.Reason)
+	assert.Equal(t, uint16(0x0412), stop.PC)
+
+	stop = d.Continue(1000)
+	assert.Equal(t, StopBreakpoint, stop.Reason)
+	assert.Equal(t, conditional, stop.Breakpoint)
+
+	d.RemoveBreakpoint(conditional.ID)
+	stop = d.Continue(100)
+	assert.Equal(t, StopCycleLimit, stop.Reason)
+}
+
+func TestParseCondition(t *testing.T) {
+	d := newDebugger()
+	d.Cpu().MemoryMapper().Write(0x10, 0x34)
+	d.Cpu().MemoryMapper().Write(0x11, 0x12)
+
+	condition, err := ParseCondition("[$10] + [$11] * 256 == $1234 && !C")
+	require.NoError(t, err)
+	assert.True(t, condition(d.Cpu()))
+
+	_, err = ParseCondition("A ==")
+	assert.Error(t, err)
+}
+
+func TestDebugger_reverseContinue(t *testing.T) {
+	d := newDebugger()
+	d.EnableHistory(100)
+	d.RunUntil(0x0405, 1000)
+	d.AddBreakpoint(0x0412)
+
+	stop := d.ReverseContinue()
+	assert.Equal(t, StopBreakpoint, stop.Reason)
+	assert.Equal(t, uint16(0x0412), d.Cpu().PC)
+	assert.Equal(t, byte(0x42), d.Cpu().A)
+
+	stop = d.ReverseContinue()
+	assert.Equal(t, StopHistoryStart, stop.Reason)
+	assert.Equal(t, uint16(0x0400), d.Cpu().PC)
+	assert.Equal(t, byte(0), d.Cpu().A)
+}
+
+func TestDebugger_watchpointSkipsFetches(t *testing.T) {
+	d := newDebugger()
+	d.AddWatchpoint(0x0410, 4, WatchRead)
+
+	stop := d.Continue(100)
+	assert.Equal(t, StopCycleLimit, stop.Reason)
+
+	// 0420 LDA $0411
+	d.Cpu().MemoryMapper().Write(0x0420, 0xAD)
+	d.Cpu().MemoryMapper().Write(0x0421, 0x11)
+	d.Cpu().MemoryMapper().Write(0x0422, 0x04)
+	d.Cpu().PC = 0x0420
+
+	stop = d.Continue(100)
+	require.Equal(t, StopWatchpoint, stop.Reason)
+	assert.Equal(t, uint16(0x0411), stop.Watch.Address)
+	assert.Equal(t, byte(0x42), stop.Watch.Value)
+	assert.False(t, stop.Watch.Write)
+}
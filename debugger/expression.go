@@ -0,0 +1,288 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/number"
+)
+
+// Condition decides whether a conditional breakpoint should stop the execution
+type Condition func(c *cpu.Cpu) bool
+
+// value is a compiled expression, booleans are represented as 1 and 0
+type value func(c *cpu.Cpu) int
+
+// ParseCondition compiles an expression over registers and memory into a Condition.
+//
+// Supported syntax:
+//   - numbers: 16, $10, 0x10, %00010000
+//   - registers: A, X, Y, S (or SP), PC, P (packed status), flags C, Z, I, D, V, N and CYC (cycle counter)
+//   - memory: [$0200] reads a byte, [$10]+[$11]*256 reads a little endian word
+//   - operators: + - & | ^ == != < <= > >= && || ! and parentheses
+//
+// For example: "A == $FF && [$0200] != 0" or "X > 3 || C"
+func ParseCondition(expression string) (Condition, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	v, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.tokens[p.pos], expression)
+	}
+	return func(c *cpu.Cpu) bool { return v(c) != 0 }, nil
+}
+
+func tokenize(expression string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("=!<>&|", r) && i+1 < len(runes) && isTwoCharOperator(string(runes[i:i+2])):
+			tokens = append(tokens, string(runes[i:i+2]))
+			i += 2
+		case strings.ContainsRune("+-&|^<>!()[]*", r):
+			tokens = append(tokens, string(r))
+			i++
+		case r == '$' || r == '%' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			return nil, fmt.Errorf("unexpected character %q in %q", r, expression)
+		}
+	}
+	return tokens, nil
+}
+
+func isTwoCharOperator(s string) bool {
+	switch s {
+	case "==", "!=", "<=", ">=", "&&", "||":
+		return true
+	}
+	return false
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) or() (value, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c *cpu.Cpu) int { return toInt(l(c) != 0 || right(c) != 0) }
+	}
+	return left, nil
+}
+
+func (p *parser) and() (value, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c *cpu.Cpu) int { return toInt(l(c) != 0 && right(c) != 0) }
+	}
+	return left, nil
+}
+
+func (p *parser) comparison() (value, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	operator := p.peek()
+	var compare func(a, b int) bool
+	switch operator {
+	case "==":
+		compare = func(a, b int) bool { return a == b }
+	case "!=":
+		compare = func(a, b int) bool { return a != b }
+	case "<":
+		compare = func(a, b int) bool { return a < b }
+	case "<=":
+		compare = func(a, b int) bool { return a <= b }
+	case ">":
+		compare = func(a, b int) bool { return a > b }
+	case ">=":
+		compare = func(a, b int) bool { return a >= b }
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return func(c *cpu.Cpu) int { return toInt(compare(left(c), right(c))) }, nil
+}
+
+func (p *parser) sum() (value, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := p.peek()
+		var combine func(a, b int) int
+		switch operator {
+		case "+":
+			combine = func(a, b int) int { return a + b }
+		case "-":
+			combine = func(a, b int) int { return a - b }
+		case "&":
+			combine = func(a, b int) int { return a & b }
+		case "|":
+			combine = func(a, b int) int { return a | b }
+		case "^":
+			combine = func(a, b int) int { return a ^ b }
+		default:
+			return left, nil
+		}
+		p.next()
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c *cpu.Cpu) int { return combine(l(c), right(c)) }
+	}
+}
+
+func (p *parser) product() (value, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c *cpu.Cpu) int { return l(c) * right(c) }
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (value, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		v, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(c *cpu.Cpu) int { return toInt(v(c) == 0) }, nil
+	case "-":
+		p.next()
+		v, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(c *cpu.Cpu) int { return -v(c) }, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (value, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "(":
+		v, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return v, nil
+	case "[":
+		address, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != "]" {
+			return nil, fmt.Errorf("missing ]")
+		}
+		return func(c *cpu.Cpu) int { return int(memory.Peek(c.MemoryMapper(), uint16(address(c)))) }, nil
+	}
+	if register, ok := registers[strings.ToUpper(token)]; ok {
+		return register, nil
+	}
+	n, err := number.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	return func(c *cpu.Cpu) int { return n }, nil
+}
+
+var registers = map[string]value{
+	"A":   func(c *cpu.Cpu) int { return int(c.A) },
+	"X":   func(c *cpu.Cpu) int { return int(c.X) },
+	"Y":   func(c *cpu.Cpu) int { return int(c.Y) },
+	"S":   func(c *cpu.Cpu) int { return int(c.S) },
+	"SP":  func(c *cpu.Cpu) int { return int(c.S) },
+	"PC":  func(c *cpu.Cpu) int { return int(c.PC) },
+	"P":   func(c *cpu.Cpu) int { return int(c.Status()) },
+	"C":   func(c *cpu.Cpu) int { return int(c.C) },
+	"Z":   func(c *cpu.Cpu) int { return int(c.Z) },
+	"I":   func(c *cpu.Cpu) int { return int(c.I) },
+	"D":   func(c *cpu.Cpu) int { return int(c.D) },
+	"V":   func(c *cpu.Cpu) int { return int(c.V) },
+	"N":   func(c *cpu.Cpu) int { return int(c.N) },
+	"CYC": func(c *cpu.Cpu) int { return int(c.Cycles) },
+}
+
+func toInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+package debugger
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/history"
+)
+
+// EnableHistory starts recording executed instructions so they can be undone, depth is the number of
+// instructions kept. Calling it again discards the recorded history.
+func (d *Debugger) EnableHistory(depth int) *history.Recorder {
+	if d.history != nil {
+		d.history.Stop()
+	}
+	d.history = history.New(d.cpu, depth)
+	return d.history
+}
+
+// History returns the recorder set up by EnableHistory, nil if history is disabled
+func (d *Debugger) History() *history.Recorder {
+	return d.history
+}
+
+// StepBack undoes the last executed instruction
+func (d *Debugger) StepBack() Stop {
+	if d.history == nil || !d.history.StepBack() {
+		return Stop{Reason: StopHistoryStart, PC: d.cpu.PC}
+	}
+	return Stop{Reason: StopStep, PC: d.cpu.PC}
+}
+
+// ReverseContinue runs backwards until a breakpoint or the start of the recorded history
+func (d *Debugger) ReverseContinue() Stop {
+	if d.history == nil {
+		return Stop{Reason: StopHistoryStart, PC: d.cpu.PC}
+	}
+	for d.history.StepBack() {
+		if breakpoint := d.breakpointHit(); breakpoint != nil {
+			return Stop{Reason: StopBreakpoint, PC: d.cpu.PC, Breakpoint: breakpoint}
+		}
+	}
+	return Stop{Reason: StopHistoryStart, PC: d.cpu.PC}
+}
@@ -0,0 +1,93 @@
+package debugger
+
+type WatchKind int
+
+const (
+	WatchWrite WatchKind = 1 << iota
+	WatchRead
+	WatchAccess = WatchRead | WatchWrite
+)
+
+// Watchpoint stops the execution after an instruction accessed memory in [Address, Address+Length)
+type Watchpoint struct {
+	ID      int
+	Address uint16
+	Length  int
+	Kind    WatchKind
+	Enabled bool
+	Hits    int
+}
+
+// WatchHit describes the access that triggered a watchpoint
+type WatchHit struct {
+	Watchpoint *Watchpoint
+	Address    uint16
+	Value      byte
+	Write      bool
+}
+
+func (w *Watchpoint) covers(address uint16) bool {
+	return int(address) >= int(w.Address) && int(address) < int(w.Address)+w.Length
+}
+
+// AddWatchpoint watches length bytes starting at address
+func (d *Debugger) AddWatchpoint(address uint16, length int, kind WatchKind) *Watchpoint {
+	if length < 1 {
+		length = 1
+	}
+	if len(d.watchpoints) == 0 {
+		d.cpu.AddMemoryListener(d)
+	}
+	watchpoint := &Watchpoint{ID: d.nextID, Address: address, Length: length, Kind: kind, Enabled: true}
+	d.watchpoints[watchpoint.ID] = watchpoint
+	d.nextID++
+	return watchpoint
+}
+
+func (d *Debugger) RemoveWatchpoint(id int) bool {
+	_, ok := d.watchpoints[id]
+	delete(d.watchpoints, id)
+	if ok && len(d.watchpoints) == 0 {
+		d.cpu.RemoveMemoryListener(d)
+	}
+	return ok
+}
+
+// Watchpoints returns all watchpoints ordered by ID
+func (d *Debugger) Watchpoints() []*Watchpoint {
+	result := make([]*Watchpoint, 0, len(d.watchpoints))
+	for id := 1; id < d.nextID; id++ {
+		if w, ok := d.watchpoints[id]; ok {
+			result = append(result, w)
+		}
+	}
+	return result
+}
+
+// MemoryFetch implements cpu.MemoryListener, executing code does not trigger read watchpoints
+func (d *Debugger) MemoryFetch(address uint16, value byte) {}
+
+// MemoryRead implements cpu.MemoryListener
+func (d *Debugger) MemoryRead(address uint16, value byte) {
+	d.watchAccess(address, value, WatchRead)
+}
+
+// MemoryWrite implements cpu.MemoryListener
+func (d *Debugger) MemoryWrite(address uint16, value byte) {
+	d.watchAccess(address, value, WatchWrite)
+}
+
+func (d *Debugger) watchAccess(address uint16, value byte, kind WatchKind) {
+	if d.watchHit != nil {
+		return // the first access of an instruction wins
+	}
+	for id := 1; id < d.nextID; id++ {
+		w, ok := d.watchpoints[id]
+		if !ok || !w.Enabled || w.Kind&kind == 0 || !w.covers(address) {
+			continue
+		}
+		w.Hits++
+		d.watchHit = &WatchHit{Watchpoint: w, Address: address, Value: value, Write: kind == WatchWrite}
+		return
+	}
+}
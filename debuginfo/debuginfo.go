@@ -0,0 +1,212 @@
+package debuginfo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Info holds the parts of a ca65/ld65 debug info file (ld65 --dbgfile) needed for source level debugging:
+// which addresses each source line produced and where the labels are.
+type Info struct {
+	Files   map[int]string // file id -> file name as given to the assembler
+	Lines   []Line         // ordered by address
+	Symbols []Symbol       // labels ordered by address
+}
+
+// Line maps a source line to the address range of the bytes it produced
+type Line struct {
+	File    string
+	Line    int
+	Address uint16
+	Size    int
+}
+
+type Symbol struct {
+	Name    string
+	Address uint16
+}
+
+func Load(path string) (*Info, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+type record map[string]string
+
+func (r record) int(key string) int {
+	value := r[key]
+	var n int64
+	if strings.HasPrefix(value, "0x") {
+		n, _ = strconv.ParseInt(value[2:], 16, 64)
+	} else {
+		n, _ = strconv.ParseInt(value, 10, 64)
+	}
+	return int(n)
+}
+
+// Parse reads the debug info format, see https://cc65.github.io/doc/debugging.html
+func Parse(reader io.Reader) (*Info, error) {
+	type span struct{ seg, start, size int }
+	type sourceLine struct {
+		file, line int
+		spans      []int
+	}
+	files := map[int]string{}
+	segments := map[int]int{} // segment id -> start address
+	spans := map[int]span{}
+	var lines []sourceLine
+	var symbols []record
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := scanner.Text()
+		tab := strings.IndexAny(text, "\t ")
+		if tab < 0 {
+			continue
+		}
+		kind := text[:tab]
+		r, err := parseRecord(text[tab+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		switch kind {
+		case "file":
+			files[r.int("id")] = r["name"]
+		case "seg":
+			segments[r.int("id")] = r.int("start")
+		case "span":
+			spans[r.int("id")] = span{seg: r.int("seg"), start: r.int("start"), size: r.int("size")}
+		case "line":
+			if r["span"] == "" {
+				continue
+			}
+			l := sourceLine{file: r.int("file"), line: r.int("line")}
+			for _, id := range strings.Split(r["span"], "+") {
+				n, _ := strconv.Atoi(id)
+				l.spans = append(l.spans, n)
+			}
+			lines = append(lines, l)
+		case "sym":
+			if r["type"] == "lab" && r["val"] != "" {
+				symbols = append(symbols, r)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	info := &Info{Files: files}
+	for _, l := range lines {
+		for _, id := range l.spans {
+			s, ok := spans[id]
+			if !ok {
+				continue
+			}
+			info.Lines = append(info.Lines, Line{
+				File:    files[l.file],
+				Line:    l.line,
+				Address: uint16(segments[s.seg] + s.start),
+				Size:    s.size,
+			})
+		}
+	}
+	sort.SliceStable(info.Lines, func(i, j int) bool { return info.Lines[i].Address < info.Lines[j].Address })
+	for _, s := range symbols {
+		info.Symbols = append(info.Symbols, Symbol{Name: s["name"], Address: uint16(s.int("val"))})
+	}
+	sort.SliceStable(info.Symbols, func(i, j int) bool { return info.Symbols[i].Address < info.Symbols[j].Address })
+	return info, nil
+}
+
+// parseRecord splits key=value pairs separated by commas, values can be quoted strings
+func parseRecord(text string) (record, error) {
+	r := record{}
+	for len(text) > 0 {
+		eq := strings.IndexByte(text, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("expected key=value in %q", text)
+		}
+		key := text[:eq]
+		text = text[eq+1:]
+		var value string
+		if strings.HasPrefix(text, "\"") {
+			end := strings.IndexByte(text[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in %q", text)
+			}
+			value = text[1 : end+1]
+			text = text[end+2:]
+		} else {
+			end := strings.IndexByte(text, ',')
+			if end < 0 {
+				end = len(text)
+			}
+			value = text[:end]
+			text = text[end:]
+		}
+		r[key] = value
+		text = strings.TrimPrefix(text, ",")
+	}
+	return r, nil
+}
+
+// AddressesForLine returns start addresses of the code produced by a source line.
+// The path matches files recorded by the assembler by their base name if the full path does not match.
+func (i *Info) AddressesForLine(path string, line int) []uint16 {
+	var result []uint16
+	for _, l := range i.Lines {
+		if l.Line == line && sameFile(l.File, path) {
+			result = append(result, l.Address)
+		}
+	}
+	return result
+}
+
+// LineForAddress returns the source line that produced the byte at address
+func (i *Info) LineForAddress(address uint16) (Line, bool) {
+	// several lines can cover the same address (e.g. macro invocations), the innermost one is the last
+	var found Line
+	ok := false
+	for _, l := range i.Lines {
+		if l.Address > address {
+			break
+		}
+		if int(address) < int(l.Address)+l.Size {
+			found = l
+			ok = true
+		}
+	}
+	return found, ok
+}
+
+// SymbolForAddress returns the closest label at or below the address
+func (i *Info) SymbolForAddress(address uint16) (Symbol, bool) {
+	index := sort.Search(len(i.Symbols), func(n int) bool { return i.Symbols[n].Address > address })
+	if index == 0 {
+		return Symbol{}, false
+	}
+	return i.Symbols[index-1], true
+}
+
+func sameFile(recorded, path string) bool {
+	if recorded == path {
+		return true
+	}
+	if filepath.IsAbs(recorded) {
+		return filepath.Clean(recorded) == filepath.Clean(path)
+	}
+	return strings.HasSuffix(filepath.ToSlash(path), "/"+filepath.ToSlash(recorded)) || filepath.Base(recorded) == filepath.Base(path)
+}
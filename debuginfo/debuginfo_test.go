@@ -0,0 +1,26 @@
+package debuginfo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	info, err := Load("testdata/hello.dbg")
+	require.NoError(t, err)
+
+	assert.Equal(t, []uint16{0x0403}, info.AddressesForLine("/home/me/project/hello.s", 4))
+	assert.Empty(t, info.AddressesForLine("other.s", 4))
+
+	line, ok := info.LineForAddress(0x0407)
+	assert.True(t, ok)
+	assert.Equal(t, Line{File: "hello.s", Line: 5, Address: 0x0406, Size: 3}, line)
+	_, ok = info.LineForAddress(0x0500)
+	assert.False(t, ok)
+
+	symbol, ok := info.SymbolForAddress(0x0405)
+	assert.True(t, ok)
+	assert.Equal(t, "start", symbol.Name)
+}
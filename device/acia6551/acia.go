@@ -0,0 +1,246 @@
+package acia6551
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// Registers, selected by RS0-RS1
+const (
+	RegData    = 0x0 // read: receive data, write: transmit data
+	RegStatus  = 0x1 // write: programmed reset
+	RegCommand = 0x2
+	RegControl = 0x3
+)
+
+// Status register bits
+const (
+	StatusParity  = 1 << iota // parity error
+	StatusFraming             // framing error
+	StatusOverrun             // a character arrived while the previous one was still unread
+	StatusRDRF                // receive data register full
+	StatusTDRE                // transmit data register empty
+	StatusDCD                 // data carrier detect, 0 when a carrier is present
+	StatusDSR                 // data set ready, 0 when ready
+	StatusIRQ                 // interrupt occurred, cleared by reading the status
+)
+
+// Command register bits
+const (
+	CommandDTR        = 0x01 // data terminal ready: enables the receiver and interrupts
+	CommandRxIRQOff   = 0x02 // receiver interrupts disabled
+	CommandTxControl  = 0x0C // transmitter control, see TxOff...TxBreak
+	CommandEcho       = 0x10 // receiver echo, only with the transmitter off
+	CommandParity     = 0x20
+	CommandParityMode = 0xC0
+)
+
+// Transmitter control, bits 2-3 of the command register
+const (
+	TxOff   = 0x00 // RTS high, transmitter off
+	TxIRQ   = 0x04 // transmitter on, interrupt when the data register is empty
+	TxOn    = 0x08 // transmitter on, no interrupt
+	TxBreak = 0x0C // transmitter on sending a break, no interrupt
+)
+
+// baud rates selected by the low nibble of the control register, 0 is the 16x external clock,
+// taken to be the 1.8432 MHz crystal the internal rates derive from
+var baudRates = [16]float64{
+	115200, 50, 75, 109.92, 134.58, 150, 300, 600, 1200, 1800, 2400, 3600, 4800, 7200, 9600, 19200,
+}
+
+// ACIA is a MOS 6551 Asynchronous Communications Interface Adapter connected to a host serial line.
+// Characters take as many cpu cycles as the programmed baud rate and frame size imply: the receiver takes
+// at most one character from the host per character time and the transmitter sends one per character time.
+type ACIA struct {
+	irq       *cpu.InterruptPin
+	scheduler *scheduler.Scheduler
+	clock     float64 // cpu cycles per second
+	host      hostio.Serial
+	transmit  *scheduler.Event
+	state     state
+}
+
+// state is everything a save state needs
+type state struct {
+	Status, Command, Control byte
+	RxData                   byte
+	TxData                   byte // waiting in the transmit data register while TDRE is clear
+	Shifter                  byte // being sent
+	Shifting                 bool
+}
+
+// New creates an ACIA timed against a cpu running at clock Hz, irq may be nil when the IRQ output is not connected
+func New(irq *cpu.InterruptPin, s *scheduler.Scheduler, clock float64, host hostio.Serial) *ACIA {
+	a := &ACIA{irq: irq, scheduler: s, clock: clock, host: host}
+	a.Reset()
+	a.poll()
+	return a
+}
+
+// Reset is the hardware reset: the transmitter is idle and every register is cleared
+func (a *ACIA) Reset() {
+	if a.transmit != nil {
+		a.transmit.Cancel()
+		a.transmit = nil
+	}
+	a.state = state{Status: StatusTDRE}
+	a.updateIRQ()
+}
+
+func (a *ACIA) Read(address uint16) byte {
+	s := &a.state
+	switch address & 0x3 {
+	case RegData:
+		s.Status &^= StatusRDRF | StatusOverrun | StatusFraming | StatusParity
+		return s.RxData
+	case RegStatus:
+		status := s.Status
+		s.Status &^= StatusIRQ
+		a.updateIRQ()
+		return status
+	}
+	return a.Peek(address)
+}
+
+// Peek reads a register without clearing status bits
+func (a *ACIA) Peek(address uint16) byte {
+	s := &a.state
+	switch address & 0x3 {
+	case RegData:
+		return s.RxData
+	case RegStatus:
+		return s.Status
+	case RegCommand:
+		return s.Command
+	default:
+		return s.Control
+	}
+}
+
+func (a *ACIA) Write(address uint16, value byte) {
+	s := &a.state
+	switch address & 0x3 {
+	case RegData:
+		s.TxData = value
+		s.Status &^= StatusTDRE
+		a.startTransmit()
+	case RegStatus:
+		// programmed reset, parity settings and the control register are kept
+		s.Command &= CommandParity | CommandParityMode
+		s.Status &^= StatusOverrun
+	case RegCommand:
+		s.Command = value
+		if a.txIRQ() && s.Status&StatusTDRE != 0 {
+			s.Status |= StatusIRQ
+		}
+		a.startTransmit()
+	case RegControl:
+		s.Control = value
+	}
+	a.updateIRQ()
+}
+
+// CharacterCycles is the number of cpu cycles a character takes on the line with the current settings
+func (a *ACIA) CharacterCycles() uint64 {
+	s := &a.state
+	bits := 1 + 8 - int(s.Control>>5&0x3) + 1 // start, data, stop
+	if s.Command&CommandParity != 0 {
+		bits++
+	}
+	if s.Control&0x80 != 0 {
+		bits++
+	}
+	cycles := uint64(a.clock * float64(bits) / baudRates[s.Control&0xF])
+	if cycles == 0 {
+		return 1
+	}
+	return cycles
+}
+
+// poll takes a character from the host every character time
+func (a *ACIA) poll() {
+	a.scheduler.After(a.CharacterCycles(), a.poll)
+	s := &a.state
+	if s.Command&CommandDTR == 0 {
+		return
+	}
+	b, ok := a.host.Poll()
+	if !ok {
+		return
+	}
+	if s.Status&StatusRDRF != 0 {
+		// the new character is lost
+		s.Status |= StatusOverrun
+	} else {
+		s.RxData = b
+		s.Status |= StatusRDRF
+	}
+	if s.Command&CommandEcho != 0 && s.Command&CommandTxControl == TxOff {
+		a.host.Write([]byte{b})
+	}
+	if s.Command&CommandRxIRQOff == 0 {
+		s.Status |= StatusIRQ
+	}
+	a.updateIRQ()
+}
+
+// startTransmit moves the data register into the idle shift register when the transmitter is on
+func (a *ACIA) startTransmit() {
+	s := &a.state
+	if s.Shifting || s.Status&StatusTDRE != 0 || s.Command&CommandTxControl == TxOff {
+		return
+	}
+	s.Shifter = s.TxData
+	s.Shifting = true
+	s.Status |= StatusTDRE
+	if a.txIRQ() {
+		s.Status |= StatusIRQ
+	}
+	a.transmit = a.scheduler.After(a.CharacterCycles(), a.sent)
+}
+
+func (a *ACIA) sent() {
+	a.transmit = nil
+	a.state.Shifting = false
+	a.host.Write([]byte{a.state.Shifter})
+	a.startTransmit()
+	a.updateIRQ()
+}
+
+func (a *ACIA) txIRQ() bool {
+	return a.state.Command&CommandTxControl == TxIRQ
+}
+
+func (a *ACIA) updateIRQ() {
+	a.irq.Set(a.IRQ())
+}
+
+// IRQ reports the level of the IRQ output, interrupts need DTR
+func (a *ACIA) IRQ() bool {
+	return a.state.Status&StatusIRQ != 0 && a.state.Command&CommandDTR != 0
+}
+
+// SaveState implements memory.Stateful
+func (a *ACIA) SaveState() ([]byte, error) {
+	return json.Marshal(a.state)
+}
+
+// LoadState implements memory.Stateful, a character being sent is restarted
+func (a *ACIA) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &a.state); err != nil {
+		return err
+	}
+	if a.transmit != nil {
+		a.transmit.Cancel()
+		a.transmit = nil
+	}
+	if a.state.Shifting {
+		a.transmit = a.scheduler.After(a.CharacterCycles(), a.sent)
+	}
+	a.updateIRQ()
+	return nil
+}
@@ -0,0 +1,111 @@
+package acia6551
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fixture struct {
+	acia   *ACIA
+	cpu    *cpu.Cpu
+	sched  *scheduler.Scheduler
+	output *bytes.Buffer
+}
+
+// an ACIA at 1 MHz, 9600 baud 8N1: a character takes 1041 cycles
+func newACIA(input string) fixture {
+	c := cpu.NewCpu(nil, memory.NewRAM(0x10000))
+	s := scheduler.New(&c)
+	output := &bytes.Buffer{}
+	a := New(c.IRQLine().Pin(), s, 1e6, hostio.NewSerial(hostio.NewBytesInput([]byte(input)), output))
+	a.Write(RegControl, 0x1E)
+	return fixture{a, &c, s, output}
+}
+
+func (f fixture) run(cycles uint64) {
+	f.cpu.Cycles += cycles
+	f.sched.Sync()
+}
+
+func TestACIA_transmit(t *testing.T) {
+	f := newACIA("")
+	f.acia.Write(RegCommand, CommandDTR|TxOn|CommandRxIRQOff)
+	assert.Equal(t, uint64(1041), f.acia.CharacterCycles())
+
+	f.acia.Write(RegData, 'H')
+	assert.NotZero(t, f.acia.Read(RegStatus)&StatusTDRE, "moved to the shift register at once")
+	f.acia.Write(RegData, 'i')
+	assert.Zero(t, f.acia.Read(RegStatus)&StatusTDRE, "waits for the first character")
+
+	f.run(1040)
+	assert.Equal(t, "", f.output.String())
+	f.run(1)
+	assert.Equal(t, "H", f.output.String())
+	assert.NotZero(t, f.acia.Read(RegStatus)&StatusTDRE)
+	f.run(1041)
+	assert.Equal(t, "Hi", f.output.String())
+	assert.False(t, f.cpu.IRQLine().Active())
+}
+
+func TestACIA_transmitInterrupt(t *testing.T) {
+	f := newACIA("")
+	f.acia.Write(RegCommand, CommandDTR|TxIRQ|CommandRxIRQOff)
+	assert.True(t, f.cpu.IRQLine().Active(), "the data register is empty")
+	assert.Equal(t, byte(StatusIRQ|StatusTDRE), f.acia.Read(RegStatus))
+	assert.False(t, f.cpu.IRQLine().Active(), "reading the status acknowledges")
+
+	f.acia.Write(RegData, 'A')
+	assert.True(t, f.cpu.IRQLine().Active())
+}
+
+func TestACIA_receive(t *testing.T) {
+	f := newACIA("ab")
+	f.acia.Write(RegCommand, CommandDTR|TxOn)
+
+	f.run(1041)
+	assert.True(t, f.cpu.IRQLine().Active())
+	assert.Equal(t, byte(StatusIRQ|StatusTDRE|StatusRDRF), f.acia.Peek(RegStatus))
+	assert.Equal(t, byte(StatusIRQ|StatusTDRE|StatusRDRF), f.acia.Peek(RegStatus), "peeking has no side effects")
+	f.acia.Read(RegStatus)
+	assert.Equal(t, byte('a'), f.acia.Read(RegData))
+	assert.Zero(t, f.acia.Read(RegStatus)&StatusRDRF)
+
+	f.run(2 * 1041)
+	assert.Equal(t, byte(StatusIRQ|StatusTDRE|StatusRDRF), f.acia.Read(RegStatus))
+	assert.Equal(t, byte('b'), f.acia.Read(RegData))
+}
+
+func TestACIA_overrun(t *testing.T) {
+	f := newACIA("xy")
+	f.acia.Write(RegCommand, CommandDTR|TxOn|CommandRxIRQOff)
+	f.run(3 * 1041)
+	assert.Equal(t, byte(StatusTDRE|StatusRDRF|StatusOverrun), f.acia.Read(RegStatus))
+	assert.Equal(t, byte('x'), f.acia.Read(RegData), "the second character is lost")
+	assert.Equal(t, byte(StatusTDRE), f.acia.Read(RegStatus))
+}
+
+func TestACIA_receiverDisabledWithoutDTR(t *testing.T) {
+	f := newACIA("x")
+	f.run(5000)
+	assert.Zero(t, f.acia.Read(RegStatus)&StatusRDRF)
+
+	f.acia.Write(RegCommand, CommandEcho|CommandDTR)
+	f.run(1041)
+	assert.Equal(t, byte('x'), f.acia.Read(RegData))
+	assert.Equal(t, "x", f.output.String(), "echo")
+}
+
+func TestACIA_programmedReset(t *testing.T) {
+	f := newACIA("")
+	f.acia.Write(RegCommand, 0xEB)
+	f.acia.Write(RegStatus, 0)
+	assert.Equal(t, byte(0xE0), f.acia.Read(RegCommand))
+	assert.Equal(t, byte(0x1E), f.acia.Read(RegControl))
+}
@@ -0,0 +1,22 @@
+package acia6551
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("acia6551", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		options := struct {
+			Host string // see hostio.Open
+		}{Host: "stdio"}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		host, err := m.OpenHost(config, options.Host)
+		if err != nil {
+			return nil, err
+		}
+		return New(m.Pin(config), m.Scheduler, m.ClockOr(1e6), host), nil
+	})
+}
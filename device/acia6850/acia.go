@@ -0,0 +1,238 @@
+package acia6850
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// Registers, selected by RS
+const (
+	RegControl = 0x0 // read: status, write: control
+	RegData    = 0x1 // read: receive data, write: transmit data
+)
+
+// Status register bits
+const (
+	StatusRDRF    = 1 << iota // receive data register full
+	StatusTDRE                // transmit data register empty
+	StatusDCD                 // loss of carrier
+	StatusCTS                 // clear to send is high, the transmitter is inhibited
+	StatusFraming             // framing error
+	StatusOverrun             // a character arrived while the previous one was still unread
+	StatusParity              // parity error
+	StatusIRQ                 // the IRQ output is active
+)
+
+// Control register fields
+const (
+	ControlDivide    = 0x03 // counter divide select, see Divide1...MasterReset
+	ControlWord      = 0x1C // word length, parity and stop bits
+	ControlTxControl = 0x60 // transmitter control, see TxRTS...TxBreak
+	ControlRxIRQ     = 0x80 // receive interrupt enable
+)
+
+// Counter divide select, bits 0-1 of the control register
+const (
+	Divide1     = 0x00
+	Divide16    = 0x01
+	Divide64    = 0x02
+	MasterReset = 0x03
+)
+
+// Transmitter control, bits 5-6 of the control register
+const (
+	TxRTS   = 0x00 // RTS low, transmit interrupt disabled
+	TxIRQ   = 0x20 // RTS low, transmit interrupt enabled
+	TxNoRTS = 0x40 // RTS high, transmit interrupt disabled
+	TxBreak = 0x60 // RTS low, sending a break, transmit interrupt disabled
+)
+
+// bits in a character for each word select value: start, data, parity and stop bits
+var wordBits = [8]int{
+	1 + 7 + 1 + 2, 1 + 7 + 1 + 2, 1 + 7 + 1 + 1, 1 + 7 + 1 + 1,
+	1 + 8 + 2, 1 + 8 + 1, 1 + 8 + 1 + 1, 1 + 8 + 1 + 1,
+}
+
+// ACIA is a Motorola 6850 Asynchronous Communications Interface Adapter connected to a host serial line.
+// The transmit and receive clock input runs at rxtxClock Hz and is divided by 1, 16 or 64, characters take
+// as many cpu cycles as that rate and the word format imply. After power on the chip needs a master reset.
+type ACIA struct {
+	irq       *cpu.InterruptPin
+	scheduler *scheduler.Scheduler
+	cycles    float64 // cpu cycles per period of the transmit and receive clock
+	host      hostio.Serial
+	transmit  *scheduler.Event
+	state     state
+}
+
+// state is everything a save state needs
+type state struct {
+	Status, Control byte
+	RxData          byte
+	TxData          byte // waiting in the transmit data register while TDRE is clear
+	Shifter         byte // being sent
+	Shifting        bool
+	Reset           bool // held in master reset
+}
+
+// New creates an ACIA for a cpu running at clock Hz, irq may be nil when the IRQ output is not connected
+func New(irq *cpu.InterruptPin, s *scheduler.Scheduler, clock, rxtxClock float64, host hostio.Serial) *ACIA {
+	a := &ACIA{irq: irq, scheduler: s, cycles: clock / rxtxClock, host: host}
+	a.Reset()
+	a.poll()
+	return a
+}
+
+// Reset is the power on state: held in master reset until the control register is written
+func (a *ACIA) Reset() {
+	a.state = state{Control: MasterReset}
+	a.masterReset()
+}
+
+func (a *ACIA) masterReset() {
+	if a.transmit != nil {
+		a.transmit.Cancel()
+		a.transmit = nil
+	}
+	s := &a.state
+	s.Reset = true
+	s.Shifting = false
+	s.Status = 0
+	a.updateIRQ()
+}
+
+func (a *ACIA) Read(address uint16) byte {
+	if address&1 == RegData {
+		a.state.Status &^= StatusRDRF | StatusOverrun | StatusFraming | StatusParity
+		a.updateIRQ()
+	}
+	return a.Peek(address)
+}
+
+// Peek reads a register without clearing status bits
+func (a *ACIA) Peek(address uint16) byte {
+	if address&1 == RegData {
+		return a.state.RxData
+	}
+	return a.state.Status
+}
+
+func (a *ACIA) Write(address uint16, value byte) {
+	s := &a.state
+	if address&1 == RegData {
+		s.TxData = value
+		s.Status &^= StatusTDRE
+		a.startTransmit()
+		a.updateIRQ()
+		return
+	}
+	s.Control = value
+	if value&ControlDivide == MasterReset {
+		a.masterReset()
+		return
+	}
+	if s.Reset {
+		s.Reset = false
+		s.Status |= StatusTDRE
+	}
+	a.updateIRQ()
+}
+
+// CharacterCycles is the number of cpu cycles a character takes on the line with the current settings
+func (a *ACIA) CharacterCycles() uint64 {
+	divide := 1
+	switch a.state.Control & ControlDivide {
+	case Divide16:
+		divide = 16
+	case Divide64:
+		divide = 64
+	}
+	cycles := uint64(a.cycles * float64(divide*wordBits[a.state.Control&ControlWord>>2]))
+	if cycles == 0 {
+		return 1
+	}
+	return cycles
+}
+
+// poll takes a character from the host every character time
+func (a *ACIA) poll() {
+	a.scheduler.After(a.CharacterCycles(), a.poll)
+	s := &a.state
+	if s.Reset {
+		return
+	}
+	b, ok := a.host.Poll()
+	if !ok {
+		return
+	}
+	if s.Status&StatusRDRF != 0 {
+		// the new character is lost
+		s.Status |= StatusOverrun
+	} else {
+		s.RxData = b
+		s.Status |= StatusRDRF
+	}
+	a.updateIRQ()
+}
+
+// startTransmit moves the data register into the idle shift register
+func (a *ACIA) startTransmit() {
+	s := &a.state
+	if s.Reset || s.Shifting || s.Status&StatusTDRE != 0 {
+		return
+	}
+	s.Shifter = s.TxData
+	s.Shifting = true
+	s.Status |= StatusTDRE
+	a.transmit = a.scheduler.After(a.CharacterCycles(), a.sent)
+}
+
+func (a *ACIA) sent() {
+	a.transmit = nil
+	a.state.Shifting = false
+	a.host.Write([]byte{a.state.Shifter})
+	a.startTransmit()
+	a.updateIRQ()
+}
+
+// updateIRQ follows the interrupt conditions: the IRQ status bit and output are levels, not latched
+func (a *ACIA) updateIRQ() {
+	s := &a.state
+	rx := s.Control&ControlRxIRQ != 0 && s.Status&(StatusRDRF|StatusOverrun|StatusDCD) != 0
+	tx := s.Control&ControlTxControl == TxIRQ && s.Status&StatusTDRE != 0
+	if (rx || tx) && !s.Reset {
+		s.Status |= StatusIRQ
+	} else {
+		s.Status &^= StatusIRQ
+	}
+	a.irq.Set(a.IRQ())
+}
+
+// IRQ reports the level of the IRQ output
+func (a *ACIA) IRQ() bool {
+	return a.state.Status&StatusIRQ != 0
+}
+
+// SaveState implements memory.Stateful
+func (a *ACIA) SaveState() ([]byte, error) {
+	return json.Marshal(a.state)
+}
+
+// LoadState implements memory.Stateful, a character being sent is restarted
+func (a *ACIA) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &a.state); err != nil {
+		return err
+	}
+	if a.transmit != nil {
+		a.transmit.Cancel()
+		a.transmit = nil
+	}
+	if a.state.Shifting {
+		a.transmit = a.scheduler.After(a.CharacterCycles(), a.sent)
+	}
+	a.updateIRQ()
+	return nil
+}
@@ -0,0 +1,84 @@
+package acia6850
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fixture struct {
+	acia   *ACIA
+	cpu    *cpu.Cpu
+	sched  *scheduler.Scheduler
+	output *bytes.Buffer
+}
+
+// an ACIA clocked at 1.8432 MHz next to a 1.8432 MHz cpu, so a bit at ÷16 takes 16 cycles
+func newACIA(input string) fixture {
+	c := cpu.NewCpu(nil, memory.NewRAM(0x10000))
+	s := scheduler.New(&c)
+	output := &bytes.Buffer{}
+	a := New(c.IRQLine().Pin(), s, 1.8432e6, 1.8432e6, hostio.NewSerial(hostio.NewBytesInput([]byte(input)), output))
+	return fixture{a, &c, s, output}
+}
+
+func (f fixture) run(cycles uint64) {
+	f.cpu.Cycles += cycles
+	f.sched.Sync()
+}
+
+func TestACIA_masterReset(t *testing.T) {
+	f := newACIA("x")
+	f.run(10000)
+	assert.Equal(t, byte(0), f.acia.Read(RegControl), "held in reset after power on")
+	f.acia.Write(RegData, 'A')
+	f.run(10000)
+	assert.Empty(t, f.output.String())
+
+	f.acia.Write(RegControl, Divide16|0x14) // 8N1
+	assert.Equal(t, byte(StatusTDRE), f.acia.Read(RegControl))
+	assert.Equal(t, uint64(160), f.acia.CharacterCycles())
+}
+
+func TestACIA_transmit(t *testing.T) {
+	f := newACIA("")
+	f.acia.Write(RegControl, MasterReset)
+	f.acia.Write(RegControl, Divide16|0x14|TxIRQ)
+	assert.True(t, f.cpu.IRQLine().Active(), "the transmit data register is empty")
+
+	f.acia.Write(RegData, 'O')
+	f.acia.Write(RegData, 'K')
+	assert.Equal(t, byte(0), f.acia.Read(RegControl), "the second character waits")
+	assert.False(t, f.cpu.IRQLine().Active())
+	f.run(159)
+	assert.Empty(t, f.output.String())
+	f.run(1)
+	assert.Equal(t, "O", f.output.String())
+	assert.Equal(t, byte(StatusIRQ|StatusTDRE), f.acia.Read(RegControl))
+	f.run(160)
+	assert.Equal(t, "OK", f.output.String())
+}
+
+func TestACIA_receive(t *testing.T) {
+	f := newACIA("abc")
+	f.acia.Write(RegControl, MasterReset)
+	f.acia.Write(RegControl, Divide64|0x14|ControlRxIRQ)
+	assert.Equal(t, uint64(640), f.acia.CharacterCycles())
+
+	f.run(640)
+	assert.True(t, f.cpu.IRQLine().Active())
+	assert.Equal(t, byte(StatusIRQ|StatusTDRE|StatusRDRF), f.acia.Peek(RegControl))
+	assert.Equal(t, byte('a'), f.acia.Read(RegData))
+	assert.False(t, f.cpu.IRQLine().Active(), "reading the data clears the interrupt")
+
+	f.run(2 * 640)
+	assert.Equal(t, byte(StatusIRQ|StatusTDRE|StatusRDRF|StatusOverrun), f.acia.Read(RegControl))
+	assert.Equal(t, byte('b'), f.acia.Read(RegData), "the third character is lost")
+	assert.Equal(t, byte(StatusTDRE), f.acia.Read(RegControl))
+}
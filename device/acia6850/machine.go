@@ -0,0 +1,28 @@
+package acia6850
+
+import (
+	"fmt"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("acia6850", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		options := struct {
+			Host  string            // see hostio.Open
+			Clock machine.Frequency // transmit and receive clock input
+		}{Host: "stdio", Clock: 1.8432e6}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		if options.Clock <= 0 {
+			return nil, fmt.Errorf("clock must be positive")
+		}
+		host, err := m.OpenHost(config, options.Host)
+		if err != nil {
+			return nil, err
+		}
+		return New(m.Pin(config), m.Scheduler, m.ClockOr(1e6), float64(options.Clock), host), nil
+	})
+}
@@ -0,0 +1,78 @@
+package apple1
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/pia6821"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerminal_keys(t *testing.T) {
+	terminal := NewTerminal(hostio.NewSerial(hostio.NewBytesInput([]byte("a\r\nZ\x7f\n")), nil), nil, 1e6, 0)
+	var keys []byte
+	for {
+		key, ok := terminal.Key()
+		if !ok {
+			break
+		}
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []byte{0xC1, 0x8D, 0xDA, 0xDF, 0x8D}, keys)
+}
+
+func TestPIA(t *testing.T) {
+	c := cpu.NewCpu(nil, memory.NewRAM(0x10000))
+	s := scheduler.New(&c)
+	output := &bytes.Buffer{}
+	host := hostio.NewSerial(hostio.NewBytesInput([]byte("r")), output)
+	p := pia6821.New(nil, nil)
+	s.AddTicker(p)
+	a := NewPIA(p, NewTerminal(host, s, 1000, 10), s)
+	a.Write(RegDSP, 0x7F)
+	a.Write(RegKBDCR, 0xA7)
+	a.Write(RegDSPCR, 0xA7)
+
+	assert.Equal(t, byte(0x27), a.Peek(RegKBDCR))
+	c.Cycles += keyboardPoll
+	s.Sync()
+	assert.Equal(t, byte(0xA7), a.Peek(RegKBDCR), "key strobe on CA1")
+	assert.Equal(t, byte(0xD2), a.Read(RegKBD))
+	assert.Equal(t, byte(0x27), a.Read(RegKBDCR))
+
+	a.Write(RegDSP, 0xC8)
+	assert.Equal(t, byte(0x80), a.Read(RegDSP)&0x80, "busy for a character time")
+	c.Cycles += 100
+	s.Sync()
+	assert.Equal(t, byte(0), a.Read(RegDSP)&0x80)
+	a.Write(RegDSP, 0x8D)
+	assert.Equal(t, "H\r\n", output.String())
+}
+
+func TestPIA_saveState(t *testing.T) {
+	c := cpu.NewCpu(nil, memory.NewRAM(0x10000))
+	s := scheduler.New(&c)
+	p := pia6821.New(nil, nil)
+	s.AddTicker(p)
+	a := NewPIA(p, NewTerminal(hostio.NewSerial(hostio.NewBytesInput(nil), &bytes.Buffer{}), s, 1000, 10), s)
+	a.Write(RegDSP, 0x7F)
+	a.Write(RegDSPCR, 0xA7)
+	a.Write(RegDSP, 0xC8)
+	saved, err := a.SaveState()
+	assert.NoError(t, err)
+
+	c.Cycles += 100
+	s.Sync()
+	assert.False(t, a.Terminal.Busy())
+	assert.NoError(t, a.LoadState(saved))
+	assert.True(t, a.Terminal.Busy())
+	assert.Equal(t, byte(0x80), a.Read(RegDSP)&0x80, "busy again")
+	c.Cycles += 100
+	s.Sync()
+	assert.Equal(t, byte(0), a.Read(RegDSP)&0x80, "the restored character finished")
+}
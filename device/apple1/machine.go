@@ -0,0 +1,26 @@
+package apple1
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/device/pia6821"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("apple1-pia", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		options := struct {
+			Host string  // see hostio.Open
+			Rate float64 // displayed characters per second, 0 for no delay
+		}{Host: "stdio", Rate: 60}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		host, err := m.OpenHost(config, options.Host)
+		if err != nil {
+			return nil, err
+		}
+		p := pia6821.New(m.Pin(config), m.Pin(config))
+		m.Scheduler.AddTicker(p)
+		return NewPIA(p, NewTerminal(host, m.Scheduler, m.ClockOr(1e6), options.Rate), m.Scheduler), nil
+	})
+}
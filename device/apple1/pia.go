@@ -0,0 +1,86 @@
+package apple1
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/pia6821"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// Registers of the PIA as the Woz Monitor names them
+const (
+	RegKBD   = pia6821.RegPRA // keyboard data, bit 7 always set
+	RegKBDCR = pia6821.RegCRA // keyboard control, bit 7 set while a key is waiting
+	RegDSP   = pia6821.RegPRB // display data, bit 7 set while the display is busy
+	RegDSPCR = pia6821.RegCRB
+)
+
+// keyboardPoll is how often the host keyboard is looked at, in cpu cycles
+const keyboardPoll = 1000
+
+// PIA is the 6821 of the Apple-1 wired to the terminal: the keyboard drives port A and strobes CA1,
+// the display takes PB0-PB6 when CB2 goes low after a write, signals busy on PB7 and acknowledges on CB1.
+type PIA struct {
+	*pia6821.PIA
+	Terminal *Terminal
+}
+
+// NewPIA connects the terminal to the PIA
+func NewPIA(p *pia6821.PIA, terminal *Terminal, s *scheduler.Scheduler) *PIA {
+	a := &PIA{PIA: p, Terminal: terminal}
+	p.PortB.Set(0x00)
+	p.OnCB2 = func(level bool) {
+		if level {
+			return
+		}
+		p.PortB.Set(0x80)
+		terminal.Display(p.PortB.Output())
+	}
+	terminal.OnReady = func() {
+		p.PortB.Set(0x00)
+		p.SetCB1(false)
+		p.SetCB1(true)
+	}
+	var poll func()
+	poll = func() {
+		s.After(keyboardPoll, poll)
+		if p.Peek(RegKBDCR)&pia6821.ControlIRQ1 != 0 {
+			// the last key has not been read yet
+			return
+		}
+		if key, ok := terminal.Key(); ok {
+			p.PortA.Set(key)
+			p.SetCA1(false)
+			p.SetCA1(true)
+		}
+	}
+	s.After(keyboardPoll, poll)
+	return a
+}
+
+type piaState struct {
+	PIA  json.RawMessage
+	Busy bool // the display is taking a character
+}
+
+// SaveState implements memory.Stateful, it keeps the PIA and whether the display is busy
+func (a *PIA) SaveState() ([]byte, error) {
+	p, err := a.PIA.SaveState()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(piaState{PIA: p, Busy: a.Terminal.Busy()})
+}
+
+// LoadState implements memory.Stateful, a character being displayed is restarted
+func (a *PIA) LoadState(data []byte) error {
+	var s piaState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if err := a.PIA.LoadState(s.PIA); err != nil {
+		return err
+	}
+	a.Terminal.restart(s.Busy)
+	return nil
+}
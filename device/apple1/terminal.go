@@ -0,0 +1,103 @@
+package apple1
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// Terminal is the Apple-1 video terminal and ASCII keyboard bridged to a host serial line.
+// Keys are sent upper case with bit 7 set, Return as CR and Backspace/Delete as "_", the WozMon rub out.
+// The display takes 7 bit characters, shows the upper case set only and accepts one character per
+// character time, 60 per second on the original.
+type Terminal struct {
+	Host hostio.Serial
+	// OnReady is told when the display can take the next character
+	OnReady func()
+
+	scheduler *scheduler.Scheduler
+	cycles    uint64 // cpu cycles per displayed character
+	busy      bool
+	pending   *scheduler.Event // the end of the character time while busy
+	afterCR   bool
+}
+
+// NewTerminal creates a terminal for a cpu running at clock Hz displaying rate characters per second,
+// a rate of 0 displays immediately
+func NewTerminal(host hostio.Serial, s *scheduler.Scheduler, clock, rate float64) *Terminal {
+	t := &Terminal{Host: host, scheduler: s}
+	if rate > 0 {
+		t.cycles = uint64(clock / rate)
+	}
+	return t
+}
+
+// Key returns the next key typed on the host
+func (t *Terminal) Key() (byte, bool) {
+	for {
+		b, ok := t.Host.Poll()
+		if !ok {
+			return 0, false
+		}
+		afterCR := t.afterCR
+		t.afterCR = b == '\r'
+		switch {
+		case b == '\n' && afterCR:
+			// CR LF from a terminal is a single Return
+			continue
+		case b == '\n' || b == '\r':
+			return 0x8D, true
+		case b == 0x08 || b == 0x7F:
+			return '_' | 0x80, true
+		case b >= 'a' && b <= 'z':
+			return (b - 'a' + 'A') | 0x80, true
+		default:
+			return b | 0x80, true
+		}
+	}
+}
+
+// Busy reports whether the display is still taking the last character
+func (t *Terminal) Busy() bool {
+	return t.busy
+}
+
+// Display shows a character
+func (t *Terminal) Display(b byte) {
+	b &= 0x7F
+	switch {
+	case b == '\r':
+		t.Host.Write([]byte("\r\n"))
+	case b >= 0x60 && b < 0x7F:
+		t.Host.Write([]byte{b - 0x20})
+	case b >= 0x20 && b < 0x60:
+		t.Host.Write([]byte{b})
+	default:
+		// control characters are ignored
+	}
+	if t.cycles == 0 {
+		t.ready()
+		return
+	}
+	t.busy = true
+	t.pending = t.scheduler.After(t.cycles, t.ready)
+}
+
+// restart sets whether the display is busy, a character it is taking gets a whole character time
+func (t *Terminal) restart(busy bool) {
+	if t.pending != nil {
+		t.pending.Cancel()
+		t.pending = nil
+	}
+	t.busy = busy
+	if busy {
+		t.pending = t.scheduler.After(t.cycles, t.ready)
+	}
+}
+
+func (t *Terminal) ready() {
+	t.busy = false
+	t.pending = nil
+	if t.OnReady != nil {
+		t.OnReady()
+	}
+}
@@ -0,0 +1,121 @@
+package atari2600
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/riot"
+)
+
+// Console switches on RIOT port B, a set bit is a switch in its rest position
+const (
+	SwitchReset  = 0x01
+	SwitchSelect = 0x02
+	SwitchColor  = 0x08 // colour rather than black and white
+	// SwitchesIdle leaves reset and select released, colour on and both difficulties at B
+	SwitchesIdle = SwitchReset | SwitchSelect | SwitchColor
+)
+
+// Atari2600 is the bus of an Atari 2600 mapped over the whole address space. The 6507 drives only A0-A12,
+// so everything repeats every 8K: A12 selects the cartridge, otherwise A7 low selects the TIA and A7 high the
+// RIOT, whose RAM is selected with A9 low and registers with A9 high. The RIOT ports read the joysticks
+// (port A, all released) and the console switches (port B).
+type Atari2600 struct {
+	TIA       *TIA
+	RIOT      *riot.RIOT
+	Cartridge *Cartridge
+}
+
+// New wires the chips to the bus, the RIOT has to be ticked by the caller
+func New(tia *TIA, r *riot.RIOT, cartridge *Cartridge) *Atari2600 {
+	r.PortA.Set(0xFF)
+	r.PortB.Set(SwitchesIdle)
+	return &Atari2600{TIA: tia, RIOT: r, Cartridge: cartridge}
+}
+
+func (a *Atari2600) Read(address uint16) byte {
+	address &= 0x1FFF
+	switch {
+	case address&0x1000 != 0:
+		return a.Cartridge.Read(address)
+	case address&0x0080 == 0:
+		return a.TIA.Read(address)
+	case address&0x0200 == 0:
+		return a.RIOT.RAM().Read(address & 0x7F)
+	default:
+		return a.RIOT.Read(address & 0x1F)
+	}
+}
+
+// Peek implements memory.Peeker, the cartridge does not switch banks and the RIOT flags are not cleared
+func (a *Atari2600) Peek(address uint16) byte {
+	address &= 0x1FFF
+	switch {
+	case address&0x1000 != 0:
+		return a.Cartridge.Peek(address)
+	case address&0x0080 == 0:
+		return a.TIA.Peek(address)
+	case address&0x0200 == 0:
+		return a.RIOT.RAM().Read(address & 0x7F)
+	default:
+		return a.RIOT.Peek(address & 0x1F)
+	}
+}
+
+func (a *Atari2600) Write(address uint16, value byte) {
+	address &= 0x1FFF
+	switch {
+	case address&0x1000 != 0:
+		a.Cartridge.Write(address, value)
+	case address&0x0080 == 0:
+		a.TIA.Write(address, value)
+	case address&0x0200 == 0:
+		a.RIOT.RAM().Write(address&0x7F, value)
+	default:
+		a.RIOT.Write(address&0x1F, value)
+	}
+}
+
+// IsRAM implements memory.RAMMapper, the RIOT RAM
+func (a *Atari2600) IsRAM(address uint16) bool {
+	return address&0x1000 == 0 && address&0x0080 != 0 && address&0x0200 == 0
+}
+
+type atariState struct {
+	TIA, RIOT, RAM json.RawMessage
+	Slices         [4]int
+}
+
+// SaveState implements memory.Stateful, it keeps the chips, the RIOT RAM and the cartridge banks
+func (a *Atari2600) SaveState() ([]byte, error) {
+	var s atariState
+	var err error
+	if s.TIA, err = a.TIA.SaveState(); err != nil {
+		return nil, err
+	}
+	if s.RIOT, err = a.RIOT.SaveState(); err != nil {
+		return nil, err
+	}
+	if s.RAM, err = a.RIOT.RAM().SaveState(); err != nil {
+		return nil, err
+	}
+	s.Slices = a.Cartridge.slices
+	return json.Marshal(s)
+}
+
+func (a *Atari2600) LoadState(data []byte) error {
+	var s atariState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if err := a.TIA.LoadState(s.TIA); err != nil {
+		return err
+	}
+	if err := a.RIOT.LoadState(s.RIOT); err != nil {
+		return err
+	}
+	if err := a.RIOT.RAM().LoadState(s.RAM); err != nil {
+		return err
+	}
+	a.Cartridge.slices = s.Slices
+	return nil
+}
@@ -0,0 +1,172 @@
+package atari2600
+
+import (
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/asm"
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/riot"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAtari runs a 4K cartridge assembled at $F000
+func newAtari(t *testing.T, source string) (*Atari2600, *cpu.Cpu) {
+	program, err := asm.Assemble(source, 0xF000)
+	require.NoError(t, err)
+	_, image := program.Binary()
+	cartridge, err := NewCartridge(image, "")
+	require.NoError(t, err)
+
+	var a *Atari2600
+	bus := &bus{}
+	c := cpu.NewCpu(nil, bus)
+	s := scheduler.New(&c)
+	r := riot.NewRIOT(nil)
+	s.AddTicker(r)
+	a = New(NewTIA(&c), r, cartridge)
+	bus.atari = a
+	c.Reset()
+	return a, &c
+}
+
+// bus lets the cpu be created before the board that needs it
+type bus struct {
+	atari *Atari2600
+}
+
+func (b *bus) Read(address uint16) byte         { return b.atari.Read(address) }
+func (b *bus) Write(address uint16, value byte) { b.atari.Write(address, value) }
+
+const frameProgram = `
+VSYNC = $00
+WSYNC = $02
+COLUBK = $09
+PF1 = $0E
+COLUPF = $08
+        .org $F000
+start:  LDX #$FF
+        TXS
+frame:  LDA #2
+        STA VSYNC
+        STA WSYNC
+        STA WSYNC
+        STA WSYNC
+        LDA #0
+        STA VSYNC
+        LDA #$1E
+        STA COLUBK
+        LDA #$44
+        STA COLUPF
+        LDA #$80
+        STA PF1
+        LDX #100
+line:   STA WSYNC
+        DEX
+        BNE line
+        JMP frame
+        .org $FFFC
+        .word start, start
+`
+
+func TestTIA_frames(t *testing.T) {
+	a, c := newAtari(t, frameProgram)
+	var heights []int
+	var background, playfield [4]uint8
+	a.TIA.OnFrame = func(frame *image.RGBA) {
+		heights = append(heights, frame.Bounds().Dy())
+		rgba := frame.RGBAAt(100, 50)
+		background = [4]uint8{rgba.R, rgba.G, rgba.B, rgba.A}
+		rgba = frame.RGBAAt(17, 50)
+		playfield = [4]uint8{rgba.R, rgba.G, rgba.B, rgba.A}
+	}
+	syncs := 0
+	for len(heights) < 3 {
+		wsync := a.Peek(c.PC) == 0x85 && a.Peek(c.PC+1) == WSYNC
+		c.ExecuteOpcode()
+		if wsync {
+			syncs++
+			assert.Equal(t, uint64(0), c.Cycles%76, "the cpu resumes at the start of a line")
+		}
+	}
+	assert.Greater(t, syncs, 300)
+	assert.Equal(t, []int{100, 100}, heights[1:], "the line VSYNC ends on and the 99 lines after it")
+	assert.Equal(t, [4]uint8{0xFC, 0xFC, 0x68, 0xFF}, background)
+	assert.Equal(t, [4]uint8{0xB0, 0x3C, 0x3C, 0xFF}, playfield, "PF1 bit 7 is pixels 16-19")
+}
+
+func TestAtari2600_bus(t *testing.T) {
+	a, _ := newAtari(t, `
+        .org $F000
+start:  JMP start
+        .org $FFFC
+        .word start, start
+`)
+	a.Write(0x0080, 0x12)
+	assert.Equal(t, byte(0x12), a.Read(0x0180), "the stack page reaches the RAM")
+	assert.Equal(t, byte(0x12), a.Read(0x2080), "13 address lines")
+	assert.Equal(t, byte(0x4C), a.Read(0xF000))
+	assert.Equal(t, byte(0x4C), a.Read(0x1000))
+	assert.Equal(t, byte(SwitchesIdle), a.Read(0x0282), "SWCHB")
+	assert.Equal(t, byte(0xFF), a.Read(0x0280), "SWCHA")
+	assert.Equal(t, byte(0x80), a.Read(0x000C), "INPT4")
+	a.TIA.Fire[0] = true
+	assert.Equal(t, byte(0x00), a.Read(0x003C), "INPT4 mirrored")
+}
+
+func TestCartridge_banks(t *testing.T) {
+	image := make([]byte, 0x2000)
+	for i := range image {
+		image[i] = byte(i / 0x400)
+	}
+	f8, err := NewCartridge(image, "")
+	require.NoError(t, err)
+	assert.Equal(t, SchemeF8, f8.Scheme())
+	assert.Equal(t, byte(4), f8.Read(0x1000), "starts in the last bank")
+	f8.Read(0x1FF8)
+	assert.Equal(t, byte(0), f8.Peek(0x1000))
+	f8.Write(0x1FF9, 0)
+	assert.Equal(t, byte(7), f8.Peek(0x1FFF))
+	f8.Peek(0x1FF8)
+	assert.Equal(t, 1, f8.Bank(), "peeking does not switch")
+
+	e0, err := NewCartridge(image, SchemeE0)
+	require.NoError(t, err)
+	e0.Read(0x1FE2)
+	e0.Read(0x1FEB)
+	e0.Read(0x1FF5)
+	assert.Equal(t, []byte{2, 3, 5, 7}, []byte{e0.Peek(0x1000), e0.Peek(0x1400), e0.Peek(0x1800), e0.Peek(0x1C00)})
+
+	_, err = NewCartridge(make([]byte, 0x3000), "")
+	assert.EqualError(t, err, "no bank switching scheme for a 12288 byte cartridge")
+	_, err = NewCartridge(image, SchemeF6)
+	assert.EqualError(t, err, "a f6 cartridge is 16384 bytes, the image has 8192")
+}
+
+func TestMachine_frames(t *testing.T) {
+	program, err := asm.Assemble(frameProgram, 0xF000)
+	require.NoError(t, err)
+	_, image := program.Binary()
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cartridge.bin"), image, 0o644))
+	config := `
+devices:
+  - {name: atari2600, type: atari2600, start: $0000, end: $FFFF, options: {cartridge: cartridge.bin, frames: frames}}
+`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "atari.yaml"), []byte(config), 0o644))
+
+	m, err := machine.Load(filepath.Join(dir, "atari.yaml"))
+	require.NoError(t, err)
+	frames := filepath.Join(dir, "frames")
+	assert.NoDirExists(t, frames, "created with the first frame")
+	for m.Cpu.Cycles < 100000 {
+		m.Cpu.ExecuteOpcode()
+	}
+	assert.FileExists(t, filepath.Join(frames, "frame-00001.png"))
+}
@@ -0,0 +1,155 @@
+package atari2600
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Bank switching schemes
+const (
+	Scheme2K = "2k" // 2K mirrored in the 4K cartridge space
+	Scheme4K = "4k"
+	SchemeF8 = "f8" // 8K, two 4K banks selected by accessing $1FF8-$1FF9
+	SchemeF6 = "f6" // 16K, four 4K banks selected by accessing $1FF6-$1FF9
+	SchemeF4 = "f4" // 32K, eight 4K banks selected by accessing $1FF4-$1FFB
+	SchemeE0 = "e0" // Parker Brothers 8K: the 1K slices at $1000, $1400 and $1800 selected by accessing $1FE0-$1FF7, the last 1K fixed at $1C00
+)
+
+// schemes maps the schemes to their image size
+var schemes = map[string]int{
+	Scheme2K: 0x0800,
+	Scheme4K: 0x1000,
+	SchemeF8: 0x2000,
+	SchemeF6: 0x4000,
+	SchemeF4: 0x8000,
+	SchemeE0: 0x2000,
+}
+
+// Schemes lists the supported bank switching schemes
+func Schemes() []string {
+	var names []string
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GuessScheme picks the scheme for an image from its size, 8K images are taken as F8
+func GuessScheme(size int) (string, error) {
+	switch size {
+	case 0x0800:
+		return Scheme2K, nil
+	case 0x1000:
+		return Scheme4K, nil
+	case 0x2000:
+		return SchemeF8, nil
+	case 0x4000:
+		return SchemeF6, nil
+	case 0x8000:
+		return SchemeF4, nil
+	}
+	return "", fmt.Errorf("no bank switching scheme for a %d byte cartridge", size)
+}
+
+// Cartridge is the ROM in the 4K at $1000-$1FFF with its bank switching hardware. Hotspots switch banks
+// when they are read or written.
+type Cartridge struct {
+	scheme string
+	image  []byte
+	// slices holds the offset into the image of each 1K of the cartridge space
+	slices [4]int
+}
+
+// NewCartridge creates a cartridge from its image, an empty scheme is guessed from the size
+func NewCartridge(image []byte, scheme string) (*Cartridge, error) {
+	if scheme == "" {
+		var err error
+		if scheme, err = GuessScheme(len(image)); err != nil {
+			return nil, err
+		}
+	}
+	size, ok := schemes[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown bank switching scheme %q, expected one of %s", scheme, strings.Join(Schemes(), ", "))
+	}
+	if len(image) != size {
+		return nil, fmt.Errorf("a %s cartridge is %d bytes, the image has %d", scheme, size, len(image))
+	}
+	c := &Cartridge{scheme: scheme, image: image}
+	c.Reset()
+	return c, nil
+}
+
+// Reset selects the banks the schemes start in: the last 4K bank, or the last four slices for E0
+func (c *Cartridge) Reset() {
+	switch c.scheme {
+	case Scheme2K:
+		c.slices = [4]int{0, 0x400, 0, 0x400}
+	case SchemeE0:
+		c.slices = [4]int{0x1000, 0x1400, 0x1800, 0x1C00}
+	default:
+		c.selectBank(len(c.image)/0x1000 - 1)
+	}
+}
+
+// Scheme returns the bank switching scheme
+func (c *Cartridge) Scheme() string {
+	return c.scheme
+}
+
+// Bank returns the 4K bank selected, for E0 the bank of the slice at $1000 in 1K units
+func (c *Cartridge) Bank() int {
+	if c.scheme == SchemeE0 {
+		return c.slices[0] / 0x400
+	}
+	return c.slices[0] / 0x1000
+}
+
+func (c *Cartridge) selectBank(bank int) {
+	for i := range c.slices {
+		c.slices[i] = bank*0x1000 + i*0x400
+	}
+}
+
+// access switches banks when a hotspot is accessed, address is the offset in the cartridge space
+func (c *Cartridge) access(address uint16) {
+	address &= 0x0FFF
+	switch c.scheme {
+	case SchemeF8:
+		if address >= 0xFF8 && address <= 0xFF9 {
+			c.selectBank(int(address - 0xFF8))
+		}
+	case SchemeF6:
+		if address >= 0xFF6 && address <= 0xFF9 {
+			c.selectBank(int(address - 0xFF6))
+		}
+	case SchemeF4:
+		if address >= 0xFF4 && address <= 0xFFB {
+			c.selectBank(int(address - 0xFF4))
+		}
+	case SchemeE0:
+		if address >= 0xFE0 && address <= 0xFF7 {
+			slice := (address - 0xFE0) / 8
+			c.slices[slice] = int(address&0x7) * 0x400
+		}
+	}
+}
+
+// Peek reads the cartridge without switching banks
+func (c *Cartridge) Peek(address uint16) byte {
+	address &= 0x0FFF
+	return c.image[c.slices[address>>10]+int(address&0x3FF)]
+}
+
+func (c *Cartridge) Read(address uint16) byte {
+	value := c.Peek(address)
+	c.access(address)
+	return value
+}
+
+// Write only reaches the hotspots, the cartridge is ROM
+func (c *Cartridge) Write(address uint16, value byte) {
+	c.access(address)
+}
@@ -0,0 +1,85 @@
+package atari2600
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/riot"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("atari2600", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		options := struct {
+			Cartridge string // the cartridge image
+			Scheme    string // bank switching, guessed from the image size when empty
+			Frames    string // directory the frames are written to as PNG images, none when empty
+			Every     int    // write every nth frame
+		}{Every: 1}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		if options.Cartridge == "" {
+			return nil, fmt.Errorf("no cartridge image")
+		}
+		if options.Every < 1 {
+			return nil, fmt.Errorf("every must be at least 1")
+		}
+		image, err := m.ReadFile(options.Cartridge)
+		if err != nil {
+			return nil, err
+		}
+		cartridge, err := NewCartridge(image, options.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		r := riot.NewRIOT(nil)
+		m.Scheduler.AddTicker(r)
+		tia := NewTIA(m.Cpu)
+		if options.Frames != "" {
+			tia.OnFrame = frameWriter(m.Path(options.Frames), options.Every)
+		}
+		return New(tia, r, cartridge), nil
+	})
+}
+
+// frameWriter saves every nth frame as frame-00001.png and on, numbered by frame. The directory is created
+// with the first frame. The first error is reported and ends the writing.
+func frameWriter(dir string, every int) func(frame *image.RGBA) {
+	count := 0
+	created, failed := false, false
+	return func(frame *image.RGBA) {
+		count++
+		if failed || count%every != 0 {
+			return
+		}
+		var err error
+		if !created {
+			err = os.MkdirAll(dir, 0o755)
+			created = err == nil
+		}
+		if err == nil {
+			err = writePNG(filepath.Join(dir, fmt.Sprintf("frame-%05d.png", count)), frame)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "atari2600: %v\n", err)
+			failed = true
+		}
+	}
+}
+
+func writePNG(name string, frame image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, frame); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,445 @@
+package atari2600
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+)
+
+// TIA write registers
+const (
+	VSYNC  = 0x00
+	VBLANK = 0x01
+	WSYNC  = 0x02
+	RSYNC  = 0x03
+	NUSIZ0 = 0x04
+	NUSIZ1 = 0x05
+	COLUP0 = 0x06
+	COLUP1 = 0x07
+	COLUPF = 0x08
+	COLUBK = 0x09
+	CTRLPF = 0x0A
+	REFP0  = 0x0B
+	REFP1  = 0x0C
+	PF0    = 0x0D
+	PF1    = 0x0E
+	PF2    = 0x0F
+	RESP0  = 0x10
+	RESP1  = 0x11
+	RESM0  = 0x12
+	RESM1  = 0x13
+	RESBL  = 0x14
+	GRP0   = 0x1B
+	GRP1   = 0x1C
+	ENAM0  = 0x1D
+	ENAM1  = 0x1E
+	ENABL  = 0x1F
+	HMP0   = 0x20
+	HMP1   = 0x21
+	HMM0   = 0x22
+	HMM1   = 0x23
+	HMBL   = 0x24
+	VDELP0 = 0x25
+	VDELP1 = 0x26
+	VDELBL = 0x27
+	RESMP0 = 0x28
+	RESMP1 = 0x29
+	HMOVE  = 0x2A
+	HMCLR  = 0x2B
+	CXCLR  = 0x2C
+)
+
+// TIA read registers
+const (
+	CXM0P  = 0x0
+	CXM1P  = 0x1
+	CXP0FB = 0x2
+	CXP1FB = 0x3
+	CXM0FB = 0x4
+	CXM1FB = 0x5
+	CXBLPF = 0x6
+	CXPPMM = 0x7
+	INPT4  = 0xC
+	INPT5  = 0xD
+)
+
+// Picture geometry in colour clocks, three per cpu cycle
+const (
+	ClocksPerLine = 228
+	HBlank        = 68
+	Width         = ClocksPerLine - HBlank
+	// MaxLines is the most lines a frame image holds, a frame without VSYNC is cut there
+	MaxLines = 320
+)
+
+// cyclesPerLine is the length of a line in cpu cycles
+const cyclesPerLine = ClocksPerLine / 3
+
+// copies are the offsets of the player and missile copies for the NUSIZ number-size bits
+var copies = [8][]int{{0}, {0, 16}, {0, 32}, {0, 16, 32}, {0, 64}, {0}, {0, 32, 64}, {0}}
+
+// TIA is the video part of the Television Interface Adaptor: the playfield, two players, two missiles and
+// the ball are drawn a colour clock at a time into a frame image, catching up with the cpu whenever a register
+// is written. The beam is tied to the cpu cycle counter, a line every 76 cycles, and WSYNC stalls the cpu to
+// the start of the next line. A frame ends when VSYNC is turned on. Sound is not emulated, RSYNC is ignored and
+// objects are positioned without the delays of the real motion counters. Colours are from the NTSC palette.
+type TIA struct {
+	// OnFrame is given each finished frame, one pixel per colour clock of the lines drawn since VSYNC.
+	// The image is reused for the next frame.
+	OnFrame func(frame *image.RGBA)
+	// Fire holds the joystick buttons read on INPT4 and INPT5
+	Fire [2]bool
+
+	cpu   *cpu.Cpu
+	image *image.RGBA
+	state tiaState
+}
+
+type tiaState struct {
+	Registers  [0x40]byte
+	OldGRP0    byte // the values VDELP0, VDELP1 and VDELBL show, copied when the other player's graphics are written
+	OldGRP1    byte
+	OldENABL   byte
+	P0, P1     int // object positions, pixels from the left edge
+	M0, M1, BL int
+	Collisions [8]byte
+	Drawn      uint64 // colour clocks drawn since power-up
+	Row        int    // frame row of the line being drawn, -1 during VSYNC
+	Rows       int    // rows drawn in the frame
+	HMOVELine  uint64 // line whose first 8 pixels are blanked by an HMOVE in the horizontal blank, plus 1
+}
+
+// NewTIA creates the TIA of a cpu, the beam is at the top left corner at cycle 0
+func NewTIA(c *cpu.Cpu) *TIA {
+	t := &TIA{cpu: c, image: image.NewRGBA(image.Rect(0, 0, Width, MaxLines))}
+	t.clear()
+	return t
+}
+
+// Frame returns the frame being drawn
+func (t *TIA) Frame() *image.RGBA {
+	return t.image.SubImage(image.Rect(0, 0, Width, t.state.Rows)).(*image.RGBA)
+}
+
+func (t *TIA) Read(address uint16) byte {
+	return t.Peek(address)
+}
+
+// Peek implements memory.Peeker, the TIA drives bits 6 and 7 only
+func (t *TIA) Peek(address uint16) byte {
+	address &= 0x0F
+	switch {
+	case address <= CXPPMM:
+		t.catchUp()
+		return t.state.Collisions[address]
+	case address == INPT4 || address == INPT5:
+		if t.Fire[address-INPT4] {
+			return 0x00
+		}
+		return 0x80
+	}
+	return 0
+}
+
+func (t *TIA) Write(address uint16, value byte) {
+	t.catchUp()
+	s := &t.state
+	address &= 0x3F
+	x := int(s.Drawn%ClocksPerLine) - HBlank
+	switch address {
+	case VSYNC:
+		switch on := value&0x02 != 0; {
+		case on && s.Row >= 0:
+			t.endFrame()
+			s.Row = -1
+		case !on && s.Row < 0:
+			s.Row = 0
+		}
+	case WSYNC:
+		t.cpu.Stall(cyclesPerLine - t.cpu.AccessCycle()%cyclesPerLine - 1)
+	case RESP0:
+		s.P0 = position(x, 5)
+	case RESP1:
+		s.P1 = position(x, 5)
+	case RESM0:
+		s.M0 = position(x, 4)
+	case RESM1:
+		s.M1 = position(x, 4)
+	case RESBL:
+		s.BL = position(x, 4)
+	case GRP0:
+		s.OldGRP1 = s.Registers[GRP1]
+	case GRP1:
+		s.OldGRP0 = s.Registers[GRP0]
+		s.OldENABL = s.Registers[ENABL]
+	case RESMP0:
+		if value&0x02 != 0 {
+			s.M0 = (s.P0 + center(s.Registers[NUSIZ0])) % Width
+		}
+	case RESMP1:
+		if value&0x02 != 0 {
+			s.M1 = (s.P1 + center(s.Registers[NUSIZ1])) % Width
+		}
+	case HMOVE:
+		r := &s.Registers
+		for _, object := range []struct {
+			position *int
+			motion   byte
+		}{{&s.P0, r[HMP0]}, {&s.P1, r[HMP1]}, {&s.M0, r[HMM0]}, {&s.M1, r[HMM1]}, {&s.BL, r[HMBL]}} {
+			*object.position = ((*object.position-int(int8(object.motion)>>4))%Width + Width) % Width
+		}
+		if x < 0 {
+			s.HMOVELine = s.Drawn/ClocksPerLine + 1
+		}
+	case HMCLR:
+		for r := HMP0; r <= HMBL; r++ {
+			s.Registers[r] = 0
+		}
+		return
+	case CXCLR:
+		s.Collisions = [8]byte{}
+		return
+	}
+	s.Registers[address] = value
+}
+
+// position is where an object reset at x appears, objects reset during the horizontal blank appear near the left edge
+func position(x, delay int) int {
+	if x < 0 {
+		return delay - 2
+	}
+	return (x + delay) % Width
+}
+
+// center is the offset of the middle of a player of the size selected by NUSIZ
+func center(nusiz byte) int {
+	switch nusiz & 0x07 {
+	case 5:
+		return 8
+	case 7:
+		return 16
+	}
+	return 4
+}
+
+// catchUp draws the colour clocks up to the cpu bus access being made
+func (t *TIA) catchUp() {
+	s := &t.state
+	now := t.cpu.AccessCycle() * 3
+	for ; s.Drawn < now; s.Drawn++ {
+		x := int(s.Drawn%ClocksPerLine) - HBlank
+		if x == -HBlank && s.Drawn > 0 && s.Row >= 0 {
+			s.Row++
+			if s.Row == MaxLines {
+				t.endFrame()
+				s.Row = 0
+			}
+		}
+		if x < 0 || s.Row < 0 {
+			continue
+		}
+		value := t.pixel(x)
+		if s.Registers[VBLANK]&0x02 != 0 || x < 8 && s.Drawn/ClocksPerLine+1 == s.HMOVELine {
+			value = 0
+		}
+		t.image.SetRGBA(x, s.Row, palette[value>>1])
+		if s.Row >= s.Rows {
+			s.Rows = s.Row + 1
+		}
+	}
+}
+
+func (t *TIA) endFrame() {
+	if t.state.Rows == 0 {
+		return
+	}
+	if t.OnFrame != nil {
+		t.OnFrame(t.Frame())
+	}
+	t.state.Rows = 0
+	t.clear()
+}
+
+func (t *TIA) clear() {
+	draw.Draw(t.image, t.image.Bounds(), image.Black, image.Point{}, draw.Src)
+}
+
+// pixel returns the colour register value at x and records the collisions there
+func (t *TIA) pixel(x int) byte {
+	s := &t.state
+	r := &s.Registers
+	grp0, grp1, enabl := r[GRP0], r[GRP1], r[ENABL]
+	if r[VDELP0]&0x01 != 0 {
+		grp0 = s.OldGRP0
+	}
+	if r[VDELP1]&0x01 != 0 {
+		grp1 = s.OldGRP1
+	}
+	if r[VDELBL]&0x01 != 0 {
+		enabl = s.OldENABL
+	}
+	pf := t.playfield(x)
+	bl := enabl&0x02 != 0 && covers(x, s.BL, 0, 1<<(r[CTRLPF]>>4&0x03))
+	p0 := player(x, s.P0, grp0, r[NUSIZ0], r[REFP0])
+	p1 := player(x, s.P1, grp1, r[NUSIZ1], r[REFP1])
+	m0 := r[RESMP0]&0x02 == 0 && missile(x, s.M0, r[ENAM0], r[NUSIZ0])
+	m1 := r[RESMP1]&0x02 == 0 && missile(x, s.M1, r[ENAM1], r[NUSIZ1])
+	t.collide(p0, p1, m0, m1, bl, pf)
+
+	pfColor := r[COLUPF]
+	if r[CTRLPF]&0x02 != 0 {
+		// score mode
+		pfColor = r[COLUP0]
+		if x >= Width/2 {
+			pfColor = r[COLUP1]
+		}
+	}
+	if r[CTRLPF]&0x04 != 0 {
+		// playfield and ball in front of the players
+		switch {
+		case bl:
+			return r[COLUPF]
+		case pf:
+			return pfColor
+		}
+	}
+	switch {
+	case p0 || m0:
+		return r[COLUP0]
+	case p1 || m1:
+		return r[COLUP1]
+	case bl:
+		return r[COLUPF]
+	case pf:
+		return pfColor
+	}
+	return r[COLUBK]
+}
+
+// playfield tells whether the playfield bit shown at x is set, the right half repeats or reflects the left
+func (t *TIA) playfield(x int) bool {
+	r := &t.state.Registers
+	bit := x / 4
+	if bit >= 20 {
+		bit -= 20
+		if r[CTRLPF]&0x01 != 0 {
+			bit = 19 - bit
+		}
+	}
+	switch {
+	case bit < 4:
+		return r[PF0]&(0x10<<bit) != 0
+	case bit < 12:
+		return r[PF1]&(0x80>>(bit-4)) != 0
+	default:
+		return r[PF2]&(1<<(bit-12)) != 0
+	}
+}
+
+// covers tells whether x is within width pixels from position plus offset, wrapping around the line
+func covers(x, position, offset, width int) bool {
+	d := ((x-position-offset)%Width + Width) % Width
+	return d < width
+}
+
+func player(x, position int, graphics, nusiz, reflect byte) bool {
+	if graphics == 0 {
+		return false
+	}
+	scale := 1
+	switch nusiz & 0x07 {
+	case 5:
+		scale = 2
+	case 7:
+		scale = 4
+	}
+	for _, offset := range copies[nusiz&0x07] {
+		d := ((x-position-offset)%Width + Width) % Width
+		if d >= 8*scale {
+			continue
+		}
+		bit := d / scale
+		if reflect&0x08 != 0 {
+			return graphics&(1<<bit) != 0
+		}
+		return graphics&(0x80>>bit) != 0
+	}
+	return false
+}
+
+func missile(x, position int, enable, nusiz byte) bool {
+	if enable&0x02 == 0 {
+		return false
+	}
+	width := 1 << (nusiz >> 4 & 0x03)
+	for _, offset := range copies[nusiz&0x07] {
+		if covers(x, position, offset, width) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TIA) collide(p0, p1, m0, m1, bl, pf bool) {
+	if !p0 && !p1 && !m0 && !m1 && !bl {
+		return
+	}
+	c := &t.state.Collisions
+	for _, pair := range []struct {
+		hit      bool
+		register int
+		bit      byte
+	}{
+		{m0 && p1, CXM0P, 0x80}, {m0 && p0, CXM0P, 0x40},
+		{m1 && p0, CXM1P, 0x80}, {m1 && p1, CXM1P, 0x40},
+		{p0 && pf, CXP0FB, 0x80}, {p0 && bl, CXP0FB, 0x40},
+		{p1 && pf, CXP1FB, 0x80}, {p1 && bl, CXP1FB, 0x40},
+		{m0 && pf, CXM0FB, 0x80}, {m0 && bl, CXM0FB, 0x40},
+		{m1 && pf, CXM1FB, 0x80}, {m1 && bl, CXM1FB, 0x40},
+		{bl && pf, CXBLPF, 0x80},
+		{p0 && p1, CXPPMM, 0x80}, {m0 && m1, CXPPMM, 0x40},
+	} {
+		if pair.hit {
+			c[pair.register] |= pair.bit
+		}
+	}
+}
+
+// SaveState implements memory.Stateful, the frame being drawn is not kept
+func (t *TIA) SaveState() ([]byte, error) {
+	return json.Marshal(t.state)
+}
+
+func (t *TIA) LoadState(data []byte) error {
+	return json.Unmarshal(data, &t.state)
+}
+
+// palette is the NTSC palette, indexed by the colour register value shifted right once
+var palette = func() [128]color.RGBA {
+	rgb := [128]uint32{
+		0x000000, 0x404040, 0x6C6C6C, 0x909090, 0xB0B0B0, 0xC8C8C8, 0xDCDCDC, 0xECECEC,
+		0x444400, 0x646410, 0x848424, 0xA0A034, 0xB8B840, 0xD0D050, 0xE8E85C, 0xFCFC68,
+		0x702800, 0x844414, 0x985C28, 0xAC783C, 0xBC8C4C, 0xCCA05C, 0xDCB468, 0xECC878,
+		0x841800, 0x983418, 0xAC5030, 0xC06848, 0xD0805C, 0xE09470, 0xECA880, 0xFCBC94,
+		0x880000, 0x9C2020, 0xB03C3C, 0xC05858, 0xD07070, 0xE08888, 0xECA0A0, 0xFCB4B4,
+		0x78005C, 0x8C2074, 0xA03C88, 0xB0589C, 0xC070B0, 0xD084C0, 0xDC9CD0, 0xECB0E0,
+		0x480078, 0x602090, 0x783CA4, 0x8C58B8, 0xA070CC, 0xB484DC, 0xC49CEC, 0xD4B0FC,
+		0x140084, 0x302098, 0x4C3CAC, 0x6858C0, 0x7C70D0, 0x9488E0, 0xA8A0EC, 0xBCB4FC,
+		0x000088, 0x1C209C, 0x3840B0, 0x505CC0, 0x6874D0, 0x7C8CE0, 0x90A4EC, 0xA4B8FC,
+		0x00187C, 0x1C3890, 0x3854A8, 0x5070BC, 0x6888CC, 0x7C9CDC, 0x90B4EC, 0xA4C8FC,
+		0x002C5C, 0x1C4C78, 0x386890, 0x5084AC, 0x689CC0, 0x7CB4D4, 0x90CCE8, 0xA4E0FC,
+		0x003C2C, 0x1C5C48, 0x387C64, 0x509C80, 0x68B494, 0x7CD0AC, 0x90E4C0, 0xA4FCD4,
+		0x003C00, 0x205C20, 0x407C40, 0x5C9C5C, 0x74B474, 0x8CD08C, 0xA4E4A4, 0xB8FCB8,
+		0x143800, 0x345C1C, 0x507C38, 0x6C9850, 0x84B468, 0x9CCC7C, 0xB4E490, 0xC8FCA4,
+		0x2C3000, 0x4C501C, 0x687034, 0x848C4C, 0x9CA864, 0xB4C078, 0xCCD488, 0xE0EC9C,
+		0x442800, 0x644818, 0x846830, 0xA08444, 0xB89C58, 0xD0B46C, 0xE8CC7C, 0xFCE08C,
+	}
+	var p [128]color.RGBA
+	for i, c := range rgb {
+		p[i] = color.RGBA{R: byte(c >> 16), G: byte(c >> 8), B: byte(c), A: 0xFF}
+	}
+	return p
+}()
@@ -0,0 +1,220 @@
+package beneater
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/hd44780"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/via6522"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// LCD wirings
+const (
+	// Wiring8Bit is the LCD of the first videos: D0-D7 on port B, E on PA7, R/W on PA6 and RS on PA5
+	Wiring8Bit = "8bit"
+	// Wiring4Bit leaves port A free: D4-D7 on PB0-PB3, RS on PB4, R/W on PB5 and E on PB6
+	Wiring4Bit = "4bit"
+)
+
+// Timing in seconds
+const (
+	holdTime  = 0.05 // a button pressed from the host is held down this long, and released as long before the next
+	frameTime = 0.02 // the display is drawn once it has not changed for this long
+	maxFrames = 10   // but at least every this many frame times while it keeps changing
+)
+
+// Button is an input pulled up and grounded by a push button: PA0-PA7, PB0-PB7, CA1, CA2, CB1 or CB2
+type Button string
+
+func (b Button) validate() error {
+	switch b {
+	case "CA1", "CA2", "CB1", "CB2":
+		return nil
+	}
+	if len(b) == 3 && (b[:2] == "PA" || b[:2] == "PB") && b[2] >= '0' && b[2] <= '7' {
+		return nil
+	}
+	return fmt.Errorf("unknown button input %q, expected PA0-PA7, PB0-PB7, CA1, CA2, CB1 or CB2", string(b))
+}
+
+// bit returns the port, A or B, and the pin mask of a port input
+func (b Button) bit() (byte, byte) {
+	if len(b) != 3 || b[0] != 'P' {
+		return 0, 0
+	}
+	n, _ := strconv.Atoi(string(b[2]))
+	return b[1], 1 << n
+}
+
+// Board is the 6522 of Ben Eater's breadboard computer with the HD44780 LCD and push buttons on its ports.
+// The display is drawn to the host as a boxed frame whenever it settles on new text, and host keys press
+// the buttons they are assigned to.
+type Board struct {
+	*via6522.VIA
+	LCD  *hd44780.LCD
+	Host hostio.Serial
+
+	scheduler   *scheduler.Scheduler
+	fourBit     bool
+	buttons     map[byte]Button
+	held        Button // button held down, empty for none
+	outputA     byte   // port outputs, the LCD sees the pins configured as inputs low
+	outputB     byte
+	holdCycles  uint64
+	frameCycles uint64
+
+	dirty     bool
+	changedAt uint64
+	shownAt   uint64
+	shown     string
+}
+
+// NewBoard wires the LCD to the VIA, buttons assigns host keys to button inputs
+func NewBoard(v *via6522.VIA, lcd *hd44780.LCD, wiring string, buttons map[byte]Button, host hostio.Serial,
+	s *scheduler.Scheduler, clock float64) (*Board, error) {
+	if wiring != Wiring8Bit && wiring != Wiring4Bit {
+		return nil, fmt.Errorf("unknown LCD wiring %q, expected %s or %s", wiring, Wiring8Bit, Wiring4Bit)
+	}
+	for _, button := range buttons {
+		if err := button.validate(); err != nil {
+			return nil, err
+		}
+	}
+	b := &Board{
+		VIA:         v,
+		LCD:         lcd,
+		Host:        host,
+		scheduler:   s,
+		fourBit:     wiring == Wiring4Bit,
+		buttons:     buttons,
+		holdCycles:  uint64(clock * holdTime),
+		frameCycles: uint64(clock * frameTime),
+	}
+	v.PortA.OnWrite = func(output, ddr byte) {
+		b.outputA = output
+		b.update()
+	}
+	v.PortB.OnWrite = func(output, ddr byte) {
+		b.outputB = output
+		b.update()
+	}
+	lcd.OnChange = func() {
+		b.dirty = true
+		b.changedAt = s.Cycle()
+	}
+	b.update()
+	s.After(b.holdCycles, b.poll)
+	s.After(b.frameCycles, b.render)
+	return b, nil
+}
+
+// update drives the LCD from the port outputs and the port inputs from the LCD and the buttons
+func (b *Board) update() {
+	a, pb := b.outputA, b.outputB
+	var driven byte
+	if b.fourBit {
+		driven = b.LCD.Pins(pb<<4, pb&0x10 != 0, pb&0x20 != 0, pb&0x40 != 0)
+	} else {
+		driven = b.LCD.Pins(pb, a&0x20 != 0, a&0x40 != 0, a&0x80 != 0)
+	}
+	inputA, inputB := byte(0xFF), byte(0xFF)
+	if port, mask := b.held.bit(); port == 'A' {
+		inputA &^= mask
+	} else if port == 'B' {
+		inputB &^= mask
+	}
+	if b.fourBit {
+		inputB &= driven>>4 | 0xF0
+	} else {
+		inputB &= driven
+	}
+	b.PortA.Set(inputA)
+	b.PortB.Set(inputB)
+}
+
+// press holds a button down, or releases the one held with an empty button
+func (b *Board) press(button Button) {
+	level := button == ""
+	target := button
+	if level {
+		target = b.held
+	}
+	b.held = button
+	switch target {
+	case "CA1":
+		b.SetCA1(level)
+	case "CA2":
+		b.SetCA2(level)
+	case "CB1":
+		b.SetCB1(level)
+	case "CB2":
+		b.SetCB2(level)
+	default:
+		b.update()
+	}
+}
+
+// poll presses a button for a host key, or releases the one held
+func (b *Board) poll() {
+	b.scheduler.After(b.holdCycles, b.poll)
+	if b.held != "" {
+		b.press("")
+		return
+	}
+	for {
+		key, ok := b.Host.Poll()
+		if !ok {
+			return
+		}
+		if button, ok := b.buttons[key]; ok {
+			b.press(button)
+			return
+		}
+	}
+}
+
+// render draws the display once it has settled, or every few frames while it keeps changing
+func (b *Board) render() {
+	b.scheduler.After(b.frameCycles, b.render)
+	now := b.scheduler.Cycle()
+	if !b.dirty || now-b.changedAt < b.frameCycles && now-b.shownAt < maxFrames*b.frameCycles {
+		return
+	}
+	b.dirty = false
+	b.shownAt = now
+	if frame := b.LCD.Frame(); frame != b.shown {
+		b.shown = frame
+		b.Host.Write([]byte(frame))
+	}
+}
+
+type boardState struct {
+	VIA, LCD json.RawMessage
+}
+
+// SaveState implements memory.Stateful, it keeps the VIA and the LCD
+func (b *Board) SaveState() ([]byte, error) {
+	var s boardState
+	var err error
+	if s.VIA, err = b.VIA.SaveState(); err != nil {
+		return nil, err
+	}
+	if s.LCD, err = b.LCD.SaveState(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+func (b *Board) LoadState(data []byte) error {
+	var s boardState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if err := b.VIA.LoadState(s.VIA); err != nil {
+		return err
+	}
+	return b.LCD.LoadState(s.LCD)
+}
@@ -0,0 +1,99 @@
+package beneater
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/hd44780"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/via6522"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBoard runs at 1000 cycles per second: buttons are held for 50 cycles and frames last 20,
+// without a scheduler for the LCD it is never busy
+func newBoard(t *testing.T, wiring string, input string) (*Board, *cpu.Cpu, *scheduler.Scheduler, *bytes.Buffer) {
+	c := cpu.NewCpu(nil, memory.NewRAM(0x10000))
+	s := scheduler.New(&c)
+	output := &bytes.Buffer{}
+	host := hostio.NewSerial(hostio.NewBytesInput([]byte(input)), output)
+	buttons := map[byte]Button{' ': "CA1", 'u': "PA0"}
+	b, err := NewBoard(via6522.New(nil), hd44780.New(8, 1, nil, 1000), wiring, buttons, host, s, 1000)
+	require.NoError(t, err)
+	return b, &c, s, output
+}
+
+func at(c *cpu.Cpu, s *scheduler.Scheduler, cycle uint64) {
+	c.Cycles = cycle
+	s.Sync()
+}
+
+func TestBoard_8bit(t *testing.T) {
+	b, c, s, output := newBoard(t, Wiring8Bit, "")
+	b.Write(via6522.RegDDRA, 0xE0)
+	send := func(rs byte, value byte) {
+		b.Write(via6522.RegDDRB, 0xFF)
+		b.Write(via6522.RegORB, value)
+		b.Write(via6522.RegORA, rs)
+		b.Write(via6522.RegORA, rs|0x80)
+		b.Write(via6522.RegORA, rs)
+	}
+	send(0, 0x30)
+	send(0, 0x0C)
+	for _, char := range []byte("6502") {
+		send(0x20, char)
+	}
+	assert.Equal(t, "6502    ", b.LCD.Lines()[0])
+
+	b.Write(via6522.RegDDRB, 0)
+	b.Write(via6522.RegORA, 0x40|0x80)
+	assert.Equal(t, byte(0x04), b.Read(via6522.RegORB), "address counter read on port B")
+	b.Write(via6522.RegORA, 0x40)
+	assert.Equal(t, byte(0xFF), b.Read(via6522.RegORB), "released")
+
+	at(c, s, 40)
+	assert.Equal(t, "+--------+\r\n|6502    |\r\n+--------+\r\n", output.String())
+}
+
+func TestBoard_4bit(t *testing.T) {
+	b, _, _, _ := newBoard(t, Wiring4Bit, "")
+	b.Write(via6522.RegDDRB, 0x7F)
+	nibble := func(rs byte, value byte) {
+		b.Write(via6522.RegORB, rs|value)
+		b.Write(via6522.RegORB, rs|value|0x40)
+		b.Write(via6522.RegORB, rs|value)
+	}
+	send := func(rs byte, value byte) {
+		nibble(rs, value>>4)
+		nibble(rs, value&0x0F)
+	}
+	nibble(0, 0x2)
+	send(0, 0x20)
+	send(0, 0x0C)
+	send(0x10, 'O')
+	send(0x10, 'K')
+	assert.Equal(t, "OK      ", b.LCD.Lines()[0])
+
+	b.Write(via6522.RegDDRB, 0x70)
+	b.Write(via6522.RegORB, 0x20|0x40)
+	assert.Equal(t, byte(0x60), b.Read(via6522.RegORB)&0x7F, "high nibble of the address counter, R/W and E")
+	b.Write(via6522.RegORB, 0x20)
+	b.Write(via6522.RegORB, 0x20|0x40)
+	assert.Equal(t, byte(0x62), b.Read(via6522.RegORB)&0x7F, "low nibble")
+}
+
+func TestBoard_buttons(t *testing.T) {
+	b, c, s, _ := newBoard(t, Wiring8Bit, "xu ")
+	b.Write(via6522.RegIER, via6522.IntAny|via6522.IntCA1)
+	at(c, s, 50)
+	assert.Equal(t, byte(0xFE), b.Read(via6522.RegORA2), "u on PA0, x is not assigned")
+	at(c, s, 100)
+	assert.Equal(t, byte(0xFF), b.Read(via6522.RegORA2))
+	at(c, s, 150)
+	assert.True(t, b.IRQ(), "space on CA1")
+}
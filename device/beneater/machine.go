@@ -0,0 +1,45 @@
+package beneater
+
+import (
+	"fmt"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/hd44780"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/via6522"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("beneater-via", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		options := struct {
+			Host    string // see hostio.Open
+			LCD     string `yaml:"lcd"` // 8bit or 4bit, see Wiring8Bit and Wiring4Bit
+			Columns int
+			Lines   int
+			// Buttons assigns host keys to button inputs, e.g. {" ": CA1, "u": PA0}
+			Buttons map[string]Button
+		}{Host: "stdio", LCD: Wiring8Bit, Columns: 16, Lines: 2}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		if options.Columns < 1 || options.Columns > 40 || options.Lines < 1 || options.Lines > 4 {
+			return nil, fmt.Errorf("unsupported LCD size %dx%d", options.Columns, options.Lines)
+		}
+		buttons := map[byte]Button{}
+		for key, button := range options.Buttons {
+			if len(key) != 1 {
+				return nil, fmt.Errorf("button key %q is not a single character", key)
+			}
+			buttons[key[0]] = button
+		}
+		host, err := m.OpenHost(config, options.Host)
+		if err != nil {
+			return nil, err
+		}
+		clock := m.ClockOr(1e6)
+		v := via6522.New(m.Pin(config))
+		m.Scheduler.AddTicker(v)
+		lcd := hd44780.New(options.Columns, options.Lines, m.Scheduler, clock)
+		return NewBoard(v, lcd, options.LCD, buttons, host, m.Scheduler, clock)
+	})
+}
@@ -0,0 +1,269 @@
+package c64
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/cia6526"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// 6510 port lines selecting the memory configuration
+const (
+	PortLORAM  = 0x01 // BASIC ROM at $A000
+	PortHIRAM  = 0x02 // KERNAL ROM at $E000
+	PortCHAREN = 0x04 // I/O at $D000 instead of the character ROM
+)
+
+// portInputs are the levels of the 6510 port pins configured as inputs: the banking lines and the cassette
+// sense line are pulled up, bits 6 and 7 are not connected
+const portInputs = 0x17
+
+// ROM sizes
+const (
+	BasicSize   = 0x2000
+	KernalSize  = 0x2000
+	ChargenSize = 0x1000
+)
+
+// ROMs holds the images of the BASIC, KERNAL and character ROMs. A missing image leaves RAM visible in its place.
+type ROMs struct {
+	Basic, Kernal, Chargen []byte
+}
+
+func (r ROMs) validate() error {
+	for _, rom := range []struct {
+		name  string
+		image []byte
+		size  int
+	}{{"basic", r.Basic, BasicSize}, {"kernal", r.Kernal, KernalSize}, {"chargen", r.Chargen, ChargenSize}} {
+		if rom.image != nil && len(rom.image) != rom.size {
+			return fmt.Errorf("the %s ROM is %d bytes, expected %d", rom.name, len(rom.image), rom.size)
+		}
+	}
+	return nil
+}
+
+// C64 is the cpu side of a Commodore 64 mapped over the whole address space: 64K of RAM with the ROMs and
+// I/O banked in by the 6510 on-chip port at $0000/$0001, the two CIAs (CIA 1 drives IRQ and scans the keyboard,
+// CIA 2 drives NMI and selects the VIC bank), a VIC-II that only keeps the raster counter and its interrupt,
+// an SID that ignores writes and reads 0, and the colour RAM. Writes always reach the RAM unless the I/O
+// area is banked in. The text screen is rendered to the host once a frame, host keys are typed on the keyboard.
+type C64 struct {
+	CIA1, CIA2 *cia6526.CIA
+	VIC        *VIC
+	Keyboard   *Keyboard
+	Screen     *Screen
+
+	roms  ROMs
+	state state
+}
+
+// state is everything a save state needs besides the chips
+type state struct {
+	RAM      []byte
+	DDR      byte // 6510 port data direction
+	Data     byte // 6510 port output register
+	ColorRAM []byte
+}
+
+// New creates a C64, the chips are created by the caller so they can be ticked and wired to the cpu
+func New(roms ROMs, cia1, cia2 *cia6526.CIA, vic *VIC, host hostio.Serial, s *scheduler.Scheduler, clock float64, screen string) (*C64, error) {
+	if err := roms.validate(); err != nil {
+		return nil, err
+	}
+	c := &C64{
+		CIA1:  cia1,
+		CIA2:  cia2,
+		VIC:   vic,
+		roms:  roms,
+		state: state{RAM: make([]byte, 0x10000), ColorRAM: make([]byte, 0x400)},
+	}
+	var err error
+	if c.Screen, err = NewScreen(c, host, screen); err != nil {
+		return nil, err
+	}
+	c.Keyboard = NewKeyboard(host, s, clock)
+	cia1.PortB.OnRead = func() byte {
+		return c.Keyboard.Rows(cia1.PortA.Output())
+	}
+	vic.OnFrame = c.Screen.Frame
+	return c, nil
+}
+
+// Port returns the levels of the 6510 port pins
+func (c *C64) Port() byte {
+	return c.state.Data&c.state.DDR | portInputs&^c.state.DDR
+}
+
+// RAM is the 64K of RAM as the VIC sees it
+func (c *C64) RAM() []byte {
+	return c.state.RAM
+}
+
+// ColorRAM holds the colour of each screen position in the low nibbles
+func (c *C64) ColorRAM() []byte {
+	return c.state.ColorRAM
+}
+
+// visible tells what the cpu sees at an address that is not plain RAM
+type visible int
+
+const (
+	visibleRAM visible = iota
+	visibleBasic
+	visibleKernal
+	visibleChargen
+	visibleIO
+)
+
+func (c *C64) visible(address uint16) visible {
+	port := c.Port()
+	loram, hiram := port&PortLORAM != 0, port&PortHIRAM != 0
+	switch {
+	case address >= 0xA000 && address < 0xC000 && loram && hiram && c.roms.Basic != nil:
+		return visibleBasic
+	case address >= 0xE000 && hiram && c.roms.Kernal != nil:
+		return visibleKernal
+	case address >= 0xD000 && address < 0xE000 && (loram || hiram):
+		if port&PortCHAREN != 0 {
+			return visibleIO
+		}
+		if c.roms.Chargen != nil {
+			return visibleChargen
+		}
+	}
+	return visibleRAM
+}
+
+func (c *C64) Read(address uint16) byte {
+	return c.read(address, false)
+}
+
+// Peek implements memory.Peeker, I/O registers are read without side effects
+func (c *C64) Peek(address uint16) byte {
+	return c.read(address, true)
+}
+
+func (c *C64) read(address uint16, peek bool) byte {
+	switch address {
+	case 0x0000:
+		return c.state.DDR
+	case 0x0001:
+		return c.Port()
+	}
+	switch c.visible(address) {
+	case visibleBasic:
+		return c.roms.Basic[address-0xA000]
+	case visibleKernal:
+		return c.roms.Kernal[address-0xE000]
+	case visibleChargen:
+		return c.roms.Chargen[address-0xD000]
+	case visibleIO:
+		return c.readIO(address, peek)
+	default:
+		return c.state.RAM[address]
+	}
+}
+
+func (c *C64) readIO(address uint16, peek bool) byte {
+	switch {
+	case address < 0xD400:
+		if peek {
+			return c.VIC.Peek(address & 0x3F)
+		}
+		return c.VIC.Read(address & 0x3F)
+	case address < 0xD800:
+		return 0 // SID
+	case address < 0xDC00:
+		return c.state.ColorRAM[address&0x3FF] & 0x0F
+	case address < 0xDD00:
+		if peek {
+			return c.CIA1.Peek(address & 0xF)
+		}
+		return c.CIA1.Read(address & 0xF)
+	case address < 0xDE00:
+		if peek {
+			return c.CIA2.Peek(address & 0xF)
+		}
+		return c.CIA2.Read(address & 0xF)
+	default:
+		return 0 // the expansion port I/O areas
+	}
+}
+
+func (c *C64) Write(address uint16, value byte) {
+	switch address {
+	case 0x0000:
+		c.state.DDR = value
+	case 0x0001:
+		c.state.Data = value
+	}
+	if c.visible(address) != visibleIO {
+		c.state.RAM[address] = value
+		return
+	}
+	switch {
+	case address < 0xD400:
+		c.VIC.Write(address&0x3F, value)
+	case address < 0xD800:
+		// SID
+	case address < 0xDC00:
+		c.state.ColorRAM[address&0x3FF] = value & 0x0F
+	case address < 0xDD00:
+		c.CIA1.Write(address&0xF, value)
+	case address < 0xDE00:
+		c.CIA2.Write(address&0xF, value)
+	}
+}
+
+// IsRAM implements memory.RAMMapper, writes reach the RAM unless the I/O area is banked in
+func (c *C64) IsRAM(address uint16) bool {
+	return c.visible(address) != visibleIO
+}
+
+// VICBank is the 16K the VIC sees, selected by CIA 2 PA0-PA1 (inverted)
+func (c *C64) VICBank() uint16 {
+	return uint16(3-c.CIA2.PortA.Output()&0x03) * 0x4000
+}
+
+type c64State struct {
+	Memory, CIA1, CIA2, VIC json.RawMessage
+}
+
+// SaveState implements memory.Stateful, it keeps the memory and the chips
+func (c *C64) SaveState() ([]byte, error) {
+	var s c64State
+	var err error
+	if s.Memory, err = json.Marshal(c.state); err != nil {
+		return nil, err
+	}
+	if s.CIA1, err = c.CIA1.SaveState(); err != nil {
+		return nil, err
+	}
+	if s.CIA2, err = c.CIA2.SaveState(); err != nil {
+		return nil, err
+	}
+	if s.VIC, err = c.VIC.SaveState(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+func (c *C64) LoadState(data []byte) error {
+	var s c64State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(s.Memory, &c.state); err != nil {
+		return err
+	}
+	if err := c.CIA1.LoadState(s.CIA1); err != nil {
+		return err
+	}
+	if err := c.CIA2.LoadState(s.CIA2); err != nil {
+		return err
+	}
+	return c.VIC.LoadState(s.VIC)
+}
@@ -0,0 +1,164 @@
+package c64
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/asm"
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/cia6526"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func filled(size int, value byte) []byte {
+	return bytes.Repeat([]byte{value}, size)
+}
+
+func newC64(t *testing.T, screen string) (*C64, *cpu.Cpu, *scheduler.Scheduler, *bytes.Buffer) {
+	c := cpu.NewCpu(nil, memory.NewRAM(0x10000))
+	s := scheduler.New(&c)
+	output := &bytes.Buffer{}
+	host := hostio.NewSerial(hostio.NewBytesInput(nil), output)
+	roms := ROMs{Basic: filled(BasicSize, 0xBA), Kernal: filled(KernalSize, 0xEE), Chargen: filled(ChargenSize, 0xCC)}
+	cia1 := cia6526.New(c.IRQLine().Pin(), 985248, 50)
+	cia2 := cia6526.New(c.NMILine().Pin(), 985248, 50)
+	c64, err := New(roms, cia1, cia2, NewVIC(c.IRQLine().Pin(), s, PAL), host, s, 985248, screen)
+	require.NoError(t, err)
+	return c64, &c, s, output
+}
+
+func TestC64_banking(t *testing.T) {
+	c, _, _, _ := newC64(t, ScreenNone)
+	assert.Equal(t, byte(0x17), c.Read(0x0001), "all lines are pulled up inputs after reset")
+	assert.Equal(t, []byte{0xBA, 0x00, 0xEE}, []byte{c.Read(0xA000), c.Read(0xD020) & 0x0F, c.Read(0xE000)})
+
+	c.Write(0xA000, 0x11)
+	c.Write(0xE000, 0x22)
+	c.Write(0xD800, 0x3F)
+	assert.Equal(t, byte(0x0F), c.Read(0xD800), "colour RAM keeps nibbles")
+	c.Write(0x0000, 0x2F)
+	c.Write(0x0001, 0x37)
+	assert.Equal(t, byte(0x37), c.Read(0x0001))
+
+	for _, config := range []struct {
+		port            byte
+		basic, io, kern byte
+	}{
+		{0x36, 0x11, 0xF0, 0xEE}, // no BASIC
+		{0x35, 0x11, 0xF0, 0x22}, // I/O only
+		{0x33, 0xBA, 0xC0, 0xEE}, // character ROM instead of I/O
+		{0x34, 0x11, 0x00, 0x22}, // all RAM
+	} {
+		c.Write(0x0001, config.port)
+		assert.Equal(t, []byte{config.basic, config.io, config.kern},
+			[]byte{c.Read(0xA000), c.Read(0xD020) & 0xF0, c.Read(0xE000)}, "port %02X", config.port)
+	}
+	assert.Equal(t, byte(0x34), c.RAM()[0x0001], "port writes reach the RAM below")
+}
+
+func TestVIC_raster(t *testing.T) {
+	c, cpu, s, _ := newC64(t, ScreenNone)
+	c.Write(0xD012, 10)
+	c.Write(0xD01A, IntRaster)
+	cpu.Cycles += 9 * 63
+	s.Sync()
+	assert.Equal(t, byte(9), c.Read(0xD012))
+	assert.False(t, cpu.IRQLine().Active())
+	cpu.Cycles += 63
+	s.Sync()
+	assert.True(t, cpu.IRQLine().Active())
+	assert.Equal(t, byte(0xF1), c.Read(0xD019))
+	c.Write(0xD019, IntRaster)
+	assert.False(t, cpu.IRQLine().Active())
+
+	cpu.Cycles += 300 * 63
+	s.Sync()
+	assert.Equal(t, byte(0x80), c.Read(0xD011)&0x80, "line 310")
+}
+
+func TestKeyboard(t *testing.T) {
+	assert.Equal(t, []int{10}, Keys('a'))
+	assert.Equal(t, []int{10}, Keys('A'))
+	assert.Equal(t, []int{KeyLShift, 7*8 + 0}, Keys('!'))
+	assert.Equal(t, []int{1}, Keys('\n'))
+	assert.Nil(t, Keys('{'))
+
+	c, cpu, s, _ := newC64(t, ScreenNone)
+	c.Keyboard.Type(Keys('"')...)
+	cpu.Cycles += 50000
+	s.Sync()
+	c.Write(0xDC02, 0xFF)
+	c.Write(0xDC00, 0x00)
+	assert.Equal(t, byte(0x77), c.Read(0xDC01), "any key: shift and 2")
+	c.Write(0xDC00, 0xFD)
+	assert.Equal(t, byte(0x7F), c.Read(0xDC01), "column 1: left shift")
+	c.Write(0xDC00, 0x7F)
+	assert.Equal(t, byte(0xF7), c.Read(0xDC01), "column 7: 2")
+	cpu.Cycles += 50000
+	s.Sync()
+	assert.Equal(t, byte(0xFF), c.Read(0xDC01), "released")
+}
+
+func TestScreen(t *testing.T) {
+	c, cpu, s, output := newC64(t, ScreenText)
+	c.Write(0xD018, 0x14)
+	copy(c.RAM()[0x0400:], []byte{8, 5, 12, 12, 15, 0x20, 0x80 | 0x21, 0x5E})
+	cpu.Cycles += 2 * 312 * 63
+	s.Sync()
+	assert.Equal(t, "HELLO !π", string([]rune(c.Screen.Lines()[0])[:8]))
+	assert.Contains(t, output.String(), "|HELLO !π")
+
+	c.Write(0xD018, 0x16)
+	assert.Equal(t, "hello !▒", string([]rune(c.Screen.Lines()[0])[:8]), "lower case set")
+	c.Write(0xDD02, 0x03)
+	c.Write(0xDD00, 0x02)
+	assert.Equal(t, uint16(0x4000), c.VICBank())
+}
+
+func TestC64_machine(t *testing.T) {
+	program, err := asm.Assemble(`
+        .org $E000
+RESET:  LDX #4
+LOOP:   LDA TEXT,X
+        STA $0400,X
+        DEX
+        BPL LOOP
+        LDA #$14
+        STA $D018
+        LDA $A000
+        STA $0410
+DONE:   JMP DONE
+TEXT:   .byte 3, 54, 52, 32, 33
+        .org $FFFC
+        .word RESET
+`, 0xE000)
+	require.NoError(t, err)
+	_, image := program.Binary()
+	image = append(image, make([]byte, KernalSize-len(image))...)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kernal.bin"), image, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "basic.bin"), filled(BasicSize, 0x02), 0o644))
+
+	config, err := machine.Parse([]byte(`
+clock: 985248 Hz
+devices:
+  - {name: c64, type: c64, start: $0000, end: $FFFF, options: {kernal: kernal.bin, basic: basic.bin, host: none, screen: none}}
+`))
+	require.NoError(t, err)
+	m, err := machine.New(config, dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0xE000), m.Cpu.PC)
+	for m.Cpu.Cycles < 40000 {
+		m.Cpu.ExecuteOpcode()
+	}
+	c := m.Devices["c64"].(*C64)
+	assert.Equal(t, "C64 !@@@@@@@@@@@B", c.Screen.Lines()[0][:17])
+}
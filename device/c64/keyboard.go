@@ -0,0 +1,125 @@
+package c64
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// Keys without a host character, positions in the matrix: the CIA 1 PA line selecting the column times 8
+// plus the PB line the key pulls low
+const (
+	KeyRight     = 0*8 + 2
+	KeyF7        = 0*8 + 3
+	KeyF1        = 0*8 + 4
+	KeyF3        = 0*8 + 5
+	KeyF5        = 0*8 + 6
+	KeyDown      = 0*8 + 7
+	KeyLShift    = 1*8 + 7
+	KeyHome      = 6*8 + 3
+	KeyRShift    = 6*8 + 4
+	KeyCtrl      = 7*8 + 2
+	KeyCommodore = 7*8 + 5
+)
+
+// layout has the unshifted character of each key, 0 for the keys above. £ is typed as \, ↑ as ^, ← as _,
+// INST/DEL as DEL and RUN/STOP as ESC.
+var layout = [64]byte{
+	0x7F, '\r', 0, 0, 0, 0, 0, 0,
+	'3', 'W', 'A', '4', 'Z', 'S', 'E', 0,
+	'5', 'R', 'D', '6', 'C', 'F', 'T', 'X',
+	'7', 'Y', 'G', '8', 'B', 'H', 'U', 'V',
+	'9', 'I', 'J', '0', 'M', 'K', 'O', 'N',
+	'+', 'P', 'L', '-', '.', ':', '@', ',',
+	'\\', '*', ';', 0, 0, '=', '^', '/',
+	'1', '_', 0, '2', ' ', 0, 'Q', 0x1B,
+}
+
+// shifted characters typed with the left shift key and another key
+var shifted = map[byte]byte{
+	'!': '1', '"': '2', '#': '3', '$': '4', '%': '5', '&': '6', '\'': '7', '(': '8', ')': '9',
+	'[': ':', ']': ';', '<': ',', '>': '.', '?': '/',
+}
+
+// Keyboard is the 8x8 key matrix scanned through CIA 1: PA selects columns by pulling them low and PB reads
+// the rows, a pressed key connects its column to its row. Host characters are typed one at a time, holding
+// the keys for a few jiffies and releasing them as long before the next. Letters are typed unshifted whatever
+// their host case.
+type Keyboard struct {
+	Host hostio.Serial
+
+	scheduler  *scheduler.Scheduler
+	holdCycles uint64
+	held       []int
+	queue      [][]int
+}
+
+// NewKeyboard creates a keyboard typing host characters for a cpu running at clock Hz
+func NewKeyboard(host hostio.Serial, s *scheduler.Scheduler, clock float64) *Keyboard {
+	k := &Keyboard{Host: host, scheduler: s, holdCycles: uint64(clock * 0.05)}
+	s.After(k.holdCycles, k.poll)
+	return k
+}
+
+// Keys returns the matrix positions typing a host character, nothing when the keyboard has no such character
+func Keys(c byte) []int {
+	switch {
+	case c >= 'a' && c <= 'z':
+		c -= 'a' - 'A'
+	case c == '\n':
+		c = '\r'
+	case c == 0x08:
+		c = 0x7F
+	}
+	shift := false
+	if unshifted, ok := shifted[c]; ok {
+		c, shift = unshifted, true
+	}
+	for key, char := range layout {
+		if char == c && c != 0 {
+			if shift {
+				return []int{KeyLShift, key}
+			}
+			return []int{key}
+		}
+	}
+	return nil
+}
+
+// Type queues keys to be pressed together, after the ones already queued
+func (k *Keyboard) Type(keys ...int) {
+	k.queue = append(k.queue, keys)
+}
+
+// Rows returns the PB levels for the columns selected by PA
+func (k *Keyboard) Rows(columns byte) byte {
+	rows := byte(0xFF)
+	for _, key := range k.held {
+		if columns&(1<<(key/8)) == 0 {
+			rows &^= 1 << (key % 8)
+		}
+	}
+	return rows
+}
+
+// poll releases the keys held, or presses the next queued or typed keys
+func (k *Keyboard) poll() {
+	k.scheduler.After(k.holdCycles, k.poll)
+	if k.held != nil {
+		k.held = nil
+		return
+	}
+	if len(k.queue) > 0 {
+		k.held, k.queue = k.queue[0], k.queue[1:]
+		return
+	}
+	for {
+		c, ok := k.Host.Poll()
+		if !ok {
+			return
+		}
+		if keys := Keys(c); keys != nil {
+			k.held = keys
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package c64
+
+import (
+	"fmt"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/cia6526"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("c64", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		options := struct {
+			// ROM images, raw binaries
+			Basic, Kernal, Chargen string
+			Host                   string // see hostio.Open
+			Screen                 string // ansi, text or none
+			Video                  string // pal or ntsc
+		}{Host: "stdio", Screen: ScreenANSI, Video: PAL}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		if options.Video != PAL && options.Video != NTSC {
+			return nil, fmt.Errorf("unknown video standard %q, expected %s or %s", options.Video, PAL, NTSC)
+		}
+		var roms ROMs
+		for _, rom := range []struct {
+			file  string
+			image *[]byte
+		}{{options.Basic, &roms.Basic}, {options.Kernal, &roms.Kernal}, {options.Chargen, &roms.Chargen}} {
+			if rom.file == "" {
+				continue
+			}
+			var err error
+			if *rom.image, err = m.ReadFile(rom.file); err != nil {
+				return nil, err
+			}
+		}
+		host, err := m.OpenHost(config, options.Host)
+		if err != nil {
+			return nil, err
+		}
+		clock, tod := 985248.0, 50.0
+		if options.Video == NTSC {
+			clock, tod = 1022727, 60
+		}
+		clock = m.ClockOr(clock)
+		cia1 := cia6526.New(m.Cpu.IRQLine().Pin(), clock, tod)
+		cia2 := cia6526.New(m.Cpu.NMILine().Pin(), clock, tod)
+		m.Scheduler.AddTicker(cia1)
+		m.Scheduler.AddTicker(cia2)
+		vic := NewVIC(m.Cpu.IRQLine().Pin(), m.Scheduler, options.Video)
+		return New(roms, cia1, cia2, vic, host, m.Scheduler, clock, options.Screen)
+	})
+}
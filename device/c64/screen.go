@@ -0,0 +1,153 @@
+package c64
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+)
+
+// Screen rendering modes
+const (
+	// ScreenANSI redraws the screen in place with ANSI escape sequences whenever it changes, reverse characters
+	// in reverse video
+	ScreenANSI = "ansi"
+	// ScreenText prints the screen in a box whenever it changes and then stays the same for a frame,
+	// reverse characters are shown plain so the blinking cursor does not count as a change
+	ScreenText = "text"
+	// ScreenNone draws nothing
+	ScreenNone = "none"
+)
+
+// Screen size in characters
+const (
+	Columns = 40
+	Rows    = 25
+)
+
+// Screen renders the 40x25 text screen from the screen memory selected by the VIC to the host
+type Screen struct {
+	Host hostio.Serial
+
+	c64      *C64
+	mode     string
+	previous string
+	shown    string
+}
+
+// NewScreen creates the renderer for one of the modes ScreenANSI, ScreenText or ScreenNone
+func NewScreen(c *C64, host hostio.Serial, mode string) (*Screen, error) {
+	switch mode {
+	case ScreenANSI, ScreenText, ScreenNone:
+	default:
+		return nil, fmt.Errorf("unknown screen mode %q, expected %s, %s or %s", mode, ScreenANSI, ScreenText, ScreenNone)
+	}
+	return &Screen{Host: host, c64: c, mode: mode}, nil
+}
+
+// Codes returns the screen codes, a row each
+func (s *Screen) Codes() [][]byte {
+	base := s.c64.VICBank() + uint16(s.c64.VIC.Peek(RegMemory)>>4)*0x400
+	codes := make([][]byte, Rows)
+	for row := range codes {
+		start := int(base) + row*Columns
+		codes[row] = s.c64.RAM()[start : start+Columns]
+	}
+	return codes
+}
+
+// Lines returns the screen as text, reverse characters shown plain
+func (s *Screen) Lines() []string {
+	lower := s.c64.VIC.Peek(RegMemory)&0x02 != 0
+	lines := make([]string, Rows)
+	for row, codes := range s.Codes() {
+		line := make([]rune, Columns)
+		for i, code := range codes {
+			line[i] = Glyph(code, lower)
+		}
+		lines[row] = string(line)
+	}
+	return lines
+}
+
+// Frame draws the screen, it is called once per video frame
+func (s *Screen) Frame() {
+	switch s.mode {
+	case ScreenANSI:
+		s.ansi()
+	case ScreenText:
+		text := strings.Join(s.Lines(), "|\r\n|")
+		settled := text == s.previous
+		s.previous = text
+		if !settled || text == s.shown {
+			return
+		}
+		s.shown = text
+		border := "+" + strings.Repeat("-", Columns) + "+\r\n"
+		s.Host.Write([]byte(border + "|" + text + "|\r\n" + border))
+	}
+}
+
+func (s *Screen) ansi() {
+	lower := s.c64.VIC.Peek(RegMemory)&0x02 != 0
+	var b strings.Builder
+	for row, codes := range s.Codes() {
+		fmt.Fprintf(&b, "\x1b[%dH", row+1)
+		reverse := false
+		for _, code := range codes {
+			if r := code&0x80 != 0; r != reverse {
+				reverse = r
+				if r {
+					b.WriteString("\x1b[7m")
+				} else {
+					b.WriteString("\x1b[27m")
+				}
+			}
+			b.WriteRune(Glyph(code, lower))
+		}
+		if reverse {
+			b.WriteString("\x1b[27m")
+		}
+	}
+	text := b.String()
+	if text == s.shown {
+		return
+	}
+	if s.shown == "" {
+		s.Host.Write([]byte("\x1b[2J"))
+	}
+	s.shown = text
+	s.Host.Write([]byte(text))
+}
+
+// graphics approximates the PETSCII graphics characters of screen codes $40-$7F in the upper case set
+var graphics = []rune("─♠│────││╮╰╯└╲╱┌┐●─♥│╭╳○♣│♦┼▒│π◥" +
+	" ▌▄▔▁▏▒▕▒◤▕├▗└┐▂┌┴┬┤▏▍▐▔▀▃▗▖▝┘▘▚")
+
+// Glyph returns the character shown for a screen code in the upper case or lower case set,
+// the reverse bit is ignored
+func Glyph(code byte, lower bool) rune {
+	code &= 0x7F
+	switch {
+	case code == 0x00:
+		return '@'
+	case code < 0x1B && lower:
+		return rune('a' + code - 1)
+	case code < 0x1B:
+		return rune('A' + code - 1)
+	case code < 0x20:
+		return []rune("[£]↑←")[code-0x1B]
+	case code < 0x40:
+		return rune(code)
+	case code == 0x40:
+		return '─'
+	case code < 0x5B && lower:
+		return rune('A' + code - 0x41)
+	case code >= 0x5B && code < 0x60 && lower:
+		return []rune("┼▒│▒▒")[code-0x5B]
+	case code == 0x7A && lower:
+		return '✓'
+	default:
+		return graphics[code-0x40]
+	}
+}
@@ -0,0 +1,156 @@
+package c64
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// VIC-II registers used by the stub
+const (
+	RegControl1  = 0x11 // bit 7: bit 8 of the raster line
+	RegRaster    = 0x12
+	RegMemory    = 0x18 // bits 4-7: screen at 1K steps in the VIC bank, bit 1: lower case characters
+	RegInterrupt = 0x19 // latched interrupts, writing 1s clears them
+	RegIntEnable = 0x1A
+)
+
+// IntRaster is the raster compare bit of the interrupt registers
+const IntRaster = 0x01
+
+// Video standards
+const (
+	PAL  = "pal"
+	NTSC = "ntsc"
+)
+
+// VIC is a stub of the VIC-II video chip that draws nothing: registers are stored, the raster counter advances
+// one line per line time and the raster compare interrupt fires. Bad lines and sprite DMA do not stall the cpu.
+type VIC struct {
+	// OnFrame is told when the raster counter wraps to line 0
+	OnFrame func()
+
+	irq           *cpu.InterruptPin
+	scheduler     *scheduler.Scheduler
+	lines         int
+	cyclesPerLine uint64
+	state         vicState
+}
+
+type vicState struct {
+	Registers [0x40]byte
+	Raster    int
+	Compare   int
+	Latched   byte
+}
+
+// NewVIC creates the stub for a video standard, PAL (312 lines of 63 cycles) or NTSC (263 lines of 65 cycles)
+func NewVIC(irq *cpu.InterruptPin, s *scheduler.Scheduler, standard string) *VIC {
+	v := &VIC{irq: irq, scheduler: s, lines: 312, cyclesPerLine: 63}
+	if standard == NTSC {
+		v.lines, v.cyclesPerLine = 263, 65
+	}
+	s.After(v.cyclesPerLine, v.line)
+	return v
+}
+
+// Raster returns the current raster line
+func (v *VIC) Raster() int {
+	return v.state.Raster
+}
+
+func (v *VIC) line() {
+	v.scheduler.After(v.cyclesPerLine, v.line)
+	s := &v.state
+	s.Raster++
+	if s.Raster == v.lines {
+		s.Raster = 0
+		if v.OnFrame != nil {
+			v.OnFrame()
+		}
+	}
+	if s.Raster == s.Compare {
+		s.Latched |= IntRaster
+		v.updateIRQ()
+	}
+}
+
+func (v *VIC) Read(address uint16) byte {
+	return v.Peek(address)
+}
+
+// Peek implements memory.Peeker, no VIC register has read side effects
+func (v *VIC) Peek(address uint16) byte {
+	s := &v.state
+	address &= 0x3F
+	switch {
+	case address == RegControl1:
+		return s.Registers[address]&0x7F | byte(s.Raster>>8)<<7
+	case address == RegRaster:
+		return byte(s.Raster)
+	case address == RegInterrupt:
+		value := s.Latched | 0x70
+		if v.IRQ() {
+			value |= 0x80
+		}
+		return value
+	case address == RegIntEnable:
+		return s.Registers[address] | 0xF0
+	case address == 0x16:
+		return s.Registers[address] | 0xC0
+	case address == RegMemory:
+		return s.Registers[address] | 0x01
+	case address == 0x1E || address == 0x1F:
+		return 0 // collisions
+	case address >= 0x20 && address <= 0x2E:
+		return s.Registers[address] | 0xF0
+	case address > 0x2E:
+		return 0xFF
+	default:
+		return s.Registers[address]
+	}
+}
+
+func (v *VIC) Write(address uint16, value byte) {
+	s := &v.state
+	address &= 0x3F
+	switch address {
+	case RegControl1:
+		s.Compare = s.Compare&0xFF | int(value>>7)<<8
+	case RegRaster:
+		s.Compare = s.Compare&0x100 | int(value)
+		return
+	case RegInterrupt:
+		s.Latched &^= value & 0x0F
+		v.updateIRQ()
+		return
+	case RegIntEnable:
+		s.Registers[address] = value & 0x0F
+		v.updateIRQ()
+		return
+	}
+	s.Registers[address] = value
+}
+
+// IRQ reports the level of the IRQ output
+func (v *VIC) IRQ() bool {
+	return v.state.Latched&v.state.Registers[RegIntEnable] != 0
+}
+
+func (v *VIC) updateIRQ() {
+	v.irq.Set(v.IRQ())
+}
+
+// SaveState implements memory.Stateful
+func (v *VIC) SaveState() ([]byte, error) {
+	return json.Marshal(v.state)
+}
+
+func (v *VIC) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &v.state); err != nil {
+		return err
+	}
+	v.updateIRQ()
+	return nil
+}
@@ -0,0 +1,555 @@
+package cia6526
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+)
+
+// Registers, selected by RS0-RS3
+const (
+	RegPRA   = 0x0
+	RegPRB   = 0x1
+	RegDDRA  = 0x2
+	RegDDRB  = 0x3
+	RegTALO  = 0x4
+	RegTAHI  = 0x5
+	RegTBLO  = 0x6
+	RegTBHI  = 0x7
+	RegTOD10 = 0x8 // tenths of seconds, BCD
+	RegTODS  = 0x9 // seconds, BCD
+	RegTODM  = 0xA // minutes, BCD
+	RegTODH  = 0xB // hours, BCD 1-12 with bit 7 set for PM
+	RegSDR   = 0xC
+	RegICR   = 0xD
+	RegCRA   = 0xE
+	RegCRB   = 0xF
+)
+
+// Interrupt control register bits
+const (
+	IntTA    = 1 << iota // timer A underflow
+	IntTB                // timer B underflow
+	IntAlarm             // the time of day matches the alarm
+	IntSP                // serial port: a byte was sent or received
+	IntFlag              // negative edge on the FLAG input
+	_
+	_
+	IntAny // read: any enabled interrupt is active, write: set (1) or clear (0) the mask bits written
+)
+
+// Control register bits, CRA and CRB
+const (
+	ControlStart    = 0x01
+	ControlPBOn     = 0x02 // timer output on PB6 (timer A) or PB7 (timer B)
+	ControlToggle   = 0x04 // the output toggles at each underflow instead of pulsing for a cycle
+	ControlOneShot  = 0x08
+	ControlLoad     = 0x10 // strobe: load the counter from the latch
+	ControlCountCNT = 0x20 // CRA: count CNT edges instead of cycles
+	ControlSPOut    = 0x40 // CRA: the serial port shifts out at half the timer A underflow rate
+	ControlTOD50Hz  = 0x80 // CRA: the TOD input runs at 50 Hz instead of 60 Hz
+	ControlAlarm    = 0x80 // CRB: TOD register writes set the alarm
+	ControlBMode    = 0x60 // CRB: what timer B counts, see CountCycles...CountTAWithCNT
+)
+
+// Timer B input modes, bits 5-6 of CRB
+const (
+	CountCycles    = 0x00
+	CountCNT       = 0x20
+	CountTA        = 0x40 // timer A underflows, cascading the timers into 32 bits
+	CountTAWithCNT = 0x60 // timer A underflows while CNT is high
+)
+
+// CIA is a MOS 6526 Complex Interface Adapter: two 8 bit ports, two 16 bit timers that can be cascaded,
+// a BCD time of day clock with an alarm, a serial shift register and the interrupt control register.
+// It is advanced by Tick once per cpu cycle. The ICR is cleared when read, reads see the chip as it was at
+// the start of the instruction since devices are brought up to date at instruction boundaries, and
+// debugging tools use Peek which does not clear it.
+type CIA struct {
+	PortA Port
+	PortB Port
+
+	// OnSerial receives the bytes shifted out of the serial port
+	OnSerial func(b byte)
+
+	irq     *cpu.InterruptPin
+	todRate uint64 // cpu cycles per period of the TOD input
+	state   state
+}
+
+// state is everything a save state needs
+type state struct {
+	PRA, PRB, DDRA, DDRB byte
+	InputA, InputB       byte
+
+	TA, TB timer
+	PB6    bool // timer A output
+	PB7    bool // timer B output
+
+	TOD, Alarm [4]byte // tenths, seconds, minutes, hours
+	TODLatch   [4]byte
+	TODLatched bool // reading the hours freezes the registers until the tenths are read
+	TODStopped bool // writing the hours stops the clock until the tenths are written
+	TODCycles  uint64
+	TODTicks   int
+
+	SDR        byte
+	Shifter    byte
+	ShiftCount int // timer A underflows left for the byte being shifted out, 0 when idle
+	ShiftFull  bool
+
+	CNT       bool
+	ICR, Mask byte
+}
+
+type timer struct {
+	Counter, Latch uint16
+	Control        byte
+	Pulse          bool // pulse output mode: the output is high for the current cycle
+}
+
+// Port is one of the two 8 bit ports
+type Port struct {
+	// OnWrite, when set, is told about the port output whenever the output register or the data direction
+	// register changes: output holds the levels of the pins configured as outputs (ddr bits set)
+	OnWrite func(output, ddr byte)
+	// OnRead, when set, supplies the input pin levels on every read, e.g. a keyboard matrix scanned through the other port
+	OnRead func() byte
+
+	cia *CIA
+	b   bool
+}
+
+// Set drives the port pins from outside, bits of pins configured as outputs are ignored when reading
+func (p *Port) Set(input byte) {
+	if p.b {
+		p.cia.state.InputB = input
+	} else {
+		p.cia.state.InputA = input
+	}
+}
+
+// Output returns the levels of the pins, the ones configured as inputs read as the driven input
+func (p *Port) Output() byte {
+	s := &p.cia.state
+	if p.b {
+		return p.cia.timerOutputs(s.PRB&s.DDRB | p.input()&^s.DDRB)
+	}
+	return s.PRA&s.DDRA | p.input()&^s.DDRA
+}
+
+func (p *Port) input() byte {
+	if p.OnRead != nil {
+		return p.OnRead()
+	}
+	if p.b {
+		return p.cia.state.InputB
+	}
+	return p.cia.state.InputA
+}
+
+func (p *Port) written() {
+	if p.OnWrite == nil {
+		return
+	}
+	s := &p.cia.state
+	if p.b {
+		p.OnWrite(p.cia.timerOutputs(s.PRB&s.DDRB), s.DDRB)
+	} else {
+		p.OnWrite(s.PRA&s.DDRA, s.DDRA)
+	}
+}
+
+// New creates a CIA for a cpu running at clock Hz with the TOD input at todFrequency Hz,
+// irq may be nil when the IRQ output is not connected
+func New(irq *cpu.InterruptPin, clock, todFrequency float64) *CIA {
+	c := &CIA{irq: irq, todRate: uint64(clock / todFrequency)}
+	if c.todRate == 0 {
+		c.todRate = 1
+	}
+	c.PortA.cia = c
+	c.PortB = Port{cia: c, b: true}
+	c.Reset()
+	return c
+}
+
+// Reset clears the registers like the RES input, the timer latches are set to $FFFF
+func (c *CIA) Reset() {
+	c.state = state{
+		InputA: 0xFF, InputB: 0xFF,
+		TA:  timer{Counter: 0xFFFF, Latch: 0xFFFF},
+		TB:  timer{Counter: 0xFFFF, Latch: 0xFFFF},
+		TOD: [4]byte{0, 0, 0, 0x01},
+	}
+	c.updateIRQ()
+}
+
+// timerOutputs puts the timer outputs on PB6 and PB7 when enabled
+func (c *CIA) timerOutputs(value byte) byte {
+	s := &c.state
+	if s.TA.Control&ControlPBOn != 0 {
+		value = value&^0x40 | bit(s.TA.output(s.PB6), 0x40)
+	}
+	if s.TB.Control&ControlPBOn != 0 {
+		value = value&^0x80 | bit(s.TB.output(s.PB7), 0x80)
+	}
+	return value
+}
+
+func (t *timer) output(toggle bool) bool {
+	if t.Control&ControlToggle != 0 {
+		return toggle
+	}
+	return t.Pulse
+}
+
+func bit(set bool, mask byte) byte {
+	if set {
+		return mask
+	}
+	return 0
+}
+
+func (c *CIA) Read(address uint16) byte {
+	s := &c.state
+	switch address & 0xF {
+	case RegTODH:
+		if !s.TODLatched {
+			s.TODLatch = s.TOD
+			s.TODLatched = true
+		}
+		return s.TODLatch[3]
+	case RegTOD10:
+		value := c.Peek(address)
+		s.TODLatched = false
+		return value
+	case RegICR:
+		value := c.Peek(address)
+		s.ICR = 0
+		c.updateIRQ()
+		return value
+	}
+	return c.Peek(address)
+}
+
+// Peek implements memory.Peeker, it reads a register without clearing the ICR or latching the TOD
+func (c *CIA) Peek(address uint16) byte {
+	s := &c.state
+	switch address & 0xF {
+	case RegPRA:
+		return c.PortA.Output()
+	case RegPRB:
+		return c.PortB.Output()
+	case RegDDRA:
+		return s.DDRA
+	case RegDDRB:
+		return s.DDRB
+	case RegTALO:
+		return byte(s.TA.Counter)
+	case RegTAHI:
+		return byte(s.TA.Counter >> 8)
+	case RegTBLO:
+		return byte(s.TB.Counter)
+	case RegTBHI:
+		return byte(s.TB.Counter >> 8)
+	case RegTOD10, RegTODS, RegTODM, RegTODH:
+		tod := s.TOD
+		if s.TODLatched {
+			tod = s.TODLatch
+		}
+		return tod[address&0x3]
+	case RegSDR:
+		return s.SDR
+	case RegICR:
+		return s.ICR | bit(s.ICR&s.Mask != 0, IntAny)
+	case RegCRA:
+		return s.TA.Control
+	default:
+		return s.TB.Control
+	}
+}
+
+func (c *CIA) Write(address uint16, value byte) {
+	s := &c.state
+	switch address & 0xF {
+	case RegPRA:
+		s.PRA = value
+		c.PortA.written()
+	case RegPRB:
+		s.PRB = value
+		c.PortB.written()
+	case RegDDRA:
+		s.DDRA = value
+		c.PortA.written()
+	case RegDDRB:
+		s.DDRB = value
+		c.PortB.written()
+	case RegTALO:
+		s.TA.Latch = s.TA.Latch&0xFF00 | uint16(value)
+	case RegTAHI:
+		s.TA.writeHigh(value)
+	case RegTBLO:
+		s.TB.Latch = s.TB.Latch&0xFF00 | uint16(value)
+	case RegTBHI:
+		s.TB.writeHigh(value)
+	case RegTOD10, RegTODS, RegTODM, RegTODH:
+		c.writeTOD(int(address&0x3), value)
+	case RegSDR:
+		s.SDR = value
+		if s.TA.Control&ControlSPOut != 0 {
+			s.ShiftFull = true
+			c.startShift()
+		}
+	case RegICR:
+		if value&IntAny != 0 {
+			s.Mask |= value &^ IntAny
+		} else {
+			s.Mask &^= value
+		}
+		c.updateIRQ()
+	case RegCRA:
+		c.writeControl(&s.TA, value, &s.PB6)
+		if value&ControlSPOut == 0 {
+			s.ShiftCount = 0
+		}
+	case RegCRB:
+		c.writeControl(&s.TB, value, &s.PB7)
+	}
+}
+
+// writeHigh sets the high latch, a stopped timer is loaded right away
+func (t *timer) writeHigh(value byte) {
+	t.Latch = t.Latch&0x00FF | uint16(value)<<8
+	if t.Control&ControlStart == 0 {
+		t.Counter = t.Latch
+	}
+}
+
+func (c *CIA) writeControl(t *timer, value byte, toggle *bool) {
+	if value&ControlStart != 0 && t.Control&ControlStart == 0 {
+		// starting the timer sets the toggle output high
+		*toggle = true
+	}
+	if value&ControlLoad != 0 {
+		t.Counter = t.Latch
+	}
+	t.Control = value &^ ControlLoad
+	c.PortB.written()
+}
+
+func (c *CIA) writeTOD(i int, value byte) {
+	s := &c.state
+	if s.TB.Control&ControlAlarm != 0 {
+		s.Alarm[i] = value
+		return
+	}
+	switch i {
+	case 3:
+		s.TODStopped = true
+	case 0:
+		s.TODStopped = false
+		s.TODCycles, s.TODTicks = 0, 0
+	}
+	s.TOD[i] = value
+	c.checkAlarm()
+}
+
+// Tick advances the chip by one cycle
+func (c *CIA) Tick() {
+	s := &c.state
+	s.TA.Pulse, s.TB.Pulse = false, false
+
+	if s.TA.Control&ControlStart != 0 && s.TA.Control&ControlCountCNT == 0 && c.count(&s.TA, IntTA, &s.PB6) {
+		c.underflowA()
+	}
+	if s.TB.Control&ControlStart != 0 && s.TB.Control&ControlBMode == CountCycles {
+		c.count(&s.TB, IntTB, &s.PB7)
+	}
+
+	s.TODCycles++
+	if s.TODCycles >= c.todRate {
+		s.TODCycles = 0
+		c.todTick()
+	}
+}
+
+// count decrements a timer and reports whether it underflowed
+func (c *CIA) count(t *timer, flag byte, toggle *bool) bool {
+	if t.Counter != 0 {
+		t.Counter--
+		return false
+	}
+	t.Counter = t.Latch
+	if t.Control&ControlOneShot != 0 {
+		t.Control &^= ControlStart
+	}
+	t.Pulse = true
+	*toggle = !*toggle
+	c.setFlags(flag)
+	return true
+}
+
+// PulseCNT is a positive edge on the CNT input, timers set to count CNT see it
+func (c *CIA) PulseCNT() {
+	s := &c.state
+	s.CNT = true
+	if s.TA.Control&ControlStart != 0 && s.TA.Control&ControlCountCNT != 0 && c.count(&s.TA, IntTA, &s.PB6) {
+		c.underflowA()
+	}
+	if s.TB.Control&ControlStart != 0 && s.TB.Control&ControlBMode == CountCNT {
+		c.count(&s.TB, IntTB, &s.PB7)
+	}
+}
+
+// underflowA clocks the serial port and timer B when it counts timer A underflows
+func (c *CIA) underflowA() {
+	s := &c.state
+	c.shift()
+	if s.TB.Control&ControlStart == 0 {
+		return
+	}
+	switch s.TB.Control & ControlBMode {
+	case CountTA:
+		c.count(&s.TB, IntTB, &s.PB7)
+	case CountTAWithCNT:
+		if s.CNT {
+			c.count(&s.TB, IntTB, &s.PB7)
+		}
+	}
+}
+
+// SetCNT sets the level of the CNT input, timer B can count timer A underflows only while it is high
+func (c *CIA) SetCNT(level bool) {
+	if level && !c.state.CNT {
+		c.PulseCNT()
+		return
+	}
+	c.state.CNT = level
+}
+
+// Flag is a negative edge on the FLAG input
+func (c *CIA) Flag() {
+	c.setFlags(IntFlag)
+}
+
+// ShiftIn delivers a byte clocked into the serial port from outside while it is in input mode
+func (c *CIA) ShiftIn(b byte) {
+	if c.state.TA.Control&ControlSPOut != 0 {
+		return
+	}
+	c.state.SDR = b
+	c.setFlags(IntSP)
+}
+
+func (c *CIA) startShift() {
+	s := &c.state
+	if s.ShiftCount > 0 || !s.ShiftFull {
+		return
+	}
+	s.Shifter = s.SDR
+	s.ShiftFull = false
+	s.ShiftCount = 16 // a bit every other timer A underflow
+}
+
+// shift clocks the serial port output at a timer A underflow
+func (c *CIA) shift() {
+	s := &c.state
+	if s.TA.Control&ControlSPOut == 0 || s.ShiftCount == 0 {
+		return
+	}
+	s.ShiftCount--
+	if s.ShiftCount > 0 {
+		return
+	}
+	if c.OnSerial != nil {
+		c.OnSerial(s.Shifter)
+	}
+	c.setFlags(IntSP)
+	c.startShift()
+}
+
+// todTick is a period of the TOD input, the clock advances a tenth every 5 or 6 of them
+func (c *CIA) todTick() {
+	s := &c.state
+	if s.TODStopped {
+		return
+	}
+	s.TODTicks++
+	ticks := 6
+	if s.TA.Control&ControlTOD50Hz != 0 {
+		ticks = 5
+	}
+	if s.TODTicks < ticks {
+		return
+	}
+	s.TODTicks = 0
+
+	tod := &s.TOD
+	tod[0] = (tod[0] + 1) & 0x0F
+	if tod[0] == 10 {
+		tod[0] = 0
+		if tod[1] = bcdIncrement(tod[1]); tod[1] == 0x60 {
+			tod[1] = 0
+			if tod[2] = bcdIncrement(tod[2]); tod[2] == 0x60 {
+				tod[2] = 0
+				tod[3] = nextHour(tod[3])
+			}
+		}
+	}
+	c.checkAlarm()
+}
+
+func bcdIncrement(b byte) byte {
+	b++
+	if b&0x0F == 0x0A {
+		b += 0x06
+	}
+	return b
+}
+
+// nextHour advances the 12 hour clock, 11 to 12 flips AM and PM
+func nextHour(h byte) byte {
+	pm := h & 0x80
+	hour := h & 0x1F
+	switch hour {
+	case 0x11:
+		return 0x12 | pm ^ 0x80
+	case 0x12:
+		return 0x01 | pm
+	default:
+		return bcdIncrement(hour) | pm
+	}
+}
+
+func (c *CIA) checkAlarm() {
+	if c.state.TOD == c.state.Alarm {
+		c.setFlags(IntAlarm)
+	}
+}
+
+func (c *CIA) setFlags(flags byte) {
+	c.state.ICR |= flags
+	c.updateIRQ()
+}
+
+func (c *CIA) updateIRQ() {
+	c.irq.Set(c.IRQ())
+}
+
+// IRQ reports the level of the IRQ output
+func (c *CIA) IRQ() bool {
+	return c.state.ICR&c.state.Mask != 0
+}
+
+// SaveState implements memory.Stateful
+func (c *CIA) SaveState() ([]byte, error) {
+	return json.Marshal(c.state)
+}
+
+func (c *CIA) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &c.state); err != nil {
+		return err
+	}
+	c.updateIRQ()
+	return nil
+}
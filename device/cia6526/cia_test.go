@@ -0,0 +1,161 @@
+package cia6526
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a CIA at 60 Hz from a 600 Hz clock: a TOD tenth every 60 cycles
+func newCIA() (*CIA, *cpu.InterruptLine) {
+	line := &cpu.InterruptLine{}
+	return New(line.Pin(), 600, 60), line
+}
+
+func tick(c *CIA, cycles int) {
+	for i := 0; i < cycles; i++ {
+		c.Tick()
+	}
+}
+
+func TestCIA_timerA(t *testing.T) {
+	c, line := newCIA()
+	c.Write(RegICR, IntAny|IntTA)
+	c.Write(RegTALO, 9)
+	c.Write(RegTAHI, 0)
+	c.Write(RegCRA, ControlStart|ControlLoad)
+
+	tick(c, 9)
+	assert.Equal(t, byte(0), c.Peek(RegTALO))
+	assert.False(t, line.Active())
+	tick(c, 1)
+	assert.True(t, line.Active(), "latch+1 cycles")
+	assert.Equal(t, byte(9), c.Peek(RegTALO), "reloaded")
+
+	assert.Equal(t, byte(IntAny|IntTA), c.Peek(RegICR))
+	assert.Equal(t, byte(IntAny|IntTA), c.Read(RegICR))
+	assert.False(t, line.Active(), "reading the ICR clears it")
+	assert.Equal(t, byte(0), c.Read(RegICR))
+
+	tick(c, 10)
+	assert.True(t, line.Active(), "continuous mode")
+}
+
+func TestCIA_oneShotAndMask(t *testing.T) {
+	c, line := newCIA()
+	c.Write(RegTALO, 2)
+	c.Write(RegTAHI, 0)
+	c.Write(RegCRA, ControlStart|ControlOneShot)
+	tick(c, 3)
+	assert.Equal(t, byte(IntTA), c.Peek(RegICR), "flag without the mask bit")
+	assert.False(t, line.Active())
+	assert.Zero(t, c.Peek(RegCRA)&ControlStart, "one-shot stops")
+
+	c.Write(RegICR, IntAny|IntTA)
+	assert.True(t, line.Active(), "unmasking a pending flag")
+	c.Write(RegICR, IntTA)
+	assert.False(t, line.Active())
+}
+
+func TestCIA_cascade(t *testing.T) {
+	c, _ := newCIA()
+	c.Write(RegTALO, 1)
+	c.Write(RegTAHI, 0)
+	c.Write(RegTBLO, 2)
+	c.Write(RegTBHI, 0)
+	c.Write(RegCRB, ControlStart|CountTA)
+	c.Write(RegCRA, ControlStart)
+
+	tick(c, 2*2)
+	assert.Equal(t, byte(IntTA), c.Peek(RegICR))
+	tick(c, 2)
+	assert.Equal(t, byte(IntTA|IntTB), c.Peek(RegICR), "three timer A underflows")
+}
+
+func TestCIA_cascadeCNT(t *testing.T) {
+	c, _ := newCIA()
+	c.Write(RegTALO, 0)
+	c.Write(RegTAHI, 0)
+	c.Write(RegTBLO, 1)
+	c.Write(RegTBHI, 0)
+	c.Write(RegCRB, ControlStart|CountTA)
+	c.Write(RegCRA, ControlStart|ControlCountCNT)
+
+	tick(c, 10)
+	assert.Zero(t, c.Peek(RegICR), "timer A counts CNT edges, not cycles")
+	c.PulseCNT()
+	assert.Equal(t, byte(IntTA), c.Peek(RegICR))
+	c.PulseCNT()
+	assert.Equal(t, byte(IntTA|IntTB), c.Peek(RegICR), "timer B counts the underflows caused by CNT")
+}
+
+func TestCIA_timerOutput(t *testing.T) {
+	c, _ := newCIA()
+	c.Write(RegTALO, 1)
+	c.Write(RegTAHI, 0)
+	c.Write(RegCRA, ControlStart|ControlPBOn|ControlToggle)
+	assert.Equal(t, byte(0x40), c.Read(RegPRB)&0x40)
+	tick(c, 2)
+	assert.Equal(t, byte(0), c.Read(RegPRB)&0x40)
+	tick(c, 2)
+	assert.Equal(t, byte(0x40), c.Read(RegPRB)&0x40)
+}
+
+func TestCIA_tod(t *testing.T) {
+	c, line := newCIA()
+	c.Write(RegICR, IntAny|IntAlarm)
+	c.Write(RegCRB, ControlAlarm)
+	c.Write(RegTODH, 0x12)
+	c.Write(RegTODM, 0x00)
+	c.Write(RegTODS, 0x00)
+	c.Write(RegTOD10, 0x01)
+	c.Write(RegCRB, 0)
+
+	c.Write(RegTODH, 0x11|0x80)
+	c.Write(RegTODM, 0x59)
+	c.Write(RegTODS, 0x59)
+	tick(c, 600)
+	assert.Equal(t, byte(0x59), c.Read(RegTODS), "stopped until the tenths are written")
+	c.Write(RegTOD10, 0x09)
+
+	tick(c, 60)
+	assert.Equal(t, byte(0x12), c.Read(RegTODH), "11 PM to 12 AM")
+	tick(c, 60)
+	assert.Equal(t, byte(0x00), c.Read(RegTODS), "latched by the hours read")
+	assert.Equal(t, byte(0x00), c.Read(RegTOD10))
+	assert.True(t, line.Active(), "alarm at 12:00:00.1")
+	assert.Equal(t, byte(0x01), c.Read(RegTOD10))
+}
+
+func TestCIA_serialOutput(t *testing.T) {
+	c, _ := newCIA()
+	var sent []byte
+	c.OnSerial = func(b byte) { sent = append(sent, b) }
+	c.Write(RegTALO, 1) // an underflow every 2 cycles, a byte in 32
+	c.Write(RegTAHI, 0)
+	c.Write(RegCRA, ControlStart|ControlSPOut)
+	c.Write(RegSDR, 0xA5)
+	c.Write(RegSDR, 0x5A)
+	tick(c, 31)
+	assert.Empty(t, sent)
+	tick(c, 1)
+	assert.Equal(t, []byte{0xA5}, sent)
+	assert.Equal(t, byte(IntSP), c.Read(RegICR)&IntSP)
+	tick(c, 32)
+	assert.Equal(t, []byte{0xA5, 0x5A}, sent)
+}
+
+func TestCIA_portRead(t *testing.T) {
+	c, _ := newCIA()
+	c.Write(RegDDRA, 0xFF)
+	c.Write(RegPRA, 0xFE)
+	c.PortB.OnRead = func() byte {
+		if c.PortA.Output() == 0xFE {
+			return 0xEF
+		}
+		return 0xFF
+	}
+	assert.Equal(t, byte(0xEF), c.Read(RegPRB))
+}
@@ -0,0 +1,25 @@
+package cia6526
+
+import (
+	"fmt"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("cia6526", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		options := struct {
+			TOD machine.Frequency // mains frequency on the TOD input
+		}{TOD: 60}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		if options.TOD <= 0 {
+			return nil, fmt.Errorf("tod frequency must be positive")
+		}
+		c := New(m.Pin(config), m.ClockOr(1e6), float64(options.TOD))
+		m.Scheduler.AddTicker(c)
+		return c, nil
+	})
+}
@@ -0,0 +1,40 @@
+package cia6526
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const board = `
+clock: 985248 Hz
+memory:
+  - {type: ram, start: $0000, end: $CFFF}
+devices:
+  - {name: cia1, type: cia6526, start: $DC00, end: $DCFF, irq: irq}
+  - {name: cia2, type: cia6526, start: $DD00, end: $DDFF, irq: nmi, options: {tod: 50}}
+`
+
+func TestCIA_machine(t *testing.T) {
+	config, err := machine.Parse([]byte(board))
+	require.NoError(t, err)
+	m, err := machine.New(config, ".")
+	require.NoError(t, err)
+
+	for _, base := range []uint16{0xDC00, 0xDD00} {
+		m.Bus.Write(base+RegICR, IntAny|IntTA)
+		m.Bus.Write(base+RegTALO, 99)
+		m.Bus.Write(base+RegTAHI, 0)
+		m.Bus.Write(base+RegCRA, ControlStart)
+	}
+	m.Cpu.Cycles += 100
+	m.Scheduler.Sync()
+	assert.True(t, m.Cpu.IRQLine().Active())
+	assert.True(t, m.Cpu.NMILine().Active())
+	assert.Equal(t, byte(IntAny|IntTA), m.Bus.Peek(0xDD10+RegICR), "registers repeat every 16 bytes")
+	m.Bus.Read(0xDD0D)
+	assert.False(t, m.Cpu.NMILine().Active())
+}
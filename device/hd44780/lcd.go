@@ -0,0 +1,364 @@
+package hd44780
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// Instructions, the highest set bit selects one
+const (
+	InstrClear        = 0x01
+	InstrHome         = 0x02
+	InstrEntryMode    = 0x04 // bit 1: increment, bit 0: shift the display on writes
+	InstrDisplay      = 0x08 // bit 2: display on, bit 1: cursor, bit 0: blink
+	InstrShift        = 0x10 // bit 3: shift the display instead of moving the cursor, bit 2: to the right
+	InstrFunction     = 0x20 // bit 4: 8 bit interface, bit 3: two lines, bit 2: 5x10 font
+	InstrCGRAMAddress = 0x40
+	InstrDDRAMAddress = 0x80
+)
+
+// BusyFlag is bit 7 of the instruction register read
+const BusyFlag = 0x80
+
+// Execution times in seconds
+const (
+	clearTime = 1.52e-3
+	stepTime  = 37e-6
+)
+
+// LCD is a Hitachi HD44780 character LCD controller with the A00 (Japanese) character ROM. The pins are driven
+// with Pins: instructions and data are taken on the falling edge of E, reads are driven while E is high.
+// In 4 bit mode transfers are two nibbles on D4-D7, high nibble first. The controller is busy for the execution
+// time of an instruction and ignores writes meanwhile.
+type LCD struct {
+	// OnChange is told when the displayed text may have changed
+	OnChange func()
+
+	columns, lines int
+	scheduler      *scheduler.Scheduler
+	clearCycles    uint64
+	stepCycles     uint64
+	state          state
+}
+
+// state is everything a save state needs
+type state struct {
+	DDRAM [128]byte
+	CGRAM [64]byte
+
+	Address   byte
+	InCGRAM   bool // the address counter points into the CGRAM
+	Increment bool
+	AutoShift bool
+	On        bool
+	Cursor    bool
+	Blink     bool
+	EightBit  bool
+	TwoLines  bool
+	Shift     int // display shift, positive to the right
+
+	Second    bool // 4 bit mode: the next transfer is the low nibble
+	High      byte // 4 bit mode: the high nibble written
+	E         bool
+	RS, RW    bool // latched on the rising edge of E
+	Read      byte // value driven during a read
+	BusyUntil uint64
+}
+
+// New creates a controller for a display of columns x lines characters in the power on state,
+// s and clock time the busy flag, without a scheduler the controller is never busy
+func New(columns, lines int, s *scheduler.Scheduler, clock float64) *LCD {
+	l := &LCD{
+		columns:     columns,
+		lines:       lines,
+		scheduler:   s,
+		clearCycles: uint64(clock * clearTime),
+		stepCycles:  uint64(clock * stepTime),
+	}
+	l.Reset()
+	return l
+}
+
+// Reset is the internal reset at power on
+func (l *LCD) Reset() {
+	l.state = state{Increment: true, EightBit: true}
+	for i := range l.state.DDRAM {
+		l.state.DDRAM[i] = ' '
+	}
+	l.changed()
+}
+
+func (l *LCD) cycle() uint64 {
+	if l.scheduler == nil {
+		return 0
+	}
+	return l.scheduler.Cycle()
+}
+
+// Busy reports whether an instruction is still executing
+func (l *LCD) Busy() bool {
+	return l.cycle() < l.state.BusyUntil
+}
+
+func (l *LCD) busyFor(cycles uint64) {
+	if l.scheduler != nil {
+		l.state.BusyUntil = l.cycle() + cycles
+	}
+}
+
+// Pins drives RS, R/W, E and D0-D7 (D4-D7 in 4 bit mode) and returns the levels the controller drives
+// on D0-D7: the value read while E is high in a read, 0xFF otherwise. RS and R/W are taken on the rising edge
+// of E, written data on the falling edge.
+func (l *LCD) Pins(data byte, rs, rw, e bool) byte {
+	s := &l.state
+	rising, falling := e && !s.E, !e && s.E
+	s.E = e
+	if rising {
+		s.RS, s.RW = rs, rw
+	}
+	rs, rw = s.RS, s.RW
+	switch {
+	case rising && rw:
+		s.Read = l.readValue(rs)
+		if !s.EightBit && s.Second {
+			s.Read <<= 4
+		}
+	case falling && rw:
+		l.transferred(func() {
+			if rs {
+				l.step()
+			}
+		})
+	case falling:
+		if !s.EightBit {
+			if !s.Second {
+				s.High = data & 0xF0
+			}
+			data = s.High | data>>4
+		}
+		l.transferred(func() {
+			if l.Busy() {
+				return
+			}
+			if rs {
+				l.writeData(data)
+			} else {
+				l.instruction(data)
+			}
+		})
+	}
+	if e && rw {
+		return s.Read
+	}
+	return 0xFF
+}
+
+// transferred runs f once the whole byte has been transferred, after the second nibble in 4 bit mode
+func (l *LCD) transferred(f func()) {
+	s := &l.state
+	if !s.EightBit {
+		s.Second = !s.Second
+		if s.Second {
+			return
+		}
+	}
+	f()
+}
+
+func (l *LCD) readValue(rs bool) byte {
+	s := &l.state
+	if !rs {
+		value := s.Address
+		if l.Busy() {
+			value |= BusyFlag
+		}
+		return value
+	}
+	if s.InCGRAM {
+		return s.CGRAM[s.Address&0x3F]
+	}
+	return s.DDRAM[s.Address]
+}
+
+func (l *LCD) instruction(value byte) {
+	s := &l.state
+	l.busyFor(l.stepCycles)
+	switch {
+	case value&InstrDDRAMAddress != 0:
+		s.Address = value & 0x7F
+		s.InCGRAM = false
+	case value&InstrCGRAMAddress != 0:
+		s.Address = value & 0x3F
+		s.InCGRAM = true
+	case value&InstrFunction != 0:
+		s.EightBit = value&0x10 != 0
+		s.TwoLines = value&0x08 != 0
+		s.Second = false
+	case value&InstrShift != 0:
+		if value&0x08 == 0 {
+			l.move(value&0x04 != 0)
+			return
+		}
+		if value&0x04 != 0 {
+			s.Shift++
+		} else {
+			s.Shift--
+		}
+	case value&InstrDisplay != 0:
+		s.On = value&0x04 != 0
+		s.Cursor = value&0x02 != 0
+		s.Blink = value&0x01 != 0
+	case value&InstrEntryMode != 0:
+		s.Increment = value&0x02 != 0
+		s.AutoShift = value&0x01 != 0
+		return
+	case value&InstrHome != 0:
+		l.busyFor(l.clearCycles)
+		s.Address, s.InCGRAM, s.Shift = 0, false, 0
+	case value&InstrClear != 0:
+		l.busyFor(l.clearCycles)
+		for i := range s.DDRAM {
+			s.DDRAM[i] = ' '
+		}
+		s.Address, s.InCGRAM, s.Shift = 0, false, 0
+		s.Increment = true
+	default:
+		return
+	}
+	l.changed()
+}
+
+func (l *LCD) writeData(value byte) {
+	s := &l.state
+	l.busyFor(l.stepCycles)
+	if s.InCGRAM {
+		s.CGRAM[s.Address&0x3F] = value
+	} else {
+		s.DDRAM[s.Address] = value
+	}
+	l.step()
+	if s.AutoShift && !s.InCGRAM {
+		if s.Increment {
+			s.Shift--
+		} else {
+			s.Shift++
+		}
+	}
+	l.changed()
+}
+
+// step moves the address counter after a data access in the entry mode direction
+func (l *LCD) step() {
+	l.move(l.state.Increment)
+}
+
+// move moves the address counter one position, DDRAM addresses wrap around the lines
+func (l *LCD) move(forward bool) {
+	s := &l.state
+	if s.InCGRAM {
+		if forward {
+			s.Address = (s.Address + 1) & 0x3F
+		} else {
+			s.Address = (s.Address - 1) & 0x3F
+		}
+		return
+	}
+	switch {
+	case !s.TwoLines && forward:
+		s.Address = (s.Address + 1) % 80
+	case !s.TwoLines:
+		s.Address = (s.Address + 79) % 80
+	case forward && s.Address == 0x27:
+		s.Address = 0x40
+	case forward && s.Address == 0x67:
+		s.Address = 0x00
+	case forward:
+		s.Address++
+	case s.Address == 0x40:
+		s.Address = 0x27
+	case s.Address == 0x00:
+		s.Address = 0x67
+	default:
+		s.Address--
+	}
+}
+
+func (l *LCD) changed() {
+	if l.OnChange != nil {
+		l.OnChange()
+	}
+}
+
+// Lines returns the text shown on the display, blank while it is off. Lines three and four of
+// a four line display continue lines one and two, in one line mode only the first and third are used.
+func (l *LCD) Lines() []string {
+	s := &l.state
+	text := make([]string, l.lines)
+	for row := range text {
+		line := make([]rune, l.columns)
+		for column := range line {
+			line[column] = ' '
+			if !s.On || !s.TwoLines && row%2 == 1 {
+				continue
+			}
+			base, length := 0, 80
+			if s.TwoLines {
+				base, length = row%2*0x40, 40
+			}
+			offset := (row/2*l.columns + column - s.Shift) % length
+			if offset < 0 {
+				offset += length
+			}
+			line[column] = Glyph(s.DDRAM[base+offset])
+		}
+		text[row] = string(line)
+	}
+	return text
+}
+
+// Frame is the display drawn in a box, a line each
+func (l *LCD) Frame() string {
+	border := "+" + strings.Repeat("-", l.columns) + "+\r\n"
+	frame := border
+	for _, line := range l.Lines() {
+		frame += "|" + line + "|\r\n"
+	}
+	return frame + border
+}
+
+// glyphs of the A00 character ROM that are not ASCII
+var glyphs = map[byte]rune{
+	0x5C: '¥', 0x7E: '→', 0x7F: '←', 0xDF: '°', 0xE0: 'α', 0xE2: 'β', 0xE3: 'ε', 0xE4: 'μ',
+	0xE5: 'σ', 0xE6: 'ρ', 0xF2: 'θ', 0xF3: '∞', 0xF4: 'Ω', 0xF6: 'Σ', 0xF7: 'π', 0xFD: '÷', 0xFF: '█',
+}
+
+// Glyph returns the character shown for a character code, the user defined characters
+// from the CGRAM show as ▒ and the other characters without a close match as ?
+func Glyph(code byte) rune {
+	if g, ok := glyphs[code]; ok {
+		return g
+	}
+	switch {
+	case code < 0x10:
+		return '▒'
+	case code >= 0x20 && code < 0x7E:
+		return rune(code)
+	default:
+		return '?'
+	}
+}
+
+// SaveState implements memory.Stateful
+func (l *LCD) SaveState() ([]byte, error) {
+	return json.Marshal(l.state)
+}
+
+func (l *LCD) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &l.state); err != nil {
+		return err
+	}
+	l.changed()
+	return nil
+}
@@ -0,0 +1,112 @@
+package hd44780
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// write8 transfers a byte on the 8 bit interface
+func write8(l *LCD, rs bool, value byte) {
+	l.Pins(value, rs, false, true)
+	l.Pins(value, rs, false, false)
+}
+
+// write4 transfers a byte on the 4 bit interface, data is on D4-D7
+func write4(l *LCD, rs bool, value byte) {
+	write8(l, rs, value&0xF0)
+	write8(l, rs, value<<4)
+}
+
+func read4(l *LCD, rs bool) byte {
+	high := l.Pins(0, rs, true, true)
+	l.Pins(0, rs, true, false)
+	low := l.Pins(0, rs, true, true)
+	l.Pins(0, rs, true, false)
+	return high&0xF0 | low>>4
+}
+
+func text(l *LCD, rs bool, write func(*LCD, bool, byte), s string) {
+	for i := 0; i < len(s); i++ {
+		write(l, rs, s[i])
+	}
+}
+
+func TestLCD_8bit(t *testing.T) {
+	l := New(16, 2, nil, 1e6)
+	changes := 0
+	l.OnChange = func() { changes++ }
+	assert.Equal(t, []string{"                ", "                "}, l.Lines(), "off")
+	write8(l, false, 0x38)
+	write8(l, false, 0x0C)
+	write8(l, false, 0x06)
+	text(l, true, write8, "Hello")
+	write8(l, false, 0xC0+2)
+	text(l, true, write8, "world\x7E")
+	assert.Equal(t, []string{"Hello           ", "  world→        "}, l.Lines())
+	assert.Equal(t, 14, changes)
+
+	write8(l, false, 0x1C) // shift the display right
+	assert.Equal(t, " Hello          ", l.Lines()[0])
+	write8(l, false, 0x02)
+	assert.Equal(t, "Hello           ", l.Lines()[0], "home undoes the shift")
+	assert.Equal(t, "+----------------+\r\n|Hello           |\r\n|  world→        |\r\n+----------------+\r\n", l.Frame())
+
+	write8(l, false, 0x01)
+	assert.Equal(t, "                ", l.Lines()[1])
+}
+
+func TestLCD_lineWrap(t *testing.T) {
+	l := New(16, 2, nil, 1e6)
+	write8(l, false, 0x38)
+	write8(l, false, 0x0C)
+	write8(l, false, 0x80+0x26)
+	text(l, true, write8, "abc")
+	l.Pins(0, false, true, true)
+	assert.Equal(t, byte(0x41), l.Pins(0, false, true, true), "the address counter moved from $27 to $40")
+	l.Pins(0, false, true, false)
+	assert.Equal(t, "c", l.Lines()[1][:1])
+}
+
+func TestLCD_4bit(t *testing.T) {
+	l := New(16, 2, nil, 1e6)
+	write8(l, false, 0x20) // switch to 4 bits with a single transfer
+	write4(l, false, 0x28)
+	write4(l, false, 0x0C)
+	text(l, true, write4, "Hi")
+	assert.Equal(t, "Hi", l.Lines()[0][:2])
+	assert.Equal(t, byte(0x02), read4(l, false))
+	write4(l, false, 0x80)
+	assert.Equal(t, byte('H'), read4(l, true))
+	assert.Equal(t, byte('i'), read4(l, true))
+}
+
+func TestLCD_busy(t *testing.T) {
+	c := cpu.NewCpu(nil, memory.NewRAM(0x10000))
+	s := scheduler.New(&c)
+	l := New(16, 2, s, 1e6)
+	write8(l, false, 0x38)
+	write8(l, false, 0x0C)
+	assert.True(t, l.Busy())
+	c.Cycles += 37
+	s.Sync()
+	assert.False(t, l.Busy())
+
+	write8(l, false, 0x0C)
+	write8(l, true, 'X')
+	assert.Equal(t, byte(BusyFlag), l.Pins(0, false, true, true), "busy, the write was ignored")
+	l.Pins(0, false, true, false)
+	c.Cycles += 37
+	s.Sync()
+	write8(l, false, 0x01)
+	c.Cycles += 1000
+	s.Sync()
+	assert.True(t, l.Busy(), "clearing takes 1.52ms")
+	c.Cycles += 520
+	s.Sync()
+	assert.False(t, l.Busy())
+}
@@ -0,0 +1,345 @@
+package kim1
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/riot"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// Function keys, numbered after the hex digits as the monitor does
+const (
+	KeyAD   = 0x10
+	KeyDA   = 0x11
+	KeyPlus = 0x12
+	KeyGO   = 0x13
+	KeyPC   = 0x14
+)
+
+// Host keys for the keypad besides the hex digits and "+", and for the RS and ST keys in both modes
+const (
+	hostAD    = 0x01 // Ctrl-A
+	hostDA    = 0x04 // Ctrl-D
+	hostGO    = 0x07 // Ctrl-G
+	hostPC    = 0x10 // Ctrl-P
+	hostReset = 0x12 // Ctrl-R
+	hostStop  = 0x14 // Ctrl-T
+)
+
+// segment patterns of the hex digits on the LED display
+var digits = map[byte]byte{
+	0x3F: '0', 0x06: '1', 0x5B: '2', 0x4F: '3', 0x66: '4', 0x6D: '5', 0x7D: '6', 0x07: '7',
+	0x7F: '8', 0x6F: '9', 0x77: 'A', 0x7C: 'B', 0x39: 'C', 0x5E: 'D', 0x79: 'E', 0x71: 'F',
+}
+
+// Board is the 6530-002 of the KIM-1 wired to the keypad, the six digit LED display and the teletype port.
+// PB1-PB4 drive a 74145 decoder: outputs 0-2 select a keypad row read on PA0-PA6 (the first key of a row on
+// PA6), output 3 reads the teletype jumper on PA0 and outputs 4-9 light a digit with the segments on PA0-PA6.
+// The monitor bit-bangs the teletype line: PB0 sends and PA7 receives, both high when idle.
+//
+// In keypad mode host keys are pressed on the keypad and the display is rendered as a line of text whenever
+// it changes, in teletype mode the host is the teletype.
+type Board struct {
+	*riot.RRIOT
+	Host hostio.Serial
+	// OnReset and OnStop are the RS and ST keys
+	OnReset func()
+	OnStop  func()
+
+	scheduler  *scheduler.Scheduler
+	tty        bool
+	bitCycles  uint64 // teletype bit time
+	holdCycles uint64 // a typed key is held down this long, and released as long before the next
+	state      boardState
+	rx, tx     *scheduler.Event // the next bit sent to the KIM and the next bit sampled from it
+}
+
+type boardState struct {
+	Key      int // key held down, -1 for none
+	Queue    []int
+	Segments byte    // segment outputs on port A
+	Lit      [6]byte // segments lit since the display was last rendered
+	Shown    string
+
+	Line      bool // teletype input level
+	Receiving bool // a character is being sent to the KIM
+	RxChar    byte
+	RxBit     int  // the next bit of RxChar put on the line, 8 for the stop bits
+	Decoding  bool // a character from PB0 is being sampled
+	PB0       bool
+	Bits      byte
+	SampleBit int // the next bit sampled
+}
+
+// NewBoard wires the 6530, clock is the cpu frequency and baud the teletype speed
+func NewBoard(r *riot.RRIOT, host hostio.Serial, s *scheduler.Scheduler, clock float64, tty bool, baud float64) *Board {
+	b := &Board{
+		RRIOT:      r,
+		Host:       host,
+		scheduler:  s,
+		tty:        tty,
+		bitCycles:  uint64(clock / baud),
+		holdCycles: uint64(clock * 0.04),
+		state:      boardState{Key: -1, Line: true, PB0: true},
+	}
+	r.PortA.OnWrite = func(output, ddr byte) {
+		b.state.Segments = output & 0x7F
+		b.capture()
+	}
+	r.PortB.OnWrite = func(output, ddr byte) {
+		b.updateInput()
+		b.sample()
+	}
+	b.updateInput()
+	if tty {
+		// the monitor measures the teletype speed on a RUBOUT after reset
+		b.scheduler.After(b.holdCycles, func() { b.receive(0x7F) })
+	} else {
+		b.scheduler.After(b.holdCycles, b.render)
+	}
+	b.scheduler.After(b.holdCycles, b.poll)
+	return b
+}
+
+// Reset is the RES input of the 6530, the keypad, display and teletype line are left as they are
+func (b *Board) Reset() {
+	b.RRIOT.Reset()
+	b.updateInput()
+	b.sample()
+}
+
+type savedBoard struct {
+	RRIOT json.RawMessage
+	Board boardState
+}
+
+// SaveState implements memory.Stateful, it keeps the 6530, the keys waiting to be pressed, the display and
+// the characters on their way over the teletype line
+func (b *Board) SaveState() ([]byte, error) {
+	r, err := b.RRIOT.SaveState()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(savedBoard{RRIOT: r, Board: b.state})
+}
+
+// LoadState implements memory.Stateful, a teletype bit being sent or sampled is restarted
+func (b *Board) LoadState(data []byte) error {
+	var saved savedBoard
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	if err := b.RRIOT.LoadState(saved.RRIOT); err != nil {
+		return err
+	}
+	b.state = saved.Board
+	if b.rx != nil {
+		b.rx.Cancel()
+		b.rx = nil
+	}
+	if b.tx != nil {
+		b.tx.Cancel()
+		b.tx = nil
+	}
+	if b.state.Receiving {
+		b.rx = b.scheduler.After(b.bitCycles, b.receiveBit)
+	}
+	if b.state.Decoding {
+		b.tx = b.scheduler.After(b.bitCycles, b.sampleBit)
+	}
+	b.updateInput()
+	return nil
+}
+
+// row is the output of the 74145 decoder
+func (b *Board) row() int {
+	return int(b.PortB.Output() >> 1 & 0xF)
+}
+
+// updateInput puts the selected keypad row, the teletype jumper and the teletype line on port A
+func (b *Board) updateInput() {
+	s := &b.state
+	input := byte(0x7F)
+	row := b.row()
+	if row < 3 && s.Key >= 0 && s.Key/7 == row {
+		input &^= 0x40 >> (s.Key % 7)
+	}
+	if row == 3 && b.tty {
+		input &^= 0x01
+	}
+	if s.Line {
+		input |= 0x80
+	}
+	b.PortA.Set(input)
+}
+
+// capture remembers the segments of the selected digit, the monitor selects a digit before lighting it
+func (b *Board) capture() {
+	if row := b.row(); row >= 4 && row <= 9 && b.state.Segments != 0 {
+		b.state.Lit[row-4] = b.state.Segments
+	}
+}
+
+// render shows the display when the monitor has lit it since the last time
+func (b *Board) render() {
+	b.scheduler.After(b.holdCycles, b.render)
+	s := &b.state
+	text := make([]byte, 0, 7)
+	dark := true
+	for i, segments := range s.Lit {
+		if i == 4 {
+			text = append(text, ' ')
+		}
+		c, ok := digits[segments]
+		switch {
+		case segments == 0:
+			c = ' '
+		case !ok:
+			c = '?'
+		}
+		dark = dark && segments == 0
+		text = append(text, c)
+	}
+	s.Lit = [6]byte{}
+	if dark || string(text) == s.Shown {
+		return
+	}
+	s.Shown = string(text)
+	b.Host.Write(append([]byte{'\r'}, text...))
+}
+
+// poll takes host input: a key press every other hold time, or a character for the teletype
+func (b *Board) poll() {
+	b.scheduler.After(b.holdCycles, b.poll)
+	s := &b.state
+	if s.Key >= 0 {
+		s.Key = -1
+		b.updateInput()
+		return
+	}
+	if len(s.Queue) > 0 {
+		s.Key, s.Queue = s.Queue[0], s.Queue[1:]
+		b.updateInput()
+		return
+	}
+	if b.tty && s.Receiving {
+		return
+	}
+	c, ok := b.Host.Poll()
+	if !ok {
+		return
+	}
+	switch c {
+	case hostReset:
+		if b.OnReset != nil {
+			b.OnReset()
+		}
+		if b.tty {
+			b.scheduler.After(b.holdCycles, func() { b.receive(0x7F) })
+		}
+		return
+	case hostStop:
+		if b.OnStop != nil {
+			b.OnStop()
+		}
+		return
+	}
+	if b.tty {
+		if c == '\n' {
+			c = '\r'
+		}
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		b.receive(c)
+		return
+	}
+	if key, ok := keypad(c); ok {
+		s.Queue = append(s.Queue, key)
+	}
+}
+
+func keypad(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10, true
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10, true
+	}
+	switch c {
+	case hostAD:
+		return KeyAD, true
+	case hostDA:
+		return KeyDA, true
+	case '+':
+		return KeyPlus, true
+	case hostGO:
+		return KeyGO, true
+	case hostPC:
+		return KeyPC, true
+	}
+	return 0, false
+}
+
+// receive sends a character to the KIM on PA7: a start bit, 8 data bits and two stop bits
+func (b *Board) receive(c byte) {
+	s := &b.state
+	s.Receiving, s.RxChar, s.RxBit = true, c, 0
+	b.setLine(false)
+	b.rx = b.scheduler.After(b.bitCycles, b.receiveBit)
+}
+
+func (b *Board) receiveBit() {
+	s := &b.state
+	switch {
+	case s.RxBit < 8:
+		b.setLine(s.RxChar>>s.RxBit&1 != 0)
+		s.RxBit++
+		b.rx = b.scheduler.After(b.bitCycles, b.receiveBit)
+	case s.RxBit == 8:
+		b.setLine(true)
+		s.RxBit++
+		b.rx = b.scheduler.After(2*b.bitCycles, b.receiveBit)
+	default:
+		s.Receiving = false
+		b.rx = nil
+	}
+}
+
+func (b *Board) setLine(level bool) {
+	b.state.Line = level
+	b.updateInput()
+}
+
+// sample starts decoding a character from the KIM on the falling edge of PB0, bits are read in their middle
+func (b *Board) sample() {
+	s := &b.state
+	level := b.PortB.Output()&0x01 != 0
+	falling := s.PB0 && !level
+	s.PB0 = level
+	if !falling || s.Decoding {
+		return
+	}
+	s.Decoding, s.Bits, s.SampleBit = true, 0, 0
+	b.tx = b.scheduler.After(b.bitCycles*3/2, b.sampleBit)
+}
+
+func (b *Board) sampleBit() {
+	s := &b.state
+	if s.SampleBit < 8 {
+		if s.PB0 {
+			s.Bits |= 1 << s.SampleBit
+		}
+		s.SampleBit++
+		b.tx = b.scheduler.After(b.bitCycles, b.sampleBit)
+		return
+	}
+	s.Decoding = false
+	b.tx = nil
+	if c := s.Bits & 0x7F; c != 0 && c != 0x7F {
+		b.Host.Write([]byte{c})
+	}
+}
@@ -0,0 +1,158 @@
+package kim1
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/riot"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBoard runs at 1000 cycles per second and 100 baud: 10 cycles a bit and keys held for 40 cycles
+func newBoard(input string, tty bool) (*Board, *cpu.Cpu, *scheduler.Scheduler, *bytes.Buffer) {
+	c := cpu.NewCpu(nil, memory.NewRAM(0x10000))
+	s := scheduler.New(&c)
+	output := &bytes.Buffer{}
+	host := hostio.NewSerial(hostio.NewBytesInput([]byte(input)), output)
+	b := NewBoard(riot.NewRRIOT(nil, make([]byte, 1024)), host, s, 1000, tty, 100)
+	b.Write(riot.RegDDRB, 0x1F)
+	return b, &c, s, output
+}
+
+func at(c *cpu.Cpu, s *scheduler.Scheduler, cycle uint64) {
+	c.Cycles = cycle
+	s.Sync()
+}
+
+func TestBoard_keypad(t *testing.T) {
+	b, c, s, _ := newBoard("5\x07", false)
+	b.Write(riot.RegORB, 0x00) // row 0
+	at(c, s, 80)
+	assert.Equal(t, byte(0xFD), b.Read(riot.RegORA), "5 is the sixth key of row 0")
+	b.Write(riot.RegORB, 0x02)
+	assert.Equal(t, byte(0xFF), b.Read(riot.RegORA), "row 1")
+	at(c, s, 120)
+	b.Write(riot.RegORB, 0x00)
+	assert.Equal(t, byte(0xFF), b.Read(riot.RegORA), "released")
+
+	at(c, s, 200)
+	b.Write(riot.RegORB, 0x04) // row 2
+	assert.Equal(t, byte(0xFD), b.Read(riot.RegORA), "GO")
+	b.Write(riot.RegORB, 0x06) // row 3
+	assert.Equal(t, byte(0xFF), b.Read(riot.RegORA), "no teletype jumper")
+}
+
+func TestBoard_display(t *testing.T) {
+	b, c, s, output := newBoard("", false)
+	b.Write(riot.RegDDRA, 0x7F)
+	light := func(segments ...byte) {
+		for i, pattern := range segments {
+			b.Write(riot.RegORB, byte(4+i)<<1)
+			b.Write(riot.RegORA, pattern)
+			b.Write(riot.RegORA, 0)
+		}
+	}
+	light(0x06, 0x5B, 0x4F, 0x66, 0x6D, 0x7D)
+	at(c, s, 40)
+	assert.Equal(t, "\r1234 56", output.String())
+	light(0x06, 0x5B, 0x4F, 0x66, 0x6D, 0x7D)
+	at(c, s, 80)
+	at(c, s, 120)
+	assert.Equal(t, "\r1234 56", output.String(), "unchanged and dark frames are not shown")
+	light(0x77, 0x7C, 0x39, 0x5E, 0x79, 0x01)
+	at(c, s, 160)
+	assert.Equal(t, "\r1234 56\rABCD E?", output.String())
+}
+
+func TestBoard_ttyOutput(t *testing.T) {
+	b, c, s, output := newBoard("", true)
+	b.Write(riot.RegORB, 0x01)
+	send := func(start uint64, char byte) {
+		frame := uint16(char)<<1 | 0x600 // start bit, data and two stop bits
+		for i := uint64(0); i < 11; i++ {
+			at(c, s, start+10*i)
+			b.Write(riot.RegORB, byte(frame>>i&1))
+		}
+	}
+	send(1000, 'O')
+	send(1110, 'K')
+	send(1220, 0x7F)
+	at(c, s, 1400)
+	assert.Equal(t, "OK", output.String())
+}
+
+func TestBoard_ttyInput(t *testing.T) {
+	b, c, s, _ := newBoard("k", true)
+	b.Write(riot.RegORB, 0x06) // row 3
+	assert.Equal(t, byte(0xFE), b.Read(riot.RegORA), "teletype jumper on PA0, line idle")
+	pa7 := func(cycle uint64) byte {
+		at(c, s, cycle)
+		return b.Read(riot.RegORA) >> 7
+	}
+	var rubout, char []byte
+	for i := uint64(0); i < 10; i++ {
+		rubout = append(rubout, pa7(45+10*i))
+	}
+	assert.Equal(t, []byte{0, 1, 1, 1, 1, 1, 1, 1, 0, 1}, rubout, "RUBOUT for the speed detection")
+	for i := uint64(0); i < 10; i++ {
+		char = append(char, pa7(165+10*i))
+	}
+	assert.Equal(t, []byte{0, 1, 1, 0, 1, 0, 0, 1, 0, 1}, char, "K, 0x4B")
+}
+
+func TestBoard_saveState(t *testing.T) {
+	b, c, s, _ := newBoard("k", true)
+	pa7 := func(cycle uint64) byte {
+		at(c, s, cycle)
+		return b.Read(riot.RegORA) >> 7
+	}
+	at(c, s, 170) // in the middle of K
+	saved, err := b.SaveState()
+	require.NoError(t, err)
+	at(c, s, 400)
+
+	require.NoError(t, b.LoadState(saved))
+	at(c, s, 170)
+	var char []byte
+	for i := uint64(0); i < 9; i++ {
+		char = append(char, pa7(175+10*i))
+	}
+	assert.Equal(t, []byte{1, 1, 0, 1, 0, 0, 1, 0, 1}, char, "the rest of K, 0x4B")
+}
+
+func TestBoard_machine(t *testing.T) {
+	config, err := machine.Parse([]byte(`
+memory:
+  - {type: ram, start: $0000, end: $03FF}
+devices:
+  - {name: 6530-003, type: rriot6530, start: $1700, end: $173F}
+  - {name: 6530-002, type: kim1-rriot, start: $1740, end: $177F, options: {ram: $17C0, rom: $1C00, host: none}}
+`))
+	require.NoError(t, err)
+	m, err := machine.New(config, ".")
+	require.NoError(t, err)
+	m.Bus.Write(0x17C0, 0x42)
+	assert.Equal(t, byte(0x42), m.Bus.Read(0x17C0))
+	assert.Equal(t, byte(0), m.Bus.Read(0x1FFF))
+
+	m.Bus.Write(0x1741, 0xFF) // PADD of the 6530-002
+	m.Bus.Write(0x1701, 0xFF) // PADD of the 6530-003
+	m.Devices["6530-002"].(*Board).OnReset()
+	assert.Equal(t, byte(0), memory.Peek(m.Bus, 0x1741), "RS resets both 6530s")
+	assert.Equal(t, byte(0), memory.Peek(m.Bus, 0x1701))
+
+	config, err = machine.Parse([]byte(`
+devices:
+  - {name: 6530-002, type: kim1-rriot, start: $1740, end: $177F, options: {host: none, mode: cassette}}
+`))
+	require.NoError(t, err)
+	_, err = machine.New(config, ".")
+	assert.Error(t, err)
+}
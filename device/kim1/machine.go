@@ -0,0 +1,53 @@
+package kim1
+
+import (
+	"fmt"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/riot"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("kim1-rriot", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		r, err := riot.RRIOTFor(m, config)
+		if err != nil {
+			return nil, err
+		}
+		options := struct {
+			Host string  // see hostio.Open
+			Mode string  // keypad or tty
+			Baud float64 // teletype speed
+		}{Host: "stdio", Mode: "keypad", Baud: 1200}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		if options.Mode != "keypad" && options.Mode != "tty" {
+			return nil, fmt.Errorf("unknown mode %q, expected keypad or tty", options.Mode)
+		}
+		if options.Baud <= 0 {
+			return nil, fmt.Errorf("baud must be positive")
+		}
+		host, err := m.OpenHost(config, options.Host)
+		if err != nil {
+			return nil, err
+		}
+		b := NewBoard(r, host, m.Scheduler, m.ClockOr(1e6), options.Mode == "tty", options.Baud)
+		b.OnReset = func() {
+			// RS pulls the RES line of the cpu and both 6530s
+			for _, device := range m.Devices {
+				if r, ok := device.(*riot.RRIOT); ok {
+					r.Reset()
+				}
+			}
+			b.Reset()
+			m.Cpu.Reset()
+		}
+		b.OnStop = func() {
+			// ST pulls NMI, through the machine so recordings replay it
+			m.Interrupt(cpu.InterruptTypeNMI)
+		}
+		return b, nil
+	})
+}
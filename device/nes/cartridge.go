@@ -0,0 +1,86 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// iNES header
+const (
+	headerSize  = 16
+	trainerSize = 512
+	prgUnit     = 0x4000
+	chrUnit     = 0x2000
+)
+
+// Cartridge is an NROM (mapper 0) cartridge: 16K or 32K of PRG ROM at $8000, 16K images repeated at $C000,
+// and 8K of PRG RAM at $6000. It is addressed with cpu addresses.
+type Cartridge struct {
+	PRG []byte
+	CHR []byte // CHR ROM for the PPU pattern tables, empty when the cartridge has CHR RAM
+	RAM []byte
+}
+
+// LoadINES reads an iNES image, only mapper 0 is supported
+func LoadINES(data []byte) (*Cartridge, error) {
+	if len(data) < headerSize || !bytes.Equal(data[:4], []byte("NES\x1A")) {
+		return nil, fmt.Errorf("not an iNES image")
+	}
+	if mapper := data[6]>>4 | data[7]&0xF0; mapper != 0 {
+		return nil, fmt.Errorf("mapper %d is not supported, only NROM (0)", mapper)
+	}
+	prgSize, chrSize := int(data[4])*prgUnit, int(data[5])*chrUnit
+	offset := headerSize
+	if data[6]&0x04 != 0 {
+		offset += trainerSize
+	}
+	if prgSize == 0 || prgSize > 2*prgUnit {
+		return nil, fmt.Errorf("%d bytes of PRG ROM, NROM has 16K or 32K", prgSize)
+	}
+	if len(data) < offset+prgSize+chrSize {
+		return nil, fmt.Errorf("the image is %d bytes, the header says %d", len(data), offset+prgSize+chrSize)
+	}
+	return &Cartridge{
+		PRG: data[offset : offset+prgSize],
+		CHR: data[offset+prgSize : offset+prgSize+chrSize],
+		RAM: make([]byte, 0x2000),
+	}, nil
+}
+
+func (c *Cartridge) Read(address uint16) byte {
+	switch {
+	case address >= 0x8000:
+		return c.PRG[int(address-0x8000)%len(c.PRG)]
+	case address >= 0x6000:
+		return c.RAM[address-0x6000]
+	}
+	return 0
+}
+
+func (c *Cartridge) Write(address uint16, value byte) {
+	if address >= 0x6000 && address < 0x8000 {
+		c.RAM[address-0x6000] = value
+	}
+}
+
+// IsRAM implements memory.RAMMapper, the PRG RAM at $6000
+func (c *Cartridge) IsRAM(address uint16) bool {
+	return address >= 0x6000 && address < 0x8000
+}
+
+// SaveState implements memory.Stateful, it keeps the PRG RAM
+func (c *Cartridge) SaveState() ([]byte, error) {
+	return json.Marshal(c.RAM)
+}
+
+func (c *Cartridge) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &data); err != nil {
+		return err
+	}
+	if len(data) != len(c.RAM) {
+		return fmt.Errorf("expected %d bytes of PRG RAM, got %d", len(c.RAM), len(data))
+	}
+	copy(c.RAM, data)
+	return nil
+}
@@ -0,0 +1,47 @@
+package nes
+
+// Controller buttons, in the order they are shifted out
+const (
+	ButtonA = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+// Controller is a standard controller: while the strobe written to $4016 is high the shift register is loaded
+// with the buttons, then every read shifts one out on D0, ones after the eighth
+type Controller struct {
+	// Buttons holds the buttons pressed
+	Buttons byte
+
+	strobe bool
+	shift  byte
+}
+
+// Write sets the strobe from bit 0
+func (c *Controller) Write(value byte) {
+	c.strobe = value&0x01 != 0
+	if c.strobe {
+		c.shift = c.Buttons
+	}
+}
+
+func (c *Controller) Read() byte {
+	value := c.Peek()
+	if !c.strobe {
+		c.shift = c.shift>>1 | 0x80
+	}
+	return value
+}
+
+// Peek returns the button on D0 without shifting
+func (c *Controller) Peek() byte {
+	if c.strobe {
+		return c.Buttons & 0x01
+	}
+	return c.shift & 0x01
+}
@@ -0,0 +1,33 @@
+package nes
+
+import (
+	"fmt"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("nes", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		var options struct {
+			Cartridge string // an iNES image
+		}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		if options.Cartridge == "" {
+			return nil, fmt.Errorf("no cartridge image")
+		}
+		data, err := m.ReadFile(options.Cartridge)
+		if err != nil {
+			return nil, err
+		}
+		cartridge, err := LoadINES(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", options.Cartridge, err)
+		}
+		ppu := NewPPU(m.Cpu.NMILine().Pin(), m.Scheduler)
+		copy(ppu.VRAM(), cartridge.CHR)
+		return New(m.Cpu, ppu, &APU{}, cartridge), nil
+	})
+}
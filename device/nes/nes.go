@@ -0,0 +1,182 @@
+package nes
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+// I/O registers handled by the bus rather than the APU
+const (
+	OAMDMA = 0x4014 // writing a page number copies the page to OAMDATA
+	JOY1   = 0x4016 // controller 1, writes set the strobe of both controllers
+	JOY2   = 0x4017 // controller 2 on reads, the APU frame counter on writes
+)
+
+// APU is a stub of the audio processing unit: writes to $4000-$4017 are kept, the status register at $4015
+// reads 0 and the frame counter raises no interrupt
+type APU struct {
+	Registers [0x18]byte
+}
+
+func (a *APU) Read(address uint16) byte {
+	return 0
+}
+
+func (a *APU) Write(address uint16, value byte) {
+	if address < 0x18 {
+		a.Registers[address] = value
+	}
+}
+
+// NES is the cpu side memory map of the NES: 2K of RAM mirrored up to $1FFF, the PPU registers mirrored up to
+// $3FFF, the APU and I/O registers at $4000-$4017 and the cartridge from $4020. The APU and test mode registers
+// are seen at their offset from $4000, the PPU registers at 0-7 and the cartridge at the cpu address.
+// Writing $4014 copies a page to the PPU through OAMDATA and stalls the cpu for 513 cycles,
+// 514 when the DMA starts on an odd cycle.
+type NES struct {
+	PPU         memory.MemoryMapper
+	APU         memory.MemoryMapper
+	Cartridge   memory.MemoryMapper
+	Controllers [2]*Controller
+
+	cpu *cpu.Cpu
+	ram [0x800]byte
+}
+
+// New creates the bus with its parts, the cpu is stalled by OAM DMA
+func New(c *cpu.Cpu, ppu, apu, cartridge memory.MemoryMapper) *NES {
+	return &NES{PPU: ppu, APU: apu, Cartridge: cartridge, Controllers: [2]*Controller{{}, {}}, cpu: c}
+}
+
+func (n *NES) Read(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		return n.ram[address&0x7FF]
+	case address < 0x4000:
+		return n.PPU.Read(address & 0x7)
+	case address == JOY1 || address == JOY2:
+		// the upper bits are left on the data bus by the high byte of the address
+		return n.Controllers[address-JOY1].Read() | 0x40
+	case address < 0x4018:
+		return n.APU.Read(address - 0x4000)
+	case address < 0x4020:
+		return 0
+	default:
+		return n.Cartridge.Read(address)
+	}
+}
+
+// Peek implements memory.Peeker
+func (n *NES) Peek(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		return n.ram[address&0x7FF]
+	case address < 0x4000:
+		return memory.Peek(n.PPU, address&0x7)
+	case address == JOY1 || address == JOY2:
+		return n.Controllers[address-JOY1].Peek() | 0x40
+	case address < 0x4018:
+		return memory.Peek(n.APU, address-0x4000)
+	case address < 0x4020:
+		return 0
+	default:
+		return memory.Peek(n.Cartridge, address)
+	}
+}
+
+func (n *NES) Write(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		n.ram[address&0x7FF] = value
+	case address < 0x4000:
+		n.PPU.Write(address&0x7, value)
+	case address == OAMDMA:
+		n.dma(value)
+	case address == JOY1:
+		n.Controllers[0].Write(value)
+		n.Controllers[1].Write(value)
+	case address < 0x4018:
+		n.APU.Write(address-0x4000, value)
+	case address < 0x4020:
+	default:
+		n.Cartridge.Write(address, value)
+	}
+}
+
+// IsRAM implements memory.RAMMapper, the 2K of RAM and the cartridge RAM
+func (n *NES) IsRAM(address uint16) bool {
+	switch {
+	case address < 0x2000:
+		return true
+	case address < 0x4020:
+		return false
+	default:
+		return memory.IsRAM(n.Cartridge, address)
+	}
+}
+
+// dma copies a page to OAMDATA, the cpu waits while the DMA takes the bus
+func (n *NES) dma(page byte) {
+	start := n.cpu.AccessCycle() + 1
+	for i := uint16(0); i < 256; i++ {
+		n.PPU.Write(OAMDATA, n.Read(uint16(page)<<8|i))
+	}
+	n.cpu.Stall(513 + start&1)
+}
+
+type nesState struct {
+	RAM                 []byte
+	Strobe              [2]bool
+	Shift               [2]byte
+	PPU, APU, Cartridge json.RawMessage `json:",omitempty"`
+}
+
+// SaveState implements memory.Stateful, it keeps the RAM, the controllers and the parts that are Stateful,
+// their states are embedded in the JSON document and have to be JSON themselves
+func (n *NES) SaveState() ([]byte, error) {
+	s := nesState{RAM: n.ram[:]}
+	for i, c := range n.Controllers {
+		s.Strobe[i], s.Shift[i] = c.strobe, c.shift
+	}
+	for _, part := range []struct {
+		mapper memory.MemoryMapper
+		state  *json.RawMessage
+	}{{n.PPU, &s.PPU}, {n.APU, &s.APU}, {n.Cartridge, &s.Cartridge}} {
+		stateful, ok := part.mapper.(memory.Stateful)
+		if !ok {
+			continue
+		}
+		data, err := stateful.SaveState()
+		if err != nil {
+			return nil, err
+		}
+		*part.state = data
+	}
+	return json.Marshal(s)
+}
+
+func (n *NES) LoadState(data []byte) error {
+	var s nesState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	copy(n.ram[:], s.RAM)
+	for i, c := range n.Controllers {
+		c.strobe, c.shift = s.Strobe[i], s.Shift[i]
+	}
+	for _, part := range []struct {
+		mapper memory.MemoryMapper
+		state  json.RawMessage
+	}{{n.PPU, s.PPU}, {n.APU, s.APU}, {n.Cartridge, s.Cartridge}} {
+		stateful, ok := part.mapper.(memory.Stateful)
+		if !ok || part.state == nil {
+			continue
+		}
+		if err := stateful.LoadState(part.state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ines builds an NROM image with 16K of PRG ROM holding program at $C000 and the vectors pointing to it
+func ines(program ...byte) []byte {
+	prg := make([]byte, prgUnit)
+	copy(prg[0x0000:], program)
+	prg[0x3FFA], prg[0x3FFB] = 0x00, 0xC1 // NMI
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0xC0 // reset
+	header := []byte{'N', 'E', 'S', 0x1A, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	chr := make([]byte, chrUnit)
+	chr[0] = 0x3C
+	return append(append(header, prg...), chr...)
+}
+
+// bus lets the cpu be created before the NES that needs it
+type bus struct {
+	nes *NES
+}
+
+func (b *bus) Read(address uint16) byte         { return b.nes.Read(address) }
+func (b *bus) Write(address uint16, value byte) { b.nes.Write(address, value) }
+
+func newNES(t *testing.T, program ...byte) (*NES, *PPU, *cpu.Cpu) {
+	cartridge, err := LoadINES(ines(program...))
+	require.NoError(t, err)
+	b := &bus{}
+	c := cpu.NewCpu(nil, b)
+	c.Variant = cpu.Ricoh2A03
+	s := scheduler.New(&c)
+	ppu := NewPPU(c.NMILine().Pin(), s)
+	copy(ppu.VRAM(), cartridge.CHR)
+	b.nes = New(&c, ppu, &APU{}, cartridge)
+	c.Reset()
+	return b.nes, ppu, &c
+}
+
+func TestNES_memoryMap(t *testing.T) {
+	n, ppu, _ := newNES(t, 0xEA)
+	n.Write(0x0123, 0x45)
+	assert.Equal(t, byte(0x45), n.Read(0x1923), "2K of RAM mirrored")
+	assert.Equal(t, byte(0xEA), n.Read(0xC000))
+	assert.Equal(t, byte(0xEA), n.Read(0x8000), "16K of PRG ROM at $8000 and $C000")
+	n.Write(0x6000, 0x77)
+	assert.Equal(t, byte(0x77), n.Read(0x6000), "PRG RAM")
+
+	n.Write(0x3FFE, 0x21) // PPUADDR through a mirror
+	n.Write(0x2006, 0x08)
+	n.Write(0x2007, 0x99)
+	n.Write(0x2006, 0x00)
+	n.Write(0x2006, 0x00)
+	assert.Equal(t, byte(0x00), memory.Peek(n, 0x2007), "PPUDATA reads are buffered")
+	n.Read(0x2007)
+	assert.Equal(t, byte(0x3C), n.Read(0x2007), "the pattern tables hold the CHR ROM")
+	assert.Equal(t, byte(0x99), ppu.VRAM()[0x2108])
+
+	n.APU.(*APU).Registers[0x15] = 0x0F
+	n.Write(0x4000, 0x30)
+	assert.Equal(t, byte(0x30), n.APU.(*APU).Registers[0])
+	assert.Equal(t, byte(0x00), n.Read(0x4015))
+}
+
+func TestNES_controllers(t *testing.T) {
+	n, _, _ := newNES(t, 0xEA)
+	n.Controllers[0].Buttons = ButtonA | ButtonStart | ButtonRight
+	n.Write(JOY1, 1)
+	assert.Equal(t, byte(0x41), n.Read(JOY1), "A while strobed")
+	assert.Equal(t, byte(0x41), n.Read(JOY1))
+	n.Write(JOY1, 0)
+	var bits []byte
+	for i := 0; i < 10; i++ {
+		bits = append(bits, n.Read(JOY1)&1)
+	}
+	assert.Equal(t, []byte{1, 0, 0, 1, 0, 0, 0, 1, 1, 1}, bits)
+	assert.Equal(t, byte(0x40), n.Read(JOY2))
+}
+
+func TestNES_oamDMA(t *testing.T) {
+	n, ppu, c := newNES(t,
+		0xA9, 0x02, // LDA #$02
+		0x8D, 0x14, 0x40, // STA $4014
+		0xEA, // NOP
+	)
+	for i := 0; i < 256; i++ {
+		n.Write(0x0200+uint16(i), byte(i))
+	}
+	for _, start := range []uint64{0, 1} {
+		c.PC = 0xC000
+		c.Cycles = start
+		c.ExecuteOpcode()
+		c.ExecuteOpcode()
+		// STA abs writes on its fourth cycle, the DMA starts on the next
+		dmaStart := start + 2 + 4
+		assert.Equal(t, start+2+4+513+dmaStart%2, c.Cycles, "starting at cycle %d", start)
+	}
+	assert.Equal(t, byte(0x80), ppu.OAM()[0x80])
+	assert.Equal(t, byte(0xFF), ppu.OAM()[0xFF])
+}
+
+func TestPPU_vblank(t *testing.T) {
+	program := make([]byte, 0x101)
+	copy(program, []byte{
+		0xA9, 0x80, // LDA #$80
+		0x8D, 0x00, 0x20, // STA PPUCTRL, NMI on vertical blank
+		0x4C, 0x05, 0xC0, // JMP $C005
+	})
+	program[0x100] = 0xEA // NOP in the NMI handler
+	n, _, c := newNES(t, program...)
+	for c.PC < 0xC100 && c.Cycles < 40000 {
+		c.ExecuteOpcode()
+	}
+	assert.Equal(t, uint16(0xC101), c.PC, "NMI taken")
+	frame := uint64(VBlankLine) * DotsPerLine / 3
+	assert.InDelta(t, frame, c.Cycles, 10)
+	assert.Equal(t, byte(0x80), n.Read(0x2002)&0x80)
+	assert.Equal(t, byte(0x00), n.Read(0x2002)&0x80, "reading clears the flag")
+}
+
+func TestLoadINES_errors(t *testing.T) {
+	_, err := LoadINES([]byte("not a ROM"))
+	assert.EqualError(t, err, "not an iNES image")
+	image := ines()
+	image[6] = 0x10
+	_, err = LoadINES(image)
+	assert.EqualError(t, err, "mapper 1 is not supported, only NROM (0)")
+	_, err = LoadINES(ines()[:1000])
+	assert.EqualError(t, err, "the image is 1000 bytes, the header says 24592")
+}
+
+func TestNES_saveState(t *testing.T) {
+	n, ppu, _ := newNES(t, 0xEA)
+	n.Write(0x0010, 0x11)
+	n.Write(0x6000, 0x22)
+	n.Write(0x2000, 0x80)
+	data, err := n.SaveState()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"PPU":{`, "the parts are embedded, not encoded as strings")
+
+	n.Write(0x0010, 0)
+	n.Write(0x6000, 0)
+	n.Write(0x2000, 0)
+	require.NoError(t, n.LoadState(data))
+	assert.Equal(t, byte(0x11), n.Read(0x0010))
+	assert.Equal(t, byte(0x22), n.Read(0x6000))
+	assert.Equal(t, byte(0x80), ppu.state.Registers[0])
+}
@@ -0,0 +1,200 @@
+package nes
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// PPU registers, mirrored every 8 bytes from $2000 to $3FFF
+const (
+	PPUCTRL   = 0x0
+	PPUMASK   = 0x1
+	PPUSTATUS = 0x2
+	OAMADDR   = 0x3
+	OAMDATA   = 0x4
+	PPUSCROLL = 0x5
+	PPUADDR   = 0x6
+	PPUDATA   = 0x7
+)
+
+// PPU timing in dots, three per cpu cycle
+const (
+	DotsPerLine   = 341
+	LinesPerFrame = 262
+	VBlankLine    = 241 // the vertical blank starts here and lasts to the pre-render line
+	PreRenderLine = 261
+)
+
+// PPU is a stub of the picture processing unit that draws nothing: the registers work on a flat 16K of video
+// memory and the 256 bytes of OAM, the line counter runs at NTSC speed, the vertical blank flag is set on
+// line 241 with the NMI when PPUCTRL enables it and cleared on the pre-render line. Sprite 0 hit and overflow
+// are never set.
+type PPU struct {
+	// OnFrame is told when the line counter wraps to line 0
+	OnFrame func()
+
+	nmi       *cpu.InterruptPin
+	scheduler *scheduler.Scheduler
+	state     ppuState
+}
+
+type ppuState struct {
+	Registers [8]byte
+	OAM       [256]byte
+	VRAM      []byte
+	Address   uint16 // the VRAM address PPUDATA reaches
+	Latch     bool   // second write of PPUSCROLL or PPUADDR
+	Buffer    byte   // PPUDATA read buffer
+	Bus       byte   // the last value written to a register, read back from the write-only ones
+	VBlank    bool
+	Line      int
+	Dots      int // dots left over from the cycles of the previous lines
+}
+
+// NewPPU creates the stub, it starts on line 0 and drives nmi during the vertical blank when enabled
+func NewPPU(nmi *cpu.InterruptPin, s *scheduler.Scheduler) *PPU {
+	p := &PPU{nmi: nmi, scheduler: s, state: ppuState{VRAM: make([]byte, 0x4000)}}
+	p.schedule()
+	return p
+}
+
+// VRAM is the video memory, the pattern tables at $0000-$1FFF hold the CHR ROM of the cartridge
+func (p *PPU) VRAM() []byte {
+	return p.state.VRAM
+}
+
+// OAM is the sprite memory filled through OAMDATA and OAM DMA
+func (p *PPU) OAM() []byte {
+	return p.state.OAM[:]
+}
+
+// Line returns the line being drawn
+func (p *PPU) Line() int {
+	return p.state.Line
+}
+
+func (p *PPU) schedule() {
+	s := &p.state
+	s.Dots += DotsPerLine
+	cycles := s.Dots / 3
+	s.Dots %= 3
+	p.scheduler.After(uint64(cycles), p.line)
+}
+
+func (p *PPU) line() {
+	p.schedule()
+	s := &p.state
+	s.Line++
+	switch s.Line {
+	case VBlankLine:
+		s.VBlank = true
+	case PreRenderLine:
+		s.VBlank = false
+	case LinesPerFrame:
+		s.Line = 0
+		if p.OnFrame != nil {
+			p.OnFrame()
+		}
+	}
+	p.updateNMI()
+}
+
+func (p *PPU) updateNMI() {
+	p.nmi.Set(p.state.VBlank && p.state.Registers[PPUCTRL]&0x80 != 0)
+}
+
+// increment is how far PPUDATA accesses move the address, across or down a name table
+func (p *PPU) increment() uint16 {
+	if p.state.Registers[PPUCTRL]&0x04 != 0 {
+		return 32
+	}
+	return 1
+}
+
+func (p *PPU) Read(address uint16) byte {
+	s := &p.state
+	switch address & 0x7 {
+	case PPUSTATUS:
+		value := p.Peek(address)
+		s.VBlank = false
+		s.Latch = false
+		p.updateNMI()
+		return value
+	case PPUDATA:
+		value := p.Peek(address)
+		s.Buffer = s.VRAM[s.Address]
+		s.Address = (s.Address + p.increment()) & 0x3FFF
+		return value
+	default:
+		return p.Peek(address)
+	}
+}
+
+// Peek implements memory.Peeker, it reads without clearing the vertical blank flag or moving the address
+func (p *PPU) Peek(address uint16) byte {
+	s := &p.state
+	switch address & 0x7 {
+	case PPUSTATUS:
+		value := s.Bus & 0x1F
+		if s.VBlank {
+			value |= 0x80
+		}
+		return value
+	case OAMDATA:
+		return s.OAM[s.Registers[OAMADDR]]
+	case PPUDATA:
+		if s.Address >= 0x3F00 {
+			// the palette is read directly
+			return s.VRAM[s.Address]
+		}
+		return s.Buffer
+	default:
+		return s.Bus
+	}
+}
+
+func (p *PPU) Write(address uint16, value byte) {
+	s := &p.state
+	address &= 0x7
+	s.Bus = value
+	switch address {
+	case PPUSTATUS:
+		return
+	case OAMDATA:
+		s.OAM[s.Registers[OAMADDR]] = value
+		s.Registers[OAMADDR]++
+		return
+	case PPUCTRL:
+		s.Registers[PPUCTRL] = value
+		p.updateNMI()
+		return
+	case PPUSCROLL:
+		s.Latch = !s.Latch
+	case PPUADDR:
+		if s.Latch {
+			s.Address = (s.Address&0xFF00 | uint16(value)) & 0x3FFF
+		} else {
+			s.Address = uint16(value&0x3F)<<8 | s.Address&0x00FF
+		}
+		s.Latch = !s.Latch
+	case PPUDATA:
+		s.VRAM[s.Address] = value
+		s.Address = (s.Address + p.increment()) & 0x3FFF
+	}
+	s.Registers[address] = value
+}
+
+// SaveState implements memory.Stateful
+func (p *PPU) SaveState() ([]byte, error) {
+	return json.Marshal(p.state)
+}
+
+func (p *PPU) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &p.state); err != nil {
+		return err
+	}
+	p.updateNMI()
+	return nil
+}
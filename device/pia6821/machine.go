@@ -0,0 +1,15 @@
+package pia6821
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("pia6821", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		// IRQA and IRQB are both wired to the configured line
+		p := New(m.Pin(config), m.Pin(config))
+		m.Scheduler.AddTicker(p)
+		return p, nil
+	})
+}
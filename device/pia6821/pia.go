@@ -0,0 +1,332 @@
+package pia6821
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+)
+
+// Registers, selected by RS0-RS1. The data direction and peripheral registers share an address,
+// bit 2 of the control register selects between them.
+const (
+	RegPRA = 0x0 // peripheral register A or DDRA
+	RegCRA = 0x1
+	RegPRB = 0x2 // peripheral register B or DDRB
+	RegCRB = 0x3
+)
+
+// Control register bits
+const (
+	ControlC1IRQ  = 0x01 // interrupt on the active C1 transition
+	ControlC1Rise = 0x02 // C1 is active on the low to high transition
+	ControlPR     = 0x04 // the data register address reaches the peripheral register instead of the DDR
+	ControlC2     = 0x38 // C2 mode, see C2Input...C2High
+	ControlIRQ2   = 0x40 // read only: active C2 transition
+	ControlIRQ1   = 0x80 // read only: active C1 transition
+)
+
+// C2 modes, bits 3-5 of the control register
+const (
+	C2Input        = 0x00 // input, active on the high to low transition
+	C2InputIRQ     = 0x08 // input with interrupt, high to low
+	C2InputRise    = 0x10 // input, low to high
+	C2InputRiseIRQ = 0x18 // input with interrupt, low to high
+	C2Handshake    = 0x20 // output: low after a port A read or port B write until the active C1 transition
+	C2Pulse        = 0x28 // output: low for one cycle after a port A read or port B write
+	C2Low          = 0x30
+	C2High         = 0x38
+)
+
+// C2 mode bits
+const (
+	c2Output    = 0x20 // C2 is an output
+	c2IRQEnable = 0x08 // inputs: interrupt on the active transition
+)
+
+// PIA is a MOS 6820 / Motorola 6821 Peripheral Interface Adapter: two 8 bit ports with data direction
+// registers and the CA1/CA2 and CB1/CB2 control lines, each side with its own IRQ output.
+// It is advanced by Tick once per cpu cycle, which only matters for the C2 pulse output.
+type PIA struct {
+	PortA Port
+	PortB Port
+
+	// OnCA2 and OnCB2 are told when the CA2 and CB2 outputs change level
+	OnCA2 func(level bool)
+	OnCB2 func(level bool)
+
+	irqA, irqB *cpu.InterruptPin
+	state      state
+}
+
+// state is everything a save state needs
+type state struct {
+	A, B side
+}
+
+// side is one port with its control register and control lines
+type side struct {
+	OR, DDR, Input byte
+	CR             byte // bits 0-5
+	IRQ1, IRQ2     bool
+	C1, C2         bool // input levels
+	C2Out          bool // handshake and manual output level
+	Pulse          bool // pulse output mode: C2 is low for the current cycle
+}
+
+// Port is one of the two 8 bit ports
+type Port struct {
+	// OnWrite, when set, is told about the port output whenever the peripheral register or the data direction
+	// register changes: output holds the levels of the pins configured as outputs (ddr bits set)
+	OnWrite func(output, ddr byte)
+
+	pia *PIA
+	b   bool
+}
+
+func (p *Port) side() *side {
+	if p.b {
+		return &p.pia.state.B
+	}
+	return &p.pia.state.A
+}
+
+// Set drives the port pins from outside, bits of pins configured as outputs are ignored when reading
+func (p *Port) Set(input byte) {
+	p.side().Input = input
+}
+
+// Output returns the levels of the pins, the ones configured as inputs read as the driven input
+func (p *Port) Output() byte {
+	s := p.side()
+	return s.OR&s.DDR | s.Input&^s.DDR
+}
+
+func (p *Port) written() {
+	if p.OnWrite != nil {
+		s := p.side()
+		p.OnWrite(s.OR&s.DDR, s.DDR)
+	}
+}
+
+// New creates a PIA, irqA and irqB may be nil when the outputs are not connected
+// and may be pins of the same line since the outputs are open drain
+func New(irqA, irqB *cpu.InterruptPin) *PIA {
+	p := &PIA{irqA: irqA, irqB: irqB}
+	p.PortA.pia = p
+	p.PortB = Port{pia: p, b: true}
+	p.Reset()
+	return p
+}
+
+// Reset clears every register like the RES input
+func (p *PIA) Reset() {
+	for _, s := range []*side{&p.state.A, &p.state.B} {
+		*s = side{Input: 0xFF, C1: true, C2: true, C2Out: true}
+	}
+	p.updateIRQ()
+}
+
+func (p *PIA) port(address uint16) (*Port, *side) {
+	if address&0x2 == 0 {
+		return &p.PortA, &p.state.A
+	}
+	return &p.PortB, &p.state.B
+}
+
+func (p *PIA) Read(address uint16) byte {
+	value := p.Peek(address)
+	port, s := p.port(address)
+	if address&0x1 == 0 && s.CR&ControlPR != 0 {
+		s.IRQ1, s.IRQ2 = false, false
+		p.updateIRQ()
+		if !port.b {
+			p.handshake(port, s)
+		}
+	}
+	return value
+}
+
+// Peek implements memory.Peeker, it reads a register without clearing flags or handshaking
+func (p *PIA) Peek(address uint16) byte {
+	port, s := p.port(address)
+	if address&0x1 != 0 {
+		value := s.CR
+		if s.IRQ1 {
+			value |= ControlIRQ1
+		}
+		if s.IRQ2 {
+			value |= ControlIRQ2
+		}
+		return value
+	}
+	if s.CR&ControlPR == 0 {
+		return s.DDR
+	}
+	return port.Output()
+}
+
+func (p *PIA) Write(address uint16, value byte) {
+	port, s := p.port(address)
+	if address&0x1 != 0 {
+		s.CR = value & 0x3F
+		if s.CR&c2Output != 0 {
+			s.IRQ2 = false
+			switch s.CR & ControlC2 {
+			case C2Low:
+				s.C2Out = false
+			case C2High, C2Handshake:
+				s.C2Out = true
+			}
+			p.updateControlOutputs(port, s)
+		}
+		p.updateIRQ()
+		return
+	}
+	if s.CR&ControlPR == 0 {
+		s.DDR = value
+	} else {
+		s.OR = value
+		if port.b {
+			p.handshake(port, s)
+		}
+	}
+	port.written()
+}
+
+// handshake starts the C2 handshake or pulse on a port A read or a port B write
+func (p *PIA) handshake(port *Port, s *side) {
+	switch s.CR & ControlC2 {
+	case C2Handshake:
+		s.C2Out = false
+	case C2Pulse:
+		s.Pulse = true
+	default:
+		return
+	}
+	p.updateControlOutputs(port, s)
+}
+
+// Tick ends C2 pulses
+func (p *PIA) Tick() {
+	for _, port := range []*Port{&p.PortA, &p.PortB} {
+		if s := port.side(); s.Pulse {
+			s.Pulse = false
+			p.updateControlOutputs(port, s)
+		}
+	}
+}
+
+// SetCA1 drives the CA1 input
+func (p *PIA) SetCA1(level bool) {
+	p.setC1(&p.PortA, level)
+}
+
+// SetCB1 drives the CB1 input
+func (p *PIA) SetCB1(level bool) {
+	p.setC1(&p.PortB, level)
+}
+
+func (p *PIA) setC1(port *Port, level bool) {
+	s := port.side()
+	if level == s.C1 {
+		return
+	}
+	s.C1 = level
+	if level != (s.CR&ControlC1Rise != 0) {
+		return
+	}
+	s.IRQ1 = true
+	p.updateIRQ()
+	if s.CR&ControlC2 == C2Handshake {
+		// the peripheral took or supplied the data, C2 goes back high
+		s.C2Out = true
+		p.updateControlOutputs(port, s)
+	}
+}
+
+// SetCA2 drives the CA2 input, it only has an effect when CA2 is configured as an input
+func (p *PIA) SetCA2(level bool) {
+	p.setC2(&p.PortA, level)
+}
+
+// SetCB2 drives the CB2 input, it only has an effect when CB2 is configured as an input
+func (p *PIA) SetCB2(level bool) {
+	p.setC2(&p.PortB, level)
+}
+
+func (p *PIA) setC2(port *Port, level bool) {
+	s := port.side()
+	if level == s.C2 {
+		return
+	}
+	s.C2 = level
+	if s.CR&c2Output == 0 && level == (s.CR&C2InputRise != 0) {
+		s.IRQ2 = true
+		p.updateIRQ()
+	}
+}
+
+// CA2 returns the CA2 output level, high when CA2 is an input
+func (p *PIA) CA2() bool {
+	return p.state.A.c2()
+}
+
+// CB2 returns the CB2 output level, high when CB2 is an input
+func (p *PIA) CB2() bool {
+	return p.state.B.c2()
+}
+
+func (s *side) c2() bool {
+	switch s.CR & ControlC2 {
+	case C2Handshake, C2Low, C2High:
+		return s.C2Out
+	case C2Pulse:
+		return !s.Pulse
+	default:
+		return true
+	}
+}
+
+// updateControlOutputs reports the C2 output level of a side to its callback
+func (p *PIA) updateControlOutputs(port *Port, s *side) {
+	callback := p.OnCA2
+	if port.b {
+		callback = p.OnCB2
+	}
+	if callback != nil && s.CR&c2Output != 0 {
+		callback(s.c2())
+	}
+}
+
+func (s *side) irq() bool {
+	return s.IRQ1 && s.CR&ControlC1IRQ != 0 ||
+		s.IRQ2 && s.CR&(c2Output|c2IRQEnable) == c2IRQEnable
+}
+
+func (p *PIA) updateIRQ() {
+	p.irqA.Set(p.state.A.irq())
+	p.irqB.Set(p.state.B.irq())
+}
+
+// IRQA reports the level of the IRQA output
+func (p *PIA) IRQA() bool {
+	return p.state.A.irq()
+}
+
+// IRQB reports the level of the IRQB output
+func (p *PIA) IRQB() bool {
+	return p.state.B.irq()
+}
+
+// SaveState implements memory.Stateful
+func (p *PIA) SaveState() ([]byte, error) {
+	return json.Marshal(p.state)
+}
+
+func (p *PIA) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &p.state); err != nil {
+		return err
+	}
+	p.updateIRQ()
+	return nil
+}
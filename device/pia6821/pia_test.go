@@ -0,0 +1,87 @@
+package pia6821
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPIA() (*PIA, *cpu.InterruptLine) {
+	line := &cpu.InterruptLine{}
+	return New(line.Pin(), line.Pin()), line
+}
+
+func TestPIA_registerSelect(t *testing.T) {
+	p, _ := newPIA()
+	var output, ddr byte
+	p.PortB.OnWrite = func(o, d byte) { output, ddr = o, d }
+
+	p.Write(RegPRB, 0x0F)
+	assert.Equal(t, byte(0x0F), p.Read(RegPRB), "DDR while control bit 2 is clear")
+	p.Write(RegCRB, ControlPR)
+	p.Write(RegPRB, 0x33)
+	assert.Equal(t, byte(0x03), output)
+	assert.Equal(t, byte(0x0F), ddr)
+	p.PortB.Set(0x50)
+	assert.Equal(t, byte(0x53), p.Read(RegPRB))
+}
+
+func TestPIA_c1Interrupt(t *testing.T) {
+	p, line := newPIA()
+	p.Write(RegCRA, ControlPR|ControlC1IRQ|ControlC1Rise)
+	p.PortA.Set(0xC1)
+
+	p.SetCA1(false)
+	assert.False(t, line.Active(), "falling edge is not active")
+	p.SetCA1(true)
+	assert.True(t, line.Active())
+	assert.Equal(t, byte(ControlIRQ1|ControlPR|ControlC1IRQ|ControlC1Rise), p.Peek(RegCRA))
+
+	assert.Equal(t, byte(0xC1), p.Read(RegPRA))
+	assert.False(t, line.Active(), "reading the port clears the flags")
+	assert.Equal(t, byte(0), p.Read(RegCRA)&ControlIRQ1)
+}
+
+func TestPIA_c2Input(t *testing.T) {
+	p, line := newPIA()
+	p.Write(RegCRB, ControlPR|C2InputRise)
+	p.SetCB2(false)
+	p.SetCB2(true)
+	assert.Equal(t, byte(ControlIRQ2), p.Peek(RegCRB)&ControlIRQ2)
+	assert.False(t, line.Active(), "interrupt not enabled")
+	p.Write(RegCRB, ControlPR|C2InputRiseIRQ)
+	assert.True(t, line.Active())
+}
+
+func TestPIA_handshake(t *testing.T) {
+	p, _ := newPIA()
+	var levels []bool
+	p.OnCA2 = func(level bool) { levels = append(levels, level) }
+	p.Write(RegCRA, ControlPR|C2Handshake)
+	p.Read(RegPRA)
+	assert.False(t, p.CA2(), "low after reading port A")
+	p.SetCA1(false)
+	assert.True(t, p.CA2(), "back high on the active CA1 transition")
+	assert.Equal(t, []bool{true, false, true}, levels)
+}
+
+func TestPIA_pulse(t *testing.T) {
+	p, _ := newPIA()
+	p.Write(RegCRB, ControlPR|C2Pulse)
+	p.Read(RegPRB)
+	assert.True(t, p.CB2(), "port B pulses on writes")
+	p.Write(RegPRB, 0)
+	assert.False(t, p.CB2())
+	p.Tick()
+	assert.True(t, p.CB2())
+}
+
+func TestPIA_manualOutput(t *testing.T) {
+	p, _ := newPIA()
+	p.Write(RegCRB, C2Low)
+	assert.False(t, p.CB2())
+	p.Write(RegCRB, C2High)
+	assert.True(t, p.CB2())
+}
@@ -0,0 +1,75 @@
+package riot
+
+import (
+	"fmt"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("riot6532", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		var options struct {
+			RAM *machine.Address // where the 128 bytes of RAM are mapped
+		}
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		r := NewRIOT(m.Pin(config))
+		if err := mapPart(m, config.Name+" ram", options.RAM, len(r.RAM().Bytes()), r.RAM()); err != nil {
+			return nil, err
+		}
+		m.Scheduler.AddTicker(r)
+		return r, nil
+	})
+
+	machine.RegisterDevice("rriot6530", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		return RRIOTFor(m, config)
+	})
+}
+
+// RRIOTFor creates a 6530 for a rriot6530 device config, mapping its RAM and ROM as the options say.
+// Boards wiring the chip to their own peripherals build on it.
+func RRIOTFor(m *machine.Machine, config machine.Device) (*RRIOT, error) {
+	var options struct {
+		RAM *machine.Address // where the 64 bytes of RAM are mapped
+		ROM *machine.Address // where the 1K ROM is mapped
+		// File holds the ROM contents
+		File string
+	}
+	if err := config.Decode(&options); err != nil {
+		return nil, err
+	}
+	var rom []byte
+	if options.File != "" {
+		var err error
+		if rom, err = m.ReadFile(options.File); err != nil {
+			return nil, err
+		}
+		if len(rom) > 1024 {
+			return nil, fmt.Errorf("%s is %d bytes, the ROM holds 1024", options.File, len(rom))
+		}
+	}
+	rom = append(rom, make([]byte, 1024-len(rom))...)
+	r := NewRRIOT(m.Pin(config), rom)
+	if err := mapPart(m, config.Name+" ram", options.RAM, len(r.RAM().Bytes()), r.RAM()); err != nil {
+		return nil, err
+	}
+	if err := mapPart(m, config.Name+" rom", options.ROM, len(rom), r.ROM()); err != nil {
+		return nil, err
+	}
+	m.Scheduler.AddTicker(r)
+	return r, nil
+}
+
+// mapPart maps the RAM or ROM of the chip when the config places it
+func mapPart(m *machine.Machine, name string, start *machine.Address, size int, device memory.MemoryMapper) error {
+	if start == nil {
+		return nil
+	}
+	end := int(*start) + size - 1
+	if end > 0xFFFF {
+		return fmt.Errorf("%s does not fit below $FFFF", name)
+	}
+	return m.Bus.Map(name, uint16(*start), uint16(end), device)
+}
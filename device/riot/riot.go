@@ -0,0 +1,339 @@
+package riot
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+// I/O registers, selected by A0-A1 while A2 is low
+const (
+	RegORA  = 0x0
+	RegDDRA = 0x1
+	RegORB  = 0x2
+	RegDDRB = 0x3
+)
+
+// Interrupt flag register bits
+const (
+	FlagPA7   = 0x40 // active edge on PA7, 6532 only
+	FlagTimer = 0x80
+)
+
+// prescaler periods selected by A0-A1 when the timer is written
+var prescalers = [4]uint16{1, 8, 64, 1024}
+
+// chip is what the 6530 and 6532 have in common: RAM, two 8 bit ports and the interval timer
+type chip struct {
+	PortA Port
+	PortB Port
+
+	ram   *memory.RAM
+	irq   *cpu.InterruptPin
+	state state
+}
+
+// state is everything a save state needs, the RAM is saved as its own bus region
+type state struct {
+	ORA, ORB, DDRA, DDRB byte
+	InputA, InputB       byte
+
+	Timer     byte
+	Interval  uint16 // cycles per decrement, 1 after the timer ran out
+	Prescale  uint16 // cycles left until the next decrement
+	TimerFlag bool
+	TimerIRQ  bool
+
+	PA7          bool // last level seen on PA7
+	EdgeFlag     bool
+	EdgeIRQ      bool
+	EdgePositive bool
+}
+
+// Port is one of the two 8 bit ports
+type Port struct {
+	// OnWrite, when set, is told about the port output whenever the output register or the data direction
+	// register changes: output holds the levels of the pins configured as outputs (ddr bits set)
+	OnWrite func(output, ddr byte)
+
+	chip *chip
+	b    bool
+}
+
+// Set drives the port pins from outside, bits of pins configured as outputs are ignored when reading
+func (p *Port) Set(input byte) {
+	if p.b {
+		p.chip.state.InputB = input
+		return
+	}
+	p.chip.state.InputA = input
+	p.chip.edge()
+}
+
+// Output returns the levels of the pins, the ones configured as inputs read as the driven input
+func (p *Port) Output() byte {
+	s := &p.chip.state
+	if p.b {
+		return s.ORB&s.DDRB | s.InputB&^s.DDRB
+	}
+	return s.ORA&s.DDRA | s.InputA&^s.DDRA
+}
+
+func (p *Port) written() {
+	if p.OnWrite == nil {
+		return
+	}
+	s := &p.chip.state
+	if p.b {
+		p.OnWrite(s.ORB&s.DDRB, s.DDRB)
+	} else {
+		p.OnWrite(s.ORA&s.DDRA, s.DDRA)
+	}
+}
+
+func (c *chip) init(ramSize int, irq *cpu.InterruptPin) {
+	c.ram = memory.NewRAM(ramSize)
+	c.irq = irq
+	c.PortA.chip = c
+	c.PortB = Port{chip: c, b: true}
+	c.Reset()
+}
+
+// RAM is the on-chip RAM, it is mapped separately from the registers
+func (c *chip) RAM() *memory.RAM {
+	return c.ram
+}
+
+// Reset clears the ports and disables interrupts like the RES input, the timer keeps counting
+func (c *chip) Reset() {
+	s := &c.state
+	s.ORA, s.ORB, s.DDRA, s.DDRB = 0, 0, 0, 0
+	s.InputA, s.InputB = 0xFF, 0xFF
+	s.TimerIRQ, s.EdgeIRQ, s.EdgePositive, s.EdgeFlag = false, false, false, false
+	s.PA7 = true
+	if s.Interval == 0 {
+		s.Interval = 1
+	}
+	c.updateIRQ()
+}
+
+// Tick advances the interval timer by one cycle
+func (c *chip) Tick() {
+	s := &c.state
+	if s.Prescale > 0 {
+		s.Prescale--
+		return
+	}
+	s.Prescale = s.Interval - 1
+	if s.Timer == 0 {
+		// ran out: count down every cycle from $FF until the timer is written again
+		s.Interval = 1
+		s.Prescale = 0
+		s.TimerFlag = true
+		c.updateIRQ()
+	}
+	s.Timer--
+}
+
+func (c *chip) readPort(address uint16) byte {
+	s := &c.state
+	switch address & 0x3 {
+	case RegORA:
+		return c.PortA.Output()
+	case RegDDRA:
+		return s.DDRA
+	case RegORB:
+		return c.PortB.Output()
+	default:
+		return s.DDRB
+	}
+}
+
+func (c *chip) writePort(address uint16, value byte) {
+	s := &c.state
+	switch address & 0x3 {
+	case RegORA:
+		s.ORA = value
+	case RegDDRA:
+		s.DDRA = value
+	case RegORB:
+		s.ORB = value
+	default:
+		s.DDRB = value
+	}
+	if address&0x2 == 0 {
+		c.edge()
+		c.PortA.written()
+	} else {
+		c.PortB.written()
+	}
+}
+
+// writeTimer starts the timer, it decrements on the next cycle and then once per prescaler period
+func (c *chip) writeTimer(address uint16, value byte) {
+	s := &c.state
+	s.Timer = value
+	s.Interval = prescalers[address&0x3]
+	s.Prescale = 0
+	s.TimerIRQ = address&0x8 != 0
+	s.TimerFlag = false
+	c.updateIRQ()
+}
+
+func (c *chip) readTimer(address uint16) byte {
+	c.state.TimerIRQ = address&0x8 != 0
+	c.state.TimerFlag = false
+	c.updateIRQ()
+	return c.state.Timer
+}
+
+func (c *chip) flags() byte {
+	var flags byte
+	if c.state.TimerFlag {
+		flags |= FlagTimer
+	}
+	if c.state.EdgeFlag {
+		flags |= FlagPA7
+	}
+	return flags
+}
+
+// edge looks for the active transition on PA7
+func (c *chip) edge() {
+	s := &c.state
+	level := c.PortA.Output()&0x80 != 0
+	if level != s.PA7 && level == s.EdgePositive {
+		s.EdgeFlag = true
+		c.updateIRQ()
+	}
+	s.PA7 = level
+}
+
+func (c *chip) updateIRQ() {
+	c.irq.Set(c.IRQ())
+}
+
+// IRQ reports the level of the IRQ output
+func (c *chip) IRQ() bool {
+	s := &c.state
+	return s.TimerFlag && s.TimerIRQ || s.EdgeFlag && s.EdgeIRQ
+}
+
+// SaveState implements memory.Stateful
+func (c *chip) SaveState() ([]byte, error) {
+	return json.Marshal(c.state)
+}
+
+func (c *chip) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &c.state); err != nil {
+		return err
+	}
+	c.updateIRQ()
+	return nil
+}
+
+// RIOT is a MOS 6532 RAM-I/O-Timer: 128 bytes of RAM, two ports, an interval timer and
+// edge detection on PA7. The registers decode A0-A4 and are mapped apart from the RAM, the chip selects
+// between them with its RS input. It is advanced by Tick once per cpu cycle.
+type RIOT struct {
+	chip
+}
+
+// NewRIOT creates a 6532, irq may be nil when the IRQ output is not connected
+func NewRIOT(irq *cpu.InterruptPin) *RIOT {
+	r := &RIOT{}
+	r.init(128, irq)
+	return r
+}
+
+func (r *RIOT) Read(address uint16) byte {
+	switch {
+	case address&0x4 == 0:
+		return r.readPort(address)
+	case address&0x1 == 0:
+		return r.readTimer(address)
+	default:
+		flags := r.flags()
+		r.state.EdgeFlag = false
+		r.updateIRQ()
+		return flags
+	}
+}
+
+// Peek implements memory.Peeker, it reads a register without clearing flags
+func (r *RIOT) Peek(address uint16) byte {
+	switch {
+	case address&0x4 == 0:
+		return r.readPort(address)
+	case address&0x1 == 0:
+		return r.state.Timer
+	default:
+		return r.flags()
+	}
+}
+
+func (r *RIOT) Write(address uint16, value byte) {
+	switch {
+	case address&0x4 == 0:
+		r.writePort(address, value)
+	case address&0x10 != 0:
+		r.writeTimer(address, value)
+	default:
+		// edge detect control: A0 selects the positive edge, A1 enables the interrupt
+		r.state.EdgePositive = address&0x1 != 0
+		r.state.EdgeIRQ = address&0x2 != 0
+		r.updateIRQ()
+	}
+}
+
+// RRIOT is a MOS 6530 ROM-RAM-I/O-Timer: 1K of mask ROM, 64 bytes of RAM, two ports and an interval timer.
+// The registers decode A0-A3 and are mapped apart from the RAM and the ROM. It is advanced by Tick once
+// per cpu cycle.
+type RRIOT struct {
+	chip
+	rom *memory.ROM
+}
+
+// NewRRIOT creates a 6530 with the contents of its ROM, irq may be nil when the IRQ output is not connected
+func NewRRIOT(irq *cpu.InterruptPin, rom []byte) *RRIOT {
+	r := &RRIOT{rom: memory.NewROM(rom)}
+	r.init(64, irq)
+	return r
+}
+
+// ROM is the mask ROM, mapped separately from the registers
+func (r *RRIOT) ROM() *memory.ROM {
+	return r.rom
+}
+
+func (r *RRIOT) Read(address uint16) byte {
+	switch {
+	case address&0x4 == 0:
+		return r.readPort(address)
+	case address&0x1 == 0:
+		return r.readTimer(address)
+	default:
+		return r.flags()
+	}
+}
+
+// Peek implements memory.Peeker, it reads a register without clearing flags
+func (r *RRIOT) Peek(address uint16) byte {
+	switch {
+	case address&0x4 == 0:
+		return r.readPort(address)
+	case address&0x1 == 0:
+		return r.state.Timer
+	default:
+		return r.flags()
+	}
+}
+
+func (r *RRIOT) Write(address uint16, value byte) {
+	if address&0x4 == 0 {
+		r.writePort(address, value)
+		return
+	}
+	r.writeTimer(address, value)
+}
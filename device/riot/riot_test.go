@@ -0,0 +1,94 @@
+package riot
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tick(t interface{ Tick() }, cycles int) {
+	for i := 0; i < cycles; i++ {
+		t.Tick()
+	}
+}
+
+func TestRIOT_ports(t *testing.T) {
+	r := NewRIOT(nil)
+	var output, ddr byte
+	r.PortB.OnWrite = func(o, d byte) { output, ddr = o, d }
+	r.Write(RegDDRB, 0x0F)
+	r.Write(RegORB, 0x55)
+	assert.Equal(t, byte(0x05), output)
+	assert.Equal(t, byte(0x0F), ddr)
+	r.PortB.Set(0xA0)
+	assert.Equal(t, byte(0xA5), r.Read(RegORB))
+}
+
+func TestRIOT_timer(t *testing.T) {
+	line := &cpu.InterruptLine{}
+	r := NewRIOT(line.Pin())
+	r.Write(0x1D, 2) // ÷8 with interrupt
+
+	tick(r, 1)
+	assert.Equal(t, byte(1), r.Peek(0x04))
+	tick(r, 8)
+	assert.Equal(t, byte(0), r.Peek(0x04))
+	tick(r, 7)
+	assert.False(t, line.Active())
+	tick(r, 1)
+	assert.True(t, line.Active(), "2*8+1 cycles")
+	assert.Equal(t, byte(0xFF), r.Peek(0x04))
+	assert.Equal(t, byte(FlagTimer), r.Peek(0x05))
+	tick(r, 3)
+	assert.Equal(t, byte(0xFC), r.Peek(0x04), "counts every cycle after running out")
+
+	r.Read(0x04)
+	assert.False(t, line.Active(), "reading the timer clears the flag")
+	assert.Equal(t, byte(0), r.Read(0x05))
+}
+
+func TestRIOT_edgeDetect(t *testing.T) {
+	line := &cpu.InterruptLine{}
+	r := NewRIOT(line.Pin())
+	r.Write(0x07, 0) // positive edge, interrupt enabled
+	r.PortA.Set(0x7F)
+	assert.False(t, line.Active(), "negative edge")
+	r.PortA.Set(0xFF)
+	assert.True(t, line.Active())
+	assert.Equal(t, byte(FlagPA7), r.Read(0x05))
+	assert.False(t, line.Active(), "reading the flags clears the edge flag")
+}
+
+func TestRRIOT(t *testing.T) {
+	r := NewRRIOT(nil, []byte{1, 2, 3})
+	assert.Equal(t, byte(2), r.ROM().Read(1))
+	r.Write(0x0F, 0) // ÷1024 with interrupt
+	tick(r, 1)
+	assert.Equal(t, byte(FlagTimer), r.Read(0x07))
+	assert.True(t, r.IRQ())
+	r.Read(0x06)
+	assert.False(t, r.IRQ())
+}
+
+func TestRIOT_machine(t *testing.T) {
+	config, err := machine.Parse([]byte(`
+memory:
+  - {type: ram, start: $1000, end: $FFFF}
+devices:
+  - {name: riot, type: riot6532, start: $0280, end: $029F, options: {ram: $0080}}
+`))
+	require.NoError(t, err)
+	m, err := machine.New(config, ".")
+	require.NoError(t, err)
+
+	m.Bus.Write(0x00FF, 0x42)
+	assert.Equal(t, byte(0x42), m.Bus.Read(0x00FF))
+	m.Bus.Write(0x0294, 10)
+	m.Cpu.Cycles += 6
+	m.Scheduler.Sync()
+	assert.Equal(t, byte(4), m.Bus.Read(0x0284))
+}
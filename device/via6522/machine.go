@@ -0,0 +1,14 @@
+package via6522
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+func init() {
+	machine.RegisterDevice("via6522", func(m *machine.Machine, config machine.Device) (memory.MemoryMapper, error) {
+		v := New(m.Pin(config))
+		m.Scheduler.AddTicker(v)
+		return v, nil
+	})
+}
@@ -0,0 +1,63 @@
+package via6522
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/asm"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const board = `
+memory:
+  - {type: ram, start: $0000, end: $5FFF}
+  - {type: ram, start: $8000, end: $FFFF}
+devices:
+  - {name: via, type: via6522, start: $6000, end: $600F, irq: irq}
+entry: $8000
+`
+
+// a T1 interrupt every 1000 cycles counts in $00
+const program = `
+VIA_T1CL = $6004
+VIA_T1CH = $6005
+VIA_ACR  = $600B
+VIA_IER  = $600E
+        .org $8000
+        LDA #$40        ; T1 free running
+        STA VIA_ACR
+        LDA #$C0        ; enable T1 interrupts
+        STA VIA_IER
+        LDA #<998
+        STA VIA_T1CL
+        LDA #>998
+        STA VIA_T1CH
+        CLI
+loop:   JMP loop
+irq:    INC $00
+        BIT VIA_T1CL    ; acknowledge
+        RTI
+        .org $FFFE
+        .word irq
+`
+
+func TestVIA_machine(t *testing.T) {
+	config, err := machine.Parse([]byte(board))
+	require.NoError(t, err)
+	m, err := machine.New(config, ".")
+	require.NoError(t, err)
+	code, err := asm.Assemble(program, 0)
+	require.NoError(t, err)
+	for _, segment := range code.Segments {
+		for i, b := range segment.Bytes {
+			m.Bus.Write(segment.Address+uint16(i), b)
+		}
+	}
+
+	for m.Cpu.Cycles < 100000 {
+		m.Cpu.ExecuteOpcode()
+	}
+	assert.InDelta(t, 100, int(m.Bus.Read(0x00)), 1)
+}
@@ -0,0 +1,616 @@
+package via6522
+
+import (
+	"encoding/json"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+)
+
+// Registers, selected by RS0-RS3
+const (
+	RegORB  = 0x0 // output/input register B
+	RegORA  = 0x1 // output/input register A, with handshake
+	RegDDRB = 0x2
+	RegDDRA = 0x3
+	RegT1CL = 0x4 // T1 counter low, writes go to the low latch
+	RegT1CH = 0x5 // T1 counter high, writing starts T1
+	RegT1LL = 0x6
+	RegT1LH = 0x7
+	RegT2CL = 0x8 // T2 counter low, writes go to the low latch
+	RegT2CH = 0x9 // T2 counter high, writing starts T2
+	RegSR   = 0xA
+	RegACR  = 0xB
+	RegPCR  = 0xC
+	RegIFR  = 0xD
+	RegIER  = 0xE
+	RegORA2 = 0xF // output/input register A, no handshake
+)
+
+// Interrupt flags, IFR and IER bits
+const (
+	IntCA2 = 1 << iota
+	IntCA1
+	IntSR
+	IntCB2
+	IntCB1
+	IntT2
+	IntT1
+	IntAny // IFR: any enabled interrupt is active, IER: set (1) or clear (0) the written bits
+)
+
+// VIA is a MOS 6522 Versatile Interface Adapter: two 8 bit ports with data direction registers,
+// two 16 bit timers, a shift register and the CA1/CA2/CB1/CB2 control lines.
+// It is advanced by Tick once per cpu cycle and drives its IRQ output through the pin it is given.
+type VIA struct {
+	PortA Port
+	PortB Port
+
+	// OnCA2 and OnCB2 are told when the CA2 and CB2 outputs change level
+	OnCA2 func(level bool)
+	OnCB2 func(level bool)
+
+	irq   *cpu.InterruptPin
+	state state
+}
+
+// state is everything a save state needs
+type state struct {
+	ORA, ORB, DDRA, DDRB byte
+	InputA, InputB       byte
+	LatchedA, LatchedB   byte // port values captured at an active CA1/CB1 edge when latching is enabled
+
+	T1Counter, T1Latch uint16
+	T1Armed            bool // the next time out sets the interrupt flag (one-shot mode fires once)
+	T1Reload           bool // free running: the counter is reloaded from the latch on the next cycle
+	PB7                bool // T1 output on PB7
+
+	T2Counter   uint16
+	T2LatchLow  byte
+	T2Armed     bool
+	ShiftCount  int // bits shifted since the shift register was accessed, 8 when idle
+	ShiftTimer  int // cycles until the next shift
+	SR, ACR     byte
+	PCR         byte
+	IFR, IER    byte
+	CA1, CA2    bool // input levels, CA2 also the output level in output modes
+	CB1, CB2    bool
+	CA2Out      bool
+	CB2Out      bool
+	CA2Pulse    bool // pulse output mode: CA2 is low for the current cycle
+	CB2Pulse    bool
+	PB6         bool
+	ShiftOutput bool // level put on CB2 by the shift register
+}
+
+// Port is one of the two 8 bit ports
+type Port struct {
+	// OnWrite, when set, is told about the port output whenever the output register or the data direction
+	// register changes: output holds the levels of the pins configured as outputs (ddr bits set)
+	OnWrite func(output, ddr byte)
+
+	via *VIA
+	b   bool
+}
+
+// Set drives the port pins from outside, bits of pins configured as outputs are ignored when reading
+func (p *Port) Set(input byte) {
+	v := p.via
+	if !p.b {
+		v.state.InputA = input
+		return
+	}
+	pb6 := input&0x40 != 0
+	if v.state.ACR&0x20 != 0 && v.state.PB6 && !pb6 {
+		// T2 counts negative edges on PB6
+		v.countT2()
+	}
+	v.state.PB6 = pb6
+	v.state.InputB = input
+}
+
+// Output returns the levels of the pins, the ones configured as inputs read as the driven input
+func (p *Port) Output() byte {
+	if p.b {
+		return p.via.pins(p.via.state.ORB, p.via.state.DDRB, p.via.state.InputB, true)
+	}
+	return p.via.pins(p.via.state.ORA, p.via.state.DDRA, p.via.state.InputA, false)
+}
+
+// New creates a VIA, irq may be nil when the IRQ output is not connected
+func New(irq *cpu.InterruptPin) *VIA {
+	v := &VIA{irq: irq}
+	v.PortA.via = v
+	v.PortB = Port{via: v, b: true}
+	v.Reset()
+	return v
+}
+
+// Reset clears the registers like the RES input, timer counters, latches and the shift register keep their values
+func (v *VIA) Reset() {
+	s := &v.state
+	s.ORA, s.ORB, s.DDRA, s.DDRB = 0, 0, 0, 0
+	s.InputA, s.InputB = 0xFF, 0xFF
+	s.ACR, s.PCR, s.IFR, s.IER = 0, 0, 0, 0
+	s.T1Armed, s.T2Armed, s.T1Reload = false, false, false
+	s.CA1, s.CA2, s.CB1, s.CB2 = true, true, true, true
+	s.CA2Out, s.CB2Out, s.ShiftOutput = true, true, true
+	s.PB6, s.PB7 = true, true
+	s.ShiftCount = 8
+	v.updateIRQ()
+}
+
+func (v *VIA) pins(or, ddr, input byte, portB bool) byte {
+	value := or&ddr | input&^ddr
+	if portB && v.state.ACR&0x80 != 0 {
+		value &^= 0x80
+		if v.state.PB7 {
+			value |= 0x80
+		}
+	}
+	return value
+}
+
+func (v *VIA) Read(address uint16) byte {
+	s := &v.state
+	value := v.Peek(address)
+	switch address & 0xF {
+	case RegORB:
+		v.clearFlags(IntCB1 | v.independent(s.PCR>>5, IntCB2))
+	case RegORA:
+		v.clearFlags(IntCA1 | v.independent(s.PCR>>1, IntCA2))
+		v.handshakeA()
+	case RegT1CL:
+		v.clearFlags(IntT1)
+	case RegT2CL:
+		v.clearFlags(IntT2)
+	case RegSR:
+		v.clearFlags(IntSR)
+		v.startShift()
+	}
+	return value
+}
+
+// Peek implements memory.Peeker, it reads a register without clearing flags or handshaking
+func (v *VIA) Peek(address uint16) byte {
+	s := &v.state
+	switch address & 0xF {
+	case RegORB:
+		input := s.InputB
+		if s.ACR&0x02 != 0 {
+			input = s.LatchedB
+		}
+		// output pins of port B read back the output register, not the pin level
+		return v.pins(s.ORB, s.DDRB, input, true)
+	case RegORA, RegORA2:
+		if s.ACR&0x01 != 0 {
+			return s.LatchedA
+		}
+		return v.pins(s.ORA, s.DDRA, s.InputA, false)
+	case RegDDRB:
+		return s.DDRB
+	case RegDDRA:
+		return s.DDRA
+	case RegT1CL:
+		return byte(s.T1Counter)
+	case RegT1CH:
+		return byte(s.T1Counter >> 8)
+	case RegT1LL:
+		return byte(s.T1Latch)
+	case RegT1LH:
+		return byte(s.T1Latch >> 8)
+	case RegT2CL:
+		return byte(s.T2Counter)
+	case RegT2CH:
+		return byte(s.T2Counter >> 8)
+	case RegSR:
+		return s.SR
+	case RegACR:
+		return s.ACR
+	case RegPCR:
+		return s.PCR
+	case RegIFR:
+		return s.IFR
+	default: // RegIER
+		return s.IER | IntAny
+	}
+}
+
+func (v *VIA) Write(address uint16, value byte) {
+	s := &v.state
+	switch address & 0xF {
+	case RegORB:
+		s.ORB = value
+		v.clearFlags(IntCB1 | v.independent(s.PCR>>5, IntCB2))
+		v.handshakeB()
+		v.portBWritten()
+	case RegORA:
+		s.ORA = value
+		v.clearFlags(IntCA1 | v.independent(s.PCR>>1, IntCA2))
+		v.handshakeA()
+		v.portAWritten()
+	case RegORA2:
+		s.ORA = value
+		v.portAWritten()
+	case RegDDRB:
+		s.DDRB = value
+		v.portBWritten()
+	case RegDDRA:
+		s.DDRA = value
+		v.portAWritten()
+	case RegT1CL, RegT1LL:
+		s.T1Latch = s.T1Latch&0xFF00 | uint16(value)
+	case RegT1CH:
+		s.T1Latch = s.T1Latch&0x00FF | uint16(value)<<8
+		s.T1Counter = s.T1Latch
+		s.T1Armed = true
+		s.T1Reload = false
+		v.clearFlags(IntT1)
+		if s.ACR&0x80 != 0 {
+			s.PB7 = false
+			v.portBWritten()
+		}
+	case RegT1LH:
+		s.T1Latch = s.T1Latch&0x00FF | uint16(value)<<8
+		v.clearFlags(IntT1)
+	case RegT2CL:
+		s.T2LatchLow = value
+	case RegT2CH:
+		s.T2Counter = uint16(value)<<8 | uint16(s.T2LatchLow)
+		s.T2Armed = true
+		v.clearFlags(IntT2)
+	case RegSR:
+		s.SR = value
+		v.clearFlags(IntSR)
+		v.startShift()
+	case RegACR:
+		pb7 := s.ACR & 0x80
+		s.ACR = value
+		if value&0x80 != pb7 {
+			s.PB7 = true
+			v.portBWritten()
+		}
+		if v.shiftMode() == 0 {
+			s.ShiftCount = 8
+		}
+	case RegPCR:
+		s.PCR = value
+		v.updateControlOutputs()
+	case RegIFR:
+		v.clearFlags(value & 0x7F)
+	case RegIER:
+		if value&IntAny != 0 {
+			s.IER |= value & 0x7F
+		} else {
+			s.IER &^= value & 0x7F
+		}
+		v.updateIRQ()
+	}
+}
+
+func (v *VIA) portAWritten() {
+	if v.PortA.OnWrite != nil {
+		v.PortA.OnWrite(v.state.ORA&v.state.DDRA, v.state.DDRA)
+	}
+}
+
+func (v *VIA) portBWritten() {
+	if v.PortB.OnWrite != nil {
+		ddr := v.state.DDRB
+		if v.state.ACR&0x80 != 0 {
+			ddr |= 0x80
+		}
+		v.PortB.OnWrite(v.pins(v.state.ORB, v.state.DDRB, 0, true)&ddr, ddr)
+	}
+}
+
+// Tick advances the timers and the shift register by one cycle, it implements scheduler.Ticker
+func (v *VIA) Tick() {
+	s := &v.state
+
+	if s.CA2Pulse {
+		s.CA2Pulse = false
+		v.updateControlOutputs()
+	}
+	if s.CB2Pulse {
+		s.CB2Pulse = false
+		v.updateControlOutputs()
+	}
+
+	if s.T1Reload {
+		s.T1Counter = s.T1Latch
+		s.T1Reload = false
+	} else {
+		s.T1Counter--
+		if s.T1Counter == 0xFFFF {
+			v.timeoutT1()
+		}
+	}
+
+	if s.ACR&0x20 == 0 {
+		v.countT2()
+	}
+
+	if mode := v.shiftMode(); mode == 2 || mode == 6 {
+		v.shiftTimer()
+	}
+}
+
+func (v *VIA) timeoutT1() {
+	s := &v.state
+	freeRunning := s.ACR&0x40 != 0
+	if freeRunning {
+		s.T1Reload = true
+	}
+	if !s.T1Armed {
+		return
+	}
+	v.setFlags(IntT1)
+	if s.ACR&0x80 != 0 {
+		if freeRunning {
+			s.PB7 = !s.PB7
+		} else {
+			s.PB7 = true
+		}
+		v.portBWritten()
+	}
+	if !freeRunning {
+		s.T1Armed = false
+	}
+}
+
+func (v *VIA) countT2() {
+	s := &v.state
+	if mode := v.shiftMode(); mode == 1 || mode == 4 || mode == 5 {
+		// the shift register is clocked by T2, which then acts as an 8 bit counter reloading from its low latch
+		if byte(s.T2Counter) == 0 {
+			s.T2Counter = s.T2Counter&0xFF00 | uint16(s.T2LatchLow)
+			v.shift()
+		} else {
+			s.T2Counter--
+		}
+		return
+	}
+	s.T2Counter--
+	if s.T2Counter == 0xFFFF && s.T2Armed {
+		s.T2Armed = false
+		v.setFlags(IntT2)
+	}
+}
+
+func (v *VIA) shiftMode() byte {
+	return v.state.ACR >> 2 & 0x7
+}
+
+func (v *VIA) startShift() {
+	s := &v.state
+	if v.shiftMode() == 0 {
+		return
+	}
+	s.ShiftCount = 0
+	s.ShiftTimer = 2
+}
+
+// shiftTimer clocks the shift register at half the cpu clock
+func (v *VIA) shiftTimer() {
+	s := &v.state
+	s.ShiftTimer--
+	if s.ShiftTimer > 0 {
+		return
+	}
+	s.ShiftTimer = 2
+	v.shift()
+}
+
+// shift moves one bit in or out, the shift register stops after 8 bits except in free running output mode
+func (v *VIA) shift() {
+	s := &v.state
+	mode := v.shiftMode()
+	if s.ShiftCount >= 8 && mode != 4 {
+		return
+	}
+	if mode >= 4 {
+		bit := s.SR&0x80 != 0
+		s.SR = s.SR<<1 | s.SR>>7
+		s.ShiftOutput = bit
+		v.updateControlOutputs()
+	} else {
+		in := byte(0)
+		if s.CB2 {
+			in = 1
+		}
+		s.SR = s.SR<<1 | in
+	}
+	if mode == 4 {
+		return
+	}
+	s.ShiftCount++
+	if s.ShiftCount == 8 {
+		v.setFlags(IntSR)
+	}
+}
+
+// SetCA1 drives the CA1 input, the active edge is selected by PCR bit 0
+func (v *VIA) SetCA1(level bool) {
+	s := &v.state
+	if level == s.CA1 {
+		return
+	}
+	s.CA1 = level
+	if level == (s.PCR&0x01 != 0) {
+		if s.ACR&0x01 != 0 {
+			s.LatchedA = v.pins(s.ORA, s.DDRA, s.InputA, false)
+		}
+		v.setFlags(IntCA1)
+		if s.PCR>>1&0x7 == 4 {
+			// handshake output: data taken, CA2 goes back high
+			s.CA2Out = true
+			v.updateControlOutputs()
+		}
+	}
+}
+
+// SetCA2 drives the CA2 input, it only has an effect when CA2 is configured as an input
+func (v *VIA) SetCA2(level bool) {
+	s := &v.state
+	if level == s.CA2 {
+		return
+	}
+	s.CA2 = level
+	if mode := s.PCR >> 1 & 0x7; mode < 4 && level == (mode&0x2 != 0) {
+		v.setFlags(IntCA2)
+	}
+}
+
+// SetCB1 drives the CB1 input, it also clocks the shift register in external clock modes
+func (v *VIA) SetCB1(level bool) {
+	s := &v.state
+	if level == s.CB1 {
+		return
+	}
+	s.CB1 = level
+	if mode := v.shiftMode(); (mode == 3 || mode == 7) && level {
+		v.shift()
+	}
+	if level == (s.PCR&0x10 != 0) {
+		if s.ACR&0x02 != 0 {
+			s.LatchedB = v.pins(s.ORB, s.DDRB, s.InputB, true)
+		}
+		v.setFlags(IntCB1)
+		if s.PCR>>5&0x7 == 4 {
+			s.CB2Out = true
+			v.updateControlOutputs()
+		}
+	}
+}
+
+// SetCB2 drives the CB2 input, it is also the serial input of the shift register
+func (v *VIA) SetCB2(level bool) {
+	s := &v.state
+	if level == s.CB2 {
+		return
+	}
+	s.CB2 = level
+	if mode := s.PCR >> 5 & 0x7; mode < 4 && v.shiftMode() < 4 && level == (mode&0x2 != 0) {
+		v.setFlags(IntCB2)
+	}
+}
+
+// CA2 returns the CA2 output level, high when CA2 is an input
+func (v *VIA) CA2() bool {
+	s := &v.state
+	switch s.PCR >> 1 & 0x7 {
+	case 4:
+		return s.CA2Out
+	case 5:
+		return !s.CA2Pulse
+	case 6:
+		return false
+	default:
+		return true
+	}
+}
+
+// CB2 returns the CB2 output level, high when CB2 is an input. In shift out modes CB2 carries the data.
+func (v *VIA) CB2() bool {
+	s := &v.state
+	if v.shiftMode() >= 4 {
+		return s.ShiftOutput
+	}
+	switch s.PCR >> 5 & 0x7 {
+	case 4:
+		return s.CB2Out
+	case 5:
+		return !s.CB2Pulse
+	case 6:
+		return false
+	default:
+		return true
+	}
+}
+
+// handshakeA runs the CA2 handshake on an access to ORA
+func (v *VIA) handshakeA() {
+	s := &v.state
+	switch s.PCR >> 1 & 0x7 {
+	case 4:
+		s.CA2Out = false
+	case 5:
+		s.CA2Pulse = true
+	default:
+		return
+	}
+	v.updateControlOutputs()
+}
+
+// handshakeB runs the CB2 handshake on a write to ORB
+func (v *VIA) handshakeB() {
+	s := &v.state
+	switch s.PCR >> 5 & 0x7 {
+	case 4:
+		s.CB2Out = false
+	case 5:
+		s.CB2Pulse = true
+	default:
+		return
+	}
+	v.updateControlOutputs()
+}
+
+// updateControlOutputs reports CA2 and CB2 output levels to their callbacks
+func (v *VIA) updateControlOutputs() {
+	if v.OnCA2 != nil && v.state.PCR>>1&0x7 >= 4 {
+		v.OnCA2(v.CA2())
+	}
+	if v.OnCB2 != nil && (v.state.PCR>>5&0x7 >= 4 || v.shiftMode() >= 4) {
+		v.OnCB2(v.CB2())
+	}
+}
+
+// independent returns the flag when the control line mode does not clear it on port access
+func (v *VIA) independent(mode byte, flag byte) byte {
+	switch mode & 0x7 {
+	case 1, 3: // independent interrupt input modes
+		return 0
+	default:
+		return flag
+	}
+}
+
+func (v *VIA) setFlags(flags byte) {
+	v.state.IFR |= flags
+	v.updateIRQ()
+}
+
+func (v *VIA) clearFlags(flags byte) {
+	v.state.IFR &^= flags
+	v.updateIRQ()
+}
+
+func (v *VIA) updateIRQ() {
+	s := &v.state
+	active := s.IFR&s.IER&0x7F != 0
+	if active {
+		s.IFR |= IntAny
+	} else {
+		s.IFR &^= IntAny
+	}
+	v.irq.Set(active)
+}
+
+// IRQ tells whether the VIA is requesting an interrupt
+func (v *VIA) IRQ() bool {
+	return v.state.IFR&IntAny != 0
+}
+
+// SaveState implements memory.Stateful
+func (v *VIA) SaveState() ([]byte, error) {
+	return json.Marshal(v.state)
+}
+
+func (v *VIA) LoadState(data []byte) error {
+	if err := json.Unmarshal(data, &v.state); err != nil {
+		return err
+	}
+	v.updateIRQ()
+	return nil
+}
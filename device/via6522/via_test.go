@@ -0,0 +1,182 @@
+package via6522
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newVIA() (*VIA, *cpu.InterruptLine) {
+	line := &cpu.InterruptLine{}
+	return New(line.Pin()), line
+}
+
+func tick(v *VIA, cycles int) {
+	for i := 0; i < cycles; i++ {
+		v.Tick()
+	}
+}
+
+func TestVIA_ports(t *testing.T) {
+	v, _ := newVIA()
+	var output, ddr byte
+	v.PortB.OnWrite = func(o, d byte) { output, ddr = o, d }
+
+	v.Write(RegDDRB, 0xF0)
+	v.Write(RegORB, 0xAA)
+	assert.Equal(t, byte(0xA0), output)
+	assert.Equal(t, byte(0xF0), ddr)
+
+	v.PortB.Set(0x05)
+	assert.Equal(t, byte(0xA5), v.Read(RegORB), "outputs read back the register, inputs the pins")
+	v.PortA.Set(0x3C)
+	assert.Equal(t, byte(0x3C), v.Read(RegORA))
+}
+
+func TestVIA_timer1OneShot(t *testing.T) {
+	v, line := newVIA()
+	v.Write(RegIER, IntAny|IntT1)
+	v.Write(RegACR, 0x80) // PB7 output
+	v.Write(RegT1CL, 10)
+	v.Write(RegT1CH, 0)
+	assert.Equal(t, byte(0), v.Read(RegORB)&0x80, "PB7 low while counting")
+
+	tick(v, 10)
+	assert.False(t, line.Active())
+	tick(v, 1)
+	assert.True(t, line.Active())
+	assert.Equal(t, byte(IntAny|IntT1), v.Peek(RegIFR))
+	assert.Equal(t, byte(0x80), v.Read(RegORB)&0x80, "PB7 high after the time out")
+
+	v.Read(RegT1CL)
+	assert.False(t, line.Active(), "reading the low counter clears the flag")
+	tick(v, 0x10000)
+	assert.False(t, line.Active(), "one-shot fires once")
+}
+
+func TestVIA_timer1FreeRunning(t *testing.T) {
+	v, line := newVIA()
+	v.Write(RegIER, IntAny|IntT1)
+	v.Write(RegACR, 0xC0)
+	v.Write(RegT1CL, 4)
+	v.Write(RegT1CH, 0)
+
+	var fired []int
+	pb7 := []bool{}
+	for cycle := 1; cycle <= 20; cycle++ {
+		v.Tick()
+		if line.Active() {
+			fired = append(fired, cycle)
+			pb7 = append(pb7, v.Peek(RegORB)&0x80 != 0)
+			v.Write(RegIFR, IntT1)
+		}
+	}
+	assert.Equal(t, []int{5, 11, 17}, fired, "first after N+1 cycles, then every N+2")
+	assert.Equal(t, []bool{true, false, true}, pb7, "PB7 toggles")
+}
+
+func TestVIA_timer2(t *testing.T) {
+	v, line := newVIA()
+	v.Write(RegIER, IntAny|IntT2)
+	v.Write(RegT2CL, 3)
+	v.Write(RegT2CH, 0)
+	tick(v, 4)
+	assert.True(t, line.Active())
+	v.Read(RegT2CL)
+	assert.False(t, line.Active())
+
+	// pulse counting on PB6
+	v.Write(RegACR, 0x20)
+	v.Write(RegT2CL, 1)
+	v.Write(RegT2CH, 0)
+	tick(v, 100)
+	assert.False(t, line.Active(), "no pulses, no counting")
+	for i := 0; i < 2; i++ {
+		v.PortB.Set(0x00)
+		v.PortB.Set(0xFF)
+	}
+	assert.True(t, line.Active())
+}
+
+func TestVIA_interruptEnable(t *testing.T) {
+	v, line := newVIA()
+	v.SetCA1(false) // negative edge active by default
+	assert.Equal(t, byte(IntCA1), v.Peek(RegIFR))
+	assert.False(t, line.Active(), "not enabled")
+
+	v.Write(RegIER, IntAny|IntCA1|IntCB1)
+	assert.True(t, line.Active())
+	assert.Equal(t, byte(IntAny|IntCA1|IntCB1), v.Read(RegIER))
+	v.Write(RegIER, IntCA1)
+	assert.False(t, line.Active())
+	assert.Equal(t, byte(IntAny|IntCB1), v.Read(RegIER))
+}
+
+func TestVIA_handshake(t *testing.T) {
+	v, _ := newVIA()
+	var ca2 []bool
+	v.OnCA2 = func(level bool) { ca2 = append(ca2, level) }
+	v.Write(RegPCR, 0x08) // CA2 handshake output, CA1 negative edge
+
+	v.Write(RegORA, 0x41)
+	assert.False(t, v.CA2(), "data ready")
+	v.SetCA1(false)
+	assert.True(t, v.CA2(), "acknowledged")
+	assert.Equal(t, byte(IntCA1), v.Peek(RegIFR)&IntCA1)
+	v.Peek(RegORA)
+	assert.Equal(t, byte(IntCA1), v.Peek(RegIFR)&IntCA1, "peeking does not clear")
+	v.Read(RegORA)
+	assert.Zero(t, v.Peek(RegIFR)&IntCA1)
+	assert.False(t, v.CA2(), "a read handshakes as well")
+
+	v.Write(RegPCR, 0x0A) // pulse output
+	v.Write(RegORA2, 0)   // no handshake on register F
+	assert.True(t, v.CA2())
+	v.Write(RegORA, 0)
+	assert.False(t, v.CA2())
+	v.Tick()
+	assert.True(t, v.CA2())
+	assert.Equal(t, []bool{true, false, true, false, true, false, true}, ca2)
+}
+
+func TestVIA_shiftRegister(t *testing.T) {
+	v, line := newVIA()
+	v.Write(RegIER, IntAny|IntSR)
+	v.Write(RegACR, 0x18) // shift out under phi2
+	var bits []bool
+	v.OnCB2 = func(level bool) { bits = append(bits, level) }
+	v.Write(RegSR, 0xA5)
+	tick(v, 16)
+	assert.True(t, line.Active())
+	assert.Equal(t, []bool{true, false, true, false, false, true, false, true}, bits)
+	assert.Equal(t, byte(0xA5), v.Peek(RegSR), "the register recirculates")
+
+	v.Write(RegACR, 0x0C) // shift in under external clock
+	v.Read(RegSR)
+	for _, bit := range []bool{false, true, true, false, false, false, false, true} {
+		v.SetCB2(bit)
+		v.SetCB1(false)
+		v.SetCB1(true)
+	}
+	assert.Equal(t, byte(0x61), v.Peek(RegSR))
+	assert.True(t, line.Active())
+}
+
+func TestVIA_saveState(t *testing.T) {
+	v, line := newVIA()
+	v.Write(RegIER, IntAny|IntT1)
+	v.Write(RegT1CL, 0x34)
+	v.Write(RegT1CH, 0x12)
+	state, err := v.SaveState()
+	assert.NoError(t, err)
+
+	restored, restoredLine := newVIA()
+	assert.NoError(t, restored.LoadState(state))
+	assert.Equal(t, byte(0x12), restored.Peek(RegT1CH))
+	tick(v, 0x1235)
+	tick(restored, 0x1235)
+	assert.Equal(t, line.Active(), restoredLine.Active())
+	assert.True(t, restoredLine.Active())
+}
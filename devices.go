@@ -0,0 +1,17 @@
+package main
+
+// Device types available to machine descriptions
+import (
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/acia6551"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/acia6850"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/apple1"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/atari2600"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/beneater"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/c64"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/cia6526"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/kim1"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/nes"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/pia6821"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/riot"
+	_ "github.com/slawomirbiernacki/mos6502-emulator/device/via6522"
+)
@@ -0,0 +1,116 @@
+package disassembler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/addressing"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/opcode"
+)
+
+// Instruction is a single decoded instruction
+type Instruction struct {
+	Address uint16
+	Bytes   []byte
+	Spec    opcode.OpcodeSpec
+	Valid   bool // false for undocumented opcodes, which are shown as a .byte directive
+}
+
+// Disassemble decodes the instruction stored at the given address
+func Disassemble(m memory.MemoryMapper, address uint16) Instruction {
+	op := memory.Peek(m, address)
+	if !opcode.Exists(op) {
+		return Instruction{Address: address, Bytes: []byte{op}}
+	}
+	spec := opcode.Lookup(op)
+	bytes := []byte{op}
+	for i := 0; i < spec.AccessMode.OperandBytes(); i++ {
+		bytes = append(bytes, memory.Peek(m, address+uint16(i)+1))
+	}
+	return Instruction{Address: address, Bytes: bytes, Spec: spec, Valid: true}
+}
+
+// Range disassembles count instructions starting at the given address
+func Range(m memory.MemoryMapper, address uint16, count int) []Instruction {
+	result := make([]Instruction, 0, count)
+	for i := 0; i < count; i++ {
+		instruction := Disassemble(m, address)
+		result = append(result, instruction)
+		address += uint16(len(instruction.Bytes))
+	}
+	return result
+}
+
+// Next returns the address of the instruction following this one
+func (i Instruction) Next() uint16 {
+	return i.Address + uint16(len(i.Bytes))
+}
+
+// Operand returns the 8 or 16 bit operand value, 0 for implied instructions
+func (i Instruction) Operand() uint16 {
+	switch len(i.Bytes) {
+	case 2:
+		return uint16(i.Bytes[1])
+	case 3:
+		return uint16(i.Bytes[2])<<8 | uint16(i.Bytes[1])
+	default:
+		return 0
+	}
+}
+
+// Target returns the destination of a branch instruction
+func (i Instruction) Target() uint16 {
+	offset := i.Bytes[1]
+	if offset < 0x80 {
+		return i.Next() + uint16(offset)
+	}
+	return i.Next() - (0x100 - uint16(offset))
+}
+
+// String renders the instruction in the usual assembler syntax, e.g. "LDA ($10),Y"
+func (i Instruction) String() string {
+	if !i.Valid {
+		return fmt.Sprintf(".byte $%02X", i.Bytes[0])
+	}
+	mnemonic := i.Spec.Operation.String()
+	switch i.Spec.AccessMode {
+	case addressing.Implied:
+		return mnemonic
+	case addressing.Accumulator:
+		return mnemonic + " A"
+	case addressing.Immediate:
+		return fmt.Sprintf("%s #$%02X", mnemonic, i.Operand())
+	case addressing.ZeroPage:
+		return fmt.Sprintf("%s $%02X", mnemonic, i.Operand())
+	case addressing.ZeroPageX:
+		return fmt.Sprintf("%s $%02X,X", mnemonic, i.Operand())
+	case addressing.ZeroPageY:
+		return fmt.Sprintf("%s $%02X,Y", mnemonic, i.Operand())
+	case addressing.Relative:
+		return fmt.Sprintf("%s $%04X", mnemonic, i.Target())
+	case addressing.Absolute:
+		return fmt.Sprintf("%s $%04X", mnemonic, i.Operand())
+	case addressing.AbsoluteX:
+		return fmt.Sprintf("%s $%04X,X", mnemonic, i.Operand())
+	case addressing.AbsoluteY:
+		return fmt.Sprintf("%s $%04X,Y", mnemonic, i.Operand())
+	case addressing.Indirect:
+		return fmt.Sprintf("%s ($%04X)", mnemonic, i.Operand())
+	case addressing.IndirectX:
+		return fmt.Sprintf("%s ($%02X,X)", mnemonic, i.Operand())
+	case addressing.IndirectY:
+		return fmt.Sprintf("%s ($%02X),Y", mnemonic, i.Operand())
+	default:
+		return mnemonic
+	}
+}
+
+// HexBytes renders the raw instruction bytes, e.g. "B1 10"
+func (i Instruction) HexBytes() string {
+	parts := make([]string, len(i.Bytes))
+	for n, b := range i.Bytes {
+		parts[n] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/clock"
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/loader"
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+	"github.com/slawomirbiernacki/mos6502-emulator/machines"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/number"
+	"github.com/slawomirbiernacki/mos6502-emulator/oscall"
+	"github.com/slawomirbiernacki/mos6502-emulator/replay"
+)
+
+// address is a flag holding a 16 bit address in $hex, 0xhex or decimal
+type address struct {
+	value uint16
+	set   bool
+}
+
+func (a *address) String() string {
+	if !a.set {
+		return ""
+	}
+	return fmt.Sprintf("$%04X", a.value)
+}
+
+func (a *address) Set(s string) error {
+	value, err := number.ParseAddress(s)
+	if err != nil {
+		return err
+	}
+	a.value, a.set = value, true
+	return nil
+}
+
+// addressList is a repeatable flag, each use may hold several comma separated addresses
+type addressList []uint16
+
+func (l *addressList) String() string {
+	var addresses []string
+	for _, a := range *l {
+		addresses = append(addresses, fmt.Sprintf("$%04X", a))
+	}
+	return strings.Join(addresses, ",")
+}
+
+func (l *addressList) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		value, err := number.ParseAddress(strings.TrimSpace(part))
+		if err != nil {
+			return err
+		}
+		*l = append(*l, value)
+	}
+	return nil
+}
+
+// machineFlags describe the image to load and the cpu to run it on
+type machineFlags struct {
+	config  string
+	format  string
+	load    address
+	entry   address
+	variant string
+	os      string
+
+	// recording and replay, for the commands registering them
+	replay *replayFlags
+
+	// clock of the machine description, set by build
+	clock machine.Frequency
+	// calls serving the -os routines, set by build
+	calls *oscall.Calls
+}
+
+func (m *machineFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&m.config, "machine", "", fmt.Sprintf("machine description (YAML or JSON) or a built-in machine: %s, 64K of RAM when not given",
+		strings.Join(machines.Names(), ", ")))
+	flags.StringVar(&m.format, "format", "", "image format: bin, prg, hex or asm (default: guessed from the extension)")
+	flags.Var(&m.load, "load", "load address of bin images and origin of asm sources (default $0000)")
+	flags.Var(&m.entry, "entry", "entry point (default: the reset vector if the image sets it, the load address otherwise)")
+	flags.StringVar(&m.variant, "cpu", "", "cpu variant: 6502 or 2a03 for the NES (default: the one of -machine, 6502 without one)")
+	flags.StringVar(&m.os, "os", "", fmt.Sprintf("serve the character I/O routines of a system from stdin and stdout: %s",
+		strings.Join(oscall.Systems(), ", ")))
+}
+
+// build creates the cpu with the image loaded, the image is optional
+func (m *machineFlags) build(image string) (*cpu.Cpu, error) {
+	var c *cpu.Cpu
+	var board *machine.Machine
+	if m.config != "" {
+		var err error
+		if board, err = loadMachine(m.config); err != nil {
+			return nil, err
+		}
+		c = board.Cpu
+		m.clock = board.Clock
+	} else {
+		dummy := cpu.NewCpu(nil, &memory.DummyMemoryMapper{})
+		dummy.Reset()
+		dummy.PC = m.load.value
+		c = &dummy
+	}
+	if m.variant != "" {
+		variant, err := cpu.ParseVariant(m.variant)
+		if err != nil {
+			return nil, usageError(err.Error())
+		}
+		c.Variant = variant
+	}
+	entry := c.PC
+	if image != "" {
+		segments, err := loader.Load(image, m.format, m.load.value)
+		if err != nil {
+			return nil, err
+		}
+		loader.Write(c.MemoryMapper(), segments)
+		if len(segments) > 0 {
+			entry = segments[0].Address
+		}
+		if loader.Covers(segments, 0xFFFC) && loader.Covers(segments, 0xFFFD) {
+			entry = uint16(memory.Peek(c.MemoryMapper(), 0xFFFD))<<8 | uint16(memory.Peek(c.MemoryMapper(), 0xFFFC))
+		}
+	}
+	if m.entry.set {
+		entry = m.entry.value
+	}
+	c.PC = entry
+	var console io.ByteReader = bufio.NewReader(os.Stdin)
+	if m.replay != nil {
+		if err := m.replay.start(c, board); err != nil {
+			return nil, err
+		}
+		console = m.replay.console(console)
+	}
+	if m.os != "" {
+		calls, err := oscall.ForSystem(m.os, oscall.Console{In: console, Out: os.Stdout})
+		if err != nil {
+			return nil, usageError(err.Error())
+		}
+		calls.Attach(c)
+		m.calls = calls
+	}
+	return c, nil
+}
+
+// buildRunnable is build for commands that need something to run: an image, a machine or both
+func (m *machineFlags) buildRunnable(image string) (*cpu.Cpu, error) {
+	if image == "" && m.config == "" {
+		return nil, usageError("an image or a -machine is needed")
+	}
+	return m.build(image)
+}
+
+// loadMachine reads a description file, or builds a built-in machine when no such file exists
+func loadMachine(name string) (*machine.Machine, error) {
+	if _, err := os.Stat(name); os.IsNotExist(err) && machines.Has(name) {
+		return machines.Load(name)
+	}
+	return machine.Load(name)
+}
+
+// replayFlags record what reaches a run from the host, or play a recording back
+type replayFlags struct {
+	record string
+	replay string
+
+	recorder *replay.Recorder
+	player   *replay.Player
+}
+
+func (r *replayFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&r.record, "record", "", "record the device input, the -os console input and host interrupts to this file, e.g. for a bug report")
+	flags.StringVar(&r.replay, "replay", "", "play back a file made with -record, the image and -machine must be the ones recorded")
+}
+
+// start attaches the recorder or the player once the image is loaded, board is nil without -machine
+func (r *replayFlags) start(c *cpu.Cpu, board *machine.Machine) error {
+	switch {
+	case r.record != "" && r.replay != "":
+		return usageError("-record and -replay cannot be used together")
+	case r.record != "":
+		r.recorder = replay.NewRecorder(c, nil)
+		if board != nil {
+			board.SetExternal(r.recorder)
+		}
+		// the recording is kept when the run is interrupted
+		hostio.OnInterrupt(func() {
+			if err := r.recorder.Recording().SaveFile(r.record); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		})
+	case r.replay != "":
+		recording, err := replay.LoadFile(r.replay)
+		if err != nil {
+			return err
+		}
+		if r.player, err = replay.NewPlayer(c, recording); err != nil {
+			return err
+		}
+		if board != nil {
+			board.SetExternal(r.player)
+		}
+	}
+	return nil
+}
+
+// console routes the input of the -os services through the recorder or the player
+func (r *replayFlags) console(in io.ByteReader) io.ByteReader {
+	switch {
+	case r.recorder != nil:
+		return r.recorder.Reader("console", in)
+	case r.player != nil:
+		return r.player.Reader("console")
+	}
+	return in
+}
+
+// finish saves the recording, or reports a replay that did not go the way the recorded run went
+func (r *replayFlags) finish() error {
+	switch {
+	case r.recorder != nil:
+		return r.recorder.Stop().SaveFile(r.record)
+	case r.player != nil:
+		r.player.Stop()
+		if err := r.player.Err(); err != nil {
+			return fmt.Errorf("replay diverged: %v", err)
+		}
+		if !r.player.Done() {
+			fmt.Fprintln(os.Stderr, "the run ended before the whole recording was played back")
+		}
+	}
+	return nil
+}
+
+// stopFlags limit a run and say when it is finished
+type stopFlags struct {
+	cycles       uint64
+	instructions uint64
+	at           addressList
+	brk          bool
+	trap         bool
+	when         string
+	clock        string
+	showSpeed    bool
+}
+
+func (s *stopFlags) register(flags *flag.FlagSet) {
+	flags.Uint64Var(&s.cycles, "cycles", 0, "stop after this many cycles, 0 means no limit")
+	flags.Uint64Var(&s.instructions, "instructions", 0, "stop after this many instructions, 0 means no limit")
+	flags.Var(&s.at, "stop-at", "stop when the PC reaches one of these addresses (repeatable, comma separated)")
+	flags.BoolVar(&s.brk, "stop-on-brk", false, "stop before executing BRK")
+	flags.BoolVar(&s.trap, "stop-on-trap", false, "stop when an instruction jumps or branches to itself")
+	flags.StringVar(&s.when, "stop-when", "", "stop when a condition holds after an instruction, e.g. \"a == $FF && [$0200] != 0\"")
+	flags.StringVar(&s.clock, "clock", "", "run in real time at this frequency, e.g. 1MHz, or 'machine' for the clock of -machine (default: as fast as possible)")
+	flags.BoolVar(&s.showSpeed, "show-speed", false, "print the achieved speed every second")
+}
+
+// pacer creates the pacer for the -clock and -show-speed flags
+func (s *stopFlags) pacer(machineClock machine.Frequency) (*clock.Pacer, error) {
+	var frequency machine.Frequency
+	switch s.clock {
+	case "":
+	case "machine":
+		if machineClock == 0 {
+			return nil, usageError("-clock machine needs a -machine with a clock")
+		}
+		frequency = machineClock
+	default:
+		var err error
+		if frequency, err = machine.ParseFrequency(s.clock); err != nil {
+			return nil, usageError(err.Error())
+		}
+	}
+	pacer := clock.NewPacer(float64(frequency))
+	if s.showSpeed {
+		pacer.OnSpeed = func(hz float64) {
+			if frequency > 0 {
+				fmt.Fprintf(os.Stderr, "%.3f MHz (%.0f%%)\n", hz/1e6, 100*hz/float64(frequency))
+			} else {
+				fmt.Fprintf(os.Stderr, "%.3f MHz\n", hz/1e6)
+			}
+		}
+	}
+	return pacer, nil
+}
+
+// parse splits command line arguments into flags and positional arguments, flags may follow the arguments
+func parse(flags *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			// the flag set has already printed the problem and its defaults
+			return nil, flag.ErrHelp
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(positional) < minArgs || len(positional) > maxArgs {
+		return nil, usageError(fmt.Sprintf("%s: wrong number of arguments", flags.Name()))
+	}
+	return positional, nil
+}
+
+func optional(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -0,0 +1,532 @@
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/debugger"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+// continueSlice is the number of cycles executed between checks for a break (Ctrl-C) from the client
+const continueSlice = 10000
+
+// what the reader delivers for a break (Ctrl-C) from the client and for a packet with a bad checksum
+const (
+	breakPacket = "\x03"
+	badPacket   = "\x15"
+)
+
+// Registers in the order used by "g"/"G" packets and register numbers of "p"/"P" packets
+// A, X, Y, S, PC (16 bit, little endian), P (packed status)
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gnu.gdb.mos6502.core">
+    <reg name="a" bitsize="8" type="uint8" regnum="0"/>
+    <reg name="x" bitsize="8" type="uint8"/>
+    <reg name="y" bitsize="8" type="uint8"/>
+    <reg name="s" bitsize="8" type="uint8"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+    <reg name="p" bitsize="8" type="uint8"/>
+  </feature>
+</target>
+`
+
+// Server speaks the GDB remote serial protocol on top of a debugger, so GDB based front ends can attach to
+// the emulation, e.g. target remote localhost:6502
+// Reverse stepping and continuing are offered when the debugger has history enabled.
+type Server struct {
+	debugger *debugger.Debugger
+	Logger   *log.Logger // optional, logs every packet when set
+}
+
+func NewServer(d *debugger.Debugger) *Server {
+	return &Server{debugger: d}
+}
+
+// ListenAndServe accepts connections on a TCP address such as "localhost:6502", serving one client at a time
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		err = s.Serve(conn)
+		conn.Close()
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
+
+// Serve handles a single client until it detaches, kills the session or disconnects
+func (s *Server) Serve(conn io.ReadWriter) error {
+	session := &session{
+		server:  s,
+		writer:  conn,
+		packets: make(chan string),
+		errors:  make(chan error, 1),
+		done:    make(chan struct{}),
+		ack:     true,
+	}
+	defer close(session.done)
+	go session.readPackets(bufio.NewReader(conn))
+	return session.run()
+}
+
+type session struct {
+	server  *Server
+	writer  io.Writer
+	packets chan string // decoded packet payloads, breakPacket or badPacket
+	errors  chan error
+	done    chan struct{} // closed when the session is over, stops the reader
+	queued  []string      // packets that arrived while the target was running
+	ack     bool
+}
+
+func (s *session) readPackets(reader *bufio.Reader) {
+	defer close(s.packets)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			s.errors <- err
+			return
+		}
+		var packet string
+		switch b {
+		case 0x03:
+			packet = breakPacket
+		case '$':
+			payload, err := reader.ReadString('#')
+			if err != nil {
+				s.errors <- err
+				return
+			}
+			checksum := make([]byte, 2)
+			if _, err := io.ReadFull(reader, checksum); err != nil {
+				s.errors <- err
+				return
+			}
+			payload = payload[:len(payload)-1]
+			expected, _ := strconv.ParseUint(string(checksum), 16, 8)
+			packet = decode(payload)
+			if byte(expected) != sum(payload) {
+				packet = badPacket // answered by run, so the NAK is ordered with the replies
+			}
+		default:
+			// acks ('+', '-') and noise between packets
+			continue
+		}
+		select {
+		case s.packets <- packet:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// decode resolves the escapes ('}' followed by the byte xor 0x20) and the run-length encoding ('*' followed
+// by the repeat count + 29) of a packet payload
+func decode(payload string) string {
+	if !strings.ContainsAny(payload, "}*") {
+		return payload
+	}
+	decoded := make([]byte, 0, len(payload))
+	for i := 0; i < len(payload); i++ {
+		switch {
+		case payload[i] == '}' && i+1 < len(payload):
+			i++
+			decoded = append(decoded, payload[i]^0x20)
+		case payload[i] == '*' && i+1 < len(payload) && len(decoded) > 0:
+			i++
+			last := decoded[len(decoded)-1]
+			for n := int(payload[i]) - 29; n > 0; n-- {
+				decoded = append(decoded, last)
+			}
+		default:
+			decoded = append(decoded, payload[i])
+		}
+	}
+	return string(decoded)
+}
+
+// next returns the next packet, the ones queued while running come first
+func (s *session) next() (string, bool) {
+	if len(s.queued) > 0 {
+		payload := s.queued[0]
+		s.queued = s.queued[1:]
+		return payload, true
+	}
+	payload, ok := <-s.packets
+	return payload, ok
+}
+
+func (s *session) run() error {
+	for {
+		payload, ok := s.next()
+		if !ok {
+			return <-s.errors
+		}
+		if payload == breakPacket {
+			continue // not running, nothing to interrupt
+		}
+		if payload == badPacket {
+			if s.ack {
+				if _, err := s.writer.Write([]byte("-")); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if s.ack {
+			if _, err := s.writer.Write([]byte("+")); err != nil {
+				return err
+			}
+		}
+		if s.server.Logger != nil {
+			s.server.Logger.Printf("<- %s", payload)
+		}
+		reply, done := s.handle(payload)
+		if err := s.send(reply); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+func (s *session) send(payload string) error {
+	if s.server.Logger != nil {
+		s.server.Logger.Printf("-> %s", payload)
+	}
+	_, err := fmt.Fprintf(s.writer, "$%s#%02x", payload, sum(payload))
+	return err
+}
+
+func sum(payload string) byte {
+	var checksum byte
+	for i := 0; i < len(payload); i++ {
+		checksum += payload[i]
+	}
+	return checksum
+}
+
+// handle returns the reply to a packet and whether the session is over
+func (s *session) handle(payload string) (string, bool) {
+	d := s.server.debugger
+	switch {
+	case payload == "?":
+		return "S05", false
+	case payload == "g":
+		return s.readRegisters(), false
+	case strings.HasPrefix(payload, "G"):
+		return s.writeRegisters(payload[1:]), false
+	case strings.HasPrefix(payload, "p"):
+		return s.readRegister(payload[1:]), false
+	case strings.HasPrefix(payload, "P"):
+		return s.writeRegister(payload[1:]), false
+	case strings.HasPrefix(payload, "m"):
+		return s.readMemory(payload[1:]), false
+	case strings.HasPrefix(payload, "M"):
+		return s.writeMemory(payload[1:]), false
+	case strings.HasPrefix(payload, "c"):
+		if !s.resumeAt(payload[1:]) {
+			return "E01", false
+		}
+		return s.continueExecution(), false
+	case strings.HasPrefix(payload, "s"):
+		if !s.resumeAt(payload[1:]) {
+			return "E01", false
+		}
+		return stopReply(d.StepInto()), false
+	case payload == "bs":
+		return stopReply(d.StepBack()), false
+	case payload == "bc":
+		return stopReply(d.ReverseContinue()), false
+	case strings.HasPrefix(payload, "Z"), strings.HasPrefix(payload, "z"):
+		return s.breakpoint(payload), false
+	case strings.HasPrefix(payload, "qSupported"):
+		supported := "PacketSize=4000;qXfer:features:read+;swbreak+;QStartNoAckMode+"
+		if d.History() != nil {
+			supported += ";ReverseStep+;ReverseContinue+"
+		}
+		return supported, false
+	case strings.HasPrefix(payload, "qXfer:features:read:target.xml:"):
+		return s.targetDescription(payload[len("qXfer:features:read:target.xml:"):]), false
+	case payload == "QStartNoAckMode":
+		s.ack = false
+		return "OK", false
+	case payload == "qAttached":
+		return "1", false
+	case payload == "qC":
+		return "QC1", false
+	case payload == "qfThreadInfo":
+		return "m1", false
+	case payload == "qsThreadInfo":
+		return "l", false
+	case strings.HasPrefix(payload, "H"), strings.HasPrefix(payload, "T"):
+		return "OK", false
+	case payload == "D" || strings.HasPrefix(payload, "D;"):
+		return "OK", true
+	case payload == "k":
+		return "", true
+	default:
+		return "", false // unsupported
+	}
+}
+
+func (s *session) resumeAt(address string) bool {
+	if address == "" {
+		return true
+	}
+	pc, err := strconv.ParseUint(address, 16, 16)
+	if err != nil {
+		return false
+	}
+	s.server.debugger.Cpu().PC = uint16(pc)
+	return true
+}
+
+// continueExecution runs until a breakpoint, a watchpoint or a break from the client
+func (s *session) continueExecution() string {
+	d := s.server.debugger
+	for {
+		stop := d.Continue(continueSlice)
+		if stop.Reason != debugger.StopCycleLimit {
+			return stopReply(stop)
+		}
+		select {
+		case payload, ok := <-s.packets:
+			if !ok || payload == breakPacket {
+				return "S02" // SIGINT
+			}
+			// answered after the stop reply
+			s.queued = append(s.queued, payload)
+		default:
+		}
+	}
+}
+
+func stopReply(stop debugger.Stop) string {
+	if stop.Watch != nil {
+		kind := "awatch"
+		switch stop.Watch.Watchpoint.Kind {
+		case debugger.WatchWrite:
+			kind = "watch"
+		case debugger.WatchRead:
+			kind = "rwatch"
+		}
+		return fmt.Sprintf("T05%s:%04x;", kind, stop.Watch.Address)
+	}
+	if stop.Reason == debugger.StopHistoryStart {
+		return "T05replaylog:begin;"
+	}
+	if stop.Reason == debugger.StopBreakpoint {
+		return "T05swbreak:;"
+	}
+	return "S05"
+}
+
+func (s *session) readRegisters() string {
+	c := s.server.debugger.Cpu()
+	return hex.EncodeToString([]byte{c.A, c.X, c.Y, c.S, byte(c.PC), byte(c.PC >> 8), c.Status()})
+}
+
+func (s *session) writeRegisters(data string) string {
+	bytes, err := hex.DecodeString(data)
+	if err != nil || len(bytes) < 7 {
+		return "E01"
+	}
+	c := s.server.debugger.Cpu()
+	c.A, c.X, c.Y, c.S = bytes[0], bytes[1], bytes[2], bytes[3]
+	c.PC = uint16(bytes[5])<<8 | uint16(bytes[4])
+	c.SetStatus(bytes[6])
+	return "OK"
+}
+
+func (s *session) readRegister(number string) string {
+	n, err := strconv.ParseUint(number, 16, 8)
+	if err != nil {
+		return "E01"
+	}
+	c := s.server.debugger.Cpu()
+	switch n {
+	case 0:
+		return hex.EncodeToString([]byte{c.A})
+	case 1:
+		return hex.EncodeToString([]byte{c.X})
+	case 2:
+		return hex.EncodeToString([]byte{c.Y})
+	case 3:
+		return hex.EncodeToString([]byte{c.S})
+	case 4:
+		return hex.EncodeToString([]byte{byte(c.PC), byte(c.PC >> 8)})
+	case 5:
+		return hex.EncodeToString([]byte{c.Status()})
+	default:
+		return "E01"
+	}
+}
+
+func (s *session) writeRegister(assignment string) string {
+	parts := strings.SplitN(assignment, "=", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	n, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil {
+		return "E01"
+	}
+	value, err := hex.DecodeString(parts[1])
+	if err != nil || len(value) == 0 {
+		return "E01"
+	}
+	c := s.server.debugger.Cpu()
+	switch n {
+	case 0:
+		c.A = value[0]
+	case 1:
+		c.X = value[0]
+	case 2:
+		c.Y = value[0]
+	case 3:
+		c.S = value[0]
+	case 4:
+		if len(value) < 2 {
+			return "E01"
+		}
+		c.PC = uint16(value[1])<<8 | uint16(value[0])
+	case 5:
+		c.SetStatus(value[0])
+	default:
+		return "E01"
+	}
+	return "OK"
+}
+
+// parseRange parses "addr,length"
+func parseRange(s string) (uint16, int, bool) {
+	parts := strings.SplitN(s, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	address, err := strconv.ParseUint(parts[0], 16, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	length, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil || length > 0x10000 {
+		return 0, 0, false
+	}
+	return uint16(address), int(length), true
+}
+
+func (s *session) readMemory(arguments string) string {
+	address, length, ok := parseRange(arguments)
+	if !ok {
+		return "E01"
+	}
+	mapper := s.server.debugger.Cpu().MemoryMapper()
+	bytes := make([]byte, length)
+	for i := range bytes {
+		bytes[i] = memory.Peek(mapper, address+uint16(i))
+	}
+	return hex.EncodeToString(bytes)
+}
+
+func (s *session) writeMemory(arguments string) string {
+	parts := strings.SplitN(arguments, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	address, length, ok := parseRange(parts[0])
+	if !ok {
+		return "E01"
+	}
+	bytes, err := hex.DecodeString(parts[1])
+	if err != nil || len(bytes) != length {
+		return "E01"
+	}
+	mapper := s.server.debugger.Cpu().MemoryMapper()
+	for i, b := range bytes {
+		mapper.Write(address+uint16(i), b)
+	}
+	return "OK"
+}
+
+// breakpoint handles Z/z packets: type 0 and 1 are breakpoints, 2, 3 and 4 are write, read and access watchpoints
+func (s *session) breakpoint(payload string) string {
+	insert := payload[0] == 'Z'
+	parts := strings.Split(payload[1:], ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+	address, length, ok := parseRange(parts[1] + "," + parts[2])
+	if !ok {
+		return "E01"
+	}
+	d := s.server.debugger
+	switch parts[0] {
+	case "0", "1":
+		if insert {
+			d.AddBreakpoint(address)
+			return "OK"
+		}
+		for _, b := range d.Breakpoints() {
+			if b.Address == address && b.Condition == nil {
+				d.RemoveBreakpoint(b.ID)
+				return "OK"
+			}
+		}
+		return "E01"
+	case "2", "3", "4":
+		kind := map[string]debugger.WatchKind{"2": debugger.WatchWrite, "3": debugger.WatchRead, "4": debugger.WatchAccess}[parts[0]]
+		if insert {
+			d.AddWatchpoint(address, length, kind)
+			return "OK"
+		}
+		for _, w := range d.Watchpoints() {
+			if w.Address == address && w.Length == length && w.Kind == kind {
+				d.RemoveWatchpoint(w.ID)
+				return "OK"
+			}
+		}
+		return "E01"
+	default:
+		return ""
+	}
+}
+
+// targetDescription serves qXfer reads of "offset,length" chunks of the target description
+func (s *session) targetDescription(arguments string) string {
+	parts := strings.SplitN(arguments, ",", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	offset, err1 := strconv.ParseUint(parts[0], 16, 32)
+	length, err2 := strconv.ParseUint(parts[1], 16, 32)
+	if err1 != nil || err2 != nil {
+		return "E01"
+	}
+	if int(offset) >= len(targetXML) {
+		return "l"
+	}
+	end := int(offset + length)
+	if end >= len(targetXML) {
+		return "l" + targetXML[offset:]
+	}
+	return "m" + targetXML[offset:end]
+}
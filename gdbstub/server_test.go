@@ -0,0 +1,135 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/debugger"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *client) request(t *testing.T, payload string) string {
+	c.send(t, payload)
+	ack, err := c.reader.ReadByte()
+	require.NoError(t, err)
+	require.Equal(t, byte('+'), ack)
+	return c.reply(t)
+}
+
+func (c *client) send(t *testing.T, payload string) {
+	_, err := fmt.Fprintf(c.conn, "$%s#%02x", payload, sum(payload))
+	require.NoError(t, err)
+}
+
+func (c *client) reply(t *testing.T) string {
+	_, err := c.reader.ReadString('$')
+	require.NoError(t, err)
+	reply, err := c.reader.ReadString('#')
+	require.NoError(t, err)
+	_, err = c.reader.Discard(2)
+	require.NoError(t, err)
+	return strings.TrimSuffix(reply, "#")
+}
+
+// 0400 LDA #$42, 0402 STA $0300, 0405 JMP $0405
+func connect() (*client, *memory.DummyMemoryMapper, chan error) {
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[0x0400:], []byte{0xA9, 0x42, 0x8D, 0x00, 0x03, 0x4C, 0x05, 0x04})
+	mem.Mem[0xFFFD] = 0x04
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+
+	serverConn, clientConn := net.Pipe()
+	done := make(chan error)
+	go func() { done <- NewServer(debugger.New(&c)).Serve(serverConn) }()
+	return &client{conn: clientConn, reader: bufio.NewReader(clientConn)}, mem, done
+}
+
+func TestServer_session(t *testing.T) {
+	gdb, mem, done := connect()
+
+	assert.Equal(t, "000000ff000424", gdb.request(t, "g"))
+	assert.Equal(t, "a942", gdb.request(t, "m400,2"))
+	assert.Equal(t, "S05", gdb.request(t, "s"))
+	assert.Equal(t, "42", gdb.request(t, "p0"))
+	assert.Equal(t, "OK", gdb.request(t, "Z2,300,1"))
+	assert.Equal(t, "T05watch:0300;", gdb.request(t, "c"))
+	assert.Equal(t, "OK", gdb.request(t, "Z0,405,1"))
+	assert.Equal(t, "T05swbreak:;", gdb.request(t, "c"))
+	assert.Equal(t, "0504", gdb.request(t, "p4"))
+	assert.Equal(t, "OK", gdb.request(t, "M300,2:beef"))
+	assert.Equal(t, byte(0xEF), mem.Mem[0x0301])
+	assert.Equal(t, "OK", gdb.request(t, "D"))
+	assert.NoError(t, <-done)
+}
+
+func TestServer_packetWhileRunning(t *testing.T) {
+	gdb, _, done := connect()
+
+	gdb.send(t, "c")
+	ack, err := gdb.reader.ReadByte()
+	require.NoError(t, err)
+	require.Equal(t, byte('+'), ack)
+	gdb.send(t, "m400,2")
+	_, err = gdb.conn.Write([]byte{0x03})
+	require.NoError(t, err)
+
+	assert.Equal(t, "S02", gdb.reply(t))
+	ack, err = gdb.reader.ReadByte()
+	require.NoError(t, err)
+	require.Equal(t, byte('+'), ack)
+	assert.Equal(t, "a942", gdb.reply(t), "the packet sent while running is answered")
+	assert.Equal(t, "", gdb.request(t, "k"))
+	assert.NoError(t, <-done)
+}
+
+func TestServer_encodedPacket(t *testing.T) {
+	gdb, mem, done := connect()
+
+	assert.Equal(t, "OK", gdb.request(t, "M300,4:0* 1100"))
+	assert.Equal(t, []byte{0x00, 0x00, 0x11, 0x00}, mem.Mem[0x0300:0x0304])
+	assert.Equal(t, "OK", gdb.request(t, "D"))
+	assert.NoError(t, <-done)
+}
+
+func TestDecode(t *testing.T) {
+	assert.Equal(t, "m400,2", decode("m400,2"))
+	assert.Equal(t, "#$}*", decode("}\x03}\x04}]}\x0a"))
+	assert.Equal(t, "0000", decode("0* "))
+	assert.Equal(t, "a}}}}b", decode("a}]* b"))
+}
+
+func TestServer_badChecksum(t *testing.T) {
+	gdb, _, done := connect()
+
+	_, err := gdb.conn.Write([]byte("$g#00"))
+	require.NoError(t, err)
+	nak, err := gdb.reader.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte('-'), nak)
+	assert.Equal(t, "000000ff000424", gdb.request(t, "g"))
+
+	assert.Equal(t, "OK", gdb.request(t, "QStartNoAckMode"))
+	_, err = gdb.conn.Write([]byte("$g#00"))
+	require.NoError(t, err)
+	gdb.send(t, "p0")
+	next, err := gdb.reader.Peek(1)
+	require.NoError(t, err)
+	assert.Equal(t, byte('$'), next[0], "no NAK without acks")
+	assert.Equal(t, "00", gdb.reply(t))
+	gdb.send(t, "D")
+	assert.Equal(t, "OK", gdb.reply(t))
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,134 @@
+package history
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+// Write is a single memory write, Old is the value it replaced
+type Write struct {
+	Address uint16
+	Old     byte
+	New     byte
+}
+
+// Entry records one executed instruction: registers before it started and the writes it made
+type Entry struct {
+	Registers cpu.Registers
+	Writes    []Write
+}
+
+// Recorder keeps the last executed instructions in a ring buffer so execution can be undone.
+// Writes made while an interrupt is taken are attributed to the instruction before, undoing both
+// restores the state from before the interrupt. Only writes to RAM are undone: writing an old value
+// back to a device register has side effects of its own, so device state is left as it is.
+type Recorder struct {
+	cpu     *cpu.Cpu
+	entries []Entry
+	start   int // index of the oldest entry
+	count   int
+}
+
+// New starts recording the cpu, depth is the number of instructions kept
+func New(c *cpu.Cpu, depth int) *Recorder {
+	if depth < 1 {
+		depth = 1
+	}
+	r := &Recorder{cpu: c, entries: make([]Entry, depth)}
+	c.AddTracer(r)
+	c.AddMemoryListener(r)
+	return r
+}
+
+// Stop detaches the recorder from the cpu, the recorded history stays available
+func (r *Recorder) Stop() {
+	r.cpu.RemoveTracer(r)
+	r.cpu.RemoveMemoryListener(r)
+}
+
+// Len returns the number of instructions that can be stepped back
+func (r *Recorder) Len() int {
+	return r.count
+}
+
+// Clear forgets the recorded history, e.g. after memory was modified outside of the cpu
+func (r *Recorder) Clear() {
+	r.start = 0
+	r.count = 0
+}
+
+// Trace implements cpu.Tracer
+func (r *Recorder) Trace(c *cpu.Cpu) {
+	var index int
+	if r.count < len(r.entries) {
+		index = (r.start + r.count) % len(r.entries)
+		r.count++
+	} else {
+		index = r.start // overwrite the oldest entry
+		r.start = (r.start + 1) % len(r.entries)
+	}
+	r.entries[index] = Entry{Registers: c.Registers(), Writes: r.entries[index].Writes[:0]}
+}
+
+// MemoryFetch implements cpu.MemoryListener
+func (r *Recorder) MemoryFetch(address uint16, value byte) {}
+
+// MemoryRead implements cpu.MemoryListener
+func (r *Recorder) MemoryRead(address uint16, value byte) {}
+
+// MemoryWrite implements cpu.MemoryListener
+func (r *Recorder) MemoryWrite(address uint16, value byte) {
+	if r.count == 0 {
+		return
+	}
+	latest := &r.entries[r.latest()]
+	latest.Writes = append(latest.Writes, Write{Address: address, Old: memory.Peek(r.cpu.MemoryMapper(), address), New: value})
+}
+
+func (r *Recorder) latest() int {
+	return (r.start + r.count - 1) % len(r.entries)
+}
+
+// Entry returns the n-th most recent instruction, 0 is the last one executed
+func (r *Recorder) Entry(n int) (Entry, bool) {
+	if n < 0 || n >= r.count {
+		return Entry{}, false
+	}
+	entry := r.entries[(r.start+r.count-1-n)%len(r.entries)]
+	// the ring buffer reuses the writes of overwritten entries
+	entry.Writes = append([]Write(nil), entry.Writes...)
+	return entry, true
+}
+
+// StepBack undoes the last executed instruction, returns false when the history is exhausted
+func (r *Recorder) StepBack() bool {
+	if r.count == 0 {
+		return false
+	}
+	entry := r.entries[r.latest()]
+	mapper := r.cpu.MemoryMapper()
+	for i := len(entry.Writes) - 1; i >= 0; i-- {
+		if !memory.IsRAM(mapper, entry.Writes[i].Address) {
+			continue
+		}
+		mapper.Write(entry.Writes[i].Address, entry.Writes[i].Old)
+	}
+	r.cpu.SetRegisters(entry.Registers)
+	r.count--
+	return true
+}
+
+// LastWrite finds the most recent recorded write to the address.
+// It returns a copy of the instruction that made it and how many instructions ago it was executed.
+func (r *Recorder) LastWrite(address uint16) (Entry, int, bool) {
+	for n := 0; n < r.count; n++ {
+		entry := r.entries[(r.start+r.count-1-n)%len(r.entries)]
+		for _, w := range entry.Writes {
+			if w.Address == address {
+				entry, _ = r.Entry(n)
+				return entry, n, true
+			}
+		}
+	}
+	return Entry{}, 0, false
+}
@@ -0,0 +1,148 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 0400 LDA #$01, 0402 STA $10, 0404 INC $10, 0406 LDA #$FF, 0408 JMP $0408
+func newCpu() (*cpu.Cpu, *memory.DummyMemoryMapper) {
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[0x0400:], []byte{0xA9, 0x01, 0x85, 0x10, 0xE6, 0x10, 0xA9, 0xFF, 0x4C, 0x08, 0x04})
+	mem.Mem[0xFFFD] = 0x04
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+	return &c, mem
+}
+
+func TestRecorder_stepBack(t *testing.T) {
+	c, mem := newCpu()
+	recorder := New(c, 10)
+	for i := 0; i < 4; i++ {
+		c.ExecuteOpcode()
+	}
+	assert.Equal(t, byte(2), mem.Mem[0x10])
+
+	entry, ago, found := recorder.LastWrite(0x10)
+	assert.True(t, found)
+	assert.Equal(t, 1, ago)
+	assert.Equal(t, uint16(0x0404), entry.Registers.PC)
+
+	assert.True(t, recorder.StepBack())
+	assert.True(t, recorder.StepBack())
+	assert.Equal(t, uint16(0x0404), c.PC)
+	assert.Equal(t, byte(1), mem.Mem[0x10])
+	assert.Equal(t, byte(1), c.A)
+
+	assert.True(t, recorder.StepBack())
+	assert.True(t, recorder.StepBack())
+	assert.False(t, recorder.StepBack())
+	assert.Equal(t, uint16(0x0400), c.PC)
+	assert.Equal(t, byte(0), mem.Mem[0x10])
+	assert.Equal(t, uint64(0), c.Cycles)
+}
+
+func TestRecorder_depth(t *testing.T) {
+	c, _ := newCpu()
+	recorder := New(c, 2)
+	for i := 0; i < 4; i++ {
+		c.ExecuteOpcode()
+	}
+	assert.Equal(t, 2, recorder.Len())
+	recorder.StepBack()
+	recorder.StepBack()
+	assert.Equal(t, uint16(0x0404), c.PC)
+}
+
+// register counts the writes it gets, like a device register it must not be written by undo
+type register struct {
+	writes int
+}
+
+func (r *register) Read(address uint16) byte         { return 0 }
+func (r *register) Write(address uint16, value byte) { r.writes++ }
+
+func TestRecorder_stepBackDevice(t *testing.T) {
+	bus := memory.NewBus()
+	ram := memory.NewRAM(0x0800)
+	device := &register{}
+	require.NoError(t, bus.Map("ram", 0x0000, 0x07FF, ram))
+	require.NoError(t, bus.Map("device", 0x0800, 0x0800, device))
+	// 0400 LDA #$01, 0402 STA $10, 0404 STA $0800
+	copy(ram.Bytes()[0x0400:], []byte{0xA9, 0x01, 0x85, 0x10, 0x8D, 0x00, 0x08})
+	c := cpu.NewCpu(nil, bus)
+	c.PC = 0x0400
+	recorder := New(&c, 10)
+	for i := 0; i < 3; i++ {
+		c.ExecuteOpcode()
+	}
+	assert.Equal(t, 1, device.writes)
+
+	for recorder.StepBack() {
+	}
+	assert.Equal(t, 1, device.writes)
+	assert.Equal(t, byte(0), ram.Bytes()[0x10])
+	assert.Equal(t, uint16(0x0400), c.PC)
+}
+
+func TestRecorder_lastWriteCopy(t *testing.T) {
+	c, _ := newCpu()
+	recorder := New(c, 1)
+	for i := 0; i < 2; i++ {
+		c.ExecuteOpcode()
+	}
+	entry, _, found := recorder.LastWrite(0x10)
+	require.True(t, found)
+
+	// INC $10 overwrites the entry of STA $10, reusing its writes
+	c.ExecuteOpcode()
+	assert.Equal(t, []Write{{Address: 0x10, Old: 0, New: 1}}, entry.Writes)
+}
+
+// computer is a whole machine on one device: RAM everywhere but a register at $D000
+type computer struct {
+	memory.DummyMemoryMapper
+	register
+}
+
+func (c *computer) Read(address uint16) byte {
+	return c.DummyMemoryMapper.Read(address)
+}
+
+func (c *computer) Write(address uint16, value byte) {
+	if address == 0xD000 {
+		c.register.Write(address, value)
+		return
+	}
+	c.DummyMemoryMapper.Write(address, value)
+}
+
+func (c *computer) IsRAM(address uint16) bool {
+	return address != 0xD000
+}
+
+func TestRecorder_stepBackWholeDevice(t *testing.T) {
+	bus := memory.NewBus()
+	device := &computer{}
+	require.NoError(t, bus.Map("computer", 0x0000, 0xFFFF, device))
+	// 0400 LDA #$01, 0402 STA $10, 0404 STA $D000
+	copy(device.Mem[0x0400:], []byte{0xA9, 0x01, 0x85, 0x10, 0x8D, 0x00, 0xD0})
+	c := cpu.NewCpu(nil, bus)
+	c.PC = 0x0400
+	recorder := New(&c, 10)
+	for i := 0; i < 3; i++ {
+		c.ExecuteOpcode()
+	}
+	assert.Equal(t, byte(1), device.Mem[0x10])
+
+	assert.True(t, recorder.StepBack())
+	assert.True(t, recorder.StepBack())
+	assert.Equal(t, byte(0), device.Mem[0x10])
+	assert.Equal(t, 1, device.writes)
+	assert.Equal(t, uint16(0x0402), c.PC)
+}
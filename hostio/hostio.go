@@ -0,0 +1,77 @@
+package hostio
+
+import (
+	"io"
+	"sync"
+)
+
+// Input is a source of bytes coming from the host (keyboard, terminal, socket) into an emulated device.
+// Devices poll it from the emulation loop, Poll never blocks.
+type Input interface {
+	// Poll returns the next byte if one is available
+	Poll() (byte, bool)
+}
+
+// ReaderInput buffers an io.Reader in the background so it can be polled without blocking
+type ReaderInput struct {
+	mu     sync.Mutex
+	buffer []byte
+	err    error
+}
+
+func NewReaderInput(reader io.Reader) *ReaderInput {
+	input := &ReaderInput{}
+	go input.read(reader)
+	return input
+}
+
+func (i *ReaderInput) read(reader io.Reader) {
+	chunk := make([]byte, 256)
+	for {
+		n, err := reader.Read(chunk)
+		i.mu.Lock()
+		i.buffer = append(i.buffer, chunk[:n]...)
+		if err != nil {
+			i.err = err
+			i.mu.Unlock()
+			return
+		}
+		i.mu.Unlock()
+	}
+}
+
+func (i *ReaderInput) Poll() (byte, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.buffer) == 0 {
+		return 0, false
+	}
+	b := i.buffer[0]
+	i.buffer = i.buffer[1:]
+	return b, true
+}
+
+// Err returns the error that ended reading, io.EOF once the reader is exhausted
+func (i *ReaderInput) Err() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.err
+}
+
+// BytesInput serves a fixed sequence of bytes, useful for scripted input and tests
+type BytesInput struct {
+	bytes []byte
+}
+
+func NewBytesInput(bytes []byte) *BytesInput {
+	return &BytesInput{bytes: bytes}
+}
+
+func (i *BytesInput) Poll() (byte, bool) {
+	if len(i.bytes) == 0 {
+		return 0, false
+	}
+	b := i.bytes[0]
+	i.bytes = i.bytes[1:]
+	return b, true
+}
@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package hostio
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// PTY is the master side of a pseudo-terminal, terminal programs (screen, minicom, picocom) attach to Name
+type PTY struct {
+	*ReaderInput
+	master *os.File
+	output *asyncWriter
+	name   string
+}
+
+// OpenPTY allocates a new pseudo-terminal
+func OpenPTY() (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("unlocking pty: %v", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("getting pty number: %v", err)
+	}
+	return &PTY{
+		ReaderInput: NewReaderInput(master),
+		master:      master,
+		output:      newAsyncWriter(master),
+		name:        fmt.Sprintf("/dev/pts/%d", n),
+	}, nil
+}
+
+// Name is the path of the slave side
+func (p *PTY) Name() string {
+	return p.name
+}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	return p.output.Write(b)
+}
+
+func (p *PTY) Close() error {
+	return p.master.Close()
+}
+
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package hostio
+
+import "errors"
+
+// PTY is only available on Linux
+type PTY struct {
+	*ReaderInput
+}
+
+func OpenPTY() (*PTY, error) {
+	return nil, errors.New("pseudo-terminals are only supported on linux")
+}
+
+func (p *PTY) Name() string {
+	return ""
+}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (p *PTY) Close() error {
+	return nil
+}
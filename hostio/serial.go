@@ -0,0 +1,149 @@
+package hostio
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Serial is a byte stream between an emulated serial device and the host: the device polls the input
+// and writes its output. Writes must not block the emulation for long.
+type Serial interface {
+	Input
+	io.Writer
+}
+
+// Open connects to the host end described by spec:
+//
+//	stdio            the terminal the emulator runs in
+//	tcp:host:port    a TCP listener, one client at a time (telnet, nc)
+//	pty              a new pseudo-terminal, its name is printed to stderr (Linux only)
+//	none             nothing, input never arrives and output is dropped
+func Open(spec string) (Serial, error) {
+	switch {
+	case spec == "stdio":
+		return Stdio(), nil
+	case strings.HasPrefix(spec, "tcp:"):
+		server, err := ListenTCP(strings.TrimPrefix(spec, "tcp:"))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "serial port listening on %s\n", server.Addr())
+		return server, nil
+	case spec == "pty":
+		pty, err := OpenPTY()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "serial port on %s\n", pty.Name())
+		return pty, nil
+	case spec == "none" || spec == "":
+		return None(), nil
+	default:
+		return nil, fmt.Errorf("unknown host connection %q, expected stdio, tcp:host:port, pty or none", spec)
+	}
+}
+
+type serial struct {
+	Input
+	io.Writer
+}
+
+var (
+	stdio     Serial
+	stdioOnce sync.Once
+	restore   func()
+
+	interruptOnce  sync.Once
+	interruptMutex sync.Mutex
+	onInterrupt    []func()
+)
+
+// Stdio connects to the emulator's own standard input and output. A terminal on the input is switched
+// to reading a character at a time without local echo, call Restore before exiting to switch it back.
+// Interrupting the emulator restores it as well.
+func Stdio() Serial {
+	stdioOnce.Do(func() {
+		stdio = serial{NewReaderInput(os.Stdin), os.Stdout}
+		var err error
+		if restore, err = characterMode(os.Stdin.Fd()); err != nil {
+			return
+		}
+		OnInterrupt(Restore)
+	})
+	return stdio
+}
+
+// OnInterrupt runs f when the emulator is interrupted (Ctrl-C, SIGTERM), before it exits with status 130.
+// It is called from another goroutine than the emulation.
+func OnInterrupt(f func()) {
+	interruptMutex.Lock()
+	onInterrupt = append(onInterrupt, f)
+	interruptMutex.Unlock()
+	interruptOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			interruptMutex.Lock()
+			defer interruptMutex.Unlock()
+			for _, f := range onInterrupt {
+				f()
+			}
+			os.Exit(130)
+		}()
+	})
+}
+
+// Restore puts the terminal Stdio switched to character mode back the way it was
+func Restore() {
+	if restore != nil {
+		restore()
+		restore = nil
+	}
+}
+
+// None is a disconnected serial line
+func None() Serial {
+	return serial{NewBytesInput(nil), ioutil.Discard}
+}
+
+// NewSerial joins an input and a writer, e.g. a BytesInput and a buffer in tests
+func NewSerial(input Input, output io.Writer) Serial {
+	return serial{input, output}
+}
+
+// asyncWriter hands writes over to a goroutine so a slow or absent reader never blocks the emulation,
+// output is dropped when the buffer is full
+type asyncWriter struct {
+	bytes chan []byte
+}
+
+func newAsyncWriter(writer io.Writer) *asyncWriter {
+	w := &asyncWriter{bytes: make(chan []byte, 1024)}
+	go func() {
+		for b := range w.bytes {
+			writer.Write(b)
+		}
+	}()
+	return w
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	select {
+	case w.bytes <- append([]byte(nil), p...):
+	default:
+	}
+	return len(p), nil
+}
@@ -0,0 +1,106 @@
+package hostio
+
+import (
+	"net"
+	"sync"
+)
+
+// TCPServer is a serial line served over TCP, one client at a time.
+// Output written while no client is connected is dropped, a new client replaces the previous one.
+type TCPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	conn     net.Conn
+	buffer   []byte
+	output   *asyncWriter
+}
+
+func ListenTCP(address string) (*TCPServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s := &TCPServer{listener: listener}
+	s.output = newAsyncWriter(writerFunc(s.send))
+	go s.accept()
+	return s, nil
+}
+
+func (s *TCPServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *TCPServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.conn = conn
+		s.mu.Unlock()
+		go s.read(conn)
+	}
+}
+
+func (s *TCPServer) read(conn net.Conn) {
+	chunk := make([]byte, 256)
+	for {
+		n, err := conn.Read(chunk)
+		s.mu.Lock()
+		s.buffer = append(s.buffer, chunk[:n]...)
+		if err != nil && s.conn == conn {
+			s.conn = nil
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *TCPServer) Poll() (byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.buffer) == 0 {
+		return 0, false
+	}
+	b := s.buffer[0]
+	s.buffer = s.buffer[1:]
+	return b, true
+}
+
+func (s *TCPServer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	connected := s.conn != nil
+	s.mu.Unlock()
+	if !connected {
+		return len(p), nil
+	}
+	return s.output.Write(p)
+}
+
+// send writes to the connected client, it runs on the output goroutine
+func (s *TCPServer) send(p []byte) (int, error) {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil {
+		return len(p), nil
+	}
+	return conn.Write(p)
+}
+
+// Close stops listening and disconnects the client
+func (s *TCPServer) Close() error {
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.mu.Unlock()
+	return s.listener.Close()
+}
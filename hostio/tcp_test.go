@@ -0,0 +1,39 @@
+package hostio
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPServer(t *testing.T) {
+	server, err := ListenTCP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+	server.Write([]byte("dropped"))
+
+	client, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("hi"))
+	require.NoError(t, err)
+
+	var received []byte
+	assert.Eventually(t, func() bool {
+		if b, ok := server.Poll(); ok {
+			received = append(received, b)
+		}
+		return len(received) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "hi", string(received))
+
+	server.Write([]byte("ok"))
+	reply := make([]byte, 2)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = client.Read(reply)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(reply))
+}
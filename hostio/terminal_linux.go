@@ -0,0 +1,36 @@
+//go:build linux
+// +build linux
+
+package hostio
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// characterMode switches a terminal to reading a character at a time without local echo,
+// it fails when fd is not a terminal
+func characterMode(fd uintptr) (restore func(), err error) {
+	var saved syscall.Termios
+	if err := termios(fd, syscall.TCGETS, &saved); err != nil {
+		return nil, err
+	}
+	raw := saved
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := termios(fd, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return func() {
+		termios(fd, syscall.TCSETS, &saved)
+	}, nil
+}
+
+func termios(fd uintptr, request uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package hostio
+
+import "errors"
+
+func characterMode(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("character mode is only supported on linux")
+}
@@ -0,0 +1,156 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/asm"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+// Image formats
+const (
+	FormatBinary   = "bin" // raw bytes placed at the load address
+	FormatPrg      = "prg" // Commodore style, the load address is in the first two bytes
+	FormatIntelHex = "hex" // Intel HEX records carrying their own addresses
+	FormatAsm      = "asm" // assembler source, assembled from the load address until the first .org
+)
+
+// Segment is a run of consecutive bytes of an image starting at Address
+type Segment struct {
+	Address uint16
+	Bytes   []byte
+}
+
+// FormatFor guesses the image format from the file extension, anything unknown is a raw binary
+func FormatFor(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".prg":
+		return FormatPrg
+	case ".hex", ".ihx", ".ihex":
+		return FormatIntelHex
+	case ".s", ".asm", ".a65":
+		return FormatAsm
+	default:
+		return FormatBinary
+	}
+}
+
+// Load reads an image, an empty format is guessed from the extension.
+// The load address is used by the formats that do not carry one.
+func Load(path, format string, address uint16) ([]Segment, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = FormatFor(path)
+	}
+	return Parse(data, format, address)
+}
+
+func Parse(data []byte, format string, address uint16) ([]Segment, error) {
+	switch format {
+	case FormatBinary:
+		return fit(Segment{Address: address, Bytes: data})
+	case FormatPrg:
+		if len(data) < 2 {
+			return nil, fmt.Errorf("prg image too short")
+		}
+		return fit(Segment{Address: uint16(data[0]) | uint16(data[1])<<8, Bytes: data[2:]})
+	case FormatIntelHex:
+		return parseIntelHex(data)
+	case FormatAsm:
+		program, err := asm.Assemble(string(data), address)
+		if err != nil {
+			return nil, err
+		}
+		var segments []Segment
+		for _, s := range program.Segments {
+			segments = append(segments, Segment{Address: s.Address, Bytes: s.Bytes})
+		}
+		return segments, nil
+	default:
+		return nil, fmt.Errorf("unknown image format %q", format)
+	}
+}
+
+func fit(segment Segment) ([]Segment, error) {
+	if int(segment.Address)+len(segment.Bytes) > 0x10000 {
+		return nil, fmt.Errorf("image of %d bytes does not fit at $%04X", len(segment.Bytes), segment.Address)
+	}
+	return []Segment{segment}, nil
+}
+
+func parseIntelHex(data []byte) ([]Segment, error) {
+	var segments []Segment
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if !strings.HasPrefix(text, ":") {
+			return nil, fmt.Errorf("line %d: record does not start with ':'", line)
+		}
+		record, err := hex.DecodeString(text[1:])
+		if err != nil || len(record) < 5 || len(record) != int(record[0])+5 {
+			return nil, fmt.Errorf("line %d: malformed record", line)
+		}
+		var sum byte
+		for _, b := range record {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("line %d: checksum mismatch", line)
+		}
+		address := uint16(record[1])<<8 | uint16(record[2])
+		payload := record[4 : len(record)-1]
+		switch record[3] {
+		case 0x00:
+			if int(address)+len(payload) > 0x10000 {
+				return nil, fmt.Errorf("line %d: data past $FFFF", line)
+			}
+			if n := len(segments); n > 0 && int(segments[n-1].Address)+len(segments[n-1].Bytes) == int(address) {
+				segments[n-1].Bytes = append(segments[n-1].Bytes, payload...)
+			} else {
+				segments = append(segments, Segment{Address: address, Bytes: append([]byte(nil), payload...)})
+			}
+		case 0x01:
+			return segments, nil
+		case 0x02, 0x04:
+			if len(payload) != 2 || payload[0] != 0 || payload[1] != 0 {
+				return nil, fmt.Errorf("line %d: address above 64K", line)
+			}
+		case 0x03, 0x05:
+			// start address records are meaningless for the 6502, the entry comes from the reset vector or a flag
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type %02X", line, record[3])
+		}
+	}
+	return segments, scanner.Err()
+}
+
+// Write copies the segments into memory
+func Write(m memory.MemoryMapper, segments []Segment) {
+	for _, s := range segments {
+		for i, b := range s.Bytes {
+			m.Write(s.Address+uint16(i), b)
+		}
+	}
+}
+
+// Covers tells whether the segments contain the given address, e.g. whether an image brings its own reset vector
+func Covers(segments []Segment, address uint16) bool {
+	for _, s := range segments {
+		if address >= s.Address && int(address) < int(s.Address)+len(s.Bytes) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package loader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	segments, err := Parse([]byte{1, 2, 3}, FormatBinary, 0x0400)
+	require.NoError(t, err)
+	assert.Equal(t, []Segment{{Address: 0x0400, Bytes: []byte{1, 2, 3}}}, segments)
+
+	segments, err = Parse([]byte{0x01, 0x08, 0xEA}, FormatPrg, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []Segment{{Address: 0x0801, Bytes: []byte{0xEA}}}, segments)
+
+	segments, err = Parse([]byte("  .org $0300\n  NOP\n"), FormatAsm, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []Segment{{Address: 0x0300, Bytes: []byte{0xEA}}}, segments)
+
+	_, err = Parse(make([]byte, 0x200), FormatBinary, 0xFF00)
+	assert.Error(t, err)
+}
+
+func TestParse_intelHex(t *testing.T) {
+	image := ":03040000A9018DC2\n:02040300000BEC\n:02FFFC000004FF\n:00000001FF\n"
+	segments, err := Parse([]byte(image), FormatIntelHex, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []Segment{
+		{Address: 0x0400, Bytes: []byte{0xA9, 0x01, 0x8D, 0x00, 0x0B}},
+		{Address: 0xFFFC, Bytes: []byte{0x00, 0x04}},
+	}, segments)
+	assert.True(t, Covers(segments, 0xFFFD))
+	assert.False(t, Covers(segments, 0x0405))
+
+	_, err = Parse([]byte(":03040000A9018DB3\n"), FormatIntelHex, 0)
+	assert.Error(t, err, "checksum")
+}
+
+func TestFormatFor(t *testing.T) {
+	assert.Equal(t, FormatPrg, FormatFor("game.PRG"))
+	assert.Equal(t, FormatIntelHex, FormatFor("rom.hex"))
+	assert.Equal(t, FormatAsm, FormatFor("hello.s"))
+	assert.Equal(t, FormatBinary, FormatFor("rom.bin"))
+}
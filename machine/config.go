@@ -0,0 +1,142 @@
+package machine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/number"
+)
+
+// Config describes a board. It is read from YAML, which also accepts JSON.
+//
+//	name: my board
+//	cpu: 6502
+//	clock: 1MHz
+//	memory:
+//	  - {type: ram, start: $0000, end: $7FFF}
+//	  - {type: mirror, start: $8000, end: $8FFF, source: $0000, size: $0800}
+//	  - {type: rom, start: $E000, end: $FFFF, file: monitor.rom}
+//	devices:
+//	  - {name: via, type: via6522, start: $6000, end: $600F, irq: irq}
+type Config struct {
+	Name    string
+	CPU     string `yaml:"cpu"` // cpu variant, 6502 or 2a03, 6502 when empty
+	Clock   Frequency
+	Memory  []Region
+	Devices []Device
+	Entry   *Address // overrides the reset vector
+}
+
+// Region types
+const (
+	RegionRAM    = "ram"
+	RegionROM    = "rom"
+	RegionMirror = "mirror"
+)
+
+// Region is a block of memory mapped at Start..End inclusive
+type Region struct {
+	Name  string // defaults to the type and start address, e.g. ram@$0000
+	Type  string
+	Start Address
+	End   Address
+	// ram: size of the chip, mirrored over the region, defaults to the region length.
+	// mirror: length of the source window.
+	Size int
+	// ram and rom: image loaded from the start of the chip, relative paths are relative to the config file.
+	// Raw binaries are placed at the start, prg, Intel HEX and assembler sources at the addresses they carry.
+	// A rom without a file is filled with Fill, so are the parts an image leaves out.
+	File   string
+	Offset int // bytes of the file to skip
+	Fill   byte
+	// mirror: first address of the mirrored window
+	Source Address
+}
+
+func (r Region) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%s@$%04X", r.Type, uint16(r.Start))
+}
+
+func (r Region) length() int {
+	return int(r.End) - int(r.Start) + 1
+}
+
+// Device is an I/O chip of a registered type mapped at Start..End inclusive
+type Device struct {
+	Name  string
+	Type  string
+	Start Address
+	End   Address
+	// IRQ names the interrupt line the chip drives: irq, nmi or nothing
+	IRQ string `yaml:"irq"`
+	// Options are decoded by the device type
+	Options yaml.Node
+}
+
+// Decode unmarshals the device options into v
+func (d Device) Decode(v interface{}) error {
+	if d.Options.Kind == 0 {
+		return nil
+	}
+	return d.Options.Decode(v)
+}
+
+// Address is a 16 bit address written as $C000, 0xC000 or a decimal number
+type Address uint16
+
+func (a *Address) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := number.ParseAddress(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %v", value.Line, err)
+	}
+	*a = Address(parsed)
+	return nil
+}
+
+// Frequency in Hz, written as a number or with a Hz, kHz or MHz suffix, e.g. 1.023MHz
+type Frequency float64
+
+func (f *Frequency) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := ParseFrequency(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %v", value.Line, err)
+	}
+	*f = parsed
+	return nil
+}
+
+func ParseFrequency(s string) (Frequency, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix     string
+		multiplier float64
+	}{{"mhz", 1e6}, {"khz", 1e3}, {"hz", 1}} {
+		if strings.HasSuffix(text, unit.suffix) {
+			text, multiplier = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid frequency %q", s)
+	}
+	return Frequency(value * multiplier), nil
+}
+
+// Parse reads a YAML (or JSON) machine description
+func Parse(data []byte) (*Config, error) {
+	var config Config
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
@@ -0,0 +1,55 @@
+package machine
+
+import (
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+)
+
+// External is what reaches the machine from the host: the input of its devices and interrupts raised by
+// host events. replay.Recorder and replay.Player implement it to record a run and to play it back.
+type External interface {
+	Input(device string, live hostio.Input) hostio.Input
+	Interrupt(interruptType cpu.InterruptType)
+}
+
+// hostInput is the input handed to a device, SetExternal rewires it
+type hostInput struct {
+	hostio.Input
+	live hostio.Input
+}
+
+// OpenHost opens the host connection of a device, see hostio.Open. Its input goes through the External
+// set with SetExternal, so device factories use it instead of opening the connection themselves.
+func (m *Machine) OpenHost(d Device, spec string) (hostio.Serial, error) {
+	host, err := hostio.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	input := &hostInput{Input: host, live: host}
+	if m.external != nil {
+		input.Input = m.external.Input(d.Name, host)
+	}
+	m.inputs[d.Name] = input
+	return hostio.NewSerial(input, host), nil
+}
+
+// SetExternal routes the device input and the interrupts of host events through a recorder or a player,
+// nil connects them to the host again
+func (m *Machine) SetExternal(external External) {
+	m.external = external
+	for name, input := range m.inputs {
+		input.Input = input.live
+		if external != nil {
+			input.Input = external.Input(name, input.live)
+		}
+	}
+}
+
+// Interrupt requests an interrupt for a host event, e.g. a key wired to NMI
+func (m *Machine) Interrupt(interruptType cpu.InterruptType) {
+	if m.external != nil {
+		m.external.Interrupt(interruptType)
+		return
+	}
+	m.Cpu.Interrupt(interruptType)
+}
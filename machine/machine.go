@@ -0,0 +1,274 @@
+package machine
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/loader"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+)
+
+// Machine is a cpu connected to a bus of memory and devices, assembled from a Config
+type Machine struct {
+	Name      string
+	Cpu       *cpu.Cpu
+	Bus       *memory.Bus
+	Scheduler *scheduler.Scheduler // devices register their tickers and timed events here
+	Clock     Frequency            // 0 when the config does not set one
+	Devices   map[string]memory.MemoryMapper
+	Dir       string // files named in the config are relative to it
+	fsys      fs.FS  // where the files are read from, the host file system when nil
+	inputs    map[string]*hostInput
+	external  External
+}
+
+// DeviceFactory creates a device of a registered type. The machine is passed so the device can reach
+// the scheduler, its interrupt line through Pin and its host connection through OpenHost.
+type DeviceFactory func(m *Machine, config Device) (memory.MemoryMapper, error)
+
+var deviceTypes = map[string]DeviceFactory{}
+
+// RegisterDevice makes a device type available to machine configs, device packages call it from init
+func RegisterDevice(name string, factory DeviceFactory) {
+	if _, ok := deviceTypes[name]; ok {
+		panic("device type " + name + " registered twice")
+	}
+	deviceTypes[name] = factory
+}
+
+// DeviceTypes lists the registered device types
+func DeviceTypes() []string {
+	var names []string
+	for name := range deviceTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load reads a config file and builds the machine, files it refers to are relative to its directory
+func Load(path string) (*Machine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	m, err := New(config, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// LoadFS reads a config file and the files it refers to from fsys, e.g. descriptions embedded in the binary
+func LoadFS(fsys fs.FS, name string) (*Machine, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	m, err := newMachine(config, path.Dir(name), fsys)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return m, nil
+}
+
+// New builds the machine and resets the cpu, relative file names are resolved against dir
+func New(config *Config, dir string) (*Machine, error) {
+	return newMachine(config, dir, nil)
+}
+
+func newMachine(config *Config, dir string, fsys fs.FS) (*Machine, error) {
+	variant := cpu.NMOS6502
+	if config.CPU != "" {
+		var err error
+		if variant, err = cpu.ParseVariant(config.CPU); err != nil {
+			return nil, err
+		}
+	}
+	bus := memory.NewBus()
+	c := cpu.NewCpu(nil, bus)
+	c.Variant = variant
+	m := &Machine{
+		Name:      config.Name,
+		Cpu:       &c,
+		Bus:       bus,
+		Scheduler: scheduler.New(&c),
+		Clock:     config.Clock,
+		Devices:   map[string]memory.MemoryMapper{},
+		Dir:       dir,
+		fsys:      fsys,
+		inputs:    map[string]*hostInput{},
+	}
+
+	for _, r := range config.Memory {
+		if err := m.mapRegion(r); err != nil {
+			return nil, fmt.Errorf("%s: %v", r.name(), err)
+		}
+	}
+	for _, d := range config.Devices {
+		if err := m.mapDevice(d); err != nil {
+			return nil, fmt.Errorf("%s: %v", d.Name, err)
+		}
+	}
+
+	c.Reset()
+	if config.Entry != nil {
+		c.PC = uint16(*config.Entry)
+	}
+	return m, nil
+}
+
+func (m *Machine) mapRegion(r Region) error {
+	if r.End < r.Start {
+		return fmt.Errorf("end $%04X before start $%04X", uint16(r.End), uint16(r.Start))
+	}
+	var contents []byte
+	if r.File != "" {
+		var err error
+		if contents, err = m.image(r); err != nil {
+			return err
+		}
+	}
+
+	switch r.Type {
+	case RegionRAM:
+		size := r.Size
+		if size == 0 {
+			size = r.length()
+		}
+		if len(contents) > size {
+			return fmt.Errorf("%s does not fit in %d bytes", r.File, size)
+		}
+		ram := memory.NewRAM(size)
+		copy(ram.Bytes(), contents)
+		return m.Bus.Map(r.name(), uint16(r.Start), uint16(r.End), ram)
+	case RegionROM:
+		if contents == nil {
+			contents = make([]byte, r.length())
+			for i := range contents {
+				contents[i] = r.Fill
+			}
+		}
+		if len(contents) > r.length() {
+			return fmt.Errorf("%s is %d bytes, larger than the region", r.File, len(contents))
+		}
+		return m.Bus.Map(r.name(), uint16(r.Start), uint16(r.End), memory.NewROM(contents))
+	case RegionMirror:
+		size := r.Size
+		if size == 0 {
+			size = r.length()
+		}
+		return m.Bus.Mirror(r.name(), uint16(r.Start), uint16(r.End), uint16(r.Source), size)
+	default:
+		return fmt.Errorf("unknown memory type %q", r.Type)
+	}
+}
+
+func (m *Machine) mapDevice(d Device) error {
+	if d.Name == "" {
+		return fmt.Errorf("%s device without a name", d.Type)
+	}
+	factory, ok := deviceTypes[d.Type]
+	if !ok {
+		return fmt.Errorf("unknown device type %q, known types: %v", d.Type, DeviceTypes())
+	}
+	if d.End < d.Start {
+		return fmt.Errorf("end $%04X before start $%04X", uint16(d.End), uint16(d.Start))
+	}
+	switch d.IRQ {
+	case "", "irq", "nmi":
+	default:
+		return fmt.Errorf("unknown interrupt line %q, expected irq or nmi", d.IRQ)
+	}
+	device, err := factory(m, d)
+	if err != nil {
+		return err
+	}
+	m.Devices[d.Name] = device
+	return m.Bus.Map(d.Name, uint16(d.Start), uint16(d.End), device)
+}
+
+// image reads the file of a region, images carrying addresses are placed relative to the region start
+func (m *Machine) image(r Region) ([]byte, error) {
+	data, err := m.ReadFile(r.File)
+	if err != nil {
+		return nil, err
+	}
+	if r.Offset > len(data) {
+		return nil, fmt.Errorf("offset %d past the end of %s", r.Offset, r.File)
+	}
+	data = data[r.Offset:]
+	format := loader.FormatFor(r.File)
+	if format == loader.FormatBinary {
+		return data, nil
+	}
+
+	segments, err := loader.Parse(data, format, uint16(r.Start))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", r.File, err)
+	}
+	contents := make([]byte, r.length())
+	for i := range contents {
+		contents[i] = r.Fill
+	}
+	for _, segment := range segments {
+		offset := int(segment.Address) - int(r.Start)
+		if offset < 0 || offset+len(segment.Bytes) > len(contents) {
+			return nil, fmt.Errorf("%s: $%04X-$%04X is outside the region", r.File,
+				segment.Address, int(segment.Address)+len(segment.Bytes)-1)
+		}
+		copy(contents[offset:], segment.Bytes)
+	}
+	return contents, nil
+}
+
+// ReadFile reads a file named in the config
+func (m *Machine) ReadFile(name string) ([]byte, error) {
+	if m.fsys != nil {
+		return fs.ReadFile(m.fsys, path.Join(m.Dir, name))
+	}
+	return ioutil.ReadFile(m.Path(name))
+}
+
+// Path resolves a host file named in the config, e.g. one a device writes. Relative names are relative
+// to the config file, or to the current directory when the config was not read from the host file system.
+func (m *Machine) Path(name string) string {
+	if m.fsys != nil || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(m.Dir, name)
+}
+
+// ClockOr returns the clock frequency in Hz, or the default when the config does not set one
+func (m *Machine) ClockOr(defaultHz float64) float64 {
+	if m.Clock == 0 {
+		return defaultHz
+	}
+	return float64(m.Clock)
+}
+
+// Pin connects a device to the interrupt line named in its config, nil when it is not wired
+func (m *Machine) Pin(d Device) *cpu.InterruptPin {
+	switch d.IRQ {
+	case "irq":
+		return m.Cpu.IRQLine().Pin()
+	case "nmi":
+		return m.Cpu.NMILine().Pin()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,162 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// latch holds the line while its register is non zero
+type latch struct {
+	value byte
+	irq   *cpu.InterruptPin
+}
+
+func (l *latch) Read(address uint16) byte {
+	return l.value
+}
+
+func (l *latch) Write(address uint16, value byte) {
+	l.value = value
+	l.irq.Set(value != 0)
+}
+
+// keyboard reads its host input
+type keyboard struct {
+	host hostio.Serial
+}
+
+func (k *keyboard) Read(address uint16) byte {
+	b, _ := k.host.Poll()
+	return b
+}
+
+func (k *keyboard) Write(address uint16, value byte) {}
+
+// external replays a fixed input for every device and keeps the interrupts requested
+type external struct {
+	input      string
+	interrupts []cpu.InterruptType
+}
+
+func (e *external) Input(device string, live hostio.Input) hostio.Input {
+	return hostio.NewBytesInput([]byte(device + ":" + e.input))
+}
+
+func (e *external) Interrupt(interruptType cpu.InterruptType) {
+	e.interrupts = append(e.interrupts, interruptType)
+}
+
+func init() {
+	RegisterDevice("test-keyboard", func(m *Machine, config Device) (memory.MemoryMapper, error) {
+		host, err := m.OpenHost(config, "none")
+		if err != nil {
+			return nil, err
+		}
+		return &keyboard{host: host}, nil
+	})
+	RegisterDevice("test-latch", func(m *Machine, config Device) (memory.MemoryMapper, error) {
+		var options struct{ Initial byte }
+		if err := config.Decode(&options); err != nil {
+			return nil, err
+		}
+		return &latch{value: options.Initial, irq: m.Pin(config)}, nil
+	})
+}
+
+const board = `
+name: test board
+clock: 1.5 MHz
+memory:
+  - {type: ram, start: $0000, end: $1FFF, size: 0x800}
+  - {type: mirror, name: io mirror, start: $3000, end: $3FFF, source: $2000, size: 16}
+  - {type: rom, start: $F000, end: $FFFF, fill: 0xEA}
+devices:
+  - name: latch
+    type: test-latch
+    start: $2000
+    end: $200F
+    irq: irq
+    options: {initial: 7}
+entry: $F000
+`
+
+func TestNew(t *testing.T) {
+	config, err := Parse([]byte(board))
+	require.NoError(t, err)
+	m, err := New(config, ".")
+	require.NoError(t, err)
+
+	assert.Equal(t, "test board", m.Name)
+	assert.Equal(t, Frequency(1.5e6), m.Clock)
+	assert.Equal(t, 1.5e6, m.ClockOr(1e6))
+	assert.Equal(t, 1e6, (&Machine{}).ClockOr(1e6))
+	assert.Equal(t, uint16(0xF000), m.Cpu.PC)
+	assert.Equal(t, byte(0xEA), m.Bus.Read(0xFFFC))
+
+	m.Bus.Write(0x0005, 0x11)
+	assert.Equal(t, byte(0x11), m.Bus.Read(0x0805), "2K of ram mirrored over 8K")
+
+	assert.Equal(t, byte(7), m.Bus.Read(0x3010), "device seen through the mirror")
+	m.Bus.Write(0x2000, 1)
+	assert.True(t, m.Cpu.IRQLine().Active())
+	assert.Same(t, m.Devices["latch"], m.Devices["latch"])
+}
+
+func TestNew_errors(t *testing.T) {
+	for _, source := range []string{
+		"cpu: 65816",
+		"memory: [{type: flash, start: 0, end: 1}]",
+		"memory: [{type: ram, start: $2000, end: $1000}]",
+		"memory: [{type: rom, start: 0, end: $FF, file: missing.bin}]",
+		"devices: [{name: x, type: missing, start: 0, end: 1}]",
+		"devices: [{name: x, type: test-latch, start: 0, end: 1, irq: firq}]",
+	} {
+		config, err := Parse([]byte(source))
+		require.NoError(t, err, source)
+		_, err = New(config, ".")
+		assert.Error(t, err, source)
+	}
+	_, err := Parse([]byte("clock: fast"))
+	assert.Error(t, err)
+	_, err = Parse([]byte("memroy: []"))
+	assert.Error(t, err, "unknown fields are reported")
+}
+
+func TestLoad(t *testing.T) {
+	m, err := Load("../machines/functional_test.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0x0400), m.Cpu.PC)
+	assert.Equal(t, byte(0xD8), m.Bus.Read(0x0400), "CLD at the start of the test")
+}
+
+func TestMachine_external(t *testing.T) {
+	config, err := Parse([]byte(`
+memory:
+  - {type: ram, start: $0000, end: $FFFF}
+devices:
+  - {name: kbd, type: test-keyboard, start: $D000, end: $D000}
+`))
+	require.NoError(t, err)
+	m, err := New(config, ".")
+	require.NoError(t, err)
+	assert.Equal(t, byte(0), m.Bus.Read(0xD000), "nothing arrives from the host")
+
+	e := &external{input: "x"}
+	m.SetExternal(e)
+	assert.Equal(t, byte('k'), m.Bus.Read(0xD000))
+	assert.Equal(t, byte('b'), m.Bus.Read(0xD000))
+	m.Interrupt(cpu.InterruptTypeNMI)
+	assert.Equal(t, []cpu.InterruptType{cpu.InterruptTypeNMI}, e.interrupts)
+	assert.Empty(t, m.Cpu.PendingInterrupts())
+
+	m.SetExternal(nil)
+	assert.Equal(t, byte(0), m.Bus.Read(0xD000))
+	m.Interrupt(cpu.InterruptTypeIRQ)
+	assert.Equal(t, []cpu.InterruptType{cpu.InterruptTypeIRQ}, m.Cpu.PendingInterrupts())
+}
@@ -0,0 +1,153 @@
+; The Woz Monitor, Steve Wozniak's 256 byte monitor from the Apple-1 ROM at $FF00.
+;
+;   FF00         examine a location
+;   FF00.FF0F    examine a block
+;   0300: A9 01  store bytes from $0300
+;   0300R        run from $0300
+;   _            rubs out the last character, ESC cancels the line
+
+XAML    = $24           ; last opened location
+XAMH    = $25
+STL     = $26           ; store address
+STH     = $27
+L       = $28           ; hex value being parsed
+H       = $29
+YSAV    = $2A
+MODE    = $2B           ; $00 examine, $74 store, $AE block examine
+
+IN      = $0200         ; input line buffer
+KBD     = $D010         ; PIA keyboard data
+KBDCR   = $D011         ; PIA keyboard control
+DSP     = $D012         ; PIA display data
+DSPCR   = $D013         ; PIA display control
+
+        .org $FF00
+RESET:  CLD
+        CLI
+        LDY #$7F        ; display data direction: bits 0-6 out, bit 7 in
+        STY DSP
+        LDA #$A7        ; CA1 and CB1 active on the positive edge, select the data registers
+        STA KBDCR
+        STA DSPCR
+NOTCR:  CMP #$DF        ; "_" rubs out
+        BEQ BACKSPACE
+        CMP #$9B        ; ESC
+        BEQ ESCAPE
+        INY
+        BPL NEXTCHAR    ; the line is full after 128 characters
+ESCAPE: LDA #$DC        ; backslash
+        JSR ECHO
+GETLINE: LDA #$8D       ; CR
+        JSR ECHO
+        LDY #$01
+BACKSPACE: DEY
+        BMI GETLINE
+NEXTCHAR: LDA KBDCR     ; wait for a key
+        BPL NEXTCHAR
+        LDA KBD
+        STA IN,Y
+        JSR ECHO
+        CMP #$8D
+        BNE NOTCR
+        LDY #$FF        ; parse the line
+        LDA #$00
+        TAX
+SETSTOR: ASL            ; ":" shifts to $74, bit 6 set selects store mode
+SETMODE: STA MODE
+BLSKIP: INY
+NEXTITEM: LDA IN,Y
+        CMP #$8D        ; end of line
+        BEQ GETLINE
+        CMP #$AE        ; "."
+        BCC BLSKIP      ; skip delimiters
+        BEQ SETMODE     ; block examine
+        CMP #$BA        ; ":"
+        BEQ SETSTOR
+        CMP #$D2        ; "R"
+        BEQ RUN
+        STX L
+        STX H
+        STY YSAV
+NEXTHEX: LDA IN,Y       ; hex digit
+        EOR #$B0        ; "0"-"9" become 0-9
+        CMP #$0A
+        BCC DIG
+        ADC #$88        ; "A"-"F" become $FA-$FF
+        CMP #$FA
+        BCC NOTHEX
+DIG:    ASL             ; digit to the high nibble
+        ASL
+        ASL
+        ASL
+        LDX #$04
+HEXSHIFT: ASL           ; shift it into L and H
+        ROL L
+        ROL H
+        DEX
+        BNE HEXSHIFT
+        INY
+        BNE NEXTHEX
+NOTHEX: CPY YSAV        ; no digits: error
+        BEQ ESCAPE
+        BIT MODE
+        BVC NOTSTOR
+        LDA L           ; store mode
+        STA (STL,X)
+        INC STL
+        BNE NEXTITEM
+        INC STH
+TONEXTITEM: JMP NEXTITEM
+RUN:    JMP (XAML)
+NOTSTOR: BMI XAMNEXT    ; block examine
+        LDX #$02        ; copy the address to the store and examine indices
+SETADR: LDA L-1,X
+        STA STL-1,X
+        STA XAML-1,X
+        DEX
+        BNE SETADR
+NXTPRNT: BNE PRDATA     ; print the address on new lines
+        LDA #$8D
+        JSR ECHO
+        LDA XAMH
+        JSR PRBYTE
+        LDA XAML
+        JSR PRBYTE
+        LDA #$BA        ; ":"
+        JSR ECHO
+PRDATA: LDA #$A0        ; space
+        JSR ECHO
+        LDA (XAML,X)
+        JSR PRBYTE
+XAMNEXT: STX MODE
+        LDA XAML        ; done when the examine index passes the end
+        CMP L
+        LDA XAMH
+        SBC H
+        BCS TONEXTITEM
+        INC XAML
+        BNE MOD8CHK
+        INC XAMH
+MOD8CHK: LDA XAML       ; a new line every 8 bytes
+        AND #$07
+        BPL NXTPRNT
+PRBYTE: PHA
+        LSR
+        LSR
+        LSR
+        LSR
+        JSR PRHEX
+        PLA
+PRHEX:  AND #$0F
+        ORA #$B0        ; "0"
+        CMP #$BA
+        BCC ECHO
+        ADC #$06        ; "A"-"F"
+ECHO:   BIT DSP         ; wait for the display
+        BMI ECHO
+        STA DSP
+        RTS
+
+        .org $FFFA
+        .word $0F00     ; NMI
+        .word RESET
+        .word $0000     ; IRQ
@@ -0,0 +1,135 @@
+; Hello world for Ben Eater's breadboard computer: the LCD on the VIA in the 8 bit wiring shows a greeting,
+; the second line counts presses of the button on CA1 (the space bar).
+
+PORTB   = $6000
+PORTA   = $6001
+DDRB    = $6002
+DDRA    = $6003
+PCR     = $600C
+IFR     = $600D
+IER     = $600E
+
+E       = %10000000
+RW      = %01000000
+RS      = %00100000
+
+COUNT   = $00           ; button presses, counted by the interrupt handler
+SHOWN   = $01           ; count on the display
+
+        .org $8000
+RESET:  LDX #$FF
+        TXS
+        LDA #%11111111  ; port B is the LCD data bus
+        STA DDRB
+        LDA #%11100000  ; E, R/W and RS
+        STA DDRA
+        LDA #%00111000  ; 8 bit interface, two lines, 5x8 font
+        JSR LCDINS
+        LDA #%00001100  ; display on, no cursor
+        JSR LCDINS
+        LDA #%00000110  ; increment, no display shift
+        JSR LCDINS
+        LDA #%00000001  ; clear
+        JSR LCDINS
+
+        LDX #0
+GREET:  LDA MESSAGE,X
+        BEQ COUNTER
+        JSR LCDCHR
+        INX
+        JMP GREET
+
+COUNTER: LDA #0
+        STA COUNT
+        LDA #$FF
+        STA SHOWN
+        LDA #%00000000  ; CA1 on the falling edge
+        STA PCR
+        LDA #%10000010  ; enable the CA1 interrupt
+        STA IER
+        CLI
+
+LOOP:   LDA COUNT
+        CMP SHOWN
+        BEQ LOOP
+        STA SHOWN
+        LDA #%11000000  ; second line
+        JSR LCDINS
+        LDX #0
+PRESSES: LDA LABEL,X
+        BEQ NUMBER
+        JSR LCDCHR
+        INX
+        JMP PRESSES
+NUMBER: LDA SHOWN
+        LSR A
+        LSR A
+        LSR A
+        LSR A
+        JSR HEXCHR
+        LDA SHOWN
+        JSR HEXCHR
+        JMP LOOP
+
+; HEXCHR shows the low nibble of A as a hex digit
+HEXCHR: AND #$0F
+        CMP #10
+        BCC DIGIT
+        ADC #'A'-10-1   ; carry is set
+        JMP LCDCHR
+DIGIT:  ADC #'0'
+        JMP LCDCHR
+
+; LCDWAIT waits until the LCD is no longer busy
+LCDWAIT: PHA
+        LDA #%00000000  ; port B input
+        STA DDRB
+BUSY:   LDA #RW
+        STA PORTA
+        LDA #RW+E
+        STA PORTA
+        LDA PORTB
+        AND #%10000000
+        BNE BUSY
+        LDA #RW
+        STA PORTA
+        LDA #%11111111
+        STA DDRB
+        PLA
+        RTS
+
+; LCDINS sends the instruction in A
+LCDINS: JSR LCDWAIT
+        STA PORTB
+        LDA #0
+        STA PORTA
+        LDA #E
+        STA PORTA
+        LDA #0
+        STA PORTA
+        RTS
+
+; LCDCHR shows the character in A
+LCDCHR: JSR LCDWAIT
+        STA PORTB
+        LDA #RS
+        STA PORTA
+        LDA #RS+E
+        STA PORTA
+        LDA #RS
+        STA PORTA
+        RTS
+
+IRQ:    PHA
+        INC COUNT
+        LDA PORTA       ; reading port A clears the CA1 flag
+        PLA
+        RTI
+
+MESSAGE: .byte "Hello, world!", 0
+LABEL:  .byte "Presses: ", 0
+
+        .org $FFFA
+        .word IRQ
+        .word RESET
+        .word IRQ
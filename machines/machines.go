@@ -0,0 +1,39 @@
+// Package machines holds the machine descriptions built into the emulator, they are selected by name
+// wherever a description file is accepted.
+package machines
+
+import (
+	"embed"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/machine"
+)
+
+//go:embed apple1.yaml apple1 beneater.yaml beneater
+var files embed.FS
+
+// Names lists the built-in machines
+func Names() []string {
+	entries, _ := fs.ReadDir(files, ".")
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".yaml") {
+			names = append(names, strings.TrimSuffix(e.Name(), ".yaml"))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has tells whether name is a built-in machine
+func Has(name string) bool {
+	_, err := fs.Stat(files, name+".yaml")
+	return err == nil
+}
+
+// Load builds a built-in machine, the device types it uses must be registered
+func Load(name string) (*machine.Machine, error) {
+	return machine.LoadFS(files, name+".yaml")
+}
@@ -0,0 +1,39 @@
+package machines
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/device/apple1"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/beneater"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApple1(t *testing.T) {
+	assert.Contains(t, Names(), "apple1")
+	m, err := Load("apple1")
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0xFF00), m.Cpu.PC)
+
+	output := &bytes.Buffer{}
+	pia := m.Devices["pia"].(*apple1.PIA)
+	pia.Terminal.Host = hostio.NewSerial(hostio.NewBytesInput([]byte("FF00.FF03\n")), output)
+	for m.Cpu.Cycles < 2000000 {
+		m.Cpu.ExecuteOpcode()
+	}
+	assert.Equal(t, "\\\r\nFF00.FF03\r\n\r\nFF00: D8 58 A0 7F\r\n", output.String())
+}
+
+func TestBenEater(t *testing.T) {
+	m, err := Load("beneater")
+	require.NoError(t, err)
+	board := m.Devices["via"].(*beneater.Board)
+	board.Host = hostio.NewSerial(hostio.NewBytesInput([]byte("  ")), &bytes.Buffer{})
+	for m.Cpu.Cycles < 300000 {
+		m.Cpu.ExecuteOpcode()
+	}
+	assert.Equal(t, []string{"Hello, world!   ", "Presses: 02     "}, board.LCD.Lines())
+}
@@ -1,23 +1,97 @@
 package main
 
 import (
-	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
-	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
 )
 
-func main() {
+// Exit codes
+const (
+	exitOK      = 0 // a stop condition was reached, the test passed
+	exitFailure = 1 // the program could not be run or the test failed
+	exitUsage   = 2
+	exitLimit   = 3 // the cycle or instruction limit ran out before any stop condition
+)
+
+type command struct {
+	usage       string
+	description string
+	run         func(args []string) (int, error)
+}
 
-	cpu := cpu.NewCpu(nil, &memory.DummyMemoryMapper{})
+var commands = map[string]command{
+	"run":     {"[flags] [image]", "run a program or a machine until a stop condition or a limit", runCommand},
+	"trace":   {"[flags] [image]", "run a program or a machine logging every executed instruction", traceCommand},
+	"test":    {"[flags] [image]", "run a test image until it traps, by default Klaus Dormann's functional test and Bruce Clark's decimal test", testCommand},
+	"disasm":  {"[flags] image", "disassemble a program", disasmCommand},
+	"asm":     {"[flags] source", "assemble a source file into a binary", asmCommand},
+	"monitor": {"[flags] [image]", "open the interactive machine language monitor", monitorCommand},
+	"gdb":     {"[flags] [image]", "serve the GDB remote serial protocol", gdbCommand},
+	"dap":     {"[flags] [image]", "serve the Debug Adapter Protocol", dapCommand},
+}
+
+// demo is what runs without a command: the Apple-1 and its monitor in real time
+var demo = []string{"run", "-machine", "apple1", "-clock", "machine"}
 
-	err := cpu.Load("roms/functional_test/6502_functional_test_no_decimal.bin", 0x0, 0x0400)
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Apple-1 with the Woz Monitor, try FF00.FF1F or 280: A9 C1 20 EF FF 4C 1F FF then 280R, Ctrl-C quits")
+		fmt.Fprintln(os.Stderr, "run 'mos6502-emulator help' for the commands")
+		args = demo
+	}
+	os.Exit(dispatch(args))
+}
+
+// dispatch runs a command and returns the exit code
+func dispatch(args []string) int {
+	defer hostio.Restore()
+	cmd, ok := commands[args[0]]
+	if !ok {
+		if args[0] != "help" && args[0] != "-h" && args[0] != "-help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		}
+		usage()
+		return exitUsage
+	}
+	code, err := cmd.run(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return exitUsage
+	}
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(os.Stderr, "%v\nusage: mos6502-emulator %s %s\n", err, args[0], cmd.usage)
+		return exitUsage
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return exitFailure
 	}
+	return code
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: mos6502-emulator <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "without a command the Apple-1 runs")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun 'mos6502-emulator <command> -h' for the flags of a command")
+}
 
-	// for true {
-	// 	cpu.ExecuteOpcode()
-	// }
-	cpu.Run(10000)
-	print("finished!")
+type usageError string
 
+func (e usageError) Error() string {
+	return string(e)
 }
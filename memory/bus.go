@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Bus is a MemoryMapper built from devices mapped at address ranges.
+// A device sees addresses relative to the start of its range. Reads of unmapped addresses return 0
+// and writes to them are dropped. Later mappings take precedence over earlier ones where they overlap.
+type Bus struct {
+	regions []region
+	// index+1 of the region serving each address, 0 when unmapped
+	lookup [0x10000]uint16
+}
+
+type region struct {
+	name   string
+	start  uint16
+	end    uint16
+	device MemoryMapper
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Map connects the device to the addresses start..end inclusive
+func (b *Bus) Map(name string, start, end uint16, device MemoryMapper) error {
+	if end < start {
+		return fmt.Errorf("%s: end $%04X before start $%04X", name, end, start)
+	}
+	for _, r := range b.regions {
+		if r.name == name {
+			return fmt.Errorf("%s mapped twice", name)
+		}
+	}
+	b.regions = append(b.regions, region{name: name, start: start, end: end, device: device})
+	for address := int(start); address <= int(end); address++ {
+		b.lookup[address] = uint16(len(b.regions))
+	}
+	return nil
+}
+
+// Mirror makes start..end show the size bytes of the bus at source, repeated over the whole range
+func (b *Bus) Mirror(name string, start, end, source uint16, size int) error {
+	if size <= 0 {
+		return fmt.Errorf("%s: mirror size must be positive", name)
+	}
+	if int(source) <= int(end) && int(source)+size > int(start) {
+		return fmt.Errorf("%s: mirror overlaps its source", name)
+	}
+	return b.Map(name, start, end, &mirror{bus: b, source: source, size: size})
+}
+
+func (b *Bus) Read(address uint16) byte {
+	if i := b.lookup[address]; i != 0 {
+		r := &b.regions[i-1]
+		return r.device.Read(address - r.start)
+	}
+	return 0
+}
+
+// Peek implements Peeker, devices are peeked when they support it
+func (b *Bus) Peek(address uint16) byte {
+	if i := b.lookup[address]; i != 0 {
+		r := &b.regions[i-1]
+		return Peek(r.device, address-r.start)
+	}
+	return 0
+}
+
+func (b *Bus) Write(address uint16, value byte) {
+	if i := b.lookup[address]; i != 0 {
+		r := &b.regions[i-1]
+		r.device.Write(address-r.start, value)
+	}
+}
+
+// Device returns the device mapped under the given name
+func (b *Bus) Device(name string) (MemoryMapper, bool) {
+	for _, r := range b.regions {
+		if r.name == name {
+			return r.device, true
+		}
+	}
+	return nil, false
+}
+
+// IsRAM implements RAMMapper, the address is RAM when it reaches a RAM region, the RAM of a device
+// implementing RAMMapper, or either through a mirror
+func (b *Bus) IsRAM(address uint16) bool {
+	if i := b.lookup[address]; i != 0 {
+		r := &b.regions[i-1]
+		return IsRAM(r.device, address-r.start)
+	}
+	return false
+}
+
+// SaveState stores the state of every mapped device implementing Stateful, keyed by name
+func (b *Bus) SaveState() ([]byte, error) {
+	states := map[string][]byte{}
+	for _, r := range b.regions {
+		if stateful, ok := r.device.(Stateful); ok {
+			state, err := stateful.SaveState()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", r.name, err)
+			}
+			states[r.name] = state
+		}
+	}
+	return json.Marshal(states)
+}
+
+func (b *Bus) LoadState(data []byte) error {
+	var states map[string][]byte
+	if err := json.Unmarshal(data, &states); err != nil {
+		return err
+	}
+	for _, r := range b.regions {
+		stateful, ok := r.device.(Stateful)
+		if !ok {
+			continue
+		}
+		state, ok := states[r.name]
+		if !ok {
+			return fmt.Errorf("save state has nothing for %s", r.name)
+		}
+		if err := stateful.LoadState(state); err != nil {
+			return fmt.Errorf("%s: %v", r.name, err)
+		}
+	}
+	return nil
+}
+
+type mirror struct {
+	bus    *Bus
+	source uint16
+	size   int
+}
+
+func (m *mirror) Read(address uint16) byte {
+	return m.bus.Read(m.source + uint16(int(address)%m.size))
+}
+
+func (m *mirror) Peek(address uint16) byte {
+	return m.bus.Peek(m.source + uint16(int(address)%m.size))
+}
+
+func (m *mirror) IsRAM(address uint16) bool {
+	return m.bus.IsRAM(m.source + uint16(int(address)%m.size))
+}
+
+func (m *mirror) Write(address uint16, value byte) {
+	m.bus.Write(m.source+uint16(int(address)%m.size), value)
+}
@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	ram := NewRAM(0x0800)
+	require.NoError(t, bus.Map("ram", 0x0000, 0x07FF, ram))
+	require.NoError(t, bus.Mirror("ram mirror", 0x0800, 0x1FFF, 0x0000, 0x0800))
+	require.NoError(t, bus.Map("rom", 0xF000, 0xFFFF, NewROM([]byte{0xEA, 0x60})))
+
+	bus.Write(0x0801, 0x42)
+	assert.Equal(t, byte(0x42), ram.Bytes()[1])
+	assert.Equal(t, byte(0x42), bus.Read(0x1801))
+
+	bus.Write(0xF000, 0x00)
+	assert.Equal(t, byte(0xEA), bus.Read(0xF000))
+	assert.Equal(t, byte(0x60), bus.Read(0xFFFF), "rom mirrors itself over the region")
+	assert.Equal(t, byte(0), bus.Read(0x8000), "unmapped")
+
+	assert.True(t, bus.IsRAM(0x0001))
+	assert.True(t, bus.IsRAM(0x1801), "through the mirror")
+	assert.False(t, bus.IsRAM(0xF000))
+	assert.False(t, bus.IsRAM(0x8000))
+
+	assert.Error(t, bus.Map("ram", 0x2000, 0x2FFF, ram))
+	assert.Error(t, bus.Mirror("loop", 0x2000, 0x2FFF, 0x2800, 0x100))
+
+	state, err := bus.SaveState()
+	require.NoError(t, err)
+	bus.Write(0x0001, 0x00)
+	require.NoError(t, bus.LoadState(state))
+	assert.Equal(t, byte(0x42), bus.Read(0x0001))
+}
@@ -1,5 +1,7 @@
 package memory
 
+import "fmt"
+
 type MemoryMapper interface {
 	Read(address uint16) byte
 	Write(address uint16, value byte)
@@ -16,3 +18,57 @@ func (m *DummyMemoryMapper) Read(address uint16) byte {
 func (m *DummyMemoryMapper) Write(address uint16, value byte) {
 	m.Mem[address] = value
 }
+
+// Stateful is implemented by memory mappers and devices that can be stored in a save state
+type Stateful interface {
+	SaveState() ([]byte, error)
+	LoadState(data []byte) error
+}
+
+func (m *DummyMemoryMapper) SaveState() ([]byte, error) {
+	return append([]byte{}, m.Mem[:]...), nil
+}
+
+func (m *DummyMemoryMapper) LoadState(data []byte) error {
+	if len(data) != len(m.Mem) {
+		return fmt.Errorf("expected %d bytes of memory, got %d", len(m.Mem), len(data))
+	}
+	copy(m.Mem[:], data)
+	return nil
+}
+
+// Peeker is implemented by memory mappers and devices whose reads have side effects, like clearing
+// interrupt flags or consuming input. Peek returns what Read would, without the side effects.
+type Peeker interface {
+	Peek(address uint16) byte
+}
+
+// Peek reads memory without side effects, debugging tools use it to look at I/O registers
+func Peek(m MemoryMapper, address uint16) byte {
+	if p, ok := m.(Peeker); ok {
+		return p.Peek(address)
+	}
+	return m.Read(address)
+}
+
+// RAMMapper is implemented by memory mappers that hold RAM among other things, like a bus or a device that
+// is a whole computer. IsRAM tells whether writing the address only changes memory, so it can be undone.
+type RAMMapper interface {
+	IsRAM(address uint16) bool
+}
+
+// IsRAM tells whether an address of the memory mapper is plain RAM
+func IsRAM(m MemoryMapper, address uint16) bool {
+	switch m := m.(type) {
+	case *RAM:
+		return true
+	case RAMMapper:
+		return m.IsRAM(address)
+	}
+	return false
+}
+
+// IsRAM implements RAMMapper, all of it is RAM
+func (m *DummyMemoryMapper) IsRAM(address uint16) bool {
+	return true
+}
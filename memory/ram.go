@@ -0,0 +1,57 @@
+package memory
+
+import "fmt"
+
+// RAM is a block of read/write memory, addresses beyond its size wrap around so it mirrors
+// itself when mapped into a larger region
+type RAM struct {
+	data []byte
+}
+
+func NewRAM(size int) *RAM {
+	return &RAM{data: make([]byte, size)}
+}
+
+func (r *RAM) Read(address uint16) byte {
+	return r.data[int(address)%len(r.data)]
+}
+
+func (r *RAM) Write(address uint16, value byte) {
+	r.data[int(address)%len(r.data)] = value
+}
+
+// Bytes gives direct access to the contents, e.g. to preload them
+func (r *RAM) Bytes() []byte {
+	return r.data
+}
+
+func (r *RAM) SaveState() ([]byte, error) {
+	return append([]byte{}, r.data...), nil
+}
+
+func (r *RAM) LoadState(data []byte) error {
+	if len(data) != len(r.data) {
+		return fmt.Errorf("expected %d bytes of ram, got %d", len(r.data), len(data))
+	}
+	copy(r.data, data)
+	return nil
+}
+
+// ROM is read only memory, writes are ignored. Like RAM it mirrors itself past its size.
+type ROM struct {
+	data []byte
+}
+
+func NewROM(data []byte) *ROM {
+	return &ROM{data: data}
+}
+
+func (r *ROM) Read(address uint16) byte {
+	if len(r.data) == 0 {
+		return 0
+	}
+	return r.data[int(address)%len(r.data)]
+}
+
+func (r *ROM) Write(address uint16, value byte) {
+}
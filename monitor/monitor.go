@@ -0,0 +1,564 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/asm"
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/debugger"
+	"github.com/slawomirbiernacki/mos6502-emulator/disassembler"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/number"
+	"github.com/slawomirbiernacki/mos6502-emulator/savestate"
+	"github.com/slawomirbiernacki/mos6502-emulator/trace"
+)
+
+// RunBudget is the number of cycles "g" and friends execute before giving control back to the user
+const RunBudget = 10000000
+
+const help = `Addresses and values are hex, a leading $ is optional.
+  m [start [end]]          examine memory
+  > addr byte...           modify memory
+  r [reg=value...]         show or set registers and flags (A X Y S PC P C Z I D V N)
+  d [start [end]]          disassemble
+  a addr instruction       assemble one instruction in place, e.g. a 0400 LDA #$10
+  b addr [if condition]    set a breakpoint, conditions use the debugger expression syntax
+  bl                       list breakpoints
+  bd id                    delete a breakpoint
+  z [count]                step into
+  n                        step over (JSR counts as one step)
+  ret                      step out (until RTS/RTI)
+  g [addr]                 continue, optionally from addr
+  u addr                   run until addr
+  l file addr              load a binary file to memory
+  s file start end         save memory range to a file
+  ss file                  save the whole machine state
+  sl file                  restore a machine state saved with ss
+  f start end byte...      fill memory with a pattern
+  c start end dest         compare memory ranges
+  h start end byte...      hunt for a byte sequence
+  x                        exit
+`
+
+// Monitor is an interactive machine language monitor in the spirit of WozMon and the VICE monitor
+type Monitor struct {
+	debugger *debugger.Debugger
+	out      io.Writer
+
+	// next addresses for m and d without arguments
+	nextMemory      uint16
+	nextDisassembly uint16
+}
+
+func New(d *debugger.Debugger, out io.Writer) *Monitor {
+	return &Monitor{debugger: d, out: out, nextMemory: d.Cpu().PC, nextDisassembly: d.Cpu().PC}
+}
+
+// Run reads commands until "x" or the end of input
+func (m *Monitor) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	m.registers()
+	for {
+		fmt.Fprint(m.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(m.out)
+			return scanner.Err()
+		}
+		if !m.Execute(scanner.Text()) {
+			return nil
+		}
+	}
+}
+
+// Execute runs a single command line, returns false when the user asked to exit
+func (m *Monitor) Execute(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	command, args := strings.ToLower(fields[0]), fields[1:]
+	var err error
+	switch command {
+	case "x", "q", "exit", "quit":
+		return false
+	case "?", "help":
+		fmt.Fprint(m.out, help)
+	case "m":
+		err = m.memory(args)
+	case ">":
+		err = m.modify(args)
+	case "r":
+		err = m.setRegisters(args)
+	case "d":
+		err = m.disassemble(args)
+	case "a":
+		err = m.assemble(line)
+	case "b":
+		err = m.breakpoint(line)
+	case "bl":
+		m.listBreakpoints()
+	case "bd":
+		err = m.deleteBreakpoint(args)
+	case "z":
+		err = m.step(args)
+	case "n":
+		m.stopped(m.debugger.StepOver(RunBudget))
+	case "ret":
+		m.stopped(m.debugger.StepOut(RunBudget))
+	case "g":
+		err = m.run(args)
+	case "u":
+		err = m.runUntil(args)
+	case "l":
+		err = m.load(args)
+	case "s":
+		err = m.save(args)
+	case "ss":
+		err = m.saveState(args)
+	case "sl":
+		err = m.loadState(args)
+	case "f":
+		err = m.fill(args)
+	case "c":
+		err = m.compare(args)
+	case "h":
+		err = m.hunt(args)
+	default:
+		err = fmt.Errorf("unknown command %q, type ? for help", command)
+	}
+	if err != nil {
+		fmt.Fprintf(m.out, "error: %v\n", err)
+	}
+	return true
+}
+
+func (m *Monitor) cpu() *cpu.Cpu {
+	return m.debugger.Cpu()
+}
+
+func (m *Monitor) read(address uint16) byte {
+	return memory.Peek(m.cpu().MemoryMapper(), address)
+}
+
+func (m *Monitor) write(address uint16, value byte) {
+	m.cpu().MemoryMapper().Write(address, value)
+}
+
+func (m *Monitor) registers() {
+	c := m.cpu()
+	fmt.Fprintf(m.out, "PC:%04X A:%02X X:%02X Y:%02X S:%02X P:%s CYC:%d\n", c.PC, c.A, c.X, c.Y, c.S, trace.Flags(c.Status()), c.Cycles)
+}
+
+func (m *Monitor) stopped(stop debugger.Stop) {
+	fmt.Fprintf(m.out, "stopped: %v\n", stop)
+	m.registers()
+	m.nextDisassembly = m.cpu().PC
+	fmt.Fprintln(m.out, formatInstruction(disassembler.Disassemble(m.cpu().MemoryMapper(), m.cpu().PC)))
+}
+
+func (m *Monitor) memory(args []string) error {
+	start, end, err := m.addressRange(args, m.nextMemory, 0x7F)
+	if err != nil {
+		return err
+	}
+	for line := int(start); line <= int(end); line += 16 {
+		var hex, text strings.Builder
+		for i := line; i < line+16 && i <= int(end); i++ {
+			b := m.read(uint16(i))
+			fmt.Fprintf(&hex, "%02X ", b)
+			if b >= 0x20 && b < 0x7F {
+				text.WriteByte(b)
+			} else {
+				text.WriteByte('.')
+			}
+		}
+		fmt.Fprintf(m.out, "%04X  %-48s %s\n", line, hex.String(), text.String())
+	}
+	m.nextMemory = end + 1
+	return nil
+}
+
+func (m *Monitor) modify(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: > addr byte...")
+	}
+	address, err := parseHex(args[0], 0xFFFF)
+	if err != nil {
+		return err
+	}
+	values, err := parseBytes(args[1:])
+	if err != nil {
+		return err
+	}
+	for i, v := range values {
+		m.write(uint16(address)+uint16(i), v)
+	}
+	return nil
+}
+
+func (m *Monitor) setRegisters(args []string) error {
+	c := m.cpu()
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("expected reg=value, got %q", arg)
+		}
+		name := strings.ToUpper(parts[0])
+		limit := 0xFF
+		if name == "PC" {
+			limit = 0xFFFF
+		}
+		value, err := parseHex(parts[1], limit)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "A":
+			c.A = byte(value)
+		case "X":
+			c.X = byte(value)
+		case "Y":
+			c.Y = byte(value)
+		case "S", "SP":
+			c.S = byte(value)
+		case "PC":
+			c.PC = uint16(value)
+		case "P":
+			c.SetStatus(byte(value))
+		case "C", "Z", "I", "D", "V", "N":
+			if value > 1 {
+				return fmt.Errorf("flag %s can only be 0 or 1", name)
+			}
+			m.setFlag(name, byte(value))
+		default:
+			return fmt.Errorf("unknown register %q", parts[0])
+		}
+	}
+	m.registers()
+	return nil
+}
+
+func (m *Monitor) setFlag(name string, value byte) {
+	c := m.cpu()
+	switch name {
+	case "C":
+		c.C = value
+	case "Z":
+		c.Z = value
+	case "I":
+		c.I = value
+	case "D":
+		c.D = value
+	case "V":
+		c.V = value
+	case "N":
+		c.N = value
+	}
+}
+
+func (m *Monitor) disassemble(args []string) error {
+	start, end, err := m.addressRange(args, m.nextDisassembly, 0x1F)
+	if err != nil {
+		return err
+	}
+	address := int(start)
+	for address <= int(end) {
+		instruction := disassembler.Disassemble(m.cpu().MemoryMapper(), uint16(address))
+		fmt.Fprintln(m.out, formatInstruction(instruction))
+		address += len(instruction.Bytes)
+	}
+	m.nextDisassembly = uint16(address)
+	return nil
+}
+
+func formatInstruction(i disassembler.Instruction) string {
+	return fmt.Sprintf("%04X  %-8s  %s", i.Address, i.HexBytes(), i.String())
+}
+
+func (m *Monitor) assemble(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return fmt.Errorf("usage: a addr instruction")
+	}
+	address, err := parseHex(fields[1], 0xFFFF)
+	if err != nil {
+		return err
+	}
+	instruction := strings.Join(fields[2:], " ")
+	bytes, err := asm.AssembleLine(instruction, uint16(address))
+	if err != nil {
+		return err
+	}
+	for i, b := range bytes {
+		m.write(uint16(address)+uint16(i), b)
+	}
+	fmt.Fprintln(m.out, formatInstruction(disassembler.Disassemble(m.cpu().MemoryMapper(), uint16(address))))
+	return nil
+}
+
+func (m *Monitor) breakpoint(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("usage: b addr [if condition]")
+	}
+	address, err := parseHex(fields[1], 0xFFFF)
+	if err != nil {
+		return err
+	}
+	var breakpoint *debugger.Breakpoint
+	if len(fields) > 2 {
+		if strings.ToLower(fields[2]) != "if" || len(fields) < 4 {
+			return fmt.Errorf("usage: b addr [if condition]")
+		}
+		breakpoint, err = m.debugger.AddConditionalBreakpoint(uint16(address), strings.Join(fields[3:], " "))
+		if err != nil {
+			return err
+		}
+	} else {
+		breakpoint = m.debugger.AddBreakpoint(uint16(address))
+	}
+	fmt.Fprintf(m.out, "breakpoint %d at $%04X\n", breakpoint.ID, breakpoint.Address)
+	return nil
+}
+
+func (m *Monitor) listBreakpoints() {
+	for _, b := range m.debugger.Breakpoints() {
+		fmt.Fprintf(m.out, "%3d  $%04X  hits:%d", b.ID, b.Address, b.Hits)
+		if b.Expression != "" {
+			fmt.Fprintf(m.out, "  if %s", b.Expression)
+		}
+		fmt.Fprintln(m.out)
+	}
+}
+
+func (m *Monitor) deleteBreakpoint(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: bd id")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	if !m.debugger.RemoveBreakpoint(id) {
+		return fmt.Errorf("no breakpoint %d", id)
+	}
+	return nil
+}
+
+func (m *Monitor) step(args []string) error {
+	count := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("usage: z [count], count is at least 1")
+		}
+		count = n
+	}
+	var stop debugger.Stop
+	for i := 0; i < count; i++ {
+		stop = m.debugger.StepInto()
+	}
+	m.stopped(stop)
+	return nil
+}
+
+func (m *Monitor) run(args []string) error {
+	if len(args) > 0 {
+		address, err := parseHex(args[0], 0xFFFF)
+		if err != nil {
+			return err
+		}
+		m.cpu().PC = uint16(address)
+	}
+	m.stopped(m.debugger.Continue(RunBudget))
+	return nil
+}
+
+func (m *Monitor) runUntil(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: u addr")
+	}
+	address, err := parseHex(args[0], 0xFFFF)
+	if err != nil {
+		return err
+	}
+	m.stopped(m.debugger.RunUntil(uint16(address), RunBudget))
+	return nil
+}
+
+func (m *Monitor) load(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: l file addr")
+	}
+	address, err := parseHex(args[1], 0xFFFF)
+	if err != nil {
+		return err
+	}
+	bytes, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	for i, b := range bytes {
+		m.write(uint16(address+i), b)
+	}
+	fmt.Fprintf(m.out, "loaded $%04X bytes to $%04X-$%04X\n", len(bytes), address, uint16(address+len(bytes)-1))
+	return nil
+}
+
+func (m *Monitor) save(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: s file start end")
+	}
+	start, end, err := m.addressRange(args[1:], 0, 0)
+	if err != nil {
+		return err
+	}
+	bytes := make([]byte, 0, int(end)-int(start)+1)
+	for a := int(start); a <= int(end); a++ {
+		bytes = append(bytes, m.read(uint16(a)))
+	}
+	return ioutil.WriteFile(args[0], bytes, 0644)
+}
+
+func (m *Monitor) saveState(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ss file")
+	}
+	return savestate.SaveFile(m.cpu(), args[0])
+}
+
+func (m *Monitor) loadState(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sl file")
+	}
+	if err := savestate.LoadFile(m.cpu(), args[0]); err != nil {
+		return err
+	}
+	if m.debugger.History() != nil {
+		m.debugger.History().Clear()
+	}
+	m.registers()
+	return nil
+}
+
+func (m *Monitor) fill(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: f start end byte...")
+	}
+	start, end, err := m.addressRange(args[:2], 0, 0)
+	if err != nil {
+		return err
+	}
+	pattern, err := parseBytes(args[2:])
+	if err != nil {
+		return err
+	}
+	for a := int(start); a <= int(end); a++ {
+		m.write(uint16(a), pattern[(a-int(start))%len(pattern)])
+	}
+	return nil
+}
+
+func (m *Monitor) compare(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: c start end dest")
+	}
+	start, end, err := m.addressRange(args[:2], 0, 0)
+	if err != nil {
+		return err
+	}
+	destination, err := parseHex(args[2], 0xFFFF)
+	if err != nil {
+		return err
+	}
+	differences := 0
+	for a := int(start); a <= int(end); a++ {
+		other := uint16(destination + a - int(start))
+		if m.read(uint16(a)) != m.read(other) {
+			fmt.Fprintf(m.out, "$%04X:%02X  $%04X:%02X\n", a, m.read(uint16(a)), other, m.read(other))
+			differences++
+		}
+	}
+	fmt.Fprintf(m.out, "%d differences\n", differences)
+	return nil
+}
+
+func (m *Monitor) hunt(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: h start end byte...")
+	}
+	start, end, err := m.addressRange(args[:2], 0, 0)
+	if err != nil {
+		return err
+	}
+	pattern, err := parseBytes(args[2:])
+	if err != nil {
+		return err
+	}
+	var found []string
+	for a := int(start); a+len(pattern)-1 <= int(end); a++ {
+		match := true
+		for i, b := range pattern {
+			if m.read(uint16(a+i)) != b {
+				match = false
+				break
+			}
+		}
+		if match {
+			found = append(found, fmt.Sprintf("%04X", a))
+		}
+	}
+	fmt.Fprintln(m.out, strings.Join(found, " "))
+	return nil
+}
+
+// addressRange parses optional start and end arguments, end defaults to start+length
+func (m *Monitor) addressRange(args []string, defaultStart uint16, length int) (uint16, uint16, error) {
+	start := int(defaultStart)
+	var err error
+	if len(args) > 0 {
+		start, err = parseHex(args[0], 0xFFFF)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	end := start + length
+	if len(args) > 1 {
+		end, err = parseHex(args[1], 0xFFFF)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if end > 0xFFFF {
+		end = 0xFFFF
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("end $%04X is before start $%04X", end, start)
+	}
+	return uint16(start), uint16(end), nil
+}
+
+func parseHex(s string, limit int) (int, error) {
+	value, err := number.ParseBase(s, 16)
+	if err != nil || value < 0 || value > limit {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return int(value), nil
+}
+
+func parseBytes(args []string) ([]byte, error) {
+	result := make([]byte, 0, len(args))
+	for _, arg := range args {
+		value, err := parseHex(arg, 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, byte(value))
+	}
+	return result, nil
+}
@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/debugger"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor_session(t *testing.T) {
+	mem := &memory.DummyMemoryMapper{}
+	mem.Mem[0xFFFD] = 0x04
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+	out := &bytes.Buffer{}
+
+	session := strings.Join([]string{
+		"a 0400 LDA #$42",
+		"a 0402 STA $0300",
+		"a 0405 JMP $0405",
+		"b 0405",
+		"g",
+		"m 0300 0300",
+		"f 0310 0317 01 02",
+		"h 0300 03ff 02 01",
+		"r x=7 c=1",
+		"x",
+	}, "\n")
+	require.NoError(t, New(debugger.New(&c), out).Run(strings.NewReader(session)))
+
+	output := out.String()
+	assert.Contains(t, output, "0402  8D 00 03  STA $0300")
+	assert.Contains(t, output, "stopped: breakpoint 1 at $0405")
+	assert.Contains(t, output, "0300  42 ")
+	assert.Contains(t, output, "0311 0313 0315\n")
+	assert.Equal(t, byte(7), c.X)
+	assert.Equal(t, byte(1), c.C)
+}
+
+func TestMonitor_stepCount(t *testing.T) {
+	mem := &memory.DummyMemoryMapper{}
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+	out := &bytes.Buffer{}
+
+	require.NoError(t, New(debugger.New(&c), out).Run(strings.NewReader("z 0\nz -1\nx")))
+
+	assert.Equal(t, 2, strings.Count(out.String(), "error: usage: z [count]"))
+	assert.Equal(t, uint64(0), c.Cycles)
+}
@@ -0,0 +1,49 @@
+// Package number parses the number notations used across the emulator: $hex, 0xhex, %binary and plain digits
+package number
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse parses $FF (hex), 0xFF (hex), %1010 (binary) and decimal numbers
+func Parse(s string) (int, error) {
+	return ParseBase(s, 10)
+}
+
+// ParseBase is Parse with plain digits read in the given base, the monitor takes them as hex
+func ParseBase(s string, base int) (int, error) {
+	s = strings.TrimSpace(s)
+	digits := s
+	switch {
+	case strings.HasPrefix(s, "$"):
+		digits, base = s[1:], 16
+	case strings.HasPrefix(s, "%"):
+		digits, base = s[1:], 2
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		digits, base = s[2:], 16
+	}
+	n, err := strconv.ParseInt(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return int(n), nil
+}
+
+// ParseAddress parses a number that has to fit in 16 bits
+func ParseAddress(s string) (uint16, error) {
+	return ParseAddressBase(s, 10)
+}
+
+// ParseAddressBase is ParseAddress with plain digits read in the given base
+func ParseAddressBase(s string, base int) (uint16, error) {
+	n, err := ParseBase(s, base)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > 0xFFFF {
+		return 0, fmt.Errorf("address %s out of range", strings.TrimSpace(s))
+	}
+	return uint16(n), nil
+}
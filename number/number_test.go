@@ -0,0 +1,38 @@
+package number
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for s, expected := range map[string]int{"$FF": 255, "0x10": 16, "0XfF": 255, "%101": 5, "42": 42, " $10 ": 16, "-3": -3, "010": 10} {
+		n, err := Parse(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, n, s)
+	}
+	for _, s := range []string{"", "$", "FF", "%12", "0x", "1.5"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseBase(t *testing.T) {
+	n, err := ParseBase("FF", 16)
+	assert.NoError(t, err)
+	assert.Equal(t, 255, n)
+	n, err = ParseBase("%11", 16)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n, "prefixes override the base")
+}
+
+func TestParseAddress(t *testing.T) {
+	a, err := ParseAddress("$C000")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0xC000), a)
+	_, err = ParseAddress("$10000")
+	assert.EqualError(t, err, "address $10000 out of range")
+	_, err = ParseAddressBase("-1", 16)
+	assert.Error(t, err)
+}
@@ -249,6 +249,29 @@ var mapping = map[byte]OpcodeSpec{
 	0x70: {Operation: BVS, AccessMode: addressing.Relative, Cycles: 2},
 }
 
+var names = [...]string{
+	"ORA", "AND", "EOR", "ADC", "STA", "LDA", "CMP", "SBC", "ASL", "ROL", "LSR", "ROR",
+	"STX", "LDX", "DEC", "INC", "BIT", "JMP", "STY", "LDY", "CPY", "CPX",
+	"BRK", "JSR", "RTI", "RTS", "PHP", "PLP", "PHA", "PLA", "DEY", "TAY", "INY", "INX",
+	"CLC", "SEC", "CLI", "SEI", "TYA", "CLV", "CLD", "SED", "TXA", "TXS", "TAX", "TSX", "DEX", "NOP",
+	"BCC", "BCS", "BEQ", "BMI", "BNE", "BPL", "BVC", "BVS",
+}
+
+// String returns the assembler mnemonic of the operation, e.g. "LDA"
+func (o Operation) String() string {
+	if o < 0 || int(o) >= len(names) {
+		return "???"
+	}
+	return names[o]
+}
+
 func Lookup(opcode byte) OpcodeSpec {
 	return mapping[opcode]
 }
+
+// Exists tells whether the opcode is a documented 6502 instruction.
+// Lookup returns a zero spec (ORA zero page) for the ones that aren't.
+func Exists(opcode byte) bool {
+	_, ok := mapping[opcode]
+	return ok
+}
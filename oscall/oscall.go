@@ -0,0 +1,212 @@
+// Package oscall runs programs that use operating system routines without the ROMs that hold them:
+// when the cpu reaches the address of a routine a Go handler performs the service and the cpu returns
+// to the caller as if by RTS.
+package oscall
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+)
+
+// rtsCycles is what the return to the caller costs
+const rtsCycles = 6
+
+// Handler performs a service with the registers and memory of the cpu. An error stops the program:
+// it is kept by the Calls and the cpu returns to the caller all the same.
+type Handler func(c *cpu.Cpu) error
+
+// Calls intercepts the routines it has handlers for, it is a cpu.BoundaryListener
+type Calls struct {
+	handlers map[uint16]Handler
+	err      error
+}
+
+func New() *Calls {
+	return &Calls{handlers: map[uint16]Handler{}}
+}
+
+// Set installs the handler for the routine at address
+func (calls *Calls) Set(address uint16, handler Handler) {
+	calls.handlers[address] = handler
+}
+
+// Attach starts intercepting calls made by the cpu
+func (calls *Calls) Attach(c *cpu.Cpu) {
+	c.AddBoundaryListener(calls)
+}
+
+// Err returns the first error a handler returned, io.EOF when a program asked for more input than there was
+func (calls *Calls) Err() error {
+	return calls.err
+}
+
+// Boundary implements cpu.BoundaryListener
+func (calls *Calls) Boundary(c *cpu.Cpu) {
+	handler, ok := calls.handlers[c.PC]
+	if !ok {
+		return
+	}
+	if err := handler(c); err != nil && calls.err == nil {
+		calls.err = err
+	}
+	Return(c)
+}
+
+// Return returns from a subroutine like RTS
+func Return(c *cpu.Cpu) {
+	m := c.MemoryMapper()
+	low := m.Read(0x0100 | uint16(c.S+1))
+	high := m.Read(0x0100 | uint16(c.S+2))
+	c.S += 2
+	c.PC = (uint16(high)<<8 | uint16(low)) + 1
+	c.Cycles += rtsCycles
+}
+
+// Console is the input and output of the built-in services
+type Console struct {
+	In  io.ByteReader
+	Out io.Writer
+}
+
+// read reads a character, newlines are returned as CR
+func (console Console) read() (byte, error) {
+	b, err := console.In.ReadByte()
+	if err != nil {
+		return '\r', err
+	}
+	if b == '\n' {
+		b = '\r'
+	}
+	return b, nil
+}
+
+func (console Console) write(s string) error {
+	_, err := io.WriteString(console.Out, s)
+	return err
+}
+
+// systems are the built-in services by system name
+var systems = map[string]func(calls *Calls, console Console){
+	"c64":    commodore,
+	"bbc":    acorn,
+	"apple2": apple,
+}
+
+// Systems lists the systems whose routines have built-in services
+func Systems() []string {
+	var names []string
+	for name := range systems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForSystem creates the calls serving the character I/O routines of a system:
+//
+//	c64     KERNAL CHROUT $FFD2, CHRIN $FFCF, GETIN $FFE4 and STOP $FFE1
+//	bbc     Acorn MOS OSWRCH $FFEE, OSASCI $FFE3, OSNEWL $FFE7 and OSRDCH $FFE0
+//	apple2  Apple II monitor COUT $FDED, CROUT $FD8E, PRBYTE $FDDA, RDKEY $FD0C and KEYIN $FD1B
+//
+// Output goes to the console as ASCII with host newlines. Input is read when the program asks for it,
+// waiting for the console, and host newlines are passed as CR.
+func ForSystem(name string, console Console) (*Calls, error) {
+	install, ok := systems[name]
+	if !ok {
+		return nil, fmt.Errorf("no built-in services for %q, known systems: %s", name, strings.Join(Systems(), ", "))
+	}
+	calls := New()
+	install(calls, console)
+	return calls, nil
+}
+
+func commodore(calls *Calls, console Console) {
+	calls.Set(0xFFD2, func(c *cpu.Cpu) error { // CHROUT
+		c.C = 0
+		switch a := c.A; {
+		case a == 0x0D:
+			return console.write("\n")
+		case a >= 0x20 && a < 0x60:
+			return console.write(string(rune(a)))
+		case a >= 0xC1 && a <= 0xDA:
+			// shifted letters, upper case in the lower case character set
+			return console.write(string(rune(a - 0x80)))
+		}
+		return nil
+	})
+	input := func(c *cpu.Cpu) error {
+		b, err := console.read()
+		if b >= 'a' && b <= 'z' {
+			b -= 'a' - 'A'
+		}
+		c.A, c.C = b, 0
+		return err
+	}
+	calls.Set(0xFFCF, input) // CHRIN
+	calls.Set(0xFFE4, input) // GETIN
+	// STOP, the key is never pressed
+	calls.Set(0xFFE1, func(c *cpu.Cpu) error {
+		c.Z = 0
+		return nil
+	})
+}
+
+func acorn(calls *Calls, console Console) {
+	calls.Set(0xFFEE, func(c *cpu.Cpu) error { // OSWRCH
+		return console.write(string([]byte{c.A}))
+	})
+	calls.Set(0xFFE3, func(c *cpu.Cpu) error { // OSASCI
+		if c.A == 0x0D {
+			return console.write("\n")
+		}
+		return console.write(string([]byte{c.A}))
+	})
+	calls.Set(0xFFE7, func(c *cpu.Cpu) error { // OSNEWL
+		return console.write("\n")
+	})
+	calls.Set(0xFFE0, func(c *cpu.Cpu) error { // OSRDCH
+		b, err := console.read()
+		c.A, c.C = b, 0
+		if err != nil {
+			// the escape condition
+			c.A, c.C = 0x1B, 1
+		}
+		return err
+	})
+}
+
+func apple(calls *Calls, console Console) {
+	cout := func(a byte) error {
+		a &= 0x7F
+		if a == 0x0D {
+			return console.write("\n")
+		}
+		if a < 0x20 {
+			return nil
+		}
+		return console.write(string(rune(a)))
+	}
+	calls.Set(0xFDED, func(c *cpu.Cpu) error { // COUT
+		return cout(c.A)
+	})
+	calls.Set(0xFD8E, func(c *cpu.Cpu) error { // CROUT
+		return console.write("\n")
+	})
+	calls.Set(0xFDDA, func(c *cpu.Cpu) error { // PRBYTE
+		return console.write(fmt.Sprintf("%02X", c.A))
+	})
+	rdkey := func(c *cpu.Cpu) error {
+		b, err := console.read()
+		if b >= 'a' && b <= 'z' {
+			b -= 'a' - 'A'
+		}
+		c.A = b | 0x80
+		return err
+	}
+	calls.Set(0xFD0C, rdkey) // RDKEY
+	calls.Set(0xFD1B, rdkey) // KEYIN
+}
@@ -0,0 +1,125 @@
+package oscall
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/asm"
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run assembles a program at $0400 and runs it until it reaches the jump to itself at done
+func run(t *testing.T, system, source, input string) (*cpu.Cpu, *Calls, string) {
+	program, err := asm.Assemble(source, 0x0400)
+	require.NoError(t, err)
+	start, binary := program.Binary()
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[start:], binary)
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+	c.PC = 0x0400
+
+	out := &bytes.Buffer{}
+	calls, err := ForSystem(system, Console{In: bufio.NewReader(strings.NewReader(input)), Out: out})
+	require.NoError(t, err)
+	calls.Attach(&c)
+	for i := 0; i < 10000; i++ {
+		pc := c.PC
+		c.ExecuteOpcode()
+		if c.PC == pc {
+			return &c, calls, out.String()
+		}
+	}
+	t.Fatal("the program did not finish")
+	return nil, nil, ""
+}
+
+func TestCommodore_echo(t *testing.T) {
+	c, calls, out := run(t, "c64", `
+CHROUT = $FFD2
+CHRIN = $FFCF
+        LDX #0
+print:  LDA text,X
+        BEQ echo
+        JSR CHROUT
+        INX
+        BNE print
+echo:   JSR CHRIN
+        JSR CHROUT
+        CMP #13
+        BNE echo
+done:   JMP done
+text:   .byte "HELLO ", $C1, 13, 0
+`, "abc\n")
+
+	assert.Equal(t, "HELLO A\nABC\n", out)
+	assert.NoError(t, calls.Err())
+	assert.Equal(t, byte(0xFF), c.S, "every call returned")
+}
+
+func TestAcorn_endOfInput(t *testing.T) {
+	c, calls, out := run(t, "bbc", `
+OSRDCH = $FFE0
+OSASCI = $FFE3
+loop:   JSR OSRDCH
+        BCS done
+        JSR OSASCI
+        JMP loop
+done:   JMP done
+`, "x\n")
+
+	assert.Equal(t, "x\n", out)
+	assert.Equal(t, io.EOF, calls.Err())
+	assert.Equal(t, byte(0x1B), c.A)
+}
+
+func TestApple_cout(t *testing.T) {
+	_, calls, out := run(t, "apple2", `
+        LDA #'H'+$80
+        JSR $FDED
+        LDA #$A5
+        JSR $FDDA
+        JSR $FD8E
+done:   JMP done
+`, "")
+
+	assert.Equal(t, "HA5\n", out)
+	assert.NoError(t, calls.Err())
+}
+
+func TestReturn(t *testing.T) {
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[0x0400:], []byte{0x20, 0x00, 0x80, 0xEA}) // JSR $8000, NOP
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+	c.PC = 0x0400
+	s := c.S
+	calls := New()
+	called := 0
+	calls.Set(0x8000, func(c *cpu.Cpu) error {
+		called++
+		return nil
+	})
+	calls.Attach(&c)
+
+	c.ExecuteOpcode()
+	cycles := c.Cycles
+	c.ExecuteOpcode()
+
+	assert.Equal(t, 1, called)
+	assert.Equal(t, uint16(0x0404), c.PC, "returned to the NOP and ran it")
+	assert.Equal(t, s, c.S)
+	assert.Equal(t, cycles+6+2, c.Cycles, "the return and the NOP")
+}
+
+func TestForSystem_unknown(t *testing.T) {
+	_, err := ForSystem("vic20", Console{})
+	assert.EqualError(t, err, `no built-in services for "vic20", known systems: apple2, bbc, c64`)
+}
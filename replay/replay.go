@@ -0,0 +1,301 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/savestate"
+)
+
+// Version of the recording format, bumped on incompatible changes
+const Version = 1
+
+type EventKind string
+
+const (
+	EventIRQ   EventKind = "irq"
+	EventNMI   EventKind = "nmi"
+	EventInput EventKind = "input" // a byte read by a device from its host input, or by a console
+)
+
+// Event is a single external input, Cycle is the cpu cycle counter when it reached the machine
+type Event struct {
+	Cycle  uint64
+	Kind   EventKind
+	Device string `json:",omitempty"` // input events only
+	Poll   uint64 `json:",omitempty"` // input events only, index of the device poll that returned the byte
+	Value  byte   `json:",omitempty"`
+}
+
+// Recording is everything needed to reproduce a run: the machine state when recording started
+// (when the memory mapper supports save states) and the external events in the order they happened
+type Recording struct {
+	Version int
+	Start   *savestate.State `json:",omitempty"`
+	Events  []Event
+}
+
+func (r *Recording) Save(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(r)
+}
+
+func (r *Recording) SaveFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func Load(reader io.Reader) (*Recording, error) {
+	var r Recording
+	if err := json.NewDecoder(reader).Decode(&r); err != nil {
+		return nil, err
+	}
+	if r.Version != Version {
+		return nil, fmt.Errorf("unsupported recording version %d, expected %d", r.Version, Version)
+	}
+	return &r, nil
+}
+
+func LoadFile(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+// Recorder logs external events against the cpu cycle counter.
+// Interrupts have to go through the recorder: pass their channel to NewRecorder instead of cpu.NewCpu,
+// or request them with Interrupt, the recorder forwards them to the cpu at instruction boundaries.
+// Device host inputs are wrapped with Input and blocking console input with Reader.
+type Recorder struct {
+	cpu        *cpu.Cpu
+	interrupts <-chan cpu.InterruptType
+	mu         sync.Mutex // guards recording, Recording may be called from another goroutine
+	recording  Recording
+}
+
+// NewRecorder starts recording, interrupts may be nil when nothing raises them
+func NewRecorder(c *cpu.Cpu, interrupts <-chan cpu.InterruptType) *Recorder {
+	r := &Recorder{cpu: c, interrupts: interrupts, recording: Recording{Version: Version}}
+	if start, err := savestate.Capture(c); err == nil {
+		r.recording.Start = start
+	}
+	c.AddBoundaryListener(r)
+	return r
+}
+
+// Boundary implements cpu.BoundaryListener
+func (r *Recorder) Boundary(c *cpu.Cpu) {
+	for {
+		select {
+		case interruptType := <-r.interrupts:
+			r.Interrupt(interruptType)
+			continue
+		default:
+		}
+		return
+	}
+}
+
+// Interrupt records an interrupt and requests it from the cpu
+func (r *Recorder) Interrupt(interruptType cpu.InterruptType) {
+	kind := EventIRQ
+	if interruptType == cpu.InterruptTypeNMI {
+		kind = EventNMI
+	}
+	r.add(Event{Cycle: r.cpu.Cycles, Kind: kind})
+	r.cpu.Interrupt(interruptType)
+}
+
+func (r *Recorder) add(e Event) {
+	r.mu.Lock()
+	r.recording.Events = append(r.recording.Events, e)
+	r.mu.Unlock()
+}
+
+// Input wraps a device's host input, every byte it delivers is recorded under the device name
+func (r *Recorder) Input(device string, input hostio.Input) hostio.Input {
+	return &recordedInput{recorder: r, device: device, input: input}
+}
+
+// Reader wraps a blocking input like the console of the oscall services, every byte read is recorded
+// under the device name
+func (r *Recorder) Reader(device string, reader io.ByteReader) io.ByteReader {
+	return &recordedReader{recorder: r, device: device, reader: reader}
+}
+
+type recordedReader struct {
+	recorder *Recorder
+	device   string
+	reader   io.ByteReader
+	reads    uint64
+}
+
+func (i *recordedReader) ReadByte() (byte, error) {
+	read := i.reads
+	i.reads++
+	b, err := i.reader.ReadByte()
+	if err == nil {
+		i.recorder.add(Event{Cycle: i.recorder.cpu.Cycles, Kind: EventInput, Device: i.device, Poll: read, Value: b})
+	}
+	return b, err
+}
+
+type recordedInput struct {
+	recorder *Recorder
+	device   string
+	input    hostio.Input
+	polls    uint64
+}
+
+func (i *recordedInput) Poll() (byte, bool) {
+	poll := i.polls
+	i.polls++
+	b, ok := i.input.Poll()
+	if ok {
+		i.recorder.add(Event{Cycle: i.recorder.cpu.Cycles, Kind: EventInput, Device: i.device, Poll: poll, Value: b})
+	}
+	return b, ok
+}
+
+// Stop detaches the recorder and returns what has been recorded
+func (r *Recorder) Stop() *Recording {
+	r.cpu.RemoveBoundaryListener(r)
+	return r.Recording()
+}
+
+// Recording returns a copy of what has been recorded so far, it is safe to call while the cpu runs
+func (r *Recorder) Recording() *Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recording := r.recording
+	recording.Events = append([]Event(nil), r.recording.Events...)
+	return &recording
+}
+
+// Player reinjects recorded events at exactly the same cycles
+type Player struct {
+	cpu        *cpu.Cpu
+	interrupts []Event
+	inputs     map[string][]Event
+	diverged   error
+}
+
+// NewPlayer restores the recorded start state, if there is one, and schedules the events
+func NewPlayer(c *cpu.Cpu, recording *Recording) (*Player, error) {
+	if recording.Start != nil {
+		if err := savestate.Restore(c, recording.Start); err != nil {
+			return nil, err
+		}
+	}
+	p := &Player{cpu: c, inputs: map[string][]Event{}}
+	for _, e := range recording.Events {
+		if e.Kind == EventInput {
+			p.inputs[e.Device] = append(p.inputs[e.Device], e)
+		} else {
+			p.interrupts = append(p.interrupts, e)
+		}
+	}
+	c.AddBoundaryListener(p)
+	return p, nil
+}
+
+// Boundary implements cpu.BoundaryListener
+func (p *Player) Boundary(c *cpu.Cpu) {
+	for len(p.interrupts) > 0 && p.interrupts[0].Cycle <= c.Cycles {
+		e := p.interrupts[0]
+		p.interrupts = p.interrupts[1:]
+		if e.Cycle != c.Cycles && p.diverged == nil {
+			p.diverged = fmt.Errorf("%s recorded at cycle %d replayed at cycle %d", e.Kind, e.Cycle, c.Cycles)
+		}
+		if e.Kind == EventNMI {
+			c.Interrupt(cpu.InterruptTypeNMI)
+		} else {
+			c.Interrupt(cpu.InterruptTypeIRQ)
+		}
+	}
+}
+
+// Interrupt drops an interrupt requested while replaying, the recorded ones are requested instead
+func (p *Player) Interrupt(interruptType cpu.InterruptType) {}
+
+// Input returns the replayed host input of a device, it replaces the live input the device was recorded with
+func (p *Player) Input(device string, live hostio.Input) hostio.Input {
+	return &replayedInput{player: p, device: device}
+}
+
+// Reader returns the replayed input of a blocking reader, io.EOF once the recorded bytes are used up
+func (p *Player) Reader(device string) io.ByteReader {
+	return &replayedReader{replayedInput{player: p, device: device}}
+}
+
+type replayedReader struct {
+	input replayedInput
+}
+
+func (r *replayedReader) ReadByte() (byte, error) {
+	b, ok := r.input.Poll()
+	if !ok {
+		return 0, io.EOF
+	}
+	return b, nil
+}
+
+type replayedInput struct {
+	player *Player
+	device string
+	polls  uint64
+}
+
+func (i *replayedInput) Poll() (byte, bool) {
+	poll := i.polls
+	i.polls++
+	events := i.player.inputs[i.device]
+	if len(events) == 0 || events[0].Poll != poll {
+		return 0, false
+	}
+	e := events[0]
+	i.player.inputs[i.device] = events[1:]
+	if e.Cycle != i.player.cpu.Cycles && i.player.diverged == nil {
+		i.player.diverged = fmt.Errorf("input for %s recorded at cycle %d replayed at cycle %d", i.device, e.Cycle, i.player.cpu.Cycles)
+	}
+	return e.Value, true
+}
+
+// Done tells whether all recorded events have been replayed
+func (p *Player) Done() bool {
+	if len(p.interrupts) > 0 {
+		return false
+	}
+	for _, events := range p.inputs {
+		if len(events) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Err reports the first event that was not replayed at its recorded cycle, which means the run diverged
+func (p *Player) Err() error {
+	return p.diverged
+}
+
+// Stop detaches the player from the cpu
+func (p *Player) Stop() {
+	p.cpu.RemoveBoundaryListener(p)
+}
@@ -0,0 +1,128 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/hostio"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/trace"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keyboard returns the next host input byte when $D000 is read, 0 when there is none
+type keyboard struct {
+	memory.DummyMemoryMapper
+	input hostio.Input
+}
+
+func (k *keyboard) Read(address uint16) byte {
+	if address == 0xD000 {
+		b, _ := k.input.Poll()
+		return b
+	}
+	return k.DummyMemoryMapper.Read(address)
+}
+
+// 0400 CLI
+// 0401 LDA $D000
+// 0404 BEQ $0401
+// 0406 STA $0200
+// 0409 JMP $0401
+// 0500 INC $10, RTI (IRQ handler)
+func newMachine() (*cpu.Cpu, *keyboard) {
+	k := &keyboard{}
+	copy(k.Mem[0x0400:], []byte{0x58, 0xAD, 0x00, 0xD0, 0xF0, 0xFB, 0x8D, 0x00, 0x02, 0x4C, 0x01, 0x04})
+	copy(k.Mem[0x0500:], []byte{0xE6, 0x10, 0x40})
+	k.Mem[0xFFFD] = 0x04
+	k.Mem[0xFFFF] = 0x05
+	c := cpu.NewCpu(nil, k)
+	c.Reset()
+	return &c, k
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	c, k := newMachine()
+	interrupts := make(chan cpu.InterruptType, 1)
+	recorder := NewRecorder(c, interrupts)
+	k.input = recorder.Input("keyboard", hostio.NewBytesInput([]byte("AB")))
+	recorded := &bytes.Buffer{}
+	c.AddTracer(trace.New(recorded, trace.FormatNestest))
+
+	c.Run(57)
+	interrupts <- cpu.InterruptTypeIRQ
+	c.Run(100)
+	interrupts <- cpu.InterruptTypeIRQ
+	c.Run(100)
+	recording := recorder.Stop()
+	end := c.Cycles
+
+	assert.Equal(t, byte(2), k.Mem[0x10])
+	assert.Equal(t, byte('B'), k.Mem[0x0200])
+	require.Len(t, recording.Events, 4)
+
+	saved := &bytes.Buffer{}
+	require.NoError(t, recording.Save(saved))
+	loaded, err := Load(saved)
+	require.NoError(t, err)
+
+	c, k = newMachine()
+	player, err := NewPlayer(c, loaded)
+	require.NoError(t, err)
+	k.input = player.Input("keyboard", nil)
+	replayed := &bytes.Buffer{}
+	c.AddTracer(trace.New(replayed, trace.FormatNestest))
+
+	for c.Cycles < end {
+		c.ExecuteOpcode()
+	}
+
+	assert.True(t, player.Done())
+	assert.NoError(t, player.Err())
+	assert.Equal(t, recorded.String(), replayed.String())
+}
+
+func TestRecordAndReplay_reader(t *testing.T) {
+	c, k := newMachine()
+	k.input = hostio.NewBytesInput(nil)
+	recorder := NewRecorder(c, nil)
+	console := recorder.Reader("console", bufio.NewReader(strings.NewReader("hi")))
+	c.Run(10)
+	b, err := console.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte('h'), b)
+	recorder.Interrupt(cpu.InterruptTypeNMI)
+	c.Run(10)
+	b, _ = console.ReadByte()
+	assert.Equal(t, byte('i'), b)
+	_, err = console.ReadByte()
+	assert.Equal(t, io.EOF, err)
+	recording := recorder.Stop()
+	require.Len(t, recording.Events, 3)
+	end := c.Registers()
+
+	c, k = newMachine()
+	k.input = hostio.NewBytesInput(nil)
+	player, err := NewPlayer(c, recording)
+	require.NoError(t, err)
+	replayed := player.Reader("console")
+	c.Run(10)
+	b, err = replayed.ReadByte()
+	require.NoError(t, err)
+	assert.Equal(t, byte('h'), b)
+	player.Interrupt(cpu.InterruptTypeIRQ) // dropped, the recorded NMI is requested instead
+	c.Run(10)
+	b, _ = replayed.ReadByte()
+	assert.Equal(t, byte('i'), b)
+	_, err = replayed.ReadByte()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, end, c.Registers())
+	assert.True(t, player.Done())
+	assert.NoError(t, player.Err())
+}
@@ -0,0 +1,107 @@
+package savestate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+)
+
+// Version of the save state format, bumped on incompatible changes
+const Version = 2
+
+// State is the whole machine: cpu registers, cycle counter, interrupts not served yet, the NMI edge
+// detector, stall cycles and the state of the memory mapper, which in turn contains the state of any
+// devices mapped into it.
+//
+// A scheduler.Scheduler is not part of it: its counter follows the cpu cycle counter and is rebased when
+// that goes back, and the events queued in it are rescheduled by the devices from their own state.
+type State struct {
+	Version           int
+	Registers         cpu.Registers
+	PendingInterrupts []cpu.InterruptType
+	NMIWasActive      bool
+	Stall             uint64
+	Memory            []byte
+}
+
+// Capture takes a snapshot of the machine, the memory mapper has to implement memory.Stateful
+func Capture(c *cpu.Cpu) (*State, error) {
+	stateful, ok := c.MemoryMapper().(memory.Stateful)
+	if !ok {
+		return nil, fmt.Errorf("memory mapper %T does not support save states", c.MemoryMapper())
+	}
+	mem, err := stateful.SaveState()
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		Version:           Version,
+		Registers:         c.Registers(),
+		PendingInterrupts: c.PendingInterrupts(),
+		NMIWasActive:      c.NMIWasActive(),
+		Stall:             c.PendingStall(),
+		Memory:            mem,
+	}, nil
+}
+
+// Restore puts the machine back into the captured state
+func Restore(c *cpu.Cpu, state *State) error {
+	if state.Version != Version {
+		return fmt.Errorf("unsupported save state version %d, expected %d", state.Version, Version)
+	}
+	stateful, ok := c.MemoryMapper().(memory.Stateful)
+	if !ok {
+		return fmt.Errorf("memory mapper %T does not support save states", c.MemoryMapper())
+	}
+	if err := stateful.LoadState(state.Memory); err != nil {
+		return err
+	}
+	c.SetRegisters(state.Registers)
+	c.SetPendingInterrupts(state.PendingInterrupts)
+	c.SetNMIWasActive(state.NMIWasActive)
+	c.SetPendingStall(state.Stall)
+	return nil
+}
+
+// Save writes the machine state as JSON
+func Save(c *cpu.Cpu, writer io.Writer) error {
+	state, err := Capture(c)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(writer).Encode(state)
+}
+
+// Load reads a JSON state written by Save and restores it
+func Load(c *cpu.Cpu, reader io.Reader) error {
+	var state State
+	if err := json.NewDecoder(reader).Decode(&state); err != nil {
+		return err
+	}
+	return Restore(c, &state)
+}
+
+func SaveFile(c *cpu.Cpu, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Save(c, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func LoadFile(c *cpu.Cpu, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return Load(c, file)
+}
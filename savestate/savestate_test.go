@@ -0,0 +1,102 @@
+package savestate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/device/via6522"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+	"github.com/slawomirbiernacki/mos6502-emulator/scheduler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveLoad(t *testing.T) {
+	interrupts := make(chan cpu.InterruptType, 1)
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[0x0400:], []byte{0xA9, 0x42, 0xE6, 0x10, 0x4C, 0x02, 0x04}) // LDA #$42, loop: INC $10, JMP loop
+	mem.Mem[0xFFFD] = 0x04
+	mem.Mem[0xFFFA] = 0x02 // NMI handler is the loop as well
+	mem.Mem[0xFFFB] = 0x04
+	c := cpu.NewCpu(interrupts, mem)
+	c.Reset()
+	c.Run(100)
+	interrupts <- cpu.InterruptTypeNMI
+
+	saved := &bytes.Buffer{}
+	require.NoError(t, Save(&c, saved))
+	expected := c.Registers()
+	counter := mem.Mem[0x10]
+
+	c.Run(100)
+	assert.NotEqual(t, counter, mem.Mem[0x10])
+
+	require.NoError(t, Load(&c, saved))
+	assert.Equal(t, expected, c.Registers())
+	assert.Equal(t, counter, mem.Mem[0x10])
+	assert.Equal(t, []cpu.InterruptType{cpu.InterruptTypeNMI}, c.PendingInterrupts())
+}
+
+func TestSaveLoad_lines(t *testing.T) {
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[0x0400:], []byte{0x4C, 0x00, 0x04}) // JMP $0400
+	mem.Mem[0xFFFA], mem.Mem[0xFFFB] = 0x00, 0x04
+	c := cpu.NewCpu(nil, mem)
+	c.PC = 0x0400
+	nmi := c.NMILine().Pin()
+	nmi.Set(true)
+	c.ExecuteOpcode() // takes the NMI, the line stays active
+	c.Stall(4)
+
+	saved := &bytes.Buffer{}
+	require.NoError(t, Save(&c, saved))
+	c.SetNMIWasActive(false)
+	c.SetPendingStall(0)
+
+	require.NoError(t, Load(&c, saved))
+	assert.True(t, c.NMIWasActive())
+	assert.Equal(t, uint64(4), c.PendingStall())
+	cycles := c.Cycles
+	c.ExecuteOpcode()
+	assert.Equal(t, cycles+4+3, c.Cycles, "the stall and the JMP, no second NMI on the held line")
+}
+
+func TestSaveLoad_timer(t *testing.T) {
+	ram := memory.NewRAM(0x6000)
+	copy(ram.Bytes()[0x0400:], []byte{0x4C, 0x00, 0x04}) // JMP $0400
+	via := via6522.New(nil)
+	bus := memory.NewBus()
+	require.NoError(t, bus.Map("ram", 0x0000, 0x5FFF, ram))
+	require.NoError(t, bus.Map("via", 0x6000, 0x600F, via))
+	c := cpu.NewCpu(nil, bus)
+	c.PC = 0x0400
+	s := scheduler.New(&c)
+	s.AddTicker(via)
+	bus.Write(0x6004, 0xFF)
+	bus.Write(0x6005, 0xFF) // start T1 at $FFFF
+	c.Run(100)
+	s.Sync()
+
+	saved := &bytes.Buffer{}
+	require.NoError(t, Save(&c, saved))
+	cycles := c.Cycles
+	counter := timer(via)
+	c.Run(1000)
+
+	require.NoError(t, Load(&c, saved))
+	c.Run(30)
+	s.Sync()
+	assert.Equal(t, counter-uint16(c.Cycles-cycles), timer(via), "the VIA counts the cycles run after the load")
+}
+
+func timer(via *via6522.VIA) uint16 {
+	return uint16(via.Peek(via6522.RegT1CH))<<8 | uint16(via.Peek(via6522.RegT1CL))
+}
+
+func TestLoad_version(t *testing.T) {
+	c := cpu.NewCpu(nil, &memory.DummyMemoryMapper{})
+	err := Load(&c, bytes.NewBufferString(`{"Version": 99}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"container/heap"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+)
+
+// Ticker is a device advanced one cpu cycle at a time
+type Ticker interface {
+	Tick()
+}
+
+// Scheduler keeps devices in lock-step with the cpu. It owns the global cycle counter: the number of
+// cycles devices have been advanced by. At every instruction boundary it catches up with the cycles
+// the cpu has executed, ticking every Ticker once per cycle and firing timed events at their cycle.
+// An interrupt raised by a device or an event is therefore seen at the boundary right after it happens.
+type Scheduler struct {
+	cpu     *cpu.Cpu
+	cycle   uint64
+	tickers []Ticker
+	events  eventQueue
+	seq     uint64
+}
+
+// Event is a callback scheduled for a cycle
+type Event struct {
+	At        uint64
+	f         func()
+	seq       uint64
+	cancelled bool
+}
+
+// Cancel stops the event from firing, it is harmless for events that have fired already
+func (e *Event) Cancel() {
+	e.cancelled = true
+}
+
+// New creates a scheduler and attaches it to the cpu, the global counter starts at the cpu cycle counter
+func New(c *cpu.Cpu) *Scheduler {
+	s := &Scheduler{cpu: c, cycle: c.Cycles}
+	c.AddBoundaryListener(s)
+	return s
+}
+
+// Detach stops following the cpu
+func (s *Scheduler) Detach() {
+	s.cpu.RemoveBoundaryListener(s)
+}
+
+// Cycle returns the global cycle counter
+func (s *Scheduler) Cycle() uint64 {
+	return s.cycle
+}
+
+func (s *Scheduler) AddTicker(t Ticker) {
+	s.tickers = append(s.tickers, t)
+}
+
+func (s *Scheduler) RemoveTicker(t Ticker) {
+	for i, existing := range s.tickers {
+		if existing == t {
+			s.tickers = append(s.tickers[:i], s.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Schedule fires f once the global counter reaches the cycle, events for past cycles fire at the next catch up.
+// Events for the same cycle fire in the order they were scheduled.
+func (s *Scheduler) Schedule(at uint64, f func()) *Event {
+	e := &Event{At: at, f: f, seq: s.seq}
+	s.seq++
+	heap.Push(&s.events, e)
+	return e
+}
+
+// After fires f the given number of cycles from now
+func (s *Scheduler) After(cycles uint64, f func()) *Event {
+	return s.Schedule(s.cycle+cycles, f)
+}
+
+// Boundary implements cpu.BoundaryListener
+func (s *Scheduler) Boundary(c *cpu.Cpu) {
+	s.Sync()
+}
+
+// Sync advances devices to the cpu cycle counter. It happens at every instruction boundary,
+// call it to bring devices up to date after the last instruction of a run.
+// When the cpu counter went back, e.g. a save state was restored, the scheduler is rebased to it.
+func (s *Scheduler) Sync() {
+	target := s.cpu.Cycles
+	if target < s.cycle {
+		s.Rebase(target)
+	}
+	if len(s.tickers) == 0 {
+		// nothing to tick, jump from event to event
+		for len(s.events) > 0 && s.events[0].At <= target {
+			if s.events[0].At > s.cycle {
+				s.cycle = s.events[0].At
+			}
+			s.fire()
+		}
+		s.cycle = target
+		return
+	}
+	for s.cycle < target {
+		s.cycle++
+		for _, t := range s.tickers {
+			t.Tick()
+		}
+		s.fire()
+	}
+	s.fire()
+}
+
+// Rebase moves the global counter to the cycle without ticking devices or firing events. Queued events
+// keep their distance from the counter, events that were due already stay due.
+func (s *Scheduler) Rebase(cycle uint64) {
+	for _, e := range s.events {
+		if e.At < s.cycle {
+			e.At = cycle
+		} else {
+			e.At = e.At - s.cycle + cycle
+		}
+	}
+	heap.Init(&s.events)
+	s.cycle = cycle
+}
+
+// fire runs the events due at the current cycle, including ones they schedule for it
+func (s *Scheduler) fire() {
+	for len(s.events) > 0 && s.events[0].At <= s.cycle {
+		e := heap.Pop(&s.events).(*Event)
+		if !e.cancelled {
+			e.f()
+		}
+	}
+}
+
+type eventQueue []*Event
+
+func (q eventQueue) Len() int {
+	return len(q)
+}
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].At != q[j].At {
+		return q[i].At < q[j].At
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q eventQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *eventQueue) Push(x interface{}) {
+	*q = append(*q, x.(*Event))
+}
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
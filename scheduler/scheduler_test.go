@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type counter struct {
+	ticks uint64
+}
+
+func (c *counter) Tick() {
+	c.ticks++
+}
+
+// newCpu runs NOPs from $0400 with the IRQ handler at $0500
+func newCpu() *cpu.Cpu {
+	m := &memory.DummyMemoryMapper{}
+	for a := 0x0400; a < 0x0600; a++ {
+		m.Mem[a] = 0xEA
+	}
+	m.Mem[0xFFFE], m.Mem[0xFFFF] = 0x00, 0x05
+	c := cpu.NewCpu(nil, m)
+	c.PC = 0x0400
+	return &c
+}
+
+func TestScheduler_ticks(t *testing.T) {
+	c := newCpu()
+	s := New(c)
+	device := &counter{}
+	s.AddTicker(device)
+
+	c.Run(100)
+	s.Sync()
+	assert.Equal(t, c.Cycles, s.Cycle())
+	assert.Equal(t, c.Cycles, device.ticks)
+
+	s.RemoveTicker(device)
+	c.Run(10)
+	s.Sync()
+	assert.Equal(t, uint64(100), device.ticks)
+}
+
+func TestScheduler_events(t *testing.T) {
+	for _, ticking := range []bool{false, true} {
+		c := newCpu()
+		s := New(c)
+		if ticking {
+			s.AddTicker(&counter{})
+		}
+		var fired []uint64
+		record := func() { fired = append(fired, s.Cycle()) }
+		s.Schedule(7, record)
+		s.Schedule(5, func() {
+			record()
+			s.After(0, record) // same cycle
+			s.After(10, record)
+		})
+		s.Schedule(9, record).Cancel()
+
+		c.Run(20)
+		s.Sync()
+		assert.Equal(t, []uint64{5, 5, 7, 15}, fired, "ticking %v", ticking)
+	}
+}
+
+func TestScheduler_interrupt(t *testing.T) {
+	c := newCpu()
+	c.I = 0
+	s := New(c)
+	irq := c.IRQLine().Pin()
+	s.Schedule(5, func() { irq.Set(true) })
+
+	c.ExecuteOpcode() // 2 cycles
+	c.ExecuteOpcode()
+	c.ExecuteOpcode()
+	assert.Equal(t, uint16(0x0403), c.PC)
+	c.ExecuteOpcode() // the event fires at the boundary after cycle 6, the interrupt is taken there
+	assert.Equal(t, uint16(0x0501), c.PC)
+}
+
+func TestScheduler_rewind(t *testing.T) {
+	c := newCpu()
+	s := New(c)
+	device := &counter{}
+	s.AddTicker(device)
+	c.Run(100)
+	s.Sync()
+	var fired []uint64
+	s.After(10, func() { fired = append(fired, s.Cycle()) })
+
+	c.Cycles = 40 // restored from a save state
+	c.Run(10)
+	s.Sync()
+	assert.Equal(t, c.Cycles, s.Cycle())
+	assert.Equal(t, []uint64{50}, fired, "the event kept its distance")
+	assert.Equal(t, 100+c.Cycles-40, device.ticks, "devices are ticked for the cycles run after the rewind")
+}
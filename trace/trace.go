@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/disassembler"
+)
+
+type Format int
+
+const (
+	// FormatText is meant to be read by humans, flags are spelled out as letters
+	//        7  0400  A9 10     LDA #$10          A:00 X:00 Y:00 S:FF P:nv-bdIzc
+	FormatText Format = iota
+	// FormatNestest follows the nestest.log layout (without the PPU column), the same one Mesen and
+	// most NES emulators can produce, so traces can be diffed line by line
+	// 0400  A9 10     LDA #$10                        A:00 X:00 Y:00 P:24 SP:FF CYC:7
+	FormatNestest
+)
+
+// resetCycles is what the reset sequence takes, nestest.log counts them so its first line is at CYC:7
+const resetCycles = 7
+
+// Tracer logs every executed instruction to the writer.
+// Attach it with cpu.AddTracer, e.g.
+//
+//	c.AddTracer(trace.New(os.Stdout, trace.FormatNestest))
+type Tracer struct {
+	writer io.Writer
+	format Format
+
+	// Only instructions with From <= PC <= To are logged, the default covers the whole address space
+	From uint16
+	To   uint16
+
+	// Skip the first Skip instructions and log at most Limit after that, 0 means no limit.
+	// Instructions outside of the address range count towards the window as well.
+	Skip  uint64
+	Limit uint64
+
+	executed uint64
+	logged   uint64
+	err      error
+}
+
+func New(writer io.Writer, format Format) *Tracer {
+	return &Tracer{writer: writer, format: format, From: 0x0000, To: 0xFFFF}
+}
+
+// Trace implements cpu.Tracer
+func (t *Tracer) Trace(c *cpu.Cpu) {
+	index := t.executed
+	t.executed++
+	if t.err != nil || index < t.Skip || c.PC < t.From || c.PC > t.To {
+		return
+	}
+	if t.Limit > 0 && t.logged >= t.Limit {
+		return
+	}
+	t.logged++
+	_, t.err = io.WriteString(t.writer, Line(c, t.format)+"\n")
+}
+
+// Err returns the first error encountered while writing, tracing stops after it
+func (t *Tracer) Err() error {
+	return t.err
+}
+
+// Line formats the instruction the cpu is about to execute along with its current state
+func Line(c *cpu.Cpu, format Format) string {
+	instruction := disassembler.Disassemble(c.MemoryMapper(), c.PC)
+	switch format {
+	case FormatNestest:
+		return fmt.Sprintf("%04X  %-8s  %-32sA:%02X X:%02X Y:%02X P:%02X SP:%02X CYC:%d",
+			c.PC, instruction.HexBytes(), instruction.String(), c.A, c.X, c.Y, c.Status(), c.S, c.Cycles+resetCycles)
+	default:
+		return fmt.Sprintf("%10d  %04X  %-8s  %-16s  A:%02X X:%02X Y:%02X S:%02X P:%s",
+			c.Cycles, c.PC, instruction.HexBytes(), instruction.String(), c.A, c.X, c.Y, c.S, Flags(c.Status()))
+	}
+}
+
+// Flags spells out the status register, upper case letters are set flags, e.g. "Nv-bdIzC"
+func Flags(status byte) string {
+	letters := []byte("NV-BDIZC")
+	lower := []byte("nv-bdizc")
+	result := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		if status&(0x80>>i) != 0 {
+			result[i] = letters[i]
+		} else {
+			result[i] = lower[i]
+		}
+	}
+	return string(result)
+}
@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/slawomirbiernacki/mos6502-emulator/cpu"
+	"github.com/slawomirbiernacki/mos6502-emulator/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCpu(program ...byte) *cpu.Cpu {
+	mem := &memory.DummyMemoryMapper{}
+	copy(mem.Mem[0x0400:], program)
+	mem.Mem[0xFFFC] = 0x00
+	mem.Mem[0xFFFD] = 0x04
+	c := cpu.NewCpu(nil, mem)
+	c.Reset()
+	return &c
+}
+
+func TestTracer_nestest(t *testing.T) {
+	c := newCpu(0xA9, 0x10, 0x8D, 0x00, 0x02) // LDA #$10, STA $0200
+	out := &bytes.Buffer{}
+	c.AddTracer(New(out, FormatNestest))
+
+	c.ExecuteOpcode()
+	c.ExecuteOpcode()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, []string{
+		"0400  A9 10     LDA #$10                        A:00 X:00 Y:00 P:24 SP:FF CYC:7",
+		"0402  8D 00 02  STA $0200                       A:10 X:00 Y:00 P:24 SP:FF CYC:9",
+	}, lines)
+}
+
+func TestTracer_filters(t *testing.T) {
+	c := newCpu(0xEA, 0xEA, 0xEA, 0xEA, 0xEA) // NOPs
+	out := &bytes.Buffer{}
+	tracer := New(out, FormatText)
+	tracer.From = 0x0401
+	tracer.Skip = 2
+	tracer.Limit = 2
+	c.AddTracer(tracer)
+
+	for i := 0; i < 5; i++ {
+		c.ExecuteOpcode()
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "0402  EA        NOP")
+	assert.Contains(t, lines[1], "0403  EA")
+}